@@ -18,12 +18,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	netops "github.com/kubeslice/netops/pkg/proto"
 	"google.golang.org/grpc"
@@ -32,8 +35,11 @@ import (
 	"github.com/kubeslice/netops/server"
 )
 
+// Interval of the bootstrap retries while the pod fails to bootstrap.
+const bootstrapRetryInterval = 30 * time.Second
+
 // startGrpcServer shall start the GRPC server to communicate to Slice Controller
-func startGrpcServer(grpcPort string) error {
+func startGrpcServer(grpcPort string, netOps *server.NetOps) error {
 	address := fmt.Sprintf(":%s", grpcPort)
 	logger.GlobalLogger.Infof("Starting GRPC Server for NETOP_POD Pod at %v", address)
 
@@ -44,7 +50,8 @@ func startGrpcServer(grpcPort string) error {
 	}
 
 	srv := grpc.NewServer()
-	netops.RegisterNetOpsServiceServer(srv, &server.NetOps{})
+	netops.RegisterNetOpsServiceServer(srv, netOps)
+	netOps.RegisterHealthServer(srv)
 	err = srv.Serve(lis)
 	if err != nil {
 		logger.GlobalLogger.Errorf("Start GRPC Server Failed with %v", err.Error())
@@ -55,6 +62,34 @@ func startGrpcServer(grpcPort string) error {
 	return nil
 }
 
+// startHealthServer serves the /healthz and /readyz probes over HTTP.
+func startHealthServer(healthPort string, netOps *server.NetOps) error {
+	address := fmt.Sprintf(":%s", healthPort)
+	logger.GlobalLogger.Infof("Starting health probes server at %v", address)
+
+	err := http.ListenAndServe(address, netOps.HealthHandler())
+	if err != nil {
+		logger.GlobalLogger.Errorf("Start health probes server Failed with %v", err.Error())
+		return err
+	}
+	return nil
+}
+
+// retryBootstrap retries the bootstrap of the pod until it succeeds. The pod
+// is reported not ready meanwhile. Only the errors of the interfaces and of
+// the root qdisc fail the bootstrap, the slices failing to restore are
+// reported in their status.
+func retryBootstrap(netOps *server.NetOps) {
+	for {
+		time.Sleep(bootstrapRetryInterval)
+		err := netOps.BootstrapNetOpPod()
+		if err == nil {
+			return
+		}
+		logger.GlobalLogger.Errorf("Failed to bootstrap kubeslice-netops pod: %v, retrying in %v", err, bootstrapRetryInterval)
+	}
+}
+
 // shutdownHandler triggers application shutdown.
 func shutdownHandler(wg *sync.WaitGroup) {
 	// signChan channel is used to transmit signal notifications.
@@ -71,14 +106,29 @@ func shutdownHandler(wg *sync.WaitGroup) {
 	os.Exit(1)
 }
 
+// reconcileHandler runs the reconciler on demand when SIGHUP is received.
+func reconcileHandler(netOps *server.NetOps) {
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	for range hupChan {
+		logger.GlobalLogger.Infof("Reconciling tc config on SIGHUP")
+		netOps.TriggerReconcile()
+	}
+}
+
 func main() {
-	var grpcPort, logLevel, metricCollectorPort string
+	var grpcPort, healthPort, logLevel, metricCollectorPort string
 
 	grpcPort = os.Getenv("GRPC_PORT")
 	if grpcPort == "" {
 		grpcPort = "5000"
 	}
 
+	healthPort = os.Getenv("HEALTH_PORT")
+	if healthPort == "" {
+		healthPort = "8080"
+	}
+
 	metricCollectorPort = os.Getenv("METRIC_COLLECTOR_PORT")
 	if metricCollectorPort == "" {
 		metricCollectorPort = "18080"
@@ -92,19 +142,45 @@ func main() {
 	// Create a Logger Module
 	logger.GlobalLogger = logger.NewLogger(logLevel)
 
-	err := server.BootstrapNetOpPod()
+	netOps := server.NewNetOps(server.NewTcBackend(os.Getenv("TC_BACKEND")))
+	err := netOps.BootstrapNetOpPod()
 	if err != nil {
-		logger.GlobalLogger.Errorf("Failed to bootstrap kubeslice-netops pod")
+		logger.GlobalLogger.Errorf("Failed to bootstrap kubeslice-netops pod: %v, retrying in %v", err, bootstrapRetryInterval)
+		go retryBootstrap(netOps)
 	}
 
 	// Start the GRPC Server to communicate with slice controller.
 	go func() {
-		err := startGrpcServer(grpcPort)
+		err := startGrpcServer(grpcPort, netOps)
 		if err != nil {
 			logger.GlobalLogger.Errorf("Failed to bootstrap startGrpcServer")
 		}
 	}()
 
+	// Repair the drift of the tc config from the slices.
+	go func() {
+		err := netOps.RunReconciler(context.Background())
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to start tc reconciler: %v", err)
+		}
+	}()
+	go reconcileHandler(netOps)
+
+	// Serve the probes, the pod is ready once it is bootstrapped and while
+	// the tc backend answers.
+	go func() {
+		err := startHealthServer(healthPort, netOps)
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to start health probes server")
+		}
+	}()
+	go func() {
+		err := netOps.RunHealthChecker(context.Background())
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to start health checker: %v", err)
+		}
+	}()
+
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	go shutdownHandler(wg)
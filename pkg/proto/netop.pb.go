@@ -123,6 +123,32 @@ func (SliceGwHostType) EnumDescriptor() ([]byte, []int) {
 	return fileDescriptor_de0dbd33d19c0b5c, []int{3}
 }
 
+// slice gateway transport protocol
+type SliceGwProtocol int32
+
+const (
+	SliceGwProtocol_SLICE_GW_UDP SliceGwProtocol = 0
+	SliceGwProtocol_SLICE_GW_TCP SliceGwProtocol = 1
+)
+
+var SliceGwProtocol_name = map[int32]string{
+	0: "SLICE_GW_UDP",
+	1: "SLICE_GW_TCP",
+}
+
+var SliceGwProtocol_value = map[string]int32{
+	"SLICE_GW_UDP": 0,
+	"SLICE_GW_TCP": 1,
+}
+
+func (x SliceGwProtocol) String() string {
+	return proto.EnumName(SliceGwProtocol_name, int32(x))
+}
+
+func (SliceGwProtocol) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{4}
+}
+
 // Response represents the netops response format.
 type Response struct {
 	StatusMsg            string   `protobuf:"bytes,1,opt,name=statusMsg,proto3" json:"statusMsg,omitempty"`
@@ -175,9 +201,10 @@ type SliceQosProfile struct {
 	TcType TcType `protobuf:"varint,4,opt,name=tcType,proto3,enum=netops.TcType" json:"tcType,omitempty"`
 	// ClassType - HTB   ( HTB)
 	ClassType ClassType `protobuf:"varint,5,opt,name=ClassType,proto3,enum=netops.ClassType" json:"ClassType,omitempty"`
-	// Bandwidth Ceiling in Mbps  - 5 Mbps (100k - 100 Mbps)
+	// Bandwidth Ceiling in kbps  - 5000 kbps (100 - 100000 kbps)
 	BwCeiling uint32 `protobuf:"varint,6,opt,name=bwCeiling,proto3" json:"bwCeiling,omitempty"`
-	// Bandwidth Guaranteed -  1 Mbps ( 100k- 100 Mbps)
+	// Bandwidth Guaranteed in kbps -  1000 kbps (100 - 100000 kbps), at most
+	// the ceiling. Not used by TBF.
 	BwGuaranteed uint32 `protobuf:"varint,7,opt,name=bwGuaranteed,proto3" json:"bwGuaranteed,omitempty"`
 	// Priority - 2 (Number 0-3)
 	Priority uint32 `protobuf:"varint,8,opt,name=priority,proto3" json:"priority,omitempty"`
@@ -354,9 +381,11 @@ type NetOpConnectionContext struct {
 	RemoteSliceGwNodeIP string `protobuf:"bytes,12,opt,name=remoteSliceGwNodeIP,proto3" json:"remoteSliceGwNodeIP,omitempty"`
 	// Remote slice gateway Node Port
 	RemoteSliceGwNodePorts []string `protobuf:"bytes,13,rep,name=remoteSliceGwNodePorts,proto3" json:"remoteSliceGwNodePorts,omitempty"`
-	XXX_NoUnkeyedLiteral   struct{} `json:"-"`
-	XXX_unrecognized       []byte   `json:"-"`
-	XXX_sizecache          int32    `json:"-"`
+	// Slice gateway transport protocol - udp/tcp
+	SliceGwProtocol      SliceGwProtocol `protobuf:"varint,14,opt,name=sliceGwProtocol,proto3,enum=netops.SliceGwProtocol" json:"sliceGwProtocol,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
 }
 
 func (m *NetOpConnectionContext) Reset()         { *m = NetOpConnectionContext{} }
@@ -475,15 +504,1408 @@ func (m *NetOpConnectionContext) GetRemoteSliceGwNodePorts() []string {
 	return nil
 }
 
+func (m *NetOpConnectionContext) GetSliceGwProtocol() SliceGwProtocol {
+	if m != nil {
+		return m.SliceGwProtocol
+	}
+	return SliceGwProtocol_SLICE_GW_UDP
+}
+
+// Slice to report the QoS status of, by ID or by name
+type SliceQosStatusRequest struct {
+	// Slice-Id, takes precedence over the name
+	SliceId string `protobuf:"bytes,1,opt,name=sliceId,proto3" json:"sliceId,omitempty"`
+	// Name of the slice
+	SliceName            string   `protobuf:"bytes,2,opt,name=sliceName,proto3" json:"sliceName,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SliceQosStatusRequest) Reset()         { *m = SliceQosStatusRequest{} }
+func (m *SliceQosStatusRequest) String() string { return proto.CompactTextString(m) }
+func (*SliceQosStatusRequest) ProtoMessage()    {}
+func (*SliceQosStatusRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{4}
+}
+
+func (m *SliceQosStatusRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SliceQosStatusRequest.Unmarshal(m, b)
+}
+func (m *SliceQosStatusRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SliceQosStatusRequest.Marshal(b, m, deterministic)
+}
+func (m *SliceQosStatusRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SliceQosStatusRequest.Merge(m, src)
+}
+func (m *SliceQosStatusRequest) XXX_Size() int {
+	return xxx_messageInfo_SliceQosStatusRequest.Size(m)
+}
+func (m *SliceQosStatusRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SliceQosStatusRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SliceQosStatusRequest proto.InternalMessageInfo
+
+func (m *SliceQosStatusRequest) GetSliceId() string {
+	if m != nil {
+		return m.SliceId
+	}
+	return ""
+}
+
+func (m *SliceQosStatusRequest) GetSliceName() string {
+	if m != nil {
+		return m.SliceName
+	}
+	return ""
+}
+
+// Tc objects of a slice found on an interface. The IFB device shaping the
+// ingress traffic is reported as an interface too.
+type SliceInterfaceQosStatus struct {
+	// Name of the interface
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Set when the tc tree of the slices is built on the interface
+	TcInited bool `protobuf:"varint,2,opt,name=tcInited,proto3" json:"tcInited,omitempty"`
+	// Error of the last attempt to build the tc tree on the interface
+	Error string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	// Classes and leaf qdisc of the slice found on the interface, the way tc
+	// prints them
+	TcObjects []string `protobuf:"bytes,4,rep,name=tcObjects,proto3" json:"tcObjects,omitempty"`
+	// Set when the classes and leaf qdisc found match the applied profile
+	InSync               bool     `protobuf:"varint,5,opt,name=inSync,proto3" json:"inSync,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SliceInterfaceQosStatus) Reset()         { *m = SliceInterfaceQosStatus{} }
+func (m *SliceInterfaceQosStatus) String() string { return proto.CompactTextString(m) }
+func (*SliceInterfaceQosStatus) ProtoMessage()    {}
+func (*SliceInterfaceQosStatus) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{5}
+}
+
+func (m *SliceInterfaceQosStatus) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SliceInterfaceQosStatus.Unmarshal(m, b)
+}
+func (m *SliceInterfaceQosStatus) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SliceInterfaceQosStatus.Marshal(b, m, deterministic)
+}
+func (m *SliceInterfaceQosStatus) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SliceInterfaceQosStatus.Merge(m, src)
+}
+func (m *SliceInterfaceQosStatus) XXX_Size() int {
+	return xxx_messageInfo_SliceInterfaceQosStatus.Size(m)
+}
+func (m *SliceInterfaceQosStatus) XXX_DiscardUnknown() {
+	xxx_messageInfo_SliceInterfaceQosStatus.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SliceInterfaceQosStatus proto.InternalMessageInfo
+
+func (m *SliceInterfaceQosStatus) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *SliceInterfaceQosStatus) GetTcInited() bool {
+	if m != nil {
+		return m.TcInited
+	}
+	return false
+}
+
+func (m *SliceInterfaceQosStatus) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *SliceInterfaceQosStatus) GetTcObjects() []string {
+	if m != nil {
+		return m.TcObjects
+	}
+	return nil
+}
+
+func (m *SliceInterfaceQosStatus) GetInSync() bool {
+	if m != nil {
+		return m.InSync
+	}
+	return false
+}
+
+// Filter of a slice gateway port on an interface
+type SliceGwFilterStatus struct {
+	// Local slice gateway Node Port
+	Port string `protobuf:"bytes,1,opt,name=port,proto3" json:"port,omitempty"`
+	// Name of the interface
+	Interface string `protobuf:"bytes,2,opt,name=interface,proto3" json:"interface,omitempty"`
+	// Address family - ipv4/ipv6
+	Family string `protobuf:"bytes,3,opt,name=family,proto3" json:"family,omitempty"`
+	// Set when the filter is found on the interface
+	Installed bool `protobuf:"varint,4,opt,name=installed,proto3" json:"installed,omitempty"`
+	// The filter as found on the interface when installed, as desired
+	// otherwise, the way tc prints it
+	Filter               string   `protobuf:"bytes,5,opt,name=filter,proto3" json:"filter,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SliceGwFilterStatus) Reset()         { *m = SliceGwFilterStatus{} }
+func (m *SliceGwFilterStatus) String() string { return proto.CompactTextString(m) }
+func (*SliceGwFilterStatus) ProtoMessage()    {}
+func (*SliceGwFilterStatus) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{6}
+}
+
+func (m *SliceGwFilterStatus) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SliceGwFilterStatus.Unmarshal(m, b)
+}
+func (m *SliceGwFilterStatus) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SliceGwFilterStatus.Marshal(b, m, deterministic)
+}
+func (m *SliceGwFilterStatus) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SliceGwFilterStatus.Merge(m, src)
+}
+func (m *SliceGwFilterStatus) XXX_Size() int {
+	return xxx_messageInfo_SliceGwFilterStatus.Size(m)
+}
+func (m *SliceGwFilterStatus) XXX_DiscardUnknown() {
+	xxx_messageInfo_SliceGwFilterStatus.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SliceGwFilterStatus proto.InternalMessageInfo
+
+func (m *SliceGwFilterStatus) GetPort() string {
+	if m != nil {
+		return m.Port
+	}
+	return ""
+}
+
+func (m *SliceGwFilterStatus) GetInterface() string {
+	if m != nil {
+		return m.Interface
+	}
+	return ""
+}
+
+func (m *SliceGwFilterStatus) GetFamily() string {
+	if m != nil {
+		return m.Family
+	}
+	return ""
+}
+
+func (m *SliceGwFilterStatus) GetInstalled() bool {
+	if m != nil {
+		return m.Installed
+	}
+	return false
+}
+
+func (m *SliceGwFilterStatus) GetFilter() string {
+	if m != nil {
+		return m.Filter
+	}
+	return ""
+}
+
+// QoS status of a slice gateway
+type SliceGwQosStatus struct {
+	// Local slice gateway ID
+	SliceGwId string `protobuf:"bytes,1,opt,name=sliceGwId,proto3" json:"sliceGwId,omitempty"`
+	// Address families the filters of the gateway ports are configured for
+	TcConfigured []string `protobuf:"bytes,2,rep,name=tcConfigured,proto3" json:"tcConfigured,omitempty"`
+	// Filters of the gateway ports
+	Filters              []*SliceGwFilterStatus `protobuf:"bytes,3,rep,name=filters,proto3" json:"filters,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}               `json:"-"`
+	XXX_unrecognized     []byte                 `json:"-"`
+	XXX_sizecache        int32                  `json:"-"`
+}
+
+func (m *SliceGwQosStatus) Reset()         { *m = SliceGwQosStatus{} }
+func (m *SliceGwQosStatus) String() string { return proto.CompactTextString(m) }
+func (*SliceGwQosStatus) ProtoMessage()    {}
+func (*SliceGwQosStatus) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{7}
+}
+
+func (m *SliceGwQosStatus) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SliceGwQosStatus.Unmarshal(m, b)
+}
+func (m *SliceGwQosStatus) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SliceGwQosStatus.Marshal(b, m, deterministic)
+}
+func (m *SliceGwQosStatus) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SliceGwQosStatus.Merge(m, src)
+}
+func (m *SliceGwQosStatus) XXX_Size() int {
+	return xxx_messageInfo_SliceGwQosStatus.Size(m)
+}
+func (m *SliceGwQosStatus) XXX_DiscardUnknown() {
+	xxx_messageInfo_SliceGwQosStatus.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SliceGwQosStatus proto.InternalMessageInfo
+
+func (m *SliceGwQosStatus) GetSliceGwId() string {
+	if m != nil {
+		return m.SliceGwId
+	}
+	return ""
+}
+
+func (m *SliceGwQosStatus) GetTcConfigured() []string {
+	if m != nil {
+		return m.TcConfigured
+	}
+	return nil
+}
+
+func (m *SliceGwQosStatus) GetFilters() []*SliceGwFilterStatus {
+	if m != nil {
+		return m.Filters
+	}
+	return nil
+}
+
+// QoS status of a slice, read from the tc config of the node
+type SliceQosStatus struct {
+	// Slice-Id
+	SliceId string `protobuf:"bytes,1,opt,name=sliceId,proto3" json:"sliceId,omitempty"`
+	// Name of the slice
+	SliceName string `protobuf:"bytes,2,opt,name=sliceName,proto3" json:"sliceName,omitempty"`
+	// QoS profile applied to the slice
+	QosProfile *SliceQosProfile `protobuf:"bytes,3,opt,name=qosProfile,proto3" json:"qosProfile,omitempty"`
+	// Parent class of the slice, e.g. 17:11
+	ParentClassId string `protobuf:"bytes,4,opt,name=parentClassId,proto3" json:"parentClassId,omitempty"`
+	// Leaf class of the slice, e.g. 17:12
+	LeafClassId string `protobuf:"bytes,5,opt,name=leafClassId,proto3" json:"leafClassId,omitempty"`
+	// Set when the classes of the slice are configured
+	TcInited bool `protobuf:"varint,6,opt,name=tcInited,proto3" json:"tcInited,omitempty"`
+	// Tc objects of the slice on each interface
+	Interfaces []*SliceInterfaceQosStatus `protobuf:"bytes,7,rep,name=interfaces,proto3" json:"interfaces,omitempty"`
+	// Slice gateways of the slice
+	SliceGws []*SliceGwQosStatus `protobuf:"bytes,8,rep,name=sliceGws,proto3" json:"sliceGws,omitempty"`
+	// Error of the last attempt to apply the QoS profile, empty when it was
+	// applied
+	LastApplyError string `protobuf:"bytes,9,opt,name=lastApplyError,proto3" json:"lastApplyError,omitempty"`
+	// Drifts of the tc config of the slice lately found and repaired by the
+	// reconciler
+	Drifts               []string `protobuf:"bytes,10,rep,name=drifts,proto3" json:"drifts,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SliceQosStatus) Reset()         { *m = SliceQosStatus{} }
+func (m *SliceQosStatus) String() string { return proto.CompactTextString(m) }
+func (*SliceQosStatus) ProtoMessage()    {}
+func (*SliceQosStatus) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{8}
+}
+
+func (m *SliceQosStatus) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SliceQosStatus.Unmarshal(m, b)
+}
+func (m *SliceQosStatus) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SliceQosStatus.Marshal(b, m, deterministic)
+}
+func (m *SliceQosStatus) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SliceQosStatus.Merge(m, src)
+}
+func (m *SliceQosStatus) XXX_Size() int {
+	return xxx_messageInfo_SliceQosStatus.Size(m)
+}
+func (m *SliceQosStatus) XXX_DiscardUnknown() {
+	xxx_messageInfo_SliceQosStatus.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SliceQosStatus proto.InternalMessageInfo
+
+func (m *SliceQosStatus) GetSliceId() string {
+	if m != nil {
+		return m.SliceId
+	}
+	return ""
+}
+
+func (m *SliceQosStatus) GetSliceName() string {
+	if m != nil {
+		return m.SliceName
+	}
+	return ""
+}
+
+func (m *SliceQosStatus) GetQosProfile() *SliceQosProfile {
+	if m != nil {
+		return m.QosProfile
+	}
+	return nil
+}
+
+func (m *SliceQosStatus) GetParentClassId() string {
+	if m != nil {
+		return m.ParentClassId
+	}
+	return ""
+}
+
+func (m *SliceQosStatus) GetLeafClassId() string {
+	if m != nil {
+		return m.LeafClassId
+	}
+	return ""
+}
+
+func (m *SliceQosStatus) GetTcInited() bool {
+	if m != nil {
+		return m.TcInited
+	}
+	return false
+}
+
+func (m *SliceQosStatus) GetInterfaces() []*SliceInterfaceQosStatus {
+	if m != nil {
+		return m.Interfaces
+	}
+	return nil
+}
+
+func (m *SliceQosStatus) GetSliceGws() []*SliceGwQosStatus {
+	if m != nil {
+		return m.SliceGws
+	}
+	return nil
+}
+
+func (m *SliceQosStatus) GetLastApplyError() string {
+	if m != nil {
+		return m.LastApplyError
+	}
+	return ""
+}
+
+func (m *SliceQosStatus) GetDrifts() []string {
+	if m != nil {
+		return m.Drifts
+	}
+	return nil
+}
+
+// Request of a dump of the state of netops
+type DumpStateRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DumpStateRequest) Reset()         { *m = DumpStateRequest{} }
+func (m *DumpStateRequest) String() string { return proto.CompactTextString(m) }
+func (*DumpStateRequest) ProtoMessage()    {}
+func (*DumpStateRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{9}
+}
+
+func (m *DumpStateRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DumpStateRequest.Unmarshal(m, b)
+}
+func (m *DumpStateRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DumpStateRequest.Marshal(b, m, deterministic)
+}
+func (m *DumpStateRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DumpStateRequest.Merge(m, src)
+}
+func (m *DumpStateRequest) XXX_Size() int {
+	return xxx_messageInfo_DumpStateRequest.Size(m)
+}
+func (m *DumpStateRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DumpStateRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DumpStateRequest proto.InternalMessageInfo
+
+// Slice gateway known to netops
+type SliceGwState struct {
+	// Local slice gateway ID
+	SliceGwId string `protobuf:"bytes,1,opt,name=sliceGwId,proto3" json:"sliceGwId,omitempty"`
+	// Local slice gateway-host-type  -  client/server
+	GwType SliceGwHostType `protobuf:"varint,2,opt,name=gwType,proto3,enum=netops.SliceGwHostType" json:"gwType,omitempty"`
+	// Slice gateway transport protocol - udp/tcp
+	Protocol SliceGwProtocol `protobuf:"varint,3,opt,name=protocol,proto3,enum=netops.SliceGwProtocol" json:"protocol,omitempty"`
+	// Local slice gateway Node Ports
+	LocalPorts []string `protobuf:"bytes,4,rep,name=localPorts,proto3" json:"localPorts,omitempty"`
+	// Remote slice gateway Node Ports
+	RemotePorts []string `protobuf:"bytes,5,rep,name=remotePorts,proto3" json:"remotePorts,omitempty"`
+	// Remote slice gateway Node IP
+	RemoteNodeIP string `protobuf:"bytes,6,opt,name=remoteNodeIP,proto3" json:"remoteNodeIP,omitempty"`
+	// Prio of the filters of the gateway ports, 0 until they are added
+	FilterPrio           uint32   `protobuf:"varint,7,opt,name=filterPrio,proto3" json:"filterPrio,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SliceGwState) Reset()         { *m = SliceGwState{} }
+func (m *SliceGwState) String() string { return proto.CompactTextString(m) }
+func (*SliceGwState) ProtoMessage()    {}
+func (*SliceGwState) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{10}
+}
+
+func (m *SliceGwState) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SliceGwState.Unmarshal(m, b)
+}
+func (m *SliceGwState) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SliceGwState.Marshal(b, m, deterministic)
+}
+func (m *SliceGwState) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SliceGwState.Merge(m, src)
+}
+func (m *SliceGwState) XXX_Size() int {
+	return xxx_messageInfo_SliceGwState.Size(m)
+}
+func (m *SliceGwState) XXX_DiscardUnknown() {
+	xxx_messageInfo_SliceGwState.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SliceGwState proto.InternalMessageInfo
+
+func (m *SliceGwState) GetSliceGwId() string {
+	if m != nil {
+		return m.SliceGwId
+	}
+	return ""
+}
+
+func (m *SliceGwState) GetGwType() SliceGwHostType {
+	if m != nil {
+		return m.GwType
+	}
+	return SliceGwHostType_SLICE_GW_SERVER
+}
+
+func (m *SliceGwState) GetProtocol() SliceGwProtocol {
+	if m != nil {
+		return m.Protocol
+	}
+	return SliceGwProtocol_SLICE_GW_UDP
+}
+
+func (m *SliceGwState) GetLocalPorts() []string {
+	if m != nil {
+		return m.LocalPorts
+	}
+	return nil
+}
+
+func (m *SliceGwState) GetRemotePorts() []string {
+	if m != nil {
+		return m.RemotePorts
+	}
+	return nil
+}
+
+func (m *SliceGwState) GetRemoteNodeIP() string {
+	if m != nil {
+		return m.RemoteNodeIP
+	}
+	return ""
+}
+
+func (m *SliceGwState) GetFilterPrio() uint32 {
+	if m != nil {
+		return m.FilterPrio
+	}
+	return 0
+}
+
+// Slice known to netops
+type SliceState struct {
+	// Slice-Id
+	SliceId string `protobuf:"bytes,1,opt,name=sliceId,proto3" json:"sliceId,omitempty"`
+	// Name of the slice
+	SliceName string `protobuf:"bytes,2,opt,name=sliceName,proto3" json:"sliceName,omitempty"`
+	// Name of the QoS profile attached to the slice
+	QosProfileName string `protobuf:"bytes,3,opt,name=qosProfileName,proto3" json:"qosProfileName,omitempty"`
+	// QoS profile of the slice, unset until it is received
+	QosProfile *SliceQosProfile `protobuf:"bytes,4,opt,name=qosProfile,proto3" json:"qosProfile,omitempty"`
+	// Parent class of the slice, e.g. 17:11
+	ParentClassId string `protobuf:"bytes,5,opt,name=parentClassId,proto3" json:"parentClassId,omitempty"`
+	// Leaf class of the slice, e.g. 17:12
+	LeafClassId string `protobuf:"bytes,6,opt,name=leafClassId,proto3" json:"leafClassId,omitempty"`
+	// Set when the classes of the slice are configured
+	TcInited bool `protobuf:"varint,7,opt,name=tcInited,proto3" json:"tcInited,omitempty"`
+	// Slice gateways ordered by ID
+	SliceGws             []*SliceGwState `protobuf:"bytes,8,rep,name=sliceGws,proto3" json:"sliceGws,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *SliceState) Reset()         { *m = SliceState{} }
+func (m *SliceState) String() string { return proto.CompactTextString(m) }
+func (*SliceState) ProtoMessage()    {}
+func (*SliceState) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{11}
+}
+
+func (m *SliceState) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SliceState.Unmarshal(m, b)
+}
+func (m *SliceState) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SliceState.Marshal(b, m, deterministic)
+}
+func (m *SliceState) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SliceState.Merge(m, src)
+}
+func (m *SliceState) XXX_Size() int {
+	return xxx_messageInfo_SliceState.Size(m)
+}
+func (m *SliceState) XXX_DiscardUnknown() {
+	xxx_messageInfo_SliceState.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SliceState proto.InternalMessageInfo
+
+func (m *SliceState) GetSliceId() string {
+	if m != nil {
+		return m.SliceId
+	}
+	return ""
+}
+
+func (m *SliceState) GetSliceName() string {
+	if m != nil {
+		return m.SliceName
+	}
+	return ""
+}
+
+func (m *SliceState) GetQosProfileName() string {
+	if m != nil {
+		return m.QosProfileName
+	}
+	return ""
+}
+
+func (m *SliceState) GetQosProfile() *SliceQosProfile {
+	if m != nil {
+		return m.QosProfile
+	}
+	return nil
+}
+
+func (m *SliceState) GetParentClassId() string {
+	if m != nil {
+		return m.ParentClassId
+	}
+	return ""
+}
+
+func (m *SliceState) GetLeafClassId() string {
+	if m != nil {
+		return m.LeafClassId
+	}
+	return ""
+}
+
+func (m *SliceState) GetTcInited() bool {
+	if m != nil {
+		return m.TcInited
+	}
+	return false
+}
+
+func (m *SliceState) GetSliceGws() []*SliceGwState {
+	if m != nil {
+		return m.SliceGws
+	}
+	return nil
+}
+
+// Class IDs handed out to a slice: its parent class followed by its child
+// classes
+type ClassIdAllocation struct {
+	// Parent class of the slice, e.g. 17:11
+	ParentClassId string `protobuf:"bytes,1,opt,name=parentClassId,proto3" json:"parentClassId,omitempty"`
+	// Number of child classes after the parent class
+	ChildClasses uint32 `protobuf:"varint,2,opt,name=childClasses,proto3" json:"childClasses,omitempty"`
+	// Name of the slice
+	SliceName            string   `protobuf:"bytes,3,opt,name=sliceName,proto3" json:"sliceName,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ClassIdAllocation) Reset()         { *m = ClassIdAllocation{} }
+func (m *ClassIdAllocation) String() string { return proto.CompactTextString(m) }
+func (*ClassIdAllocation) ProtoMessage()    {}
+func (*ClassIdAllocation) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{12}
+}
+
+func (m *ClassIdAllocation) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ClassIdAllocation.Unmarshal(m, b)
+}
+func (m *ClassIdAllocation) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ClassIdAllocation.Marshal(b, m, deterministic)
+}
+func (m *ClassIdAllocation) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ClassIdAllocation.Merge(m, src)
+}
+func (m *ClassIdAllocation) XXX_Size() int {
+	return xxx_messageInfo_ClassIdAllocation.Size(m)
+}
+func (m *ClassIdAllocation) XXX_DiscardUnknown() {
+	xxx_messageInfo_ClassIdAllocation.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ClassIdAllocation proto.InternalMessageInfo
+
+func (m *ClassIdAllocation) GetParentClassId() string {
+	if m != nil {
+		return m.ParentClassId
+	}
+	return ""
+}
+
+func (m *ClassIdAllocation) GetChildClasses() uint32 {
+	if m != nil {
+		return m.ChildClasses
+	}
+	return 0
+}
+
+func (m *ClassIdAllocation) GetSliceName() string {
+	if m != nil {
+		return m.SliceName
+	}
+	return ""
+}
+
+// Tc config of a device, the way tc prints it
+type TcTreeDump struct {
+	// Name of the device
+	Dev     string   `protobuf:"bytes,1,opt,name=dev,proto3" json:"dev,omitempty"`
+	Qdiscs  []string `protobuf:"bytes,2,rep,name=qdiscs,proto3" json:"qdiscs,omitempty"`
+	Classes []string `protobuf:"bytes,3,rep,name=classes,proto3" json:"classes,omitempty"`
+	Filters []string `protobuf:"bytes,4,rep,name=filters,proto3" json:"filters,omitempty"`
+	// Error of the dump of the device
+	Error                string   `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TcTreeDump) Reset()         { *m = TcTreeDump{} }
+func (m *TcTreeDump) String() string { return proto.CompactTextString(m) }
+func (*TcTreeDump) ProtoMessage()    {}
+func (*TcTreeDump) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{13}
+}
+
+func (m *TcTreeDump) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TcTreeDump.Unmarshal(m, b)
+}
+func (m *TcTreeDump) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TcTreeDump.Marshal(b, m, deterministic)
+}
+func (m *TcTreeDump) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TcTreeDump.Merge(m, src)
+}
+func (m *TcTreeDump) XXX_Size() int {
+	return xxx_messageInfo_TcTreeDump.Size(m)
+}
+func (m *TcTreeDump) XXX_DiscardUnknown() {
+	xxx_messageInfo_TcTreeDump.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TcTreeDump proto.InternalMessageInfo
+
+func (m *TcTreeDump) GetDev() string {
+	if m != nil {
+		return m.Dev
+	}
+	return ""
+}
+
+func (m *TcTreeDump) GetQdiscs() []string {
+	if m != nil {
+		return m.Qdiscs
+	}
+	return nil
+}
+
+func (m *TcTreeDump) GetClasses() []string {
+	if m != nil {
+		return m.Classes
+	}
+	return nil
+}
+
+func (m *TcTreeDump) GetFilters() []string {
+	if m != nil {
+		return m.Filters
+	}
+	return nil
+}
+
+func (m *TcTreeDump) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+// State of netops along with the tc config of the devices it shapes the
+// slice traffic on
+type StateDump struct {
+	// Root qdisc of netops, e.g. 17:
+	RootHandle string `protobuf:"bytes,1,opt,name=rootHandle,proto3" json:"rootHandle,omitempty"`
+	// Slices ordered by parent class
+	Slices []*SliceState `protobuf:"bytes,2,rep,name=slices,proto3" json:"slices,omitempty"`
+	// Class ID allocation table ordered by parent class
+	ClassIds []*ClassIdAllocation `protobuf:"bytes,3,rep,name=classIds,proto3" json:"classIds,omitempty"`
+	// Tc config of the interfaces, then of the IFB device
+	TcTrees              []*TcTreeDump `protobuf:"bytes,4,rep,name=tcTrees,proto3" json:"tcTrees,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *StateDump) Reset()         { *m = StateDump{} }
+func (m *StateDump) String() string { return proto.CompactTextString(m) }
+func (*StateDump) ProtoMessage()    {}
+func (*StateDump) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{14}
+}
+
+func (m *StateDump) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StateDump.Unmarshal(m, b)
+}
+func (m *StateDump) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StateDump.Marshal(b, m, deterministic)
+}
+func (m *StateDump) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StateDump.Merge(m, src)
+}
+func (m *StateDump) XXX_Size() int {
+	return xxx_messageInfo_StateDump.Size(m)
+}
+func (m *StateDump) XXX_DiscardUnknown() {
+	xxx_messageInfo_StateDump.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StateDump proto.InternalMessageInfo
+
+func (m *StateDump) GetRootHandle() string {
+	if m != nil {
+		return m.RootHandle
+	}
+	return ""
+}
+
+func (m *StateDump) GetSlices() []*SliceState {
+	if m != nil {
+		return m.Slices
+	}
+	return nil
+}
+
+func (m *StateDump) GetClassIds() []*ClassIdAllocation {
+	if m != nil {
+		return m.ClassIds
+	}
+	return nil
+}
+
+func (m *StateDump) GetTcTrees() []*TcTreeDump {
+	if m != nil {
+		return m.TcTrees
+	}
+	return nil
+}
+
+// Request to watch the traffic statistics of the slices
+type WatchSliceStatsRequest struct {
+	// Interval between two samples in ms, 1s when unset
+	IntervalMs uint32 `protobuf:"varint,1,opt,name=intervalMs,proto3" json:"intervalMs,omitempty"`
+	// Slices to watch by ID. All the slices are watched when no slice is
+	// given by ID or name.
+	SliceIds []string `protobuf:"bytes,2,rep,name=sliceIds,proto3" json:"sliceIds,omitempty"`
+	// Slices to watch by name
+	SliceNames           []string `protobuf:"bytes,3,rep,name=sliceNames,proto3" json:"sliceNames,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WatchSliceStatsRequest) Reset()         { *m = WatchSliceStatsRequest{} }
+func (m *WatchSliceStatsRequest) String() string { return proto.CompactTextString(m) }
+func (*WatchSliceStatsRequest) ProtoMessage()    {}
+func (*WatchSliceStatsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{15}
+}
+
+func (m *WatchSliceStatsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WatchSliceStatsRequest.Unmarshal(m, b)
+}
+func (m *WatchSliceStatsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WatchSliceStatsRequest.Marshal(b, m, deterministic)
+}
+func (m *WatchSliceStatsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WatchSliceStatsRequest.Merge(m, src)
+}
+func (m *WatchSliceStatsRequest) XXX_Size() int {
+	return xxx_messageInfo_WatchSliceStatsRequest.Size(m)
+}
+func (m *WatchSliceStatsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_WatchSliceStatsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WatchSliceStatsRequest proto.InternalMessageInfo
+
+func (m *WatchSliceStatsRequest) GetIntervalMs() uint32 {
+	if m != nil {
+		return m.IntervalMs
+	}
+	return 0
+}
+
+func (m *WatchSliceStatsRequest) GetSliceIds() []string {
+	if m != nil {
+		return m.SliceIds
+	}
+	return nil
+}
+
+func (m *WatchSliceStatsRequest) GetSliceNames() []string {
+	if m != nil {
+		return m.SliceNames
+	}
+	return nil
+}
+
+// Counters of a tc class or qdisc
+type TcStats struct {
+	// Handle of the class or qdisc, e.g. 17:12
+	Handle  string `protobuf:"bytes,1,opt,name=handle,proto3" json:"handle,omitempty"`
+	Bytes   uint64 `protobuf:"varint,2,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Packets uint64 `protobuf:"varint,3,opt,name=packets,proto3" json:"packets,omitempty"`
+	// Packets dropped
+	Drops uint32 `protobuf:"varint,4,opt,name=drops,proto3" json:"drops,omitempty"`
+	// Packets delayed for exceeding the rate
+	Overlimits uint32 `protobuf:"varint,5,opt,name=overlimits,proto3" json:"overlimits,omitempty"`
+	// Bytes queued
+	Backlog uint32 `protobuf:"varint,6,opt,name=backlog,proto3" json:"backlog,omitempty"`
+	// Rate in kbps since the previous sample, 0 in the first sample
+	Rate                 uint64   `protobuf:"varint,7,opt,name=rate,proto3" json:"rate,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TcStats) Reset()         { *m = TcStats{} }
+func (m *TcStats) String() string { return proto.CompactTextString(m) }
+func (*TcStats) ProtoMessage()    {}
+func (*TcStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{16}
+}
+
+func (m *TcStats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TcStats.Unmarshal(m, b)
+}
+func (m *TcStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TcStats.Marshal(b, m, deterministic)
+}
+func (m *TcStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TcStats.Merge(m, src)
+}
+func (m *TcStats) XXX_Size() int {
+	return xxx_messageInfo_TcStats.Size(m)
+}
+func (m *TcStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_TcStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TcStats proto.InternalMessageInfo
+
+func (m *TcStats) GetHandle() string {
+	if m != nil {
+		return m.Handle
+	}
+	return ""
+}
+
+func (m *TcStats) GetBytes() uint64 {
+	if m != nil {
+		return m.Bytes
+	}
+	return 0
+}
+
+func (m *TcStats) GetPackets() uint64 {
+	if m != nil {
+		return m.Packets
+	}
+	return 0
+}
+
+func (m *TcStats) GetDrops() uint32 {
+	if m != nil {
+		return m.Drops
+	}
+	return 0
+}
+
+func (m *TcStats) GetOverlimits() uint32 {
+	if m != nil {
+		return m.Overlimits
+	}
+	return 0
+}
+
+func (m *TcStats) GetBacklog() uint32 {
+	if m != nil {
+		return m.Backlog
+	}
+	return 0
+}
+
+func (m *TcStats) GetRate() uint64 {
+	if m != nil {
+		return m.Rate
+	}
+	return 0
+}
+
+// Traffic statistics of a slice on a device
+type SliceInterfaceStats struct {
+	// Name of the device
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Htb classes of the slice, unset when they are missing
+	ParentClass *TcStats `protobuf:"bytes,2,opt,name=parentClass,proto3" json:"parentClass,omitempty"`
+	LeafClass   *TcStats `protobuf:"bytes,3,opt,name=leafClass,proto3" json:"leafClass,omitempty"`
+	// Qdisc of the leaf class, sfq or tbf
+	LeafQdisc *TcStats `protobuf:"bytes,4,opt,name=leafQdisc,proto3" json:"leafQdisc,omitempty"`
+	// Error of the dump of the device
+	Error                string   `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SliceInterfaceStats) Reset()         { *m = SliceInterfaceStats{} }
+func (m *SliceInterfaceStats) String() string { return proto.CompactTextString(m) }
+func (*SliceInterfaceStats) ProtoMessage()    {}
+func (*SliceInterfaceStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{17}
+}
+
+func (m *SliceInterfaceStats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SliceInterfaceStats.Unmarshal(m, b)
+}
+func (m *SliceInterfaceStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SliceInterfaceStats.Marshal(b, m, deterministic)
+}
+func (m *SliceInterfaceStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SliceInterfaceStats.Merge(m, src)
+}
+func (m *SliceInterfaceStats) XXX_Size() int {
+	return xxx_messageInfo_SliceInterfaceStats.Size(m)
+}
+func (m *SliceInterfaceStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_SliceInterfaceStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SliceInterfaceStats proto.InternalMessageInfo
+
+func (m *SliceInterfaceStats) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *SliceInterfaceStats) GetParentClass() *TcStats {
+	if m != nil {
+		return m.ParentClass
+	}
+	return nil
+}
+
+func (m *SliceInterfaceStats) GetLeafClass() *TcStats {
+	if m != nil {
+		return m.LeafClass
+	}
+	return nil
+}
+
+func (m *SliceInterfaceStats) GetLeafQdisc() *TcStats {
+	if m != nil {
+		return m.LeafQdisc
+	}
+	return nil
+}
+
+func (m *SliceInterfaceStats) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+// Traffic statistics of a slice
+type SliceStats struct {
+	// Slice-Id
+	SliceId string `protobuf:"bytes,1,opt,name=sliceId,proto3" json:"sliceId,omitempty"`
+	// Name of the slice
+	SliceName string `protobuf:"bytes,2,opt,name=sliceName,proto3" json:"sliceName,omitempty"`
+	// Bandwidth ceiling of the slice in kbps
+	BwCeiling uint32 `protobuf:"varint,3,opt,name=bwCeiling,proto3" json:"bwCeiling,omitempty"`
+	// Devices of the slice classes, the interfaces then the IFB device
+	Interfaces           []*SliceInterfaceStats `protobuf:"bytes,4,rep,name=interfaces,proto3" json:"interfaces,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}               `json:"-"`
+	XXX_unrecognized     []byte                 `json:"-"`
+	XXX_sizecache        int32                  `json:"-"`
+}
+
+func (m *SliceStats) Reset()         { *m = SliceStats{} }
+func (m *SliceStats) String() string { return proto.CompactTextString(m) }
+func (*SliceStats) ProtoMessage()    {}
+func (*SliceStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{18}
+}
+
+func (m *SliceStats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SliceStats.Unmarshal(m, b)
+}
+func (m *SliceStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SliceStats.Marshal(b, m, deterministic)
+}
+func (m *SliceStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SliceStats.Merge(m, src)
+}
+func (m *SliceStats) XXX_Size() int {
+	return xxx_messageInfo_SliceStats.Size(m)
+}
+func (m *SliceStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_SliceStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SliceStats proto.InternalMessageInfo
+
+func (m *SliceStats) GetSliceId() string {
+	if m != nil {
+		return m.SliceId
+	}
+	return ""
+}
+
+func (m *SliceStats) GetSliceName() string {
+	if m != nil {
+		return m.SliceName
+	}
+	return ""
+}
+
+func (m *SliceStats) GetBwCeiling() uint32 {
+	if m != nil {
+		return m.BwCeiling
+	}
+	return 0
+}
+
+func (m *SliceStats) GetInterfaces() []*SliceInterfaceStats {
+	if m != nil {
+		return m.Interfaces
+	}
+	return nil
+}
+
+// Sample of the traffic statistics of the watched slices
+type SliceStatsSample struct {
+	// Time of the sample in ms since the epoch
+	Timestamp int64 `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// Slices with tc configured, ordered by parent class
+	Slices               []*SliceStats `protobuf:"bytes,2,rep,name=slices,proto3" json:"slices,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *SliceStatsSample) Reset()         { *m = SliceStatsSample{} }
+func (m *SliceStatsSample) String() string { return proto.CompactTextString(m) }
+func (*SliceStatsSample) ProtoMessage()    {}
+func (*SliceStatsSample) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{19}
+}
+
+func (m *SliceStatsSample) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SliceStatsSample.Unmarshal(m, b)
+}
+func (m *SliceStatsSample) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SliceStatsSample.Marshal(b, m, deterministic)
+}
+func (m *SliceStatsSample) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SliceStatsSample.Merge(m, src)
+}
+func (m *SliceStatsSample) XXX_Size() int {
+	return xxx_messageInfo_SliceStatsSample.Size(m)
+}
+func (m *SliceStatsSample) XXX_DiscardUnknown() {
+	xxx_messageInfo_SliceStatsSample.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SliceStatsSample proto.InternalMessageInfo
+
+func (m *SliceStatsSample) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func (m *SliceStatsSample) GetSlices() []*SliceStats {
+	if m != nil {
+		return m.Slices
+	}
+	return nil
+}
+
+// Desired state of a slice on the node
+type DesiredSlice struct {
+	// QoS profile of the slice, the slice is identified by its sliceId
+	QosProfile *SliceQosProfile `protobuf:"bytes,1,opt,name=qosProfile,proto3" json:"qosProfile,omitempty"`
+	// Connection contexts of all the slice gateways of the slice on the node.
+	// Their sliceId may be left empty.
+	ConnectionContexts   []*NetOpConnectionContext `protobuf:"bytes,2,rep,name=connectionContexts,proto3" json:"connectionContexts,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                  `json:"-"`
+	XXX_unrecognized     []byte                    `json:"-"`
+	XXX_sizecache        int32                     `json:"-"`
+}
+
+func (m *DesiredSlice) Reset()         { *m = DesiredSlice{} }
+func (m *DesiredSlice) String() string { return proto.CompactTextString(m) }
+func (*DesiredSlice) ProtoMessage()    {}
+func (*DesiredSlice) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{20}
+}
+
+func (m *DesiredSlice) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DesiredSlice.Unmarshal(m, b)
+}
+func (m *DesiredSlice) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DesiredSlice.Marshal(b, m, deterministic)
+}
+func (m *DesiredSlice) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DesiredSlice.Merge(m, src)
+}
+func (m *DesiredSlice) XXX_Size() int {
+	return xxx_messageInfo_DesiredSlice.Size(m)
+}
+func (m *DesiredSlice) XXX_DiscardUnknown() {
+	xxx_messageInfo_DesiredSlice.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DesiredSlice proto.InternalMessageInfo
+
+func (m *DesiredSlice) GetQosProfile() *SliceQosProfile {
+	if m != nil {
+		return m.QosProfile
+	}
+	return nil
+}
+
+func (m *DesiredSlice) GetConnectionContexts() []*NetOpConnectionContext {
+	if m != nil {
+		return m.ConnectionContexts
+	}
+	return nil
+}
+
+// Complete desired state of the node
+type SyncStateRequest struct {
+	// All the slices of the node, the slices netops has that are not listed
+	// are deleted
+	Slices               []*DesiredSlice `protobuf:"bytes,1,rep,name=slices,proto3" json:"slices,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *SyncStateRequest) Reset()         { *m = SyncStateRequest{} }
+func (m *SyncStateRequest) String() string { return proto.CompactTextString(m) }
+func (*SyncStateRequest) ProtoMessage()    {}
+func (*SyncStateRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{21}
+}
+
+func (m *SyncStateRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SyncStateRequest.Unmarshal(m, b)
+}
+func (m *SyncStateRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SyncStateRequest.Marshal(b, m, deterministic)
+}
+func (m *SyncStateRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SyncStateRequest.Merge(m, src)
+}
+func (m *SyncStateRequest) XXX_Size() int {
+	return xxx_messageInfo_SyncStateRequest.Size(m)
+}
+func (m *SyncStateRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SyncStateRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SyncStateRequest proto.InternalMessageInfo
+
+func (m *SyncStateRequest) GetSlices() []*DesiredSlice {
+	if m != nil {
+		return m.Slices
+	}
+	return nil
+}
+
+// Changes made to converge to the desired state
+type SyncStateResponse struct {
+	StatusMsg string `protobuf:"bytes,1,opt,name=statusMsg,proto3" json:"statusMsg,omitempty"`
+	// Names of the slices added
+	SlicesAdded []string `protobuf:"bytes,2,rep,name=slicesAdded,proto3" json:"slicesAdded,omitempty"`
+	// Names of the slices whose QoS profile changed or failed to apply
+	// before
+	SlicesUpdated []string `protobuf:"bytes,3,rep,name=slicesUpdated,proto3" json:"slicesUpdated,omitempty"`
+	// Names of the slices deleted
+	SlicesDeleted []string `protobuf:"bytes,4,rep,name=slicesDeleted,proto3" json:"slicesDeleted,omitempty"`
+	// Slice gateways added, changed and deleted, as sliceName/sliceGwId
+	SliceGwsAdded   []string `protobuf:"bytes,5,rep,name=sliceGwsAdded,proto3" json:"sliceGwsAdded,omitempty"`
+	SliceGwsUpdated []string `protobuf:"bytes,6,rep,name=sliceGwsUpdated,proto3" json:"sliceGwsUpdated,omitempty"`
+	SliceGwsDeleted []string `protobuf:"bytes,7,rep,name=sliceGwsDeleted,proto3" json:"sliceGwsDeleted,omitempty"`
+	// Number of slices already in the desired state
+	SlicesUnchanged      uint32   `protobuf:"varint,8,opt,name=slicesUnchanged,proto3" json:"slicesUnchanged,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SyncStateResponse) Reset()         { *m = SyncStateResponse{} }
+func (m *SyncStateResponse) String() string { return proto.CompactTextString(m) }
+func (*SyncStateResponse) ProtoMessage()    {}
+func (*SyncStateResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_de0dbd33d19c0b5c, []int{22}
+}
+
+func (m *SyncStateResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SyncStateResponse.Unmarshal(m, b)
+}
+func (m *SyncStateResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SyncStateResponse.Marshal(b, m, deterministic)
+}
+func (m *SyncStateResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SyncStateResponse.Merge(m, src)
+}
+func (m *SyncStateResponse) XXX_Size() int {
+	return xxx_messageInfo_SyncStateResponse.Size(m)
+}
+func (m *SyncStateResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_SyncStateResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SyncStateResponse proto.InternalMessageInfo
+
+func (m *SyncStateResponse) GetStatusMsg() string {
+	if m != nil {
+		return m.StatusMsg
+	}
+	return ""
+}
+
+func (m *SyncStateResponse) GetSlicesAdded() []string {
+	if m != nil {
+		return m.SlicesAdded
+	}
+	return nil
+}
+
+func (m *SyncStateResponse) GetSlicesUpdated() []string {
+	if m != nil {
+		return m.SlicesUpdated
+	}
+	return nil
+}
+
+func (m *SyncStateResponse) GetSlicesDeleted() []string {
+	if m != nil {
+		return m.SlicesDeleted
+	}
+	return nil
+}
+
+func (m *SyncStateResponse) GetSliceGwsAdded() []string {
+	if m != nil {
+		return m.SliceGwsAdded
+	}
+	return nil
+}
+
+func (m *SyncStateResponse) GetSliceGwsUpdated() []string {
+	if m != nil {
+		return m.SliceGwsUpdated
+	}
+	return nil
+}
+
+func (m *SyncStateResponse) GetSliceGwsDeleted() []string {
+	if m != nil {
+		return m.SliceGwsDeleted
+	}
+	return nil
+}
+
+func (m *SyncStateResponse) GetSlicesUnchanged() uint32 {
+	if m != nil {
+		return m.SlicesUnchanged
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterEnum("netops.TcType", TcType_name, TcType_value)
 	proto.RegisterEnum("netops.ClassType", ClassType_name, ClassType_value)
 	proto.RegisterEnum("netops.EventType", EventType_name, EventType_value)
 	proto.RegisterEnum("netops.SliceGwHostType", SliceGwHostType_name, SliceGwHostType_value)
+	proto.RegisterEnum("netops.SliceGwProtocol", SliceGwProtocol_name, SliceGwProtocol_value)
 	proto.RegisterType((*Response)(nil), "netops.Response")
 	proto.RegisterType((*SliceQosProfile)(nil), "netops.SliceQosProfile")
 	proto.RegisterType((*SliceLifeCycleEvent)(nil), "netops.SliceLifeCycleEvent")
 	proto.RegisterType((*NetOpConnectionContext)(nil), "netops.NetOpConnectionContext")
+	proto.RegisterType((*SliceQosStatusRequest)(nil), "netops.SliceQosStatusRequest")
+	proto.RegisterType((*SliceInterfaceQosStatus)(nil), "netops.SliceInterfaceQosStatus")
+	proto.RegisterType((*SliceGwFilterStatus)(nil), "netops.SliceGwFilterStatus")
+	proto.RegisterType((*SliceGwQosStatus)(nil), "netops.SliceGwQosStatus")
+	proto.RegisterType((*SliceQosStatus)(nil), "netops.SliceQosStatus")
+	proto.RegisterType((*DumpStateRequest)(nil), "netops.DumpStateRequest")
+	proto.RegisterType((*SliceGwState)(nil), "netops.SliceGwState")
+	proto.RegisterType((*SliceState)(nil), "netops.SliceState")
+	proto.RegisterType((*ClassIdAllocation)(nil), "netops.ClassIdAllocation")
+	proto.RegisterType((*TcTreeDump)(nil), "netops.TcTreeDump")
+	proto.RegisterType((*StateDump)(nil), "netops.StateDump")
+	proto.RegisterType((*WatchSliceStatsRequest)(nil), "netops.WatchSliceStatsRequest")
+	proto.RegisterType((*TcStats)(nil), "netops.TcStats")
+	proto.RegisterType((*SliceInterfaceStats)(nil), "netops.SliceInterfaceStats")
+	proto.RegisterType((*SliceStats)(nil), "netops.SliceStats")
+	proto.RegisterType((*SliceStatsSample)(nil), "netops.SliceStatsSample")
+	proto.RegisterType((*DesiredSlice)(nil), "netops.DesiredSlice")
+	proto.RegisterType((*SyncStateRequest)(nil), "netops.SyncStateRequest")
+	proto.RegisterType((*SyncStateResponse)(nil), "netops.SyncStateResponse")
 }
 
 func init() {
@@ -491,48 +1913,118 @@ func init() {
 }
 
 var fileDescriptor_de0dbd33d19c0b5c = []byte{
-	// 676 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x95, 0xcf, 0x4e, 0xdb, 0x40,
-	0x10, 0xc6, 0x63, 0x28, 0x49, 0x3c, 0x10, 0x30, 0x4b, 0x03, 0x2e, 0xfd, 0x17, 0xe5, 0x40, 0xa3,
-	0xa8, 0x0a, 0x15, 0xad, 0xaa, 0x4a, 0x9c, 0x88, 0xe3, 0x42, 0xd4, 0x10, 0x52, 0xc7, 0x80, 0x54,
-	0x55, 0x8a, 0x1c, 0x67, 0x41, 0x96, 0x8c, 0xd7, 0xf5, 0x2e, 0x50, 0xde, 0xad, 0xe7, 0x3e, 0x50,
-	0x9f, 0xa0, 0xf2, 0x38, 0x76, 0xec, 0xc4, 0xb4, 0xb7, 0xcc, 0xf7, 0x9b, 0x99, 0xdd, 0xfd, 0x26,
-	0xbb, 0x86, 0x55, 0x8f, 0x0a, 0xe6, 0xb7, 0xfc, 0x80, 0x09, 0x46, 0x8a, 0x18, 0xf0, 0x7a, 0x03,
-	0xca, 0x06, 0xe5, 0x3e, 0xf3, 0x38, 0x25, 0x2f, 0x40, 0xe6, 0xc2, 0x12, 0xb7, 0xfc, 0x94, 0x5f,
-	0xab, 0x52, 0x4d, 0x6a, 0xc8, 0xc6, 0x4c, 0xa8, 0xff, 0x5e, 0x82, 0x8d, 0xa1, 0xeb, 0xd8, 0xf4,
-	0x2b, 0xe3, 0x83, 0x80, 0x5d, 0x39, 0x6e, 0x54, 0x11, 0x4a, 0x7d, 0xeb, 0x86, 0x26, 0x15, 0xb1,
-	0x40, 0x54, 0x28, 0x61, 0xd0, 0x9d, 0xa8, 0x4b, 0xc8, 0xe2, 0x90, 0xec, 0xc1, 0xfa, 0x8f, 0xa4,
-	0x0b, 0x16, 0x2f, 0x63, 0xc2, 0x9c, 0x4a, 0xf6, 0xa0, 0x28, 0x6c, 0xf3, 0xc1, 0xa7, 0xea, 0x93,
-	0x9a, 0xd4, 0x58, 0x3f, 0x58, 0x6f, 0x45, 0xdb, 0x6e, 0x99, 0xa8, 0x1a, 0x53, 0x4a, 0xf6, 0x41,
-	0xd6, 0x5c, 0x8b, 0x73, 0x4c, 0x5d, 0xc1, 0xd4, 0xcd, 0x38, 0x35, 0x01, 0xc6, 0x2c, 0x27, 0xdc,
-	0xf8, 0xf8, 0x5e, 0xa3, 0x8e, 0xeb, 0x78, 0xd7, 0x6a, 0xb1, 0x26, 0x35, 0x2a, 0xc6, 0x4c, 0x20,
-	0x75, 0x58, 0x1b, 0xdf, 0x1f, 0xdf, 0x5a, 0x81, 0xe5, 0x09, 0x4a, 0x27, 0x6a, 0x09, 0x13, 0x32,
-	0x1a, 0xd9, 0x85, 0xb2, 0x1f, 0x38, 0x2c, 0x70, 0xc4, 0x83, 0x5a, 0x46, 0x9e, 0xc4, 0x61, 0xf7,
-	0x09, 0xb7, 0x7d, 0x5c, 0x4e, 0x95, 0x23, 0x5b, 0x12, 0xa1, 0xfe, 0x1d, 0xb6, 0xd0, 0xc7, 0x9e,
-	0x73, 0x45, 0xb5, 0x07, 0xdb, 0xa5, 0xfa, 0x1d, 0xf5, 0xc4, 0x7f, 0xbc, 0x7c, 0x03, 0x2b, 0x34,
-	0x4c, 0x43, 0x27, 0x53, 0xa7, 0xc3, 0x5a, 0x3c, 0x5d, 0xc4, 0xeb, 0xbf, 0x56, 0x60, 0xbb, 0x4f,
-	0xc5, 0x99, 0xaf, 0x31, 0xcf, 0xa3, 0xb6, 0x70, 0x98, 0xa7, 0x31, 0x4f, 0xd0, 0x9f, 0x22, 0x3d,
-	0x0f, 0x69, 0x61, 0x1e, 0x2e, 0xb3, 0x2d, 0x17, 0xf7, 0x75, 0x7c, 0x9f, 0x0c, 0x6c, 0x4e, 0x25,
-	0x6f, 0x61, 0x33, 0xad, 0x5c, 0xf8, 0x5e, 0x77, 0x30, 0x1d, 0xdd, 0x22, 0x20, 0x5f, 0xe0, 0x69,
-	0x5a, 0x3c, 0x61, 0x5c, 0xa4, 0x66, 0xb9, 0x13, 0x1f, 0x61, 0x0e, 0x1b, 0xb9, 0x45, 0xe4, 0x03,
-	0x54, 0xd3, 0x7a, 0x9f, 0xdf, 0x0c, 0x6f, 0xc7, 0x1e, 0x15, 0x38, 0x6e, 0xd9, 0xc8, 0x87, 0xa4,
-	0x05, 0x24, 0x03, 0xd8, 0x84, 0x76, 0x07, 0x38, 0x70, 0xd9, 0xc8, 0x21, 0x0b, 0xab, 0xb0, 0x09,
-	0x1d, 0xb0, 0x40, 0x70, 0xb5, 0x54, 0x5b, 0x5e, 0x58, 0x25, 0x86, 0xa4, 0x01, 0x1b, 0x01, 0xbd,
-	0x61, 0x82, 0xce, 0xfc, 0x2b, 0xe3, 0x12, 0xf3, 0x72, 0xb8, 0x9f, 0x8c, 0x14, 0x39, 0x18, 0xfd,
-	0x45, 0x72, 0x08, 0x39, 0x85, 0x6a, 0x46, 0x4d, 0x3c, 0x84, 0x7f, 0x7b, 0x98, 0x5f, 0x45, 0x3e,
-	0xc2, 0x76, 0x06, 0xcc, 0x5c, 0x5c, 0xc5, 0x2d, 0x3c, 0x42, 0xc9, 0x3b, 0xd8, 0xca, 0x92, 0xc8,
-	0xc7, 0x35, 0x2c, 0xca, 0x43, 0x8b, 0x2b, 0x25, 0x4e, 0x56, 0xd0, 0xc9, 0x47, 0x68, 0xf3, 0x35,
-	0x14, 0xa3, 0xbb, 0x4d, 0xaa, 0xb0, 0xd9, 0x3e, 0xea, 0x77, 0x2e, 0xbb, 0x1d, 0xf3, 0x64, 0xa4,
-	0x9d, 0xf5, 0x4d, 0xe3, 0xac, 0xa7, 0x14, 0x9a, 0x2f, 0x53, 0x57, 0x9d, 0x94, 0x60, 0xf9, 0xc4,
-	0x6c, 0x2b, 0x85, 0xf0, 0x87, 0xd9, 0xfe, 0xac, 0x48, 0xcd, 0x4f, 0x20, 0x27, 0x57, 0x82, 0x54,
-	0x40, 0xd6, 0x2f, 0x46, 0x9a, 0xa1, 0x1f, 0x99, 0xba, 0x52, 0x98, 0x86, 0xe7, 0x83, 0x4e, 0x18,
-	0x4a, 0xd3, 0xb0, 0xa3, 0xf7, 0x74, 0x53, 0x57, 0x96, 0x9a, 0x87, 0xd3, 0xe7, 0x2d, 0x65, 0xd7,
-	0x16, 0x6c, 0x0c, 0x7b, 0x5d, 0x4d, 0x1f, 0x1d, 0x5f, 0x8e, 0x86, 0xba, 0x71, 0xa1, 0x1b, 0x4a,
-	0x21, 0x23, 0x6a, 0xbd, 0xae, 0xde, 0x37, 0x15, 0xe9, 0xe0, 0x8f, 0x04, 0x15, 0xbc, 0x75, 0x7c,
-	0x48, 0x83, 0x3b, 0xc7, 0xa6, 0xa4, 0x03, 0xd5, 0x73, 0x7f, 0x62, 0x4d, 0x8f, 0x98, 0x7a, 0x33,
-	0xb3, 0x33, 0x9b, 0x81, 0x5d, 0x25, 0x06, 0xf1, 0x83, 0x5c, 0x2f, 0x90, 0x1e, 0x3c, 0x4b, 0x75,
-	0x99, 0x7b, 0x31, 0x9e, 0x67, 0x3a, 0x65, 0x61, 0x6e, 0xb7, 0x53, 0xd8, 0x89, 0xba, 0x2d, 0xbe,
-	0x0d, 0xaf, 0xe2, 0xf4, 0xfc, 0xb7, 0x23, 0xaf, 0x5d, 0x7b, 0xf5, 0x9b, 0xdc, 0xda, 0x3f, 0x8c,
-	0xf4, 0x71, 0x11, 0xbf, 0x2b, 0xef, 0xff, 0x06, 0x00, 0x00, 0xff, 0xff, 0x14, 0x93, 0x86, 0xea,
-	0x66, 0x06, 0x00, 0x00,
+	// 1795 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x58, 0x5f, 0x6f, 0xdc, 0x4a,
+	0x15, 0x5f, 0xef, 0x6e, 0xf6, 0xcf, 0xd9, 0xfc, 0xd9, 0x4c, 0x9b, 0xd4, 0x0d, 0xdc, 0xde, 0xc8,
+	0x42, 0x97, 0x28, 0x2a, 0x69, 0xc9, 0xbd, 0x05, 0x44, 0x1f, 0x20, 0xd9, 0xdd, 0x9b, 0xae, 0x48,
+	0x93, 0xbd, 0xce, 0xb6, 0x95, 0xd0, 0x95, 0x2a, 0xc7, 0x9e, 0xa4, 0xa6, 0x5e, 0xdb, 0xb5, 0x27,
+	0x09, 0x11, 0x2f, 0xbc, 0xf3, 0x8c, 0xe0, 0x01, 0x89, 0x4f, 0xc1, 0x13, 0xbc, 0x21, 0xf1, 0xcc,
+	0x47, 0xe0, 0x9b, 0x80, 0xe6, 0xcc, 0x8c, 0x3d, 0xf6, 0x3a, 0x69, 0x54, 0xee, 0x9b, 0xcf, 0xef,
+	0x9c, 0x99, 0x39, 0xf3, 0x9b, 0xf3, 0x67, 0xc6, 0xd0, 0x0b, 0x29, 0x8b, 0xe2, 0x9d, 0x38, 0x89,
+	0x58, 0x44, 0x5a, 0x28, 0xa4, 0xd6, 0x16, 0x74, 0x6c, 0x9a, 0xc6, 0x51, 0x98, 0x52, 0xf2, 0x7d,
+	0xe8, 0xa6, 0xcc, 0x61, 0x17, 0xe9, 0xcb, 0xf4, 0xdc, 0x34, 0x36, 0x8d, 0xad, 0xae, 0x9d, 0x03,
+	0xd6, 0xbf, 0xea, 0xb0, 0x72, 0x12, 0xf8, 0x2e, 0xfd, 0x26, 0x4a, 0x27, 0x49, 0x74, 0xe6, 0x07,
+	0x62, 0x04, 0x87, 0x8e, 0x9c, 0x19, 0xcd, 0x46, 0x28, 0x80, 0x98, 0xd0, 0x46, 0x61, 0xec, 0x99,
+	0x75, 0xd4, 0x29, 0x91, 0x7c, 0x01, 0xcb, 0x1f, 0xb2, 0x59, 0x70, 0x70, 0x03, 0x0d, 0x4a, 0x28,
+	0xf9, 0x02, 0x5a, 0xcc, 0x9d, 0x5e, 0xc7, 0xd4, 0x6c, 0x6e, 0x1a, 0x5b, 0xcb, 0xbb, 0xcb, 0x3b,
+	0xc2, 0xed, 0x9d, 0x29, 0xa2, 0xb6, 0xd4, 0x92, 0x27, 0xd0, 0x1d, 0x04, 0x4e, 0x9a, 0xa2, 0xe9,
+	0x02, 0x9a, 0xae, 0x2a, 0xd3, 0x4c, 0x61, 0xe7, 0x36, 0xdc, 0xf1, 0xd3, 0xab, 0x01, 0xf5, 0x03,
+	0x3f, 0x3c, 0x37, 0x5b, 0x9b, 0xc6, 0xd6, 0x92, 0x9d, 0x03, 0xc4, 0x82, 0xc5, 0xd3, 0xab, 0x83,
+	0x0b, 0x27, 0x71, 0x42, 0x46, 0xa9, 0x67, 0xb6, 0xd1, 0xa0, 0x80, 0x91, 0x0d, 0xe8, 0xc4, 0x89,
+	0x1f, 0x25, 0x3e, 0xbb, 0x36, 0x3b, 0xa8, 0xcf, 0x64, 0x3e, 0xbb, 0x97, 0xba, 0x31, 0x2e, 0x67,
+	0x76, 0x05, 0x2d, 0x19, 0x60, 0x7d, 0x0b, 0xf7, 0x90, 0xc7, 0x43, 0xff, 0x8c, 0x0e, 0xae, 0xdd,
+	0x80, 0x8e, 0x2e, 0x69, 0xc8, 0x3e, 0xc2, 0xe5, 0x0f, 0x61, 0x81, 0x72, 0x33, 0xb3, 0x5e, 0xdc,
+	0x1d, 0x8e, 0xc5, 0xdd, 0x09, 0xbd, 0xf5, 0xdf, 0x05, 0x58, 0x3f, 0xa2, 0xec, 0x38, 0x1e, 0x44,
+	0x61, 0x48, 0x5d, 0xe6, 0x47, 0xe1, 0x20, 0x0a, 0x19, 0xfd, 0x2d, 0xd3, 0xcf, 0xc3, 0x98, 0x3b,
+	0x8f, 0x20, 0x72, 0x9d, 0x00, 0xfd, 0x3a, 0xb8, 0xca, 0x0e, 0xac, 0x84, 0x92, 0xc7, 0xb0, 0xaa,
+	0x23, 0xaf, 0xe3, 0x70, 0x3c, 0x91, 0x47, 0x37, 0xaf, 0x20, 0xbf, 0x82, 0xfb, 0x3a, 0xf8, 0x22,
+	0x4a, 0x99, 0x76, 0x96, 0x0f, 0xd4, 0x16, 0x4a, 0x6a, 0xbb, 0x72, 0x10, 0xf9, 0x0a, 0xd6, 0x74,
+	0xfc, 0x28, 0x9d, 0x9d, 0x5c, 0x9c, 0x86, 0x94, 0xe1, 0x71, 0x77, 0xed, 0x6a, 0x25, 0xd9, 0x01,
+	0x52, 0x50, 0x44, 0x1e, 0x1d, 0x4f, 0xf0, 0xc0, 0xbb, 0x76, 0x85, 0x66, 0x6e, 0x95, 0xc8, 0xa3,
+	0x93, 0x28, 0x61, 0xa9, 0xd9, 0xde, 0x6c, 0xcc, 0xad, 0xa2, 0x94, 0x64, 0x0b, 0x56, 0x12, 0x3a,
+	0x8b, 0x18, 0xcd, 0xf9, 0xeb, 0xe0, 0x12, 0x65, 0x98, 0xfb, 0x53, 0x80, 0x04, 0x83, 0x22, 0x44,
+	0x2a, 0x34, 0xe4, 0x25, 0xac, 0x15, 0xd0, 0x8c, 0x43, 0xb8, 0x9d, 0xc3, 0xea, 0x51, 0xe4, 0x27,
+	0xb0, 0x5e, 0x50, 0xe4, 0x2c, 0xf6, 0xd0, 0x85, 0x1b, 0xb4, 0xe4, 0x29, 0xdc, 0x2b, 0x6a, 0x04,
+	0x8f, 0x8b, 0x38, 0xa8, 0x4a, 0x35, 0xbf, 0x52, 0xc6, 0xe4, 0x12, 0x32, 0x79, 0x83, 0x96, 0xec,
+	0xc1, 0x4a, 0x2a, 0xb0, 0x09, 0xaf, 0x53, 0x6e, 0x14, 0x98, 0xcb, 0x95, 0x5b, 0x55, 0x6a, 0xbb,
+	0x6c, 0x6f, 0x1d, 0xc3, 0x9a, 0xaa, 0x53, 0x27, 0x58, 0xbd, 0x6c, 0xfa, 0xe1, 0x82, 0xa6, 0xb7,
+	0xc5, 0x7f, 0x21, 0xf7, 0xea, 0xa5, 0xdc, 0xb3, 0xfe, 0x68, 0xc0, 0x03, 0x9c, 0x71, 0x1c, 0x32,
+	0x9a, 0x9c, 0x39, 0xda, 0xd4, 0x84, 0x40, 0x33, 0xcc, 0x13, 0x16, 0xbf, 0x79, 0x69, 0x60, 0xee,
+	0x38, 0xf4, 0x19, 0x15, 0x79, 0xd4, 0xb1, 0x33, 0x99, 0xdc, 0x87, 0x05, 0x9a, 0x24, 0x51, 0x22,
+	0xb3, 0x46, 0x08, 0x7c, 0x7d, 0xe6, 0x1e, 0x9f, 0xfe, 0x86, 0xba, 0x2c, 0x35, 0x9b, 0x48, 0x50,
+	0x0e, 0x90, 0x75, 0x68, 0xf9, 0xe1, 0xc9, 0x75, 0xe8, 0x62, 0xac, 0x77, 0x6c, 0x29, 0x71, 0xbf,
+	0xee, 0x49, 0x36, 0xbe, 0xf6, 0x03, 0x46, 0x93, 0xdc, 0xa7, 0x38, 0x4a, 0x98, 0xf2, 0x89, 0x7f,
+	0xf3, 0x15, 0x7c, 0xe5, 0xbd, 0xda, 0x61, 0x06, 0xf0, 0x15, 0xce, 0x9c, 0x99, 0x1f, 0x5c, 0x4b,
+	0xb7, 0xa4, 0x24, 0x46, 0xa5, 0xcc, 0x09, 0x02, 0xea, 0x61, 0xda, 0x76, 0xec, 0x1c, 0xc0, 0x51,
+	0xb8, 0xae, 0xcc, 0x41, 0x29, 0x59, 0x7f, 0x30, 0xa0, 0x2f, 0xfd, 0xca, 0x89, 0x52, 0x14, 0x63,
+	0x76, 0xe8, 0xe5, 0x8d, 0x03, 0xbc, 0xe2, 0x32, 0x77, 0x10, 0x85, 0x67, 0xfe, 0xf9, 0x45, 0x82,
+	0xb4, 0x71, 0x0e, 0x0a, 0x18, 0x79, 0x06, 0x6d, 0xb1, 0x40, 0x6a, 0x36, 0x36, 0x1b, 0x5b, 0xbd,
+	0xdd, 0xef, 0x95, 0x42, 0x42, 0x27, 0xc1, 0x56, 0xb6, 0xd6, 0x5f, 0x1a, 0xb0, 0x5c, 0x8c, 0x87,
+	0x4f, 0x0d, 0x04, 0xf2, 0x53, 0x80, 0xbc, 0x41, 0x21, 0x55, 0xbd, 0x52, 0x5c, 0xe6, 0xbd, 0xd1,
+	0xd6, 0x4c, 0xc9, 0x0f, 0x60, 0x29, 0x76, 0x12, 0x1a, 0x32, 0xec, 0x00, 0x63, 0xc1, 0x65, 0xd7,
+	0x2e, 0x82, 0x64, 0x13, 0x7a, 0x01, 0x75, 0xce, 0x94, 0x8d, 0x20, 0x55, 0x87, 0x0a, 0x91, 0xd5,
+	0x2a, 0x45, 0xd6, 0x2f, 0x00, 0xb2, 0x03, 0x15, 0xf5, 0xaa, 0xb7, 0xfb, 0x79, 0xc1, 0xb9, 0xf9,
+	0xf0, 0xb5, 0xb5, 0x21, 0xe4, 0x2b, 0xe8, 0xc8, 0x03, 0x49, 0xcd, 0x0e, 0x0e, 0x37, 0x4b, 0x04,
+	0xe7, 0xe3, 0x32, 0x4b, 0x6c, 0x1d, 0x4e, 0xca, 0xf6, 0xe2, 0x38, 0xb8, 0x1e, 0x61, 0x64, 0x77,
+	0x65, 0xeb, 0x28, 0xa0, 0x3c, 0x58, 0xbc, 0xc4, 0x3f, 0x63, 0xa9, 0x09, 0x78, 0xb6, 0x52, 0xb2,
+	0x08, 0xf4, 0x87, 0x17, 0xb3, 0x98, 0xcf, 0x4b, 0x65, 0xa2, 0x5a, 0x7f, 0xae, 0xc3, 0xa2, 0x5c,
+	0x12, 0xf1, 0x8f, 0x04, 0xcf, 0x13, 0x68, 0x9d, 0x5f, 0x61, 0x55, 0xac, 0xdf, 0x5e, 0x15, 0xa5,
+	0x19, 0xf9, 0x92, 0xf7, 0x6e, 0x59, 0x5d, 0x1a, 0xb7, 0x57, 0x97, 0xcc, 0x90, 0x3c, 0x02, 0xc0,
+	0xea, 0x2f, 0xaa, 0x98, 0x48, 0x52, 0x0d, 0xe1, 0xa7, 0x27, 0x6a, 0x9a, 0x30, 0x58, 0x40, 0x03,
+	0x1d, 0xe2, 0x41, 0x2e, 0xc4, 0x42, 0x1b, 0x2a, 0x60, 0x7c, 0x15, 0x11, 0xb8, 0x93, 0xc4, 0x8f,
+	0xe4, 0xc5, 0x43, 0x43, 0xac, 0xbf, 0xd7, 0x01, 0xd0, 0x47, 0x41, 0xcc, 0xa7, 0x46, 0xf2, 0x5d,
+	0x2f, 0x60, 0xc5, 0x88, 0x6f, 0xfe, 0x1f, 0x11, 0xbf, 0x70, 0x87, 0x88, 0x6f, 0xdd, 0x1e, 0xf1,
+	0xed, 0x52, 0xc4, 0x3f, 0x9d, 0x0b, 0xd8, 0xfb, 0xa5, 0x63, 0x14, 0x51, 0x95, 0x59, 0x59, 0xbf,
+	0x83, 0x55, 0x39, 0xf1, 0x5e, 0xc0, 0x8f, 0x8e, 0xdf, 0x8e, 0xe6, 0x5d, 0x35, 0xaa, 0x5c, 0xb5,
+	0x60, 0xd1, 0x7d, 0xe7, 0x07, 0x1e, 0xca, 0x34, 0x45, 0x4a, 0x97, 0xec, 0x02, 0x56, 0xe4, 0xbc,
+	0x51, 0x6e, 0x23, 0xbf, 0x37, 0x00, 0xa6, 0xee, 0x34, 0xa1, 0x94, 0x07, 0x3c, 0xe9, 0x43, 0xc3,
+	0xa3, 0x97, 0x72, 0x31, 0xfe, 0xc9, 0x53, 0xe4, 0x83, 0xe7, 0xa7, 0x6e, 0x2a, 0xcb, 0x9f, 0x94,
+	0xf8, 0x21, 0xbb, 0x72, 0xd5, 0x06, 0x2a, 0x94, 0xc8, 0x35, 0xaa, 0x24, 0x8a, 0x80, 0x54, 0x62,
+	0xde, 0x67, 0x16, 0xb4, 0x3e, 0x63, 0xfd, 0xc3, 0x80, 0x2e, 0x72, 0x82, 0x1e, 0x3c, 0x02, 0x48,
+	0xa2, 0x88, 0xbd, 0x70, 0x42, 0x2f, 0x50, 0x1d, 0x4c, 0x43, 0xc8, 0x36, 0xb4, 0xd0, 0x7b, 0xe1,
+	0x4f, 0x6f, 0x97, 0x14, 0xd8, 0x15, 0xdc, 0x4a, 0x0b, 0xf2, 0x0c, 0x3a, 0xae, 0x60, 0x4a, 0x55,
+	0xe7, 0x87, 0x85, 0x0b, 0xb8, 0xce, 0xb8, 0x9d, 0x99, 0x92, 0xc7, 0xd0, 0x66, 0x48, 0x89, 0xd8,
+	0x80, 0xb6, 0x46, 0xce, 0x94, 0xad, 0x4c, 0x2c, 0x06, 0xeb, 0x6f, 0x1c, 0xe6, 0xbe, 0xcb, 0xd6,
+	0xcf, 0x5a, 0xfb, 0x23, 0x59, 0xfc, 0x2e, 0x9d, 0xe0, 0x65, 0x8a, 0x5b, 0x59, 0xb2, 0x35, 0x84,
+	0x87, 0x91, 0x4c, 0x0c, 0x45, 0x6e, 0x26, 0xf3, 0xb1, 0xd9, 0x21, 0x29, 0x86, 0x35, 0xc4, 0xfa,
+	0x9b, 0x01, 0xed, 0xa9, 0x8b, 0xcb, 0xf1, 0x23, 0x7a, 0xa7, 0xd3, 0x25, 0x25, 0x4e, 0xf7, 0xe9,
+	0x35, 0x93, 0x61, 0xd1, 0xb4, 0x85, 0xc0, 0x8f, 0x27, 0x76, 0xdc, 0xf7, 0x94, 0xa5, 0x18, 0x0d,
+	0x4d, 0x5b, 0x89, 0xdc, 0xde, 0x4b, 0xa2, 0x38, 0xc5, 0x94, 0x5a, 0xb2, 0x85, 0xc0, 0x3d, 0x89,
+	0x2e, 0x69, 0x12, 0xf8, 0x33, 0x1f, 0x2b, 0x08, 0xee, 0x22, 0x47, 0xf8, 0x7c, 0xa7, 0x8e, 0xfb,
+	0x3e, 0x88, 0xd4, 0x9b, 0x45, 0x89, 0xbc, 0xe5, 0x27, 0x0e, 0xa3, 0x98, 0x22, 0x4d, 0x1b, 0xbf,
+	0xad, 0x7f, 0xab, 0xeb, 0x41, 0x56, 0xf7, 0xc5, 0x1e, 0xaa, 0xae, 0x2c, 0x3f, 0x86, 0x9e, 0x16,
+	0xee, 0xb8, 0x8b, 0xde, 0xee, 0x4a, 0x7e, 0x16, 0x82, 0x6c, 0xdd, 0x86, 0xfc, 0x08, 0xba, 0x59,
+	0xa2, 0x9a, 0x8d, 0xea, 0x01, 0xb9, 0x85, 0x32, 0xff, 0x86, 0x87, 0xb4, 0xd9, 0xbc, 0xc5, 0x1c,
+	0x2d, 0x6e, 0x88, 0xdf, 0xbf, 0x1a, 0x5a, 0xf5, 0xfb, 0xf4, 0x3e, 0x5e, 0x78, 0xfd, 0x35, 0xca,
+	0xaf, 0xbf, 0xe7, 0x85, 0x46, 0xda, 0xac, 0xb8, 0x6a, 0x14, 0x09, 0xd5, 0x9b, 0xa8, 0xf5, 0xad,
+	0xbc, 0xfa, 0xa0, 0xe6, 0xc4, 0x99, 0xc5, 0xe2, 0x95, 0xcc, 0xfc, 0x19, 0x4d, 0x99, 0x33, 0x8b,
+	0xd1, 0xd1, 0x86, 0x9d, 0x03, 0x77, 0xc8, 0xb2, 0x54, 0x65, 0x99, 0xf5, 0x27, 0x03, 0x16, 0x87,
+	0x34, 0xf5, 0x13, 0xea, 0xa1, 0xb6, 0x54, 0x9f, 0x8d, 0xbb, 0xd7, 0xe7, 0x23, 0x20, 0x6e, 0xf9,
+	0x81, 0xa8, 0x3c, 0x78, 0xa4, 0x26, 0xa8, 0x7e, 0x47, 0xda, 0x15, 0x23, 0xad, 0x5f, 0x42, 0x9f,
+	0xdf, 0x49, 0xf5, 0x36, 0x4e, 0x1e, 0x67, 0x3b, 0x33, 0x8a, 0xd5, 0x59, 0xdf, 0x42, 0xb6, 0xb7,
+	0x7f, 0xd6, 0x61, 0x55, 0x9b, 0xe2, 0x2e, 0xff, 0x24, 0x78, 0xff, 0x10, 0xa3, 0xf7, 0x3c, 0x2f,
+	0xbb, 0x35, 0xea, 0x10, 0x2f, 0xee, 0x42, 0x7c, 0x15, 0x7b, 0x0e, 0x6f, 0x22, 0x22, 0xbf, 0x8b,
+	0x60, 0x6e, 0x35, 0xa4, 0x01, 0x65, 0x78, 0xd7, 0xd5, 0xac, 0x24, 0x98, 0x59, 0x1d, 0x5c, 0xc9,
+	0xf5, 0x16, 0x34, 0x2b, 0x05, 0xf2, 0xc7, 0xa0, 0x02, 0xd4, 0x9a, 0x2d, 0xb4, 0x2b, 0xc3, 0xba,
+	0xa5, 0x5a, 0xb7, 0x5d, 0xb4, 0x54, 0x2b, 0x2b, 0xcb, 0xf4, 0x55, 0xe8, 0xbe, 0x73, 0xc2, 0x73,
+	0xea, 0xc9, 0x7f, 0x0e, 0x65, 0x78, 0xfb, 0x73, 0x68, 0x89, 0x7f, 0x23, 0x64, 0x0d, 0x56, 0xf7,
+	0xf7, 0x8e, 0x86, 0x6f, 0xc6, 0xc3, 0xe9, 0x8b, 0xb7, 0x83, 0xe3, 0xa3, 0xa9, 0x7d, 0x7c, 0xd8,
+	0xaf, 0x6d, 0x7f, 0xa6, 0xfd, 0x2a, 0x21, 0x6d, 0x68, 0xbc, 0x98, 0xee, 0xf7, 0x6b, 0xfc, 0x63,
+	0xba, 0xff, 0x75, 0xdf, 0xd8, 0xfe, 0x19, 0x74, 0xb3, 0x5f, 0x0a, 0x64, 0x09, 0xba, 0xa3, 0xd7,
+	0x6f, 0x07, 0xf6, 0x68, 0x6f, 0x3a, 0xea, 0xd7, 0xa4, 0xf8, 0x6a, 0x32, 0xe4, 0xa2, 0x21, 0xc5,
+	0xe1, 0xe8, 0x70, 0x34, 0x1d, 0xf5, 0xeb, 0xdb, 0xcf, 0x61, 0xa5, 0x74, 0xdf, 0x22, 0xf7, 0x60,
+	0xe5, 0xe4, 0x70, 0x3c, 0x18, 0xbd, 0x3d, 0x78, 0xf3, 0xf6, 0x64, 0x64, 0xbf, 0x1e, 0xd9, 0xfd,
+	0x5a, 0x01, 0x1c, 0x1c, 0x8e, 0x47, 0x47, 0xd3, 0xbe, 0xb1, 0xfd, 0x0c, 0x56, 0x4a, 0x37, 0x2f,
+	0xd2, 0x87, 0xc5, 0xcc, 0xee, 0xd5, 0x70, 0xd2, 0xaf, 0x15, 0x90, 0xe9, 0x60, 0xd2, 0x37, 0x76,
+	0xff, 0xd3, 0x84, 0x25, 0x0c, 0xd2, 0xf4, 0x84, 0x26, 0x97, 0x3c, 0x21, 0x86, 0xb0, 0x26, 0xe8,
+	0x2d, 0xff, 0xaa, 0xba, 0x29, 0x2b, 0x36, 0xfa, 0x4a, 0xa1, 0x62, 0xce, 0xaa, 0x91, 0x43, 0x78,
+	0xa8, 0xcd, 0x52, 0xfa, 0x51, 0x53, 0xac, 0x05, 0x45, 0x65, 0xe5, 0x6c, 0x2f, 0xe1, 0x81, 0x98,
+	0x6d, 0xfe, 0x97, 0xcc, 0x47, 0x52, 0xed, 0xa6, 0xe9, 0x44, 0x5c, 0x7c, 0x37, 0xd3, 0x1d, 0xc2,
+	0xea, 0x01, 0x65, 0xa5, 0x17, 0xd2, 0x67, 0x65, 0xb6, 0x0a, 0x2f, 0xe9, 0x8d, 0xf5, 0x6a, 0xb5,
+	0x55, 0x23, 0x3f, 0x87, 0x6e, 0x76, 0x9d, 0x27, 0xd9, 0xfb, 0xa1, 0x7c, 0xc3, 0xdf, 0xc8, 0xfe,
+	0x5f, 0x65, 0xb7, 0x11, 0xab, 0x46, 0x8e, 0x61, 0xa5, 0xd4, 0xde, 0xf3, 0x0d, 0x55, 0xf7, 0xfd,
+	0x0d, 0x73, 0xbe, 0x58, 0x8a, 0xa2, 0x6b, 0xd5, 0x9e, 0x1a, 0x64, 0x1f, 0xba, 0x59, 0x45, 0xc9,
+	0x9d, 0x29, 0xd7, 0xa9, 0x8d, 0x87, 0x15, 0x1a, 0x45, 0xcf, 0x7e, 0xef, 0xd7, 0xdd, 0x9d, 0x27,
+	0xcf, 0x85, 0xc1, 0x69, 0x0b, 0x5f, 0x03, 0x5f, 0xfe, 0x6f, 0x00, 0xbd, 0x9d, 0x1d, 0x62, 0x4b,
+	0x15, 0x00, 0x00,
 }
@@ -24,6 +24,20 @@ type NetOpsServiceClient interface {
 	UpdateSliceLifeCycleEvent(ctx context.Context, in *SliceLifeCycleEvent, opts ...grpc.CallOption) (*Response, error)
 	// The Interface to update the slicegw context to global handle
 	UpdateConnectionContext(ctx context.Context, in *NetOpConnectionContext, opts ...grpc.CallOption) (*Response, error)
+	// Remove a slice gateway from the slice, only the sliceId and the
+	// localSliceGwId of the context are used
+	DeleteConnectionContext(ctx context.Context, in *NetOpConnectionContext, opts ...grpc.CallOption) (*Response, error)
+	// Report the QoS config enforced for a slice on the node
+	GetSliceQosStatus(ctx context.Context, in *SliceQosStatusRequest, opts ...grpc.CallOption) (*SliceQosStatus, error)
+	// Dump the slices, the class IDs and the tc config of the node for
+	// debugging
+	DumpState(ctx context.Context, in *DumpStateRequest, opts ...grpc.CallOption) (*StateDump, error)
+	// Stream samples of the traffic statistics of the slices at the requested
+	// interval until the client cancels
+	WatchSliceStats(ctx context.Context, in *WatchSliceStatsRequest, opts ...grpc.CallOption) (NetOpsService_WatchSliceStatsClient, error)
+	// Converge to the complete desired state of the node, only the changes
+	// are applied
+	SyncState(ctx context.Context, in *SyncStateRequest, opts ...grpc.CallOption) (*SyncStateResponse, error)
 }
 
 type netOpsServiceClient struct {
@@ -61,6 +75,74 @@ func (c *netOpsServiceClient) UpdateConnectionContext(ctx context.Context, in *N
 	return out, nil
 }
 
+func (c *netOpsServiceClient) DeleteConnectionContext(ctx context.Context, in *NetOpConnectionContext, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, "/netops.NetOpsService/DeleteConnectionContext", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *netOpsServiceClient) GetSliceQosStatus(ctx context.Context, in *SliceQosStatusRequest, opts ...grpc.CallOption) (*SliceQosStatus, error) {
+	out := new(SliceQosStatus)
+	err := c.cc.Invoke(ctx, "/netops.NetOpsService/GetSliceQosStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *netOpsServiceClient) DumpState(ctx context.Context, in *DumpStateRequest, opts ...grpc.CallOption) (*StateDump, error) {
+	out := new(StateDump)
+	err := c.cc.Invoke(ctx, "/netops.NetOpsService/DumpState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *netOpsServiceClient) WatchSliceStats(ctx context.Context, in *WatchSliceStatsRequest, opts ...grpc.CallOption) (NetOpsService_WatchSliceStatsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &NetOpsService_ServiceDesc.Streams[0], "/netops.NetOpsService/WatchSliceStats", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &netOpsServiceWatchSliceStatsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type NetOpsService_WatchSliceStatsClient interface {
+	Recv() (*SliceStatsSample, error)
+	grpc.ClientStream
+}
+
+type netOpsServiceWatchSliceStatsClient struct {
+	grpc.ClientStream
+}
+
+func (x *netOpsServiceWatchSliceStatsClient) Recv() (*SliceStatsSample, error) {
+	m := new(SliceStatsSample)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *netOpsServiceClient) SyncState(ctx context.Context, in *SyncStateRequest, opts ...grpc.CallOption) (*SyncStateResponse, error) {
+	out := new(SyncStateResponse)
+	err := c.cc.Invoke(ctx, "/netops.NetOpsService/SyncState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // NetOpsServiceServer is the server API for NetOpsService service.
 // All implementations must embed UnimplementedNetOpsServiceServer
 // for forward compatibility
@@ -71,6 +153,20 @@ type NetOpsServiceServer interface {
 	UpdateSliceLifeCycleEvent(context.Context, *SliceLifeCycleEvent) (*Response, error)
 	// The Interface to update the slicegw context to global handle
 	UpdateConnectionContext(context.Context, *NetOpConnectionContext) (*Response, error)
+	// Remove a slice gateway from the slice, only the sliceId and the
+	// localSliceGwId of the context are used
+	DeleteConnectionContext(context.Context, *NetOpConnectionContext) (*Response, error)
+	// Report the QoS config enforced for a slice on the node
+	GetSliceQosStatus(context.Context, *SliceQosStatusRequest) (*SliceQosStatus, error)
+	// Dump the slices, the class IDs and the tc config of the node for
+	// debugging
+	DumpState(context.Context, *DumpStateRequest) (*StateDump, error)
+	// Stream samples of the traffic statistics of the slices at the requested
+	// interval until the client cancels
+	WatchSliceStats(*WatchSliceStatsRequest, NetOpsService_WatchSliceStatsServer) error
+	// Converge to the complete desired state of the node, only the changes
+	// are applied
+	SyncState(context.Context, *SyncStateRequest) (*SyncStateResponse, error)
 	mustEmbedUnimplementedNetOpsServiceServer()
 }
 
@@ -87,6 +183,21 @@ func (UnimplementedNetOpsServiceServer) UpdateSliceLifeCycleEvent(context.Contex
 func (UnimplementedNetOpsServiceServer) UpdateConnectionContext(context.Context, *NetOpConnectionContext) (*Response, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdateConnectionContext not implemented")
 }
+func (UnimplementedNetOpsServiceServer) DeleteConnectionContext(context.Context, *NetOpConnectionContext) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteConnectionContext not implemented")
+}
+func (UnimplementedNetOpsServiceServer) GetSliceQosStatus(context.Context, *SliceQosStatusRequest) (*SliceQosStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSliceQosStatus not implemented")
+}
+func (UnimplementedNetOpsServiceServer) DumpState(context.Context, *DumpStateRequest) (*StateDump, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DumpState not implemented")
+}
+func (UnimplementedNetOpsServiceServer) WatchSliceStats(*WatchSliceStatsRequest, NetOpsService_WatchSliceStatsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchSliceStats not implemented")
+}
+func (UnimplementedNetOpsServiceServer) SyncState(context.Context, *SyncStateRequest) (*SyncStateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SyncState not implemented")
+}
 func (UnimplementedNetOpsServiceServer) mustEmbedUnimplementedNetOpsServiceServer() {}
 
 // UnsafeNetOpsServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -154,6 +265,99 @@ func _NetOpsService_UpdateConnectionContext_Handler(srv interface{}, ctx context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _NetOpsService_DeleteConnectionContext_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NetOpConnectionContext)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NetOpsServiceServer).DeleteConnectionContext(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/netops.NetOpsService/DeleteConnectionContext",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NetOpsServiceServer).DeleteConnectionContext(ctx, req.(*NetOpConnectionContext))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NetOpsService_GetSliceQosStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SliceQosStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NetOpsServiceServer).GetSliceQosStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/netops.NetOpsService/GetSliceQosStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NetOpsServiceServer).GetSliceQosStatus(ctx, req.(*SliceQosStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NetOpsService_DumpState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DumpStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NetOpsServiceServer).DumpState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/netops.NetOpsService/DumpState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NetOpsServiceServer).DumpState(ctx, req.(*DumpStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NetOpsService_WatchSliceStats_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchSliceStatsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NetOpsServiceServer).WatchSliceStats(m, &netOpsServiceWatchSliceStatsServer{stream})
+}
+
+type NetOpsService_WatchSliceStatsServer interface {
+	Send(*SliceStatsSample) error
+	grpc.ServerStream
+}
+
+type netOpsServiceWatchSliceStatsServer struct {
+	grpc.ServerStream
+}
+
+func (x *netOpsServiceWatchSliceStatsServer) Send(m *SliceStatsSample) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _NetOpsService_SyncState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SyncStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NetOpsServiceServer).SyncState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/netops.NetOpsService/SyncState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NetOpsServiceServer).SyncState(ctx, req.(*SyncStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // NetOpsService_ServiceDesc is the grpc.ServiceDesc for NetOpsService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -173,7 +377,29 @@ var NetOpsService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "UpdateConnectionContext",
 			Handler:    _NetOpsService_UpdateConnectionContext_Handler,
 		},
+		{
+			MethodName: "DeleteConnectionContext",
+			Handler:    _NetOpsService_DeleteConnectionContext_Handler,
+		},
+		{
+			MethodName: "GetSliceQosStatus",
+			Handler:    _NetOpsService_GetSliceQosStatus_Handler,
+		},
+		{
+			MethodName: "DumpState",
+			Handler:    _NetOpsService_DumpState_Handler,
+		},
+		{
+			MethodName: "SyncState",
+			Handler:    _NetOpsService_SyncState_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchSliceStats",
+			Handler:       _NetOpsService_WatchSliceStats_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "netop.proto",
 }
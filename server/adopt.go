@@ -0,0 +1,636 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kubeslice/netops/logger"
+	"github.com/vishvananda/netlink"
+)
+
+// defaultUnclaimedTcTTL is how long the tc config of the slices found on the
+// node without a checkpoint is kept for their slices to claim it.
+const defaultUnclaimedTcTTL = 10 * time.Minute
+
+// tcBootstrapMode - How the tc config found on the node is handled at
+// bootstrap
+type tcBootstrapMode string
+
+const (
+	// Keep the netops objects of the slices in the checkpoint and remove
+	// the rest of the netops objects. Without a checkpoint, the classes of
+	// the slices are kept for UNCLAIMED_TC_TTL for the slices to claim
+	// them, where the reset mode removes them right away. Root qdiscs of
+	// other components are left alone.
+	TC_BOOTSTRAP_ADOPT tcBootstrapMode = "adopt"
+	// Remove the root qdisc and the IFB device, then rebuild the slices in
+	// the checkpoint.
+	TC_BOOTSTRAP_RESET tcBootstrapMode = "reset"
+)
+
+// getUnclaimedTcTTL returns how long the unclaimed tc config is kept, set by
+// the UNCLAIMED_TC_TTL env var. A zero TTL keeps it until the slices are
+// synced.
+func getUnclaimedTcTTL() (time.Duration, error) {
+	value := os.Getenv("UNCLAIMED_TC_TTL")
+	if value == "" {
+		return defaultUnclaimedTcTTL, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err == nil && ttl < 0 {
+		err = errors.New("negative TTL")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid UNCLAIMED_TC_TTL %q: %v", value, err)
+	}
+	return ttl, nil
+}
+
+// getTcBootstrapMode returns the bootstrap mode set by the TC_BOOTSTRAP_MODE
+// env var. The tc config is adopted by default.
+func getTcBootstrapMode() (tcBootstrapMode, error) {
+	switch mode := tcBootstrapMode(strings.ToLower(os.Getenv("TC_BOOTSTRAP_MODE"))); mode {
+	case "", TC_BOOTSTRAP_ADOPT:
+		return TC_BOOTSTRAP_ADOPT, nil
+	case TC_BOOTSTRAP_RESET:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid TC_BOOTSTRAP_MODE %q", os.Getenv("TC_BOOTSTRAP_MODE"))
+	}
+}
+
+// replaceForeignRootEnabled reports whether a root qdisc not added by netops
+// is replaced by the netops one. It is enabled with the
+// TC_REPLACE_FOREIGN_ROOT env var.
+func replaceForeignRootEnabled() (bool, error) {
+	return boolEnv("TC_REPLACE_FOREIGN_ROOT")
+}
+
+// rootQdisc returns the root qdisc of the tree, or nil when there is none.
+// The default qdisc attached by the kernel, which has no handle, does not
+// count.
+func rootQdisc(tree *TcTree) *TcQdisc {
+	for _, qdisc := range tree.Qdiscs {
+		if qdisc.Parent == netlink.HANDLE_ROOT && qdisc.Handle != 0 {
+			return qdisc
+		}
+	}
+	return nil
+}
+
+// isNetopsRootQdisc reports whether the root qdisc was added by netops: an
+// htb qdisc with the netops handle and default class.
+func (m *sliceStateManager) isNetopsRootQdisc(qdisc *TcQdisc) bool {
+	return qdisc.Kind == tcKindHtb && qdisc.Handle == m.tcRootHandle() && qdisc.DefaultClass == htbDefaultClassId
+}
+
+// checkForeignRoot fails when a root qdisc of another component is on the
+// interface. The interface is not used for the slices then.
+func (s *NetOps) checkForeignRoot(iface *IfaceInfo) error {
+	tree, err := s.tcBackend().Dump(iface.name)
+	if err != nil {
+		return err
+	}
+	root := rootQdisc(tree)
+	if root == nil || s.state.isNetopsRootQdisc(root) {
+		return nil
+	}
+	iface.foreignRoot = root.String()
+	logger.GlobalLogger.Errorf("Not shaping slice traffic on intf: %v, found foreign root qdisc: %v", iface.name, root)
+	return fmt.Errorf("foreign root qdisc %v", root)
+}
+
+// classOf returns the class with the handle and parent, or nil.
+func classOf(tree *TcTree, parent uint32, handle uint32) *TcClass {
+	for _, class := range tree.Classes {
+		if class.Parent == parent && class.Handle == handle {
+			return class
+		}
+	}
+	return nil
+}
+
+// adoptChildClasses keeps the child classes of the adopted slice found after
+// its leaf class on all the devices, along with their class IDs.
+func (s *NetOps) adoptChildClasses(trees map[string]*TcTree, devs []string, sliceInfo *SliceInfo, keep map[uint32]bool) {
+	first := sliceInfo.tcParentClassId
+	children := maxClassId
+	for _, dev := range devs {
+		if found := s.state.childClassesInTree(trees[dev], first); found < children {
+			children = found
+		}
+	}
+	if children <= s.state.classIds.children(first) {
+		return
+	}
+	err := s.state.classIds.resize(first, children)
+	if err != nil {
+		logger.GlobalLogger.Errorf("Failed to keep the child classes of slice: %v, err: %v", sliceInfo.sliceName, err)
+		return
+	}
+	for id := first + 1; id <= first+children; id++ {
+		keep[s.state.tcClassHandle(id)] = true
+	}
+}
+
+// adoptedSliceTc returns the tc config of the slice found in the trees, or nil
+// when its classes and leaf qdisc are not on every device alike.
+func (m *sliceStateManager) adoptedSliceTc(trees map[string]*TcTree, devs []string, sliceInfo *SliceInfo) *TcInfo {
+	parentHandle := m.tcClassHandle(sliceInfo.tcParentClassId)
+	leafHandle := m.tcClassHandle(sliceInfo.tcParentClassId + 1)
+	qdiscHandle := netlink.MakeHandle(uint16(sliceInfo.tcParentClassId), 0)
+	var tc *TcInfo
+	var objs string
+	for _, dev := range devs {
+		tree := trees[dev]
+		parent := classOf(tree, m.tcRootHandle(), parentHandle)
+		leaf := classOf(tree, parentHandle, leafHandle)
+		qdisc := qdiscByHandle(tree, qdiscHandle)
+		if parent == nil || leaf == nil || qdisc == nil || qdisc.Parent != leafHandle {
+			return nil
+		}
+		// The objects are the same on all the devices but for the name of
+		// the device.
+		devObjs := strings.ReplaceAll(parent.String()+leaf.String()+qdisc.String(), "dev "+dev+" ", "")
+		if tc != nil {
+			if devObjs != objs {
+				return nil
+			}
+			continue
+		}
+		objs = devObjs
+		tc = &TcInfo{
+			class:        CLASS_TYPE_HTB,
+			bwCeiling:    uint32(parent.Rate),
+			bwGuaranteed: uint32(leaf.Rate),
+			priority:     parent.Prio,
+		}
+		switch qdisc.Kind {
+		case tcKindSfq:
+		case tcKindTbf:
+			tc.class = CLASS_TYPE_TBF
+		default:
+			return nil
+		}
+	}
+	if tc == nil {
+		return nil
+	}
+	if p := sliceInfo.qosProfile; p != nil {
+		if tc.class == CLASS_TYPE_TBF {
+			// The guaranteed bandwidth is not set on the classes in TBF
+			// mode.
+			tc.bwGuaranteed = p.bwGuaranteed
+		}
+		tc.dscp, tc.markDscp, _ = parseDscpClass(p.dscpClass)
+	}
+	return tc
+}
+
+// qdiscByHandle returns the qdisc with the handle, or nil.
+func qdiscByHandle(tree *TcTree, handle uint32) *TcQdisc {
+	for _, q := range tree.Qdiscs {
+		if q.Handle == handle {
+			return q
+		}
+	}
+	return nil
+}
+
+// qdiscAt returns the qdisc under the parent, or nil.
+func qdiscAt(tree *TcTree, parent uint32) *TcQdisc {
+	for _, q := range tree.Qdiscs {
+		if q.Parent == parent {
+			return q
+		}
+	}
+	return nil
+}
+
+// filterKey identifies a filter by its config. The handles and the prio of
+// the filters are adopted from the ones found.
+func filterKey(f *TcFilter) string {
+	filter := *f
+	filter.Handle = 0
+	filter.Prio = 0
+	return filter.String()
+}
+
+// sliceGwFilters returns the filters of a slice gw for the address family on
+// the interfaces and the IFB device, per port.
+func (s *NetOps) sliceGwFilters(sliceInfo *SliceInfo, gwInfo *SliceGwInfo, family int, ifaces []string) [][]*TcFilter {
+	filters := [][]*TcFilter{}
+	for i := range gwInfo.localPorts {
+		egress, _ := s.state.sliceGwPortFilter(gwInfo, i, family, 0, sliceInfo.tcLeafClassFqId)
+		if egress == nil {
+			return nil
+		}
+		portFilters := []*TcFilter{}
+		if s.state.ifbIface != "" {
+			portFilters = append(portFilters, s.state.sliceGwIngressFilter(egress))
+		}
+		for _, dev := range ifaces {
+			portFilters = append(portFilters, s.state.sliceGwIfaceFilters(dev, egress, sliceInfo.tc)...)
+		}
+		filters = append(filters, portFilters)
+	}
+	return filters
+}
+
+// adoptedFilterHandles returns the handles of the filters found for each port
+// of a slice gw, or nil when a filter is missing or the filters of a port do
+// not share a handle.
+func adoptedFilterHandles(found map[string]*TcFilter, expected [][]*TcFilter) []uint32 {
+	handles := []uint32{}
+	for _, portFilters := range expected {
+		handle := uint32(0)
+		for _, filter := range portFilters {
+			f := found[filterKey(filter)]
+			if f == nil || f.Handle == 0 || (handle != 0 && f.Handle != handle) {
+				return nil
+			}
+			handle = f.Handle
+		}
+		handles = append(handles, handle)
+	}
+	return handles
+}
+
+// allSliceGwFilters returns the filters of the slice gws of the adopted
+// slices on the interfaces and the IFB device, for all the address families,
+// keyed by filterKey.
+func (s *NetOps) allSliceGwFilters(ifaces []string) map[string]*TcFilter {
+	filters := map[string]*TcFilter{}
+	for _, sliceInfo := range s.state.slices {
+		if sliceInfo.tc == nil {
+			continue
+		}
+		for _, gwInfo := range sliceInfo.sliceGwInfo {
+			for _, family := range tcFilterFamilies {
+				for _, portFilters := range s.sliceGwFilters(sliceInfo, gwInfo, family, ifaces) {
+					for _, filter := range portFilters {
+						filters[filterKey(filter)] = filter
+					}
+				}
+			}
+		}
+	}
+	return filters
+}
+
+// adoptSliceGwFilters marks the address families of the slice gws whose
+// filters are all found as configured, at the prio and with the handles they
+// were found with. It returns the keys of the filters accounted for.
+func (s *NetOps) adoptSliceGwFilters(found map[string]*TcFilter, ifaces []string) map[string]bool {
+	accounted := map[string]bool{}
+	for _, sliceInfo := range s.state.slices {
+		if sliceInfo.tc == nil {
+			continue
+		}
+		for _, gwInfo := range sliceInfo.sliceGwInfo {
+			gwInfo.tcConfigured = nil
+			gwInfo.tcFilterHandles = nil
+		}
+		for _, gwInfo := range sliceInfo.sliceGwInfo {
+			for _, family := range tcFilterFamilies {
+				expected := s.sliceGwFilters(sliceInfo, gwInfo, family, ifaces)
+				handles := adoptedFilterHandles(found, expected)
+				if len(expected) == 0 || handles == nil {
+					continue
+				}
+				for _, portFilters := range expected {
+					for _, filter := range portFilters {
+						accounted[filterKey(filter)] = true
+					}
+				}
+				if gwInfo.tcConfigured == nil {
+					gwInfo.tcConfigured = make(map[int]bool)
+					gwInfo.tcFilterHandles = make(map[int][]uint32)
+				}
+				gwInfo.tcConfigured[family] = true
+				gwInfo.tcFilterHandles[family] = handles
+				prio := uint32(found[filterKey(expected[0][0])].Prio)
+				if family == netlink.FAMILY_V6 {
+					gwInfo.tcFilterPrio = prio - tcIpv6FilterPrioOffset
+				} else if prio < tcIpv6FilterPrioOffset {
+					gwInfo.tcFilterPrio = prio
+				}
+			}
+		}
+	}
+	return accounted
+}
+
+// classDepth returns the number of classes above the class.
+func classDepth(tree *TcTree, class *TcClass) int {
+	depth := 0
+	for parent := class.Parent; ; depth++ {
+		up := classByHandle(tree, parent)
+		if up == nil || depth > len(tree.Classes) {
+			return depth
+		}
+		parent = up.Parent
+	}
+}
+
+// classByHandle returns the class with the handle, or nil.
+func classByHandle(tree *TcTree, handle uint32) *TcClass {
+	for _, c := range tree.Classes {
+		if c.Handle == handle {
+			return c
+		}
+	}
+	return nil
+}
+
+// adoptTc adopts the tc config found on the node. The netops objects of the
+// slices in the checkpoint are kept as is, the other netops objects are
+// removed. The slices have no identity in the kernel, so without a checkpoint
+// their classes and leaf qdiscs are kept as unclaimed until their QoS profiles
+// arrive, and their filters are removed. The root qdiscs of other components
+// are reported and left alone, the slice traffic is not shaped on their
+// interfaces, unless replaceForeign is set.
+func (s *NetOps) adoptTc(cp *checkpoint, replaceForeign bool) error {
+	var err error
+
+	// Find the devices with the netops root qdisc.
+	trees := map[string]*TcTree{}
+	owned := []string{}
+	for _, iface := range s.state.netIfaces {
+		tree, err := s.tcBackend().Dump(iface.name)
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to dump tc config on intf: %v, err: %v", iface.name, err)
+			return err
+		}
+		root := rootQdisc(tree)
+		switch {
+		case root == nil:
+		case s.state.ownsRootQdisc(cp, root):
+			trees[iface.name] = tree
+			owned = append(owned, iface.name)
+			iface.tcInited = true
+		case replaceForeign:
+			logger.GlobalLogger.Infof("Replacing foreign root qdisc: %v", root)
+		default:
+			iface.foreignRoot = root.String()
+			iface.tcErr = fmt.Errorf("foreign root qdisc %v", root)
+			logger.GlobalLogger.Errorf("Not shaping slice traffic on intf: %v, found foreign root qdisc: %v", iface.name, root)
+		}
+	}
+	ifbOwned := false
+	if s.state.ifbIface != "" {
+		tree, err := s.tcBackend().Dump(s.state.ifbIface)
+		if err == nil && rootQdisc(tree) != nil && s.state.isNetopsRootQdisc(rootQdisc(tree)) {
+			trees[s.state.ifbIface] = tree
+			ifbOwned = true
+		}
+		for _, dev := range owned {
+			// tc qdisc add dev eth0 ingress
+			err = s.tcBackend().QdiscAdd(&TcQdisc{Dev: dev, Kind: tcKindIngress, Parent: netlink.HANDLE_INGRESS, Handle: tcIngressHandle()})
+			if err != nil && !errors.Is(err, ErrTcObjectExists) {
+				return err
+			}
+		}
+	} else {
+		// The IFB device is left over from a run with ingress shaping.
+		err = s.netOpDelIfb()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Adopt the slices of the checkpoint whose classes are found on all the
+	// devices.
+	err = s.restoreSlices(cp)
+	if err != nil {
+		return err
+	}
+	devs := s.state.tcDevs()
+	keep := map[uint32]bool{}
+	for _, sliceInfo := range s.state.slices {
+		if len(devs) == 0 || (s.state.ifbIface != "" && !ifbOwned) {
+			break
+		}
+		tc := s.state.adoptedSliceTc(trees, devs, sliceInfo)
+		if tc == nil {
+			continue
+		}
+		sliceInfo.tcParentClassFqId = s.state.tcClassHandle(sliceInfo.tcParentClassId)
+		sliceInfo.tcLeafClassFqId = s.state.tcClassHandle(sliceInfo.tcParentClassId + 1)
+		sliceInfo.tcInited = true
+		sliceInfo.tc = tc
+		keep[sliceInfo.tcParentClassFqId] = true
+		keep[sliceInfo.tcLeafClassFqId] = true
+		s.adoptChildClasses(trees, devs, sliceInfo, keep)
+		logger.GlobalLogger.Infof("Adopted tc config of slice: %v, class ID: %v", sliceInfo.sliceName, tcHandleStr(sliceInfo.tcParentClassFqId))
+	}
+	if cp == nil && len(devs) != 0 && (s.state.ifbIface == "" || ifbOwned) {
+		s.adoptUnclaimedSlices(trees, devs, keep, time.Now())
+	}
+
+	// Keep the filters of the adopted slice gws and delete the other netops
+	// filters. The filters without a handle cannot be deleted on their own,
+	// the filters under the root qdisc are all flushed then. The shared
+	// ingress qdisc is not flushed, the netops filters there are deleted one
+	// by one.
+	sliceGwFilters := s.allSliceGwFilters(owned)
+	found := map[string]*TcFilter{}
+	for _, tree := range trees {
+		for _, filter := range tree.Filters {
+			if s.state.ownsFilter(filter, sliceGwFilters) {
+				found[filterKey(filter)] = filter
+			}
+		}
+	}
+	accounted := s.adoptSliceGwFilters(found, owned)
+	stray := []*TcFilter{}
+	flush := false
+	for key, filter := range found {
+		if !accounted[key] {
+			stray = append(stray, filter)
+			flush = flush || filter.Handle == 0 || filter.Prio == 0
+		}
+	}
+	if flush {
+		logger.GlobalLogger.Infof("Flushing the slice gw filters, %v of %v filters belong to the slice gws", len(accounted), len(found))
+		for dev := range trees {
+			err = s.tcBackend().FilterDel(&TcFilter{Dev: dev, Parent: s.state.tcRootHandle()})
+			if err != nil && !errors.Is(err, ErrTcObjectNotFound) {
+				return err
+			}
+		}
+		stray = []*TcFilter{}
+		for _, filter := range found {
+			if filter.Parent == tcIngressHandle() {
+				stray = append(stray, filter)
+			}
+		}
+		for _, sliceInfo := range s.state.slices {
+			for _, gwInfo := range sliceInfo.sliceGwInfo {
+				gwInfo.tcConfigured = nil
+				gwInfo.tcFilterHandles = nil
+			}
+		}
+	}
+	sort.Slice(stray, func(i, j int) bool { return stray[i].String() < stray[j].String() })
+	for _, filter := range stray {
+		err = s.tcBackend().FilterDel(filter)
+		if err != nil && !errors.Is(err, ErrTcObjectNotFound) {
+			return err
+		}
+	}
+
+	// Remove the classes not adopted, the child classes first.
+	for dev, tree := range trees {
+		classes := []*TcClass{}
+		for _, class := range tree.Classes {
+			if !keep[class.Handle] {
+				classes = append(classes, class)
+			}
+		}
+		sort.SliceStable(classes, func(i, j int) bool { return classDepth(tree, classes[i]) > classDepth(tree, classes[j]) })
+		for _, class := range classes {
+			err = s.tcBackend().ClassDel(class)
+			if err != nil && !errors.Is(err, ErrTcObjectNotFound) {
+				logger.GlobalLogger.Errorf("Failed to delete class not adopted on intf: %v, err: %v", dev, err)
+				return err
+			}
+			logger.GlobalLogger.Infof("Deleted class not adopted: %v", class)
+		}
+	}
+
+	if len(s.state.slices) == 0 && len(s.state.unclaimed) == 0 {
+		// No slices, remove the netops root qdiscs as on slice deletion.
+		for _, iface := range s.state.netIfaces {
+			if !iface.tcInited {
+				continue
+			}
+			err = s.delTcRootQdisc(iface)
+			if err != nil {
+				return err
+			}
+		}
+		return s.netOpDelIfb()
+	}
+	if s.state.ifbIface != "" && !ifbOwned {
+		err = s.netOpAddIfb()
+		if err != nil {
+			return err
+		}
+	}
+	if cp != nil {
+		s.applySlices(cp)
+	}
+	return nil
+}
+
+// adoptUnclaimedSlices keeps the slices found in the trees without a
+// checkpoint: the classes under the root qdisc whose ID is a multiple of
+// tcParentClassIdMultiple, with the leaf class and leaf qdisc of a slice under
+// them on all the devices alike. Their class IDs are reserved until a slice
+// claims them, or until the config expires, see expireUnclaimedSlices.
+func (s *NetOps) adoptUnclaimedSlices(trees map[string]*TcTree, devs []string, keep map[uint32]bool, now time.Time) {
+	ids := []uint32{}
+	for _, class := range trees[devs[0]].Classes {
+		_, id := netlink.MajorMinor(class.Handle)
+		if class.Parent == s.state.tcRootHandle() && uint32(id)%tcParentClassIdMultiple == 0 {
+			ids = append(ids, uint32(id))
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		sliceInfo := &SliceInfo{tcParentClassId: id}
+		tc := s.state.adoptedSliceTc(trees, devs, sliceInfo)
+		if tc == nil {
+			continue
+		}
+		err := s.state.classIds.reserve(sliceInfo.sliceName, id, sliceChildClasses)
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to keep the tc config of class ID: %v, err: %v", tcHandleStr(s.state.tcClassHandle(id)), err)
+			continue
+		}
+		s.state.unclaimed[id] = tc
+		keep[s.state.tcClassHandle(id)] = true
+		keep[s.state.tcClassHandle(id+1)] = true
+		s.adoptChildClasses(trees, devs, sliceInfo, keep)
+		logger.GlobalLogger.Infof("Adopted tc config of unclaimed slice, class ID: %v, tc: %v", tcHandleStr(s.state.tcClassHandle(id)), tc)
+	}
+	s.state.unclaimedExpiry = time.Time{}
+	if len(s.state.unclaimed) != 0 && s.state.unclaimedTTL != 0 {
+		s.state.unclaimedExpiry = now.Add(s.state.unclaimedTTL)
+	}
+}
+
+// expireUnclaimedSlices deletes the unclaimed tc config once its TTL is over.
+// The caller holds the state lock.
+func (s *NetOps) expireUnclaimedSlices(now time.Time) {
+	if len(s.state.unclaimed) == 0 || s.state.unclaimedExpiry.IsZero() || now.Before(s.state.unclaimedExpiry) {
+		return
+	}
+	logger.GlobalLogger.Infof("Deleting %d unclaimed tc configs, no slice claimed them in %v", len(s.state.unclaimed), s.state.unclaimedTTL)
+	err := s.deleteUnclaimedSlices()
+	if err != nil {
+		logger.GlobalLogger.Errorf("Failed to delete unclaimed tc config, err: %v", err)
+	}
+}
+
+// claimSliceTc hands the unclaimed tc config matching the QoS profile over to
+// a new slice, along with its class IDs. It returns the ID of the parent class
+// of the config claimed, 0 when none matches. The guaranteed bandwidth is not
+// set on the classes in TBF mode, so it is not compared then.
+//
+// Nothing in the kernel tells which slice a config belongs to. When several
+// configs match, the slices with the same profile could swap class IDs, so
+// none is claimed and the slice gets new class IDs.
+func (m *sliceStateManager) claimSliceTc(sliceInfo *SliceInfo, newTc *TcInfo) uint32 {
+	ids := []uint32{}
+	for id, tc := range m.unclaimed {
+		if tc.class == newTc.class && tc.bwCeiling == newTc.bwCeiling && tc.priority == newTc.priority &&
+			(tc.class == CLASS_TYPE_TBF || tc.bwGuaranteed == newTc.bwGuaranteed) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return 0
+	}
+	if len(ids) > 1 {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		logger.GlobalLogger.Infof("Not claiming tc config for slice: %v, %d configs of class IDs: %v match its QoS profile", sliceInfo.sliceName, len(ids), ids)
+		return 0
+	}
+	id := ids[0]
+	children := m.classIds.children(id)
+	m.classIds.free(id)
+	// The block was just freed, it fits.
+	_ = m.classIds.reserve(sliceInfo.sliceName, id, children)
+	delete(m.unclaimed, id)
+
+	sliceInfo.tcParentClassId = id
+	sliceInfo.tcParentClassFqId = m.tcClassHandle(id)
+	sliceInfo.tcLeafClassFqId = m.tcClassHandle(id + 1)
+	sliceInfo.tcInited = true
+	tc := *newTc
+	sliceInfo.tc = &tc
+	return id
+}
@@ -0,0 +1,488 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/kubeslice/netops/logger"
+	netops "github.com/kubeslice/netops/pkg/proto"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc"
+)
+
+// recordingTcBackend records the changes made to the tc config. The first
+// change starting with fail, when set, fails.
+type recordingTcBackend struct {
+	TcBackend
+	ops  []string
+	fail string
+}
+
+func (b *recordingTcBackend) record(op string, obj fmt.Stringer, change func() error) error {
+	if b.fail != "" && strings.HasPrefix(op+" "+obj.String(), b.fail) {
+		b.fail = ""
+		return &TcError{Op: op, Obj: obj, Err: syscall.EIO}
+	}
+	err := change()
+	b.ops = append(b.ops, op+" "+obj.String())
+	return err
+}
+
+func (b *recordingTcBackend) QdiscAdd(q *TcQdisc) error {
+	return b.record("qdisc add", q, func() error { return b.TcBackend.QdiscAdd(q) })
+}
+
+func (b *recordingTcBackend) QdiscReplace(q *TcQdisc) error {
+	return b.record("qdisc replace", q, func() error { return b.TcBackend.QdiscReplace(q) })
+}
+
+func (b *recordingTcBackend) QdiscDel(q *TcQdisc) error {
+	return b.record("qdisc del", q, func() error { return b.TcBackend.QdiscDel(q) })
+}
+
+func (b *recordingTcBackend) ClassAdd(c *TcClass) error {
+	return b.record("class add", c, func() error { return b.TcBackend.ClassAdd(c) })
+}
+
+func (b *recordingTcBackend) ClassReplace(c *TcClass) error {
+	return b.record("class replace", c, func() error { return b.TcBackend.ClassReplace(c) })
+}
+
+func (b *recordingTcBackend) ClassDel(c *TcClass) error {
+	return b.record("class del", c, func() error { return b.TcBackend.ClassDel(c) })
+}
+
+func (b *recordingTcBackend) FilterAdd(f *TcFilter) error {
+	return b.record("filter add", f, func() error { return b.TcBackend.FilterAdd(f) })
+}
+
+func (b *recordingTcBackend) FilterReplace(f *TcFilter) error {
+	return b.record("filter replace", f, func() error { return b.TcBackend.FilterReplace(f) })
+}
+
+func (b *recordingTcBackend) FilterDel(f *TcFilter) error {
+	return b.record("filter del", f, func() error { return b.TcBackend.FilterDel(f) })
+}
+
+// configureSlicesForAdoption configures slice-a, with a slice gw, and slice-b
+// over the RPCs.
+func configureSlicesForAdoption(t *testing.T, s *NetOps) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(s)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := netops.NewNetOpsServiceClient(conn)
+	_, err = client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+		SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1, DscpClass: "EF",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+		SliceName: "slice-b", SliceId: "id-b", BwCeiling: 3000, BwGuaranteed: 500, Priority: 0, ClassType: netops.ClassType_TBF,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.UpdateConnectionContext(ctx, &netops.NetOpConnectionContext{
+		SliceId:                "id-a",
+		LocalSliceGwId:         "gw-a",
+		LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_SERVER,
+		LocalSliceGwNodePorts:  []string{"30001", "30003"},
+		RemoteSliceGwNodePorts: []string{"30002", "30004"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+		SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1, DscpClass: "EF",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdoptTc(t *testing.T) {
+	root := defaultRootHandle()
+	testCases := []struct {
+		Case string
+		// Changes the tc config before the restart
+		Change     func(b TcBackend) error
+		Checkpoint bool
+		// Expected changes of the tc config, nil to skip the check
+		Ops []string
+		// The tree is the one before the restart if nil
+		TcTree []string
+	}{
+		{
+			"Testing the slices are adopted without any change",
+			nil,
+			true,
+			[]string{},
+			nil,
+		},
+		{
+			"Testing the classes and filters of another slice are removed",
+			func(b TcBackend) error {
+				err := b.ClassAdd(&TcClass{Dev: "eth0", Parent: root, Handle: defaultClassHandle(0x33), Rate: 1000, Burst: 64 * 1024})
+				if err == nil {
+					err = b.ClassAdd(&TcClass{Dev: "eth0", Parent: defaultClassHandle(0x33), Handle: defaultClassHandle(0x34), Rate: 1000, Burst: 32 * 1024})
+				}
+				if err == nil {
+					err = b.FilterAdd(&TcFilter{Dev: "eth0", Parent: root, Prio: 3, IPProto: unix.IPPROTO_UDP, DstPort: 40000, ClassId: defaultClassHandle(0x34)})
+				}
+				return err
+			},
+			true,
+			nil,
+			nil,
+		},
+		{
+			"Testing a filter with a handle is deleted on its own",
+			func(b TcBackend) error {
+				return b.FilterAdd(&TcFilter{Dev: "eth0", Parent: root, Prio: 3, Handle: 0x330001, IPProto: unix.IPPROTO_UDP, DstPort: 40000, ClassId: defaultClassHandle(0x12)})
+			},
+			true,
+			[]string{"filter del dev eth0 protocol ip parent 17: prio 3 handle 0x330001 flower ip_proto udp dst_port 40000 classid 17:12"},
+			nil,
+		},
+		{
+			"Testing a slice whose leaf qdisc is missing is rebuilt",
+			func(b TcBackend) error {
+				return b.QdiscDel(&TcQdisc{Dev: "eth0", Parent: defaultClassHandle(0x23)})
+			},
+			true,
+			nil,
+			nil,
+		},
+		{
+			"Testing the slice classes are kept and the filters removed without a checkpoint",
+			nil,
+			false,
+			nil,
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"qdisc dev eth0 parent 17:23 handle 22: tbf rate 3000kbit burst 3750 latency 50ms",
+				"class dev eth0 parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+				"class dev eth0 parent 17: classid 17:22 htb rate 3000kbit burst 65536",
+				"class dev eth0 parent 17:22 classid 17:23 htb rate 3000kbit ceil 3000kbit burst 32768",
+			},
+		},
+	}
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	t.Setenv("NETWORK_INTERFACE", "eth0")
+	for _, tt := range testCases {
+		t.Setenv("CHECKPOINT_PATH", filepath.Join(t.TempDir(), "checkpoint.json"))
+		backend := newFakeTcBackend()
+		s := NewNetOps(backend)
+		err := s.BootstrapNetOpPod()
+		if err != nil {
+			t.Fatal(err)
+		}
+		configureSlicesForAdoption(t, s)
+		before, err := backend.Dump("eth0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.Change != nil {
+			err = tt.Change(backend)
+			if err != nil {
+				t.Fatal(tt.Case, err)
+			}
+		}
+		if !tt.Checkpoint {
+			t.Setenv("CHECKPOINT_PATH", "")
+		}
+
+		recorder := &recordingTcBackend{TcBackend: backend, ops: []string{}}
+		restarted := NewNetOps(recorder)
+		err = restarted.BootstrapNetOpPod()
+		expectErrStr(t, tt.Case, err, "")
+		expected := tt.TcTree
+		if expected == nil {
+			expected = tcTreeLines(before)
+		}
+		expectTcTree(t, backend, "eth0", expected)
+		if tt.Ops != nil && len(recorder.ops) != len(tt.Ops) {
+			t.Error(tt.Case, "- Expected tc changes:", tt.Ops, " but got ", recorder.ops)
+		}
+		if tt.Checkpoint && len(restarted.state.slices) != 2 {
+			t.Error(tt.Case, "- Expected 2 slices but got ", len(restarted.state.slices))
+		}
+		if tt.Checkpoint && tt.TcTree == nil {
+			handles := s.state.slices["id-a"].sliceGwInfo["gw-a"].tcFilterHandles
+			adopted := restarted.state.slices["id-a"].sliceGwInfo["gw-a"].tcFilterHandles
+			if !reflect.DeepEqual(adopted, handles) {
+				t.Error(tt.Case, "- Expected the filter handles:", handles, " but got ", adopted)
+			}
+		}
+	}
+}
+
+func TestAdoptTcWithoutCheckpoint(t *testing.T) {
+	testCases := []struct {
+		Case string
+		// Slices synced after the restart
+		Slices []*netops.DesiredSlice
+		// Parent class IDs of the slices after the sync
+		ClassIds map[string]uint32
+		// Changes made by the sync
+		Ops []string
+	}{
+		{
+			"Testing the slices claim the tc config found for them",
+			[]*netops.DesiredSlice{
+				{QosProfile: &netops.SliceQosProfile{SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1, DscpClass: "EF"}},
+				{QosProfile: &netops.SliceQosProfile{SliceName: "slice-b", SliceId: "id-b", BwCeiling: 3000, BwGuaranteed: 500, ClassType: netops.ClassType_TBF}},
+			},
+			map[string]uint32{"id-a": 0x11, "id-b": 0x22},
+			[]string{},
+		},
+		{
+			"Testing the tc config no slice claims is deleted",
+			[]*netops.DesiredSlice{
+				{QosProfile: &netops.SliceQosProfile{SliceName: "slice-b", SliceId: "id-b", BwCeiling: 3000, BwGuaranteed: 500, ClassType: netops.ClassType_TBF}},
+			},
+			map[string]uint32{"id-b": 0x22},
+			[]string{
+				"class del dev eth0 parent 17:11 classid 17:12 htb rate 0kbit",
+				"class del dev eth0 parent 17: classid 17:11 htb rate 0kbit",
+			},
+		},
+		{
+			"Testing a slice with another QoS profile gets new classes",
+			[]*netops.DesiredSlice{
+				{QosProfile: &netops.SliceQosProfile{SliceName: "slice-c", SliceId: "id-c", BwCeiling: 2000, BwGuaranteed: 1000, Priority: 2}},
+			},
+			map[string]uint32{"id-c": 0x33},
+			[]string{
+				"class add dev eth0 parent 17: classid 17:33 htb rate 2000kbit burst 65536 prio 2",
+				"class add dev eth0 parent 17:33 classid 17:34 htb rate 1000kbit ceil 2000kbit burst 32768 prio 2",
+				"qdisc add dev eth0 parent 17:34 handle 33: sfq perturb 10",
+				"class del dev eth0 parent 17:11 classid 17:12 htb rate 0kbit",
+				"class del dev eth0 parent 17: classid 17:11 htb rate 0kbit",
+				"class del dev eth0 parent 17:22 classid 17:23 htb rate 0kbit",
+				"class del dev eth0 parent 17: classid 17:22 htb rate 0kbit",
+			},
+		},
+	}
+	for _, tt := range testCases {
+		backend := newFakeTcBackend()
+		s, _ := newTestNetOps(t, backend)
+		configureSlicesForAdoption(t, s)
+
+		recorder := &recordingTcBackend{TcBackend: backend, ops: []string{}}
+		restarted := NewNetOps(recorder)
+		err := restarted.BootstrapNetOpPod()
+		expectErrStr(t, tt.Case, err, "")
+		if len(restarted.state.slices) != 0 || len(restarted.state.unclaimed) != 2 {
+			t.Error(tt.Case, "- Expected 2 unclaimed slices but got ", len(restarted.state.unclaimed), " and slices ", len(restarted.state.slices))
+		}
+
+		recorder.ops = []string{}
+		ctx := context.Background()
+		conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(restarted)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := netops.NewNetOpsServiceClient(conn)
+		_, err = client.SyncState(ctx, &netops.SyncStateRequest{Slices: tt.Slices})
+		conn.Close()
+		expectErrStr(t, tt.Case, err, "")
+		if !reflect.DeepEqual(recorder.ops, tt.Ops) {
+			t.Error(tt.Case, "- Expected tc changes:", tt.Ops, " but got ", recorder.ops)
+		}
+		classIds := map[string]uint32{}
+		for sliceID, sliceInfo := range restarted.state.slices {
+			classIds[sliceID] = sliceInfo.tcParentClassId
+		}
+		if !reflect.DeepEqual(classIds, tt.ClassIds) {
+			t.Error(tt.Case, "- Expected class IDs:", tt.ClassIds, " but got ", classIds)
+		}
+		if len(restarted.state.unclaimed) != 0 {
+			t.Error(tt.Case, "- Expected no unclaimed slices but got ", len(restarted.state.unclaimed))
+		}
+	}
+}
+
+func TestAdoptTcForeignRoot(t *testing.T) {
+	testCases := []struct {
+		Case           string
+		ReplaceForeign string
+		TcTree         []string
+	}{
+		{
+			"Testing the foreign root qdisc is left alone",
+			"",
+			[]string{"qdisc dev eth0 root handle 1: htb default 10"},
+		},
+		{
+			"Testing the foreign root qdisc is replaced",
+			"true",
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"class dev eth0 parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+			},
+		},
+	}
+	ctx := context.Background()
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	t.Setenv("NETWORK_INTERFACE", "eth0")
+	for _, tt := range testCases {
+		t.Setenv("TC_REPLACE_FOREIGN_ROOT", tt.ReplaceForeign)
+		backend := newFakeTcBackend()
+		err := backend.QdiscAdd(&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: netlink.MakeHandle(1, 0), DefaultClass: 0x10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := NewNetOps(backend)
+		err = s.BootstrapNetOpPod()
+		expectErrStr(t, tt.Case, err, "")
+		conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(s)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := netops.NewNetOpsServiceClient(conn)
+		_, err = client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+			SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1,
+		})
+		expectErrStr(t, tt.Case, err, "")
+		expectTcTree(t, backend, "eth0", tt.TcTree)
+		conn.Close()
+	}
+}
+
+func TestGetTcBootstrapMode(t *testing.T) {
+	testCases := []struct {
+		Case   string
+		Value  string
+		Mode   tcBootstrapMode
+		ErrStr string
+	}{
+		{"Testing without the env var", "", TC_BOOTSTRAP_ADOPT, ""},
+		{"Testing the adopt mode", "adopt", TC_BOOTSTRAP_ADOPT, ""},
+		{"Testing the reset mode", "RESET", TC_BOOTSTRAP_RESET, ""},
+		{"Testing an invalid mode", "wipe", "", `invalid TC_BOOTSTRAP_MODE "wipe"`},
+	}
+	for _, tt := range testCases {
+		t.Setenv("TC_BOOTSTRAP_MODE", tt.Value)
+		mode, err := getTcBootstrapMode()
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		if mode != tt.Mode {
+			t.Error(tt.Case, "- Expected :", tt.Mode, " but got ", mode)
+		}
+	}
+}
+
+func TestClaimSliceTc(t *testing.T) {
+	testCases := []struct {
+		Case string
+		// Parent class IDs of the unclaimed tc config
+		Unclaimed []uint32
+		ClassId   uint32
+	}{
+		{"Testing the only tc config matching is claimed", []uint32{0x22}, 0x22},
+		{"Testing no tc config is claimed when several match", []uint32{0x11, 0x22}, 0},
+		{"Testing no tc config is claimed when none is found", []uint32{}, 0},
+	}
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	for _, tt := range testCases {
+		m := newSliceStateManager()
+		m.setRootHandle(defaultRootHandleId)
+		for _, id := range tt.Unclaimed {
+			err := m.classIds.reserve("", id, sliceChildClasses)
+			if err != nil {
+				t.Fatal(tt.Case, err)
+			}
+			m.unclaimed[id] = &TcInfo{class: CLASS_TYPE_HTB, bwCeiling: 5000, bwGuaranteed: 1000, priority: 1}
+		}
+		sliceInfo := &SliceInfo{sliceName: "slice-a"}
+		classId := m.claimSliceTc(sliceInfo, &TcInfo{class: CLASS_TYPE_HTB, bwCeiling: 5000, bwGuaranteed: 1000, priority: 1})
+		if classId != tt.ClassId {
+			t.Error(tt.Case, "- Expected :", tt.ClassId, " but got ", classId)
+		}
+		if classId == 0 && len(m.unclaimed) != len(tt.Unclaimed) {
+			t.Error(tt.Case, "- Expected the unclaimed tc config kept but got ", m.unclaimed)
+		}
+		if classId != 0 && m.classIds.blocks[classId].sliceName != "slice-a" {
+			t.Error(tt.Case, "- Expected the class IDs held by slice-a but got ", m.classIds.blocks[classId])
+		}
+	}
+}
+
+// TestExpireUnclaimedSlices restarts netops without a checkpoint and expects
+// the tc config no slice claims to be deleted once its TTL is over.
+func TestExpireUnclaimedSlices(t *testing.T) {
+	t.Setenv("UNCLAIMED_TC_TTL", "1m")
+	backend := newFakeTcBackend()
+	s, _ := newTestNetOps(t, backend)
+	configureSlicesForAdoption(t, s)
+
+	restarted := NewNetOps(backend)
+	err := restarted.BootstrapNetOpPod()
+	expectErrStr(t, "Testing the tc config is adopted", err, "")
+	if len(restarted.state.unclaimed) != 2 {
+		t.Fatal("Expected 2 unclaimed slices but got ", len(restarted.state.unclaimed))
+	}
+	restarted.expireUnclaimedSlices(time.Now())
+	if len(restarted.state.unclaimed) != 2 {
+		t.Error("Expected the unclaimed slices kept before the TTL but got ", len(restarted.state.unclaimed))
+	}
+	restarted.expireUnclaimedSlices(time.Now().Add(2 * time.Minute))
+	if len(restarted.state.unclaimed) != 0 || len(restarted.state.classIds.blocks) != 0 {
+		t.Error("Expected the unclaimed slices deleted after the TTL but got ", len(restarted.state.unclaimed))
+	}
+	expectTcTree(t, backend, "eth0", []string{})
+}
+
+func TestGetUnclaimedTcTTL(t *testing.T) {
+	testCases := []struct {
+		Case   string
+		Value  string
+		TTL    time.Duration
+		ErrStr string
+	}{
+		{"Testing the default TTL", "", defaultUnclaimedTcTTL, ""},
+		{"Testing a configured TTL", "30s", 30 * time.Second, ""},
+		{"Testing a zero TTL keeps the tc config", "0s", 0, ""},
+		{"Testing a negative TTL", "-1m", 0, `invalid UNCLAIMED_TC_TTL "-1m": negative TTL`},
+	}
+	for _, tt := range testCases {
+		t.Setenv("UNCLAIMED_TC_TTL", tt.Value)
+		ttl, err := getUnclaimedTcTTL()
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		if ttl != tt.TTL {
+			t.Error(tt.Case, "- Expected :", tt.TTL, " but got ", ttl)
+		}
+	}
+}
@@ -0,0 +1,458 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/kubeslice/netops/logger"
+)
+
+// File the slices are checkpointed to unless set with the CHECKPOINT_PATH env
+// var. It is on the volume the pod mounts from the node, so that it outlives
+// the pod.
+const defaultCheckpointPath = "/var/lib/kubeslice/netops/checkpoint.json"
+
+// Version of the checkpoint schema. A release changing the schema bumps it
+// and adds the migration from the previous version to checkpointMigrations.
+const checkpointVersion = 5
+
+// checkpointMigrations upgrade a checkpoint of the version they are keyed by
+// to the next version.
+var checkpointMigrations = map[int]func(cp map[string]json.RawMessage) error{
+	// Version 1 predates the choice of the root qdisc handle.
+	1: func(cp map[string]json.RawMessage) error {
+		cp["rootHandle"], _ = json.Marshal(defaultRootHandleId)
+		return nil
+	},
+	// Version 2 predates the number of child classes of the slices, they
+	// all had their leaf class only.
+	2: func(cp map[string]json.RawMessage) error {
+		raw, found := cp["slices"]
+		if !found {
+			return nil
+		}
+		slices := []map[string]json.RawMessage{}
+		err := json.Unmarshal(raw, &slices)
+		if err != nil {
+			return err
+		}
+		for _, slice := range slices {
+			slice["childClasses"], _ = json.Marshal(sliceChildClasses)
+		}
+		cp["slices"], _ = json.Marshal(slices)
+		return nil
+	},
+	// Version 3 predates the pending slice gws, they were not kept.
+	3: func(cp map[string]json.RawMessage) error {
+		return nil
+	},
+	// Version 4 predates the markers of the root qdiscs, the netops ones are
+	// told by their signature.
+	4: func(cp map[string]json.RawMessage) error {
+		return nil
+	},
+}
+
+// checkpoint is the desired state of the slices saved across the restarts of
+// netops. The tc config is derived from it on bootstrap.
+type checkpoint struct {
+	Version int `json:"version"`
+	// Major of the root qdisc the class and filter handles derive from
+	RootHandle uint32 `json:"rootHandle"`
+	// Root qdiscs netops added, the marker telling them from the root qdiscs
+	// of other components on restart. Unset in the checkpoints of older
+	// versions.
+	RootQdiscs []checkpointRootQdisc `json:"rootQdiscs"`
+	Slices     []checkpointSlice     `json:"slices"`
+	// Slice gws received before the QoS profile of their slice
+	PendingSliceGws []checkpointPendingSliceGw `json:"pendingSliceGws,omitempty"`
+}
+
+type checkpointSlice struct {
+	SliceID   string `json:"sliceId"`
+	SliceName string `json:"sliceName"`
+	ClassID   uint32 `json:"classId"`
+	// Number of child classes following the parent class
+	ChildClasses uint32                `json:"childClasses"`
+	QosProfile   *checkpointQosProfile `json:"qosProfile,omitempty"`
+	SliceGws     []checkpointSliceGw   `json:"sliceGws,omitempty"`
+}
+
+type checkpointQosProfile struct {
+	Name         string `json:"name,omitempty"`
+	ClassType    string `json:"classType"`
+	BwCeiling    uint32 `json:"bwCeiling"`
+	BwGuaranteed uint32 `json:"bwGuaranteed"`
+	Priority     uint32 `json:"priority"`
+	DscpClass    string `json:"dscpClass,omitempty"`
+}
+
+type checkpointSliceGw struct {
+	SliceGwID    string   `json:"sliceGwId"`
+	GwType       string   `json:"gwType"`
+	Protocol     string   `json:"protocol,omitempty"`
+	LocalPorts   []string `json:"localPorts"`
+	RemotePorts  []string `json:"remotePorts"`
+	RemoteNodeIP string   `json:"remoteNodeIP,omitempty"`
+}
+
+type checkpointPendingSliceGw struct {
+	SliceID string            `json:"sliceId"`
+	SliceGw checkpointSliceGw `json:"sliceGw"`
+	// Time the slice gw is dropped at, unset to keep it until the slice
+	// shows up
+	Expiry *time.Time `json:"expiry,omitempty"`
+}
+
+type checkpointRootQdisc struct {
+	Dev          string `json:"dev"`
+	Kind         string `json:"kind"`
+	Handle       uint32 `json:"handle"`
+	DefaultClass uint32 `json:"defaultClass"`
+}
+
+// matches reports whether the root qdisc is the one of the marker.
+func (marker *checkpointRootQdisc) matches(qdisc *TcQdisc) bool {
+	return qdisc.Dev == marker.Dev && qdisc.Kind == marker.Kind && qdisc.Handle == marker.Handle && qdisc.DefaultClass == marker.DefaultClass
+}
+
+// getCheckpointPath returns the file the slices are checkpointed to, set by
+// the CHECKPOINT_PATH env var. Setting it empty disables checkpointing.
+func getCheckpointPath() string {
+	path, found := os.LookupEnv("CHECKPOINT_PATH")
+	if !found {
+		return defaultCheckpointPath
+	}
+	return path
+}
+
+// newCheckpointSliceGw returns the checkpoint of a slice gw.
+func newCheckpointSliceGw(gwInfo *SliceGwInfo) checkpointSliceGw {
+	return checkpointSliceGw{
+		SliceGwID:    gwInfo.sliceGwId,
+		GwType:       string(gwInfo.gwType),
+		Protocol:     string(gwInfo.protocol),
+		LocalPorts:   gwInfo.localPorts,
+		RemotePorts:  gwInfo.remotePorts,
+		RemoteNodeIP: gwInfo.remoteNodeIP,
+	}
+}
+
+// sliceGwInfo returns the slice gw of the checkpoint without any tc config.
+func (gw *checkpointSliceGw) sliceGwInfo() *SliceGwInfo {
+	return &SliceGwInfo{
+		sliceGwId:    gw.SliceGwID,
+		gwType:       sliceGwType(gw.GwType),
+		protocol:     sliceGwProtocol(gw.Protocol),
+		localPorts:   gw.LocalPorts,
+		remotePorts:  gw.RemotePorts,
+		remoteNodeIP: gw.RemoteNodeIP,
+	}
+}
+
+// newCheckpoint returns the checkpoint of the slice state: the slices ordered
+// by class ID, with the number of their child classes, the pending slice gws
+// ordered by slice and slice gw ID, and the markers of the root qdiscs on the
+// interfaces the tc tree is built on.
+func newCheckpoint(m *sliceStateManager) *checkpoint {
+	cp := &checkpoint{Version: checkpointVersion, RootHandle: m.rootHandleId, Slices: []checkpointSlice{}, RootQdiscs: []checkpointRootQdisc{}}
+	for _, iface := range m.netIfaces {
+		if iface.tcInited && iface.foreignRoot == "" {
+			cp.RootQdiscs = append(cp.RootQdiscs, checkpointRootQdisc{Dev: iface.name, Kind: tcKindHtb, Handle: m.tcRootHandle(), DefaultClass: htbDefaultClassId})
+		}
+	}
+	for sliceID, sliceInfo := range m.slices {
+		cs := checkpointSlice{
+			SliceID:   sliceID,
+			SliceName: sliceInfo.sliceName,
+			ClassID:   sliceInfo.tcParentClassId,
+		}
+		cs.ChildClasses = m.classIds.children(sliceInfo.tcParentClassId)
+		if p := sliceInfo.qosProfile; p != nil {
+			cs.QosProfile = &checkpointQosProfile{
+				Name:         p.name,
+				ClassType:    string(p.class),
+				BwCeiling:    p.bwCeiling,
+				BwGuaranteed: p.bwGuaranteed,
+				Priority:     p.priority,
+				DscpClass:    p.dscpClass,
+			}
+		}
+		for _, gwInfo := range sliceInfo.sliceGwInfo {
+			cs.SliceGws = append(cs.SliceGws, newCheckpointSliceGw(gwInfo))
+		}
+		sort.Slice(cs.SliceGws, func(i, j int) bool { return cs.SliceGws[i].SliceGwID < cs.SliceGws[j].SliceGwID })
+		cp.Slices = append(cp.Slices, cs)
+	}
+	sort.Slice(cp.Slices, func(i, j int) bool { return cp.Slices[i].ClassID < cp.Slices[j].ClassID })
+	for sliceID, gws := range m.pendingGws {
+		for _, pending := range gws {
+			cpg := checkpointPendingSliceGw{SliceID: sliceID, SliceGw: newCheckpointSliceGw(pending.gwInfo)}
+			if !pending.expiry.IsZero() {
+				expiry := pending.expiry
+				cpg.Expiry = &expiry
+			}
+			cp.PendingSliceGws = append(cp.PendingSliceGws, cpg)
+		}
+	}
+	sort.Slice(cp.PendingSliceGws, func(i, j int) bool {
+		a, b := cp.PendingSliceGws[i], cp.PendingSliceGws[j]
+		return a.SliceID < b.SliceID || (a.SliceID == b.SliceID && a.SliceGw.SliceGwID < b.SliceGw.SliceGwID)
+	})
+	return cp
+}
+
+// childClasses returns the number of child classes of the slice. A slice has
+// its leaf class at least.
+func (cs *checkpointSlice) childClasses() uint32 {
+	if cs.ChildClasses < sliceChildClasses {
+		return sliceChildClasses
+	}
+	return cs.ChildClasses
+}
+
+// sliceInfo returns the slice of the checkpoint without any tc config.
+func (cs *checkpointSlice) sliceInfo() *SliceInfo {
+	sliceInfo := &SliceInfo{
+		sliceName:       cs.SliceName,
+		tcParentClassId: cs.ClassID,
+		sliceGwInfo:     make(map[string]*SliceGwInfo),
+	}
+	if p := cs.QosProfile; p != nil {
+		sliceInfo.qosProfile = &SliceQosProfile{
+			name:         p.Name,
+			class:        classType(p.ClassType),
+			bwCeiling:    p.BwCeiling,
+			bwGuaranteed: p.BwGuaranteed,
+			priority:     p.Priority,
+			dscpClass:    p.DscpClass,
+		}
+	}
+	for i := range cs.SliceGws {
+		sliceInfo.sliceGwInfo[cs.SliceGws[i].SliceGwID] = cs.SliceGws[i].sliceGwInfo()
+	}
+	return sliceInfo
+}
+
+// parseCheckpoint decodes a checkpoint, migrating it from an older version.
+func parseCheckpoint(data []byte) (*checkpoint, error) {
+	raw := map[string]json.RawMessage{}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint: %v", err)
+	}
+	version := 0
+	if v, found := raw["version"]; found {
+		err = json.Unmarshal(v, &version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid checkpoint version: %v", err)
+		}
+	}
+	if version > checkpointVersion {
+		return nil, fmt.Errorf("checkpoint version %d is newer than the supported version %d", version, checkpointVersion)
+	}
+	for ; version < checkpointVersion; version++ {
+		migrate, found := checkpointMigrations[version]
+		if !found {
+			return nil, fmt.Errorf("no migration from checkpoint version %d", version)
+		}
+		err = migrate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate checkpoint from version %d: %v", version, err)
+		}
+	}
+	raw["version"], _ = json.Marshal(checkpointVersion)
+	data, err = json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	cp := &checkpoint{}
+	err = json.Unmarshal(data, cp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint: %v", err)
+	}
+	return cp, nil
+}
+
+// loadCheckpoint reads the checkpoint from the file. It returns nil when
+// there is no checkpoint yet.
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseCheckpoint(data)
+}
+
+// writeCheckpoint replaces the checkpoint file atomically, a crash leaves
+// either the old or the new checkpoint behind.
+func writeCheckpoint(path string, cp *checkpoint) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		return err
+	}
+	// Persist the rename too.
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// saveCheckpoint checkpoints the state of the slices when a checkpoint file
+// is configured. The caller holds the state lock.
+func (s *NetOps) saveCheckpoint() {
+	if s.state.checkpointPath == "" {
+		return
+	}
+	err := writeCheckpoint(s.state.checkpointPath, newCheckpoint(s.state))
+	if err != nil {
+		logger.GlobalLogger.Errorf("Failed to save checkpoint to %v, err: %v", s.state.checkpointPath, err)
+	}
+}
+
+// loadSliceCheckpoint reads the checkpoint of the slices. It returns nil
+// when checkpointing is disabled or there is no checkpoint yet.
+func (s *NetOps) loadSliceCheckpoint() (*checkpoint, error) {
+	if s.state.checkpointPath == "" {
+		return nil, nil
+	}
+	cp, err := loadCheckpoint(s.state.checkpointPath)
+	if err != nil {
+		logger.GlobalLogger.Errorf("Failed to load checkpoint from %v, err: %v", s.state.checkpointPath, err)
+		return nil, err
+	}
+	return cp, nil
+}
+
+// restoreCheckpoint restores the slices from the checkpoint and applies their
+// tc config on a node without netops tc config.
+func (s *NetOps) restoreCheckpoint(cp *checkpoint) error {
+	if cp == nil || len(cp.Slices) == 0 {
+		return nil
+	}
+
+	err := s.netOpAddTcRootQdisc()
+	if err != nil {
+		return err
+	}
+	err = s.restoreSlices(cp)
+	if err != nil {
+		return err
+	}
+
+	s.applySlices(cp)
+	return nil
+}
+
+// restoreSlices adds the slices of the checkpoint to the state, without any
+// tc config. A slice whose class IDs hold the major of a root qdisc
+// configured since the checkpoint gets new class IDs, its tc config is
+// applied again.
+func (s *NetOps) restoreSlices(cp *checkpoint) error {
+	if cp == nil {
+		return nil
+	}
+	remap := []*checkpointSlice{}
+	for i := range cp.Slices {
+		cs := &cp.Slices[i]
+		if s.state.classIds.holdsReserved(cs.ClassID, cs.childClasses()) {
+			remap = append(remap, cs)
+			continue
+		}
+		err := s.state.classIds.reserve(cs.SliceName, cs.ClassID, cs.childClasses())
+		if err != nil {
+			return fmt.Errorf("invalid checkpoint: %v", err)
+		}
+		s.state.slices[cs.SliceID] = cs.sliceInfo()
+	}
+	// The class IDs are reassigned once the others are reserved.
+	for _, cs := range remap {
+		classId, err := s.state.classIds.alloc(cs.SliceName, cs.childClasses())
+		if err != nil {
+			return fmt.Errorf("failed to reassign the class ID %#x of slice: %v, err: %v", cs.ClassID, cs.SliceName, err)
+		}
+		logger.GlobalLogger.Infof("Class ID %#x of slice: %v collides with root qdisc handle %v, using %#x instead",
+			cs.ClassID, cs.SliceName, tcHandleStr(s.state.tcRootHandle()), classId)
+		cs.ClassID = classId
+		s.state.slices[cs.SliceID] = cs.sliceInfo()
+	}
+	return nil
+}
+
+// applySlices applies the tc config of the restored slices. The config
+// already in place is left alone. A slice that fails to apply is kept with
+// the error, it does not fail the bootstrap: the next update of the slice
+// retries it.
+func (s *NetOps) applySlices(cp *checkpoint) {
+	for _, cs := range cp.Slices {
+		var err error
+		sliceInfo := s.state.slices[cs.SliceID]
+		for _, gw := range cs.SliceGws {
+			err = s.addNetIfaceForRemoteNode(gw.RemoteNodeIP)
+			if err != nil {
+				sliceInfo.tcErr = err
+				break
+			}
+		}
+		if err == nil && sliceInfo.qosProfile != nil {
+			// The error of the slice is recorded by enforceSliceQosPolicy.
+			err = s.enforceSliceQosPolicy(cs.SliceID, cs.SliceName, sliceInfo.qosProfile)
+		}
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to restore slice: %v, err: %v", cs.SliceName, err)
+			continue
+		}
+		logger.GlobalLogger.Infof("Restored slice: %v, class ID: %v", cs.SliceName, cs.ClassID)
+	}
+}
@@ -0,0 +1,273 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kubeslice/netops/logger"
+	netops "github.com/kubeslice/netops/pkg/proto"
+	"google.golang.org/grpc"
+)
+
+func TestParseCheckpoint(t *testing.T) {
+	expiry := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	testCases := []struct {
+		Case     string
+		Data     string
+		Expected *checkpoint
+		ErrStr   string
+	}{
+		{
+			"Testing the current version",
+			`{"version": 5, "rootHandle": 24, "rootQdiscs": [{"dev": "eth0", "kind": "htb", "handle": 1572864, "defaultClass": 48}], "slices": [{"sliceId": "id-a", "sliceName": "slice-a", "classId": 17, "childClasses": 2}]}`,
+			&checkpoint{Version: 5, RootHandle: 0x18, RootQdiscs: []checkpointRootQdisc{{Dev: "eth0", Kind: "htb", Handle: 0x180000, DefaultClass: 0x30}}, Slices: []checkpointSlice{{SliceID: "id-a", SliceName: "slice-a", ClassID: 0x11, ChildClasses: 2}}},
+			"",
+		},
+		{
+			"Testing the pending slice gws",
+			`{"version": 5, "rootHandle": 24, "slices": [], "pendingSliceGws": [{"sliceId": "id-b", "sliceGw": {"sliceGwId": "gw-b", "gwType": "SLICE_GW_SERVER", "localPorts": ["30001"], "remotePorts": ["30002"]}, "expiry": "2026-01-02T03:04:05Z"}]}`,
+			&checkpoint{Version: 5, RootHandle: 0x18, Slices: []checkpointSlice{}, PendingSliceGws: []checkpointPendingSliceGw{
+				{SliceID: "id-b", SliceGw: checkpointSliceGw{SliceGwID: "gw-b", GwType: "SLICE_GW_SERVER", LocalPorts: []string{"30001"}, RemotePorts: []string{"30002"}}, Expiry: &expiry},
+			}},
+			"",
+		},
+		{
+			"Testing a version without the markers of the root qdiscs",
+			`{"version": 4, "rootHandle": 24, "slices": [{"sliceId": "id-a", "sliceName": "slice-a", "classId": 17, "childClasses": 2}]}`,
+			&checkpoint{Version: 5, RootHandle: 0x18, Slices: []checkpointSlice{{SliceID: "id-a", SliceName: "slice-a", ClassID: 0x11, ChildClasses: 2}}},
+			"",
+		},
+		{
+			"Testing a version without the pending slice gws",
+			`{"version": 3, "rootHandle": 24, "slices": [{"sliceId": "id-a", "sliceName": "slice-a", "classId": 17, "childClasses": 2}]}`,
+			&checkpoint{Version: 5, RootHandle: 0x18, Slices: []checkpointSlice{{SliceID: "id-a", SliceName: "slice-a", ClassID: 0x11, ChildClasses: 2}}},
+			"",
+		},
+		{
+			"Testing a version without the child classes",
+			`{"version": 2, "rootHandle": 24, "slices": [{"sliceId": "id-a", "sliceName": "slice-a", "classId": 17}]}`,
+			&checkpoint{Version: 5, RootHandle: 0x18, Slices: []checkpointSlice{{SliceID: "id-a", SliceName: "slice-a", ClassID: 0x11, ChildClasses: 1}}},
+			"",
+		},
+		{
+			"Testing a version without the root handle",
+			`{"version": 1, "slices": [{"sliceId": "id-a", "sliceName": "slice-a", "classId": 17}]}`,
+			&checkpoint{Version: 5, RootHandle: 0x17, Slices: []checkpointSlice{{SliceID: "id-a", SliceName: "slice-a", ClassID: 0x11, ChildClasses: 1}}},
+			"",
+		},
+		{
+			"Testing a version without a migration",
+			`{"slices": []}`,
+			nil,
+			"no migration from checkpoint version 0",
+		},
+		{
+			"Testing a newer version",
+			`{"version": 6, "slices": []}`,
+			nil,
+			"checkpoint version 6 is newer than the supported version 5",
+		},
+		{
+			"Testing invalid JSON",
+			`{"version": 5,`,
+			nil,
+			"invalid checkpoint: unexpected end of JSON input",
+		},
+	}
+	for _, tt := range testCases {
+		cp, err := parseCheckpoint([]byte(tt.Data))
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		if !reflect.DeepEqual(cp, tt.Expected) {
+			t.Error(tt.Case, "- Expected :", tt.Expected, " but got ", cp)
+		}
+	}
+}
+
+func TestParseCheckpointMigration(t *testing.T) {
+	// A version 0 checkpoint named the slices "names" instead of "slices".
+	checkpointMigrations[0] = func(cp map[string]json.RawMessage) error {
+		cp["slices"] = cp["names"]
+		delete(cp, "names")
+		return nil
+	}
+	t.Cleanup(func() { delete(checkpointMigrations, 0) })
+
+	cp, err := parseCheckpoint([]byte(`{"names": [{"sliceId": "id-a", "sliceName": "slice-a", "classId": 17}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &checkpoint{Version: 5, RootHandle: 0x17, Slices: []checkpointSlice{{SliceID: "id-a", SliceName: "slice-a", ClassID: 0x11, ChildClasses: 1}}}
+	if !reflect.DeepEqual(cp, expected) {
+		t.Error("Expected :", expected, " but got ", cp)
+	}
+}
+
+func TestWriteCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netops", "checkpoint.json")
+	for _, cp := range []*checkpoint{
+		{Version: 5, RootHandle: 0x17, RootQdiscs: []checkpointRootQdisc{{Dev: "eth0", Kind: "htb", Handle: 0x170000, DefaultClass: 0x30}}, Slices: []checkpointSlice{{SliceID: "id-a", SliceName: "slice-a", ClassID: 0x11, ChildClasses: 1}}},
+		{Version: 5, RootHandle: 0x18, RootQdiscs: []checkpointRootQdisc{}, Slices: []checkpointSlice{}},
+	} {
+		err := writeCheckpoint(path, cp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := loadCheckpoint(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(loaded, cp) {
+			t.Error("Expected :", cp, " but got ", loaded)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Error("Expected only the checkpoint file but got ", len(entries), " files")
+	}
+
+	cp, err := loadCheckpoint(filepath.Join(t.TempDir(), "missing.json"))
+	if cp != nil || err != nil {
+		t.Error("Expected no checkpoint and no error but got ", cp, err)
+	}
+}
+
+// TestCheckpointRestore restarts netops on a clean node and expects the tc
+// tree of the slices to be restored from the checkpoint.
+func TestCheckpointRestore(t *testing.T) {
+	ctx := context.Background()
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	t.Setenv("NETWORK_INTERFACE", "eth0")
+	t.Setenv("CHECKPOINT_PATH", filepath.Join(t.TempDir(), "checkpoint.json"))
+
+	s := NewNetOps(newFakeTcBackend())
+	err := s.BootstrapNetOpPod()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(s)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := netops.NewNetOpsServiceClient(conn)
+	for _, profile := range []*netops.SliceQosProfile{
+		{SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1, DscpClass: "EF"},
+		{SliceName: "slice-b", SliceId: "id-b", BwCeiling: 3000, BwGuaranteed: 500, Priority: 2, ClassType: netops.ClassType_TBF},
+	} {
+		_, err = client.UpdateSliceQosProfile(ctx, profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = client.UpdateConnectionContext(ctx, &netops.NetOpConnectionContext{
+		SliceId:                "id-a",
+		LocalSliceGwId:         "gw-a",
+		LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_CLIENT,
+		LocalSliceGwNodePorts:  []string{"30001"},
+		RemoteSliceGwNodePorts: []string{"30002"},
+		RemoteSliceGwNodeIP:    "10.0.0.2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Update the profile of slice-a to add the filters of its gw.
+	_, err = client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+		SliceName: "slice-a", SliceId: "id-a", BwCeiling: 8000, BwGuaranteed: 1000, Priority: 1, DscpClass: "EF",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := s.tc.Dump("eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewNetOps(newFakeTcBackend())
+	err = restarted.BootstrapNetOpPod()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectTcTree(t, restarted.tc, "eth0", tcTreeLines(before))
+	if !reflect.DeepEqual(restarted.state.classIds, s.state.classIds) {
+		t.Error("Expected class IDs:", s.state.classIds, " but got ", restarted.state.classIds)
+	}
+	if !reflect.DeepEqual(newCheckpoint(restarted.state), newCheckpoint(s.state)) {
+		t.Error("Expected slices:", newCheckpoint(s.state), " but got ", newCheckpoint(restarted.state))
+	}
+
+	// The checkpoint follows the deletion of the slices.
+	_, err = client.UpdateSliceLifeCycleEvent(ctx, &netops.SliceLifeCycleEvent{SliceName: "slice-a", Event: netops.EventType_EV_DELETE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err := loadCheckpoint(os.Getenv("CHECKPOINT_PATH"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cp.Slices) != 1 || cp.Slices[0].SliceName != "slice-b" {
+		t.Error("Expected only slice-b in the checkpoint but got ", cp.Slices)
+	}
+}
+
+// TestCheckpointRestoreFailure restores a checkpoint with a slice failing to
+// apply and expects the bootstrap to succeed with the error in the status of
+// the slice, and not to run again.
+func TestCheckpointRestoreFailure(t *testing.T) {
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	t.Setenv("NETWORK_INTERFACE", "eth0")
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	t.Setenv("CHECKPOINT_PATH", path)
+	err := writeCheckpoint(path, &checkpoint{Version: checkpointVersion, RootHandle: 0x17, Slices: []checkpointSlice{
+		{SliceID: "id-a", SliceName: "slice-a", ClassID: 0x11, QosProfile: &checkpointQosProfile{ClassType: "HTB", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1}},
+		{SliceID: "id-b", SliceName: "slice-b", ClassID: 0x22, QosProfile: &checkpointQosProfile{ClassType: "HTB", BwCeiling: 3000, BwGuaranteed: 500, Priority: 2}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &recordingTcBackend{TcBackend: newFakeTcBackend(), ops: []string{}, fail: "class add dev eth0 parent 17: classid 17:22"}
+	s := NewNetOps(recorder)
+	err = s.BootstrapNetOpPod()
+	expectErrStr(t, "Testing the bootstrap succeeds", err, "")
+	expectErrStr(t, "Testing the pod is ready", s.health.readyErr(), "")
+	if s.state.slices["id-a"].tcErr != nil || !s.state.slices["id-a"].tcInited {
+		t.Error("Expected slice-a restored but got ", s.state.slices["id-a"].tcErr)
+	}
+	expectErrStr(t, "Testing the error of slice-b is recorded", s.state.slices["id-b"].tcErr,
+		"tc class add dev eth0 parent 17: classid 17:22 htb rate 3000kbit burst 65536 prio 2 failed: input/output error, rolled back 0 tc changes")
+
+	// The bootstrap does not run again once the pod is ready.
+	recorder.ops = []string{}
+	err = s.BootstrapNetOpPod()
+	expectErrStr(t, "Testing the bootstrap is not run again", err, "")
+	if len(recorder.ops) != 0 {
+		t.Error("Expected no tc change but got ", recorder.ops)
+	}
+	if _, found := s.state.slices["id-b"]; !found {
+		t.Error("Expected slice-b kept")
+	}
+}
@@ -0,0 +1,190 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Range of the class IDs handed out to the slices. The HTB minor of a class
+// is 16 bits, 0 is the qdisc itself and 0xffff is the major of the ingress
+// qdisc.
+const (
+	minClassId uint32 = 0x1
+	maxClassId uint32 = 0xfffe
+)
+
+// Number of child classes of a new slice: its leaf class. A slice adopted
+// with more child classes keeps them, their number is checkpointed.
+const sliceChildClasses uint32 = 1
+
+// classIdBlock is the class IDs of a slice: its parent class followed by its
+// child classes.
+type classIdBlock struct {
+	sliceName string
+	children  uint32
+}
+
+// classIdAllocator hands out the class IDs of the slices. A slice gets a
+// block of consecutive IDs, the ID of its parent class first. The ID of the
+// parent class is also the major of the leaf qdisc and of the filter handles
+// of the slice, so the blocks never overlap.
+//
+// The blocks start at multiples of tcParentClassIdMultiple while there is
+// room, leaving the slices room for more child classes. They are packed in
+// the gaps between them once the multiples are used up.
+type classIdAllocator struct {
+	// Blocks keyed by the ID of the parent class
+	blocks map[uint32]*classIdBlock
+	// Parent class ID of the block holding each ID in use
+	used map[uint32]uint32
+	// Major of the root qdisc
+	rootHandleId uint32
+}
+
+func newClassIdAllocator(rootHandleId uint32) *classIdAllocator {
+	return &classIdAllocator{
+		blocks:       make(map[uint32]*classIdBlock),
+		used:         make(map[uint32]uint32),
+		rootHandleId: rootHandleId,
+	}
+}
+
+// reserved reports whether the ID is kept out of the blocks. The root qdisc
+// major would clash with a leaf qdisc and the default class is the one of the
+// unclassified traffic.
+func (a *classIdAllocator) reserved(id uint32) bool {
+	return id == a.rootHandleId || id == htbDefaultClassId
+}
+
+// holdsReserved reports whether the block of IDs holds a reserved ID.
+func (a *classIdAllocator) holdsReserved(first uint32, children uint32) bool {
+	for id := first; id <= first+children; id++ {
+		if a.reserved(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// fits reports whether the block of IDs is free.
+func (a *classIdAllocator) fits(first uint32, children uint32) bool {
+	if first < minClassId || first+children > maxClassId {
+		return false
+	}
+	for id := first; id <= first+children; id++ {
+		if _, found := a.used[id]; found || a.reserved(id) {
+			return false
+		}
+	}
+	return true
+}
+
+// alloc hands out a block of IDs to the slice and returns the ID of its
+// parent class.
+func (a *classIdAllocator) alloc(sliceName string, children uint32) (uint32, error) {
+	for first := tcParentClassIdMultiple; first+children <= maxClassId; first += tcParentClassIdMultiple {
+		if a.fits(first, children) {
+			a.take(sliceName, first, children)
+			return first, nil
+		}
+	}
+	for first := minClassId; first+children <= maxClassId; first++ {
+		if a.fits(first, children) {
+			a.take(sliceName, first, children)
+			return first, nil
+		}
+	}
+
+	return 0, errors.New("could not find a free class ID")
+}
+
+// reserve takes the block of IDs of a slice already configured.
+func (a *classIdAllocator) reserve(sliceName string, first uint32, children uint32) error {
+	if !a.fits(first, children) {
+		return fmt.Errorf("class IDs %#x to %#x of slice: %v are not free", first, first+children, sliceName)
+	}
+	a.take(sliceName, first, children)
+	return nil
+}
+
+func (a *classIdAllocator) take(sliceName string, first uint32, children uint32) {
+	a.blocks[first] = &classIdBlock{sliceName: sliceName, children: children}
+	for id := first; id <= first+children; id++ {
+		a.used[id] = first
+	}
+}
+
+// resize changes the number of child classes of the block. The block is left
+// as is when the IDs it grows to are not free.
+func (a *classIdAllocator) resize(first uint32, children uint32) error {
+	block, found := a.blocks[first]
+	if !found {
+		return fmt.Errorf("no slice with class ID %#x", first)
+	}
+	a.free(first)
+	err := a.reserve(block.sliceName, first, children)
+	if err != nil {
+		a.take(block.sliceName, first, block.children)
+	}
+	return err
+}
+
+// free releases the block of IDs. The IDs are handed out again once the tc
+// config of the slice is deleted.
+func (a *classIdAllocator) free(first uint32) {
+	block, found := a.blocks[first]
+	if !found {
+		return
+	}
+	for id := first; id <= first+block.children; id++ {
+		delete(a.used, id)
+	}
+	delete(a.blocks, first)
+}
+
+// children returns the number of child classes of the block.
+func (a *classIdAllocator) children(first uint32) uint32 {
+	if block, found := a.blocks[first]; found {
+		return block.children
+	}
+	return 0
+}
+
+// copy returns a copy of the allocator for the snapshot of a transaction.
+func (a *classIdAllocator) copy() *classIdAllocator {
+	c := newClassIdAllocator(a.rootHandleId)
+	for first, block := range a.blocks {
+		c.take(block.sliceName, first, block.children)
+	}
+	return c
+}
+
+// childClassesInTree returns the number of consecutive child classes found
+// under the parent class in the tree.
+func (m *sliceStateManager) childClassesInTree(tree *TcTree, first uint32) uint32 {
+	var children uint32
+	for id := first + 1; id <= maxClassId; id++ {
+		if classOf(tree, m.tcClassHandle(first), m.tcClassHandle(id)) == nil {
+			break
+		}
+		children++
+	}
+	return children
+}
@@ -0,0 +1,214 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kubeslice/netops/logger"
+	netops "github.com/kubeslice/netops/pkg/proto"
+)
+
+func TestClassIdAllocator(t *testing.T) {
+	testCases := []struct {
+		Case string
+		// Changes the allocator before the allocation
+		Setup    func(a *classIdAllocator) error
+		Children uint32
+		ClassId  uint32
+		ErrStr   string
+	}{
+		{
+			"Testing the first slice gets the first multiple",
+			nil,
+			sliceChildClasses,
+			0x11,
+			"",
+		},
+		{
+			"Testing the next slice gets the next multiple",
+			func(a *classIdAllocator) error {
+				_, err := a.alloc("slice-a", sliceChildClasses)
+				return err
+			},
+			sliceChildClasses,
+			0x22,
+			"",
+		},
+		{
+			"Testing the IDs of a freed slice are handed out again",
+			func(a *classIdAllocator) error {
+				first, err := a.alloc("slice-a", sliceChildClasses)
+				if err == nil {
+					_, err = a.alloc("slice-b", sliceChildClasses)
+				}
+				a.free(first)
+				return err
+			},
+			sliceChildClasses,
+			0x11,
+			"",
+		},
+		{
+			"Testing the root handle and the default class are skipped",
+			nil,
+			16,
+			0x33,
+			"",
+		},
+		{
+			"Testing the slices are packed once the multiples are used up",
+			func(a *classIdAllocator) error {
+				for first := tcParentClassIdMultiple; first+sliceChildClasses <= maxClassId; first += tcParentClassIdMultiple {
+					err := a.reserve("slice", first, sliceChildClasses)
+					if err != nil {
+						return err
+					}
+				}
+				return a.reserve("slice-a", 0x1, sliceChildClasses)
+			},
+			sliceChildClasses,
+			0x3,
+			"",
+		},
+		{
+			"Testing a slice does not fit in the IDs left",
+			nil,
+			maxClassId,
+			0,
+			"could not find a free class ID",
+		},
+	}
+	for _, tt := range testCases {
+		a := newClassIdAllocator(defaultRootHandleId)
+		if tt.Setup != nil {
+			err := tt.Setup(a)
+			if err != nil {
+				t.Fatal(tt.Case, err)
+			}
+		}
+		classId, err := a.alloc("slice-x", tt.Children)
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		if classId != tt.ClassId {
+			t.Error(tt.Case, "- Expected :", tt.ClassId, " but got ", classId)
+		}
+		if err == nil && a.children(classId) != tt.Children {
+			t.Error(tt.Case, "- Expected ", tt.Children, " child classes but got ", a.children(classId))
+		}
+	}
+}
+
+func TestReserveClassIds(t *testing.T) {
+	testCases := []struct {
+		Case     string
+		First    uint32
+		Children uint32
+		ErrStr   string
+	}{
+		{"Testing the IDs of a slice are reserved", 0x33, 2, ""},
+		{"Testing the IDs of another slice are not reserved", 0x12, 1, "class IDs 0x12 to 0x13 of slice: slice-b are not free"},
+		{"Testing the IDs overlapping another slice are not reserved", 0x5, 0xc, "class IDs 0x5 to 0x11 of slice: slice-b are not free"},
+		{"Testing the default class is not reserved", 0x2f, 1, "class IDs 0x2f to 0x30 of slice: slice-b are not free"},
+		{"Testing the IDs past the HTB minors are not reserved", 0xfffe, 1, "class IDs 0xfffe to 0xffff of slice: slice-b are not free"},
+	}
+	for _, tt := range testCases {
+		a := newClassIdAllocator(defaultRootHandleId)
+		err := a.reserve("slice-a", 0x11, 2)
+		if err != nil {
+			t.Fatal(tt.Case, err)
+		}
+		err = a.reserve("slice-b", tt.First, tt.Children)
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+
+		// The slice grows into the IDs of another slice.
+		err = a.resize(0x11, 0x30)
+		expectErrStr(t, tt.Case, err, "class IDs 0x11 to 0x41 of slice: slice-a are not free")
+		if a.children(0x11) != 2 {
+			t.Error(tt.Case, "- Expected 2 child classes after a failed resize but got ", a.children(0x11))
+		}
+	}
+}
+
+func TestAdoptChildClasses(t *testing.T) {
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	t.Setenv("NETWORK_INTERFACE", "eth0")
+	t.Setenv("CHECKPOINT_PATH", filepath.Join(t.TempDir(), "checkpoint.json"))
+	backend := newFakeTcBackend()
+	s := NewNetOps(backend)
+	err := s.BootstrapNetOpPod()
+	if err != nil {
+		t.Fatal(err)
+	}
+	configureSlicesForAdoption(t, s)
+	// A second child class of slice-a
+	child := &TcClass{Dev: "eth0", Parent: defaultClassHandle(0x11), Handle: defaultClassHandle(0x13), Rate: 1000, Burst: 32 * 1024}
+	err = backend.ClassAdd(child)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewNetOps(backend)
+	err = restarted.BootstrapNetOpPod()
+	expectErrStr(t, "Testing the child classes are adopted", err, "")
+	if children := restarted.state.classIds.children(0x11); children != 2 {
+		t.Error("Expected 2 child classes of slice-a but got ", children)
+	}
+	tree, err := backend.Dump("eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(tcTreeLines(tree), "\n"), "class "+child.String()) {
+		t.Error("Expected the child class to be kept but got ", tcTreeLines(tree))
+	}
+
+	// The number of child classes is checkpointed and restored on a clean
+	// node.
+	cp, err := loadCheckpoint(os.Getenv("CHECKPOINT_PATH"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cp.Slices) == 0 || cp.Slices[0].ChildClasses != 2 {
+		t.Error("Expected 2 child classes of slice-a in the checkpoint but got ", cp.Slices)
+	}
+	t.Setenv("TC_BOOTSTRAP_MODE", string(TC_BOOTSTRAP_RESET))
+	reset := NewNetOps(newFakeTcBackend())
+	err = reset.BootstrapNetOpPod()
+	expectErrStr(t, "Testing the slices are restored on a clean node", err, "")
+	if children := reset.state.classIds.children(0x11); children != 2 {
+		t.Error("Expected 2 child classes of slice-a restored but got ", children)
+	}
+	t.Setenv("TC_BOOTSTRAP_MODE", "")
+
+	err = restarted.handleSliceLifeCycleEvent("slice-a", netops.EventType_EV_DELETE)
+	expectErrStr(t, "Testing the child classes are deleted with the slice", err, "")
+	tree, err = backend.Dump("eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, class := range tree.Classes {
+		if class.Handle == defaultClassHandle(0x11) || class.Handle == defaultClassHandle(0x13) {
+			t.Error("Expected the classes of slice-a to be deleted but got ", class)
+		}
+	}
+	if _, found := restarted.state.classIds.blocks[0x11]; found {
+		t.Error("Expected the class IDs of slice-a to be freed")
+	}
+}
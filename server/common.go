@@ -26,16 +26,40 @@ const (
 	SLICE_GW_CLIENT sliceGwType = "SLICE_GW_CLIENT"
 )
 
+// sliceGwProtocol - Transport protocol of the Slice Gateway
+type sliceGwProtocol string
+
+// sliceGwProtocol - Slice Gateway tunnel protocol - udp/tcp
+const (
+	SLICE_GW_UDP sliceGwProtocol = "SLICE_GW_UDP"
+	SLICE_GW_TCP sliceGwProtocol = "SLICE_GW_TCP"
+)
+
 // classType - Type of the Class
 type classType string
 
+// classType - Slice tc enforcement mode - htb/tbf
+const (
+	CLASS_TYPE_HTB classType = "HTB"
+	CLASS_TYPE_TBF classType = "TBF"
+)
+
 type SliceGwInfo struct {
 	// Slice GW ID
-	sliceGwId    string
-	gwType       sliceGwType
-	localPorts    []string
-	remotePorts   []string
-	tcConfigured bool
+	sliceGwId   string
+	gwType      sliceGwType
+	protocol    sliceGwProtocol
+	localPorts  []string
+	remotePorts []string
+	// Node IP of the remote slice GW
+	remoteNodeIP string
+	// Address families the filters of the slice gw ports are configured for
+	tcConfigured map[int]bool
+	// Prio of the filters configured for the slice gw ports
+	tcFilterPrio uint32
+	// Handles of the filters of the slice gw ports by address family, one
+	// per port. The filters of a port share the handle on all the devices.
+	tcFilterHandles map[int][]uint32
 }
 
 // SliceInfo - the Slice information
@@ -47,21 +71,40 @@ type SliceInfo struct {
 	// Slice Tc parent class ID
 	tcParentClassId uint32
 	// Slice Tc fully qualified parent class ID.
-	// It will be in the form "x:y", where x is the root qdisc ID and y is
+	// It is the tc handle "x:y", where x is the root qdisc ID and y is
 	// the parent class ID for the slice.
-	tcParentClassFqId string
+	tcParentClassFqId uint32
 	// Slice Tc fully qualified leaf class ID.
-	// It will be in the form "x:y", where x is the root qdisc ID and y is
+	// It is the tc handle "x:y", where x is the root qdisc ID and y is
 	// the leaf class ID for the slice.
-	tcLeafClassFqId string
+	tcLeafClassFqId uint32
 	// Flag to check if the parent class has been configured for the slice.
 	tcInited bool
+	// Error of the last attempt to apply the QoS profile of the slice
+	tcErr error
 	// Tc configuration received from the slice controller for the slice.
 	tc *TcInfo
 	// SliceGw info
 	sliceGwInfo map[string]*SliceGwInfo
 }
 
+// IfaceInfo - an interface the slice traffic is shaped on
+type IfaceInfo struct {
+	// Name of the interface
+	name string
+	// Set when the interface was found from the route to a remote slice gw
+	// node rather than configured.
+	fromRoute bool
+	// Flag to check if the tc tree of the slices has been built on the
+	// interface.
+	tcInited bool
+	// Error of the last attempt to build the tc tree on the interface
+	tcErr error
+	// Root qdisc of another component found on the interface at bootstrap.
+	// The slice traffic is not shaped on the interface then.
+	foreignRoot string
+}
+
 // tcInfo - the TC information
 type TcInfo struct {
 	// ClassType
@@ -72,10 +115,16 @@ type TcInfo struct {
 	bwGuaranteed uint32
 	// Priority
 	priority uint32
+	// Mark the slice traffic with the DSCP value
+	markDscp bool
+	// DSCP value to mark the slice traffic with
+	dscp uint8
 }
 
 // sliceQosProfile structure to store slice QoS Profile
 type SliceQosProfile struct {
+	// Name of the QoS profile attached to the slice
+	name string
 	// ClassType
 	class classType
 	// Bandwidth Ceiling in Kbps
@@ -84,4 +133,6 @@ type SliceQosProfile struct {
 	bwGuaranteed uint32
 	// Priority
 	priority uint32
+	// DSCP class to mark the inter cluster traffic with
+	dscpClass string
 }
@@ -0,0 +1,55 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Highest value of the 6 bit DSCP field.
+const maxDscp = 63
+
+// parseDscpClass translates the DSCP class of a slice QoS profile into the
+// DSCP value to mark the slice traffic with. The class is either one of the
+// well known names (CS0..CS7, AF11..AF43, EF) or a decimal value from 0 to 63.
+// An empty class disables the marking.
+func parseDscpClass(class string) (uint8, bool, error) {
+	if class == "" {
+		return 0, false, nil
+	}
+	name := strings.ToUpper(class)
+	switch {
+	case name == "EF":
+		return 46, true, nil
+	case len(name) == 3 && strings.HasPrefix(name, "CS") && name[2] >= '0' && name[2] <= '7':
+		// Class selectors keep the precedence bits of the old ToS field.
+		return (name[2] - '0') << 3, true, nil
+	case len(name) == 4 && strings.HasPrefix(name, "AF") &&
+		name[2] >= '1' && name[2] <= '4' && name[3] >= '1' && name[3] <= '3':
+		// Assured forwarding class x with drop precedence y is 8x + 2y.
+		return (name[2]-'0')<<3 | (name[3]-'0')<<1, true, nil
+	}
+
+	// A leading zero would read as octal to some, reject it rather than guess.
+	dscp, err := strconv.ParseUint(class, 10, 8)
+	if err != nil || dscp > maxDscp || (len(class) > 1 && class[0] == '0') {
+		return 0, false, fmt.Errorf("invalid DSCP class %q", class)
+	}
+	return uint8(dscp), true, nil
+}
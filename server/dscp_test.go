@@ -0,0 +1,54 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+package server
+
+import "testing"
+
+func TestParseDscpClass(t *testing.T) {
+	testCases := []struct {
+		Case   string
+		Class  string
+		Dscp   uint8
+		Mark   bool
+		ErrStr string
+	}{
+		{"No DSCP class", "", 0, false, ""},
+		{"Expedited forwarding", "EF", 46, true, ""},
+		{"Lower case name", "ef", 46, true, ""},
+		{"Lowest class selector", "CS0", 0, true, ""},
+		{"Highest class selector", "CS7", 56, true, ""},
+		{"Lowest assured forwarding class", "AF11", 10, true, ""},
+		{"Assured forwarding class", "AF41", 34, true, ""},
+		{"Highest assured forwarding class", "AF43", 38, true, ""},
+		{"Numeric value", "26", 26, true, ""},
+		{"Lowest numeric value", "0", 0, true, ""},
+		{"Highest numeric value", "63", 63, true, ""},
+		{"Hex value", "0x2e", 0, false, `invalid DSCP class "0x2e"`},
+		{"Numeric value with a leading zero", "010", 0, false, `invalid DSCP class "010"`},
+		{"Numeric value out of range", "64", 0, false, `invalid DSCP class "64"`},
+		{"Invalid class selector", "CS8", 0, false, `invalid DSCP class "CS8"`},
+		{"Invalid assured forwarding class", "AF14", 0, false, `invalid DSCP class "AF14"`},
+		{"Unknown name", "BE", 0, false, `invalid DSCP class "BE"`},
+	}
+	for _, tt := range testCases {
+		dscp, mark, err := parseDscpClass(tt.Class)
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		if dscp != tt.Dscp || mark != tt.Mark {
+			t.Error(tt.Case, "- Expected :", tt.Dscp, tt.Mark, " but got ", dscp, mark)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"sort"
+
+	"github.com/kubeslice/netops/logger"
+	netops "github.com/kubeslice/netops/pkg/proto"
+)
+
+// dumpState returns the slices, the class IDs and the tc config of the
+// devices. Everything is listed in a stable order so that two dumps can be
+// diffed.
+func (s *NetOps) dumpState() *netops.StateDump {
+	dump := &netops.StateDump{
+		RootHandle: tcHandleStr(s.state.tcRootHandle()),
+		Slices:     []*netops.SliceState{},
+		ClassIds:   []*netops.ClassIdAllocation{},
+		TcTrees:    []*netops.TcTreeDump{},
+	}
+	for _, sliceID := range s.state.sliceIDsByClassId() {
+		dump.Slices = append(dump.Slices, sliceState(sliceID, s.state.slices[sliceID]))
+	}
+
+	firsts := []uint32{}
+	for first := range s.state.classIds.blocks {
+		firsts = append(firsts, first)
+	}
+	sort.Slice(firsts, func(i, j int) bool { return firsts[i] < firsts[j] })
+	for _, first := range firsts {
+		block := s.state.classIds.blocks[first]
+		dump.ClassIds = append(dump.ClassIds, &netops.ClassIdAllocation{
+			ParentClassId: tcHandleStr(s.state.tcClassHandle(first)),
+			ChildClasses:  block.children,
+			SliceName:     block.sliceName,
+		})
+	}
+
+	devs := []string{}
+	for _, iface := range s.state.netIfaces {
+		devs = append(devs, iface.name)
+	}
+	if s.state.ifbIface != "" {
+		devs = append(devs, s.state.ifbIface)
+	}
+	for _, dev := range devs {
+		dump.TcTrees = append(dump.TcTrees, s.dumpTcTree(dev))
+	}
+
+	return dump
+}
+
+// sliceState returns the state of the slice.
+func sliceState(sliceID string, sliceInfo *SliceInfo) *netops.SliceState {
+	st := &netops.SliceState{
+		SliceId:    sliceID,
+		SliceName:  sliceInfo.sliceName,
+		QosProfile: qosProfileMsg(sliceID, sliceInfo),
+		TcInited:   sliceInfo.tcInited,
+		SliceGws:   []*netops.SliceGwState{},
+	}
+	if sliceInfo.qosProfile != nil {
+		st.QosProfileName = sliceInfo.qosProfile.name
+	}
+	if sliceInfo.tcInited {
+		st.ParentClassId = tcHandleStr(sliceInfo.tcParentClassFqId)
+		st.LeafClassId = tcHandleStr(sliceInfo.tcLeafClassFqId)
+	}
+	gwIDs := []string{}
+	for gwID := range sliceInfo.sliceGwInfo {
+		gwIDs = append(gwIDs, gwID)
+	}
+	sort.Strings(gwIDs)
+	for _, gwID := range gwIDs {
+		gwInfo := sliceInfo.sliceGwInfo[gwID]
+		st.SliceGws = append(st.SliceGws, &netops.SliceGwState{
+			SliceGwId:    gwInfo.sliceGwId,
+			GwType:       netops.SliceGwHostType(netops.SliceGwHostType_value[string(gwInfo.gwType)]),
+			Protocol:     netops.SliceGwProtocol(netops.SliceGwProtocol_value[string(gwInfo.protocol)]),
+			LocalPorts:   gwInfo.localPorts,
+			RemotePorts:  gwInfo.remotePorts,
+			RemoteNodeIP: gwInfo.remoteNodeIP,
+			FilterPrio:   gwInfo.tcFilterPrio,
+		})
+	}
+	return st
+}
+
+// dumpTcTree returns the tc config of the device the way tc prints it.
+func (s *NetOps) dumpTcTree(dev string) *netops.TcTreeDump {
+	dump := &netops.TcTreeDump{Dev: dev, Qdiscs: []string{}, Classes: []string{}, Filters: []string{}}
+	tree, err := s.tc.Dump(dev)
+	if err != nil {
+		logger.GlobalLogger.Errorf("Failed to dump tc config on intf: %v, err: %v", dev, err)
+		dump.Error = err.Error()
+		return dump
+	}
+	for _, qdisc := range tree.Qdiscs {
+		dump.Qdiscs = append(dump.Qdiscs, "qdisc "+qdisc.String())
+	}
+	for _, class := range tree.Classes {
+		dump.Classes = append(dump.Classes, "class "+class.String())
+	}
+	for _, filter := range tree.Filters {
+		dump.Filters = append(dump.Filters, "filter "+filter.String())
+	}
+	return dump
+}
@@ -0,0 +1,108 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	netops "github.com/kubeslice/netops/pkg/proto"
+)
+
+func TestDumpState(t *testing.T) {
+	ctx := context.Background()
+	backend := newFakeTcBackend()
+	s, client := newTestNetOps(t, backend)
+
+	empty := &netops.StateDump{
+		RootHandle: "17:",
+		TcTrees:    []*netops.TcTreeDump{{Dev: "eth0"}},
+	}
+	dump, err := client.DumpState(ctx, &netops.DumpStateRequest{})
+	expectErrStr(t, "Testing the dump without slices", err, "")
+	if !proto.Equal(dump, empty) {
+		t.Error("Expected :", empty, " but got ", dump)
+	}
+
+	configureSlicesForAdoption(t, s)
+	profileA := &netops.SliceQosProfile{
+		SliceName: "slice-a", SliceId: "id-a", QosProfileName: "profile-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1, DscpClass: "EF",
+	}
+	_, err = client.UpdateSliceQosProfile(ctx, profileA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := backend.Dump("eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	treeDump := &netops.TcTreeDump{Dev: "eth0"}
+	for _, q := range tree.Qdiscs {
+		treeDump.Qdiscs = append(treeDump.Qdiscs, "qdisc "+q.String())
+	}
+	for _, c := range tree.Classes {
+		treeDump.Classes = append(treeDump.Classes, "class "+c.String())
+	}
+	for _, f := range tree.Filters {
+		treeDump.Filters = append(treeDump.Filters, "filter "+f.String())
+	}
+	expected := &netops.StateDump{
+		RootHandle: "17:",
+		Slices: []*netops.SliceState{
+			{
+				SliceId:        "id-a",
+				SliceName:      "slice-a",
+				QosProfileName: "profile-a",
+				QosProfile:     profileA,
+				ParentClassId:  "17:11",
+				LeafClassId:    "17:12",
+				TcInited:       true,
+				SliceGws: []*netops.SliceGwState{{
+					SliceGwId:   "gw-a",
+					GwType:      netops.SliceGwHostType_SLICE_GW_SERVER,
+					Protocol:    netops.SliceGwProtocol_SLICE_GW_UDP,
+					LocalPorts:  []string{"30001", "30003"},
+					RemotePorts: []string{"30002", "30004"},
+					FilterPrio:  1,
+				}},
+			},
+			{
+				SliceId:       "id-b",
+				SliceName:     "slice-b",
+				QosProfile:    &netops.SliceQosProfile{SliceName: "slice-b", SliceId: "id-b", BwCeiling: 3000, BwGuaranteed: 500, Priority: 0, ClassType: netops.ClassType_TBF},
+				ParentClassId: "17:22",
+				LeafClassId:   "17:23",
+				TcInited:      true,
+			},
+		},
+		ClassIds: []*netops.ClassIdAllocation{
+			{ParentClassId: "17:11", ChildClasses: 1, SliceName: "slice-a"},
+			{ParentClassId: "17:22", ChildClasses: 1, SliceName: "slice-b"},
+		},
+		TcTrees: []*netops.TcTreeDump{treeDump},
+	}
+	dump, err = client.DumpState(ctx, &netops.DumpStateRequest{})
+	expectErrStr(t, "Testing the dump of the slices", err, "")
+	if !proto.Equal(dump, expected) {
+		t.Error("Expected :", expected, " but got ", dump)
+	}
+	if len(treeDump.Qdiscs) == 0 || len(treeDump.Classes) == 0 || len(treeDump.Filters) == 0 {
+		t.Error("Expected the qdiscs, classes and filters of the slices but got ", treeDump)
+	}
+}
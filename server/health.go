@@ -0,0 +1,225 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kubeslice/netops/logger"
+	netops "github.com/kubeslice/netops/pkg/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Interval of the tc backend checks when HEALTH_CHECK_INTERVAL is not set.
+const defaultHealthCheckInterval = 10 * time.Second
+
+// healthState tracks whether netops can serve the slices: the pod must be
+// bootstrapped and the tc backend must answer. It has its own lock, the
+// health is read while the slices are changed.
+type healthState struct {
+	mu sync.Mutex
+	// Error of the last bootstrap
+	bootstrapErr error
+	// Error of the last check of the tc backend
+	backendErr error
+	// gRPC health service kept in sync with the state, nil until it is
+	// registered
+	srv *health.Server
+}
+
+func newHealthState() *healthState {
+	return &healthState{bootstrapErr: errors.New("bootstrap has not run")}
+}
+
+// liveErr returns why netops is not alive, nil when it is. A failed bootstrap
+// does not count, it is retried without a restart of the pod.
+func (h *healthState) liveErr() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.liveErrLocked()
+}
+
+func (h *healthState) liveErrLocked() error {
+	if h.backendErr != nil {
+		return fmt.Errorf("tc backend is unhealthy: %v", h.backendErr)
+	}
+	return nil
+}
+
+// readyErr returns why netops cannot serve the slices, nil when it can.
+func (h *healthState) readyErr() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.readyErrLocked()
+}
+
+func (h *healthState) readyErrLocked() error {
+	if h.bootstrapErr != nil {
+		return fmt.Errorf("not bootstrapped: %v", h.bootstrapErr)
+	}
+	return h.liveErrLocked()
+}
+
+// servingStatusLocked returns the status of the gRPC health service.
+func (h *healthState) servingStatusLocked() healthpb.HealthCheckResponse_ServingStatus {
+	if h.readyErrLocked() != nil {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	return healthpb.HealthCheckResponse_SERVING
+}
+
+// update sets one of the errors and reports the change of the serving status.
+func (h *healthState) update(field *error, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	prev := h.servingStatusLocked()
+	*field = err
+	st := h.servingStatusLocked()
+	if st != prev {
+		logger.GlobalLogger.Infof("Health status changed to %v, reason: %v", st, h.readyErrLocked())
+	}
+	h.setServingStatusLocked(st)
+}
+
+// bootstrapped reports whether a bootstrap has succeeded.
+func (h *healthState) bootstrapped() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.bootstrapErr == nil
+}
+
+func (h *healthState) setBootstrapErr(err error) {
+	h.update(&h.bootstrapErr, err)
+}
+
+func (h *healthState) setBackendErr(err error) {
+	h.update(&h.backendErr, err)
+}
+
+// setServingStatusLocked sets the status of the server and of the NetOps
+// service in the gRPC health service.
+func (h *healthState) setServingStatusLocked(st healthpb.HealthCheckResponse_ServingStatus) {
+	if h.srv == nil {
+		return
+	}
+	h.srv.SetServingStatus("", st)
+	h.srv.SetServingStatus(netops.NetOpsService_ServiceDesc.ServiceName, st)
+}
+
+// RegisterHealthServer registers the grpc.health.v1 service on the server.
+// It reports NOT_SERVING until the pod is bootstrapped and while the tc
+// backend is unhealthy.
+func (s *NetOps) RegisterHealthServer(srv *grpc.Server) {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+	s.health.srv = health.NewServer()
+	s.health.setServingStatusLocked(s.health.servingStatusLocked())
+	healthpb.RegisterHealthServer(srv, s.health.srv)
+}
+
+// HealthHandler returns the HTTP handler of the probes: /healthz fails while
+// the tc backend is unhealthy and /readyz fails until the pod is bootstrapped
+// as well.
+func (s *NetOps) HealthHandler() http.Handler {
+	probe := func(check func() error) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			if err := check(); err != nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprintln(w, err)
+				return
+			}
+			fmt.Fprintln(w, "ok")
+		}
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", probe(s.health.liveErr))
+	mux.Handle("/readyz", probe(s.health.readyErr))
+	return mux
+}
+
+// getHealthCheckInterval returns the interval set by the
+// HEALTH_CHECK_INTERVAL env var.
+func getHealthCheckInterval() (time.Duration, error) {
+	value := os.Getenv("HEALTH_CHECK_INTERVAL")
+	if value == "" {
+		return defaultHealthCheckInterval, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err == nil && interval <= 0 {
+		err = errors.New("interval must be positive")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid HEALTH_CHECK_INTERVAL %q: %v", value, err)
+	}
+	return interval, nil
+}
+
+// checkTcBackend dumps the tc config of the interfaces to check that the tc
+// backend answers, and records the result in the health state. The dumps are
+// made without the state lock so that a hung backend does not block the
+// RPCs. They go to the backend of NetOps, which is never changed, not to the
+// transaction an RPC may have in progress.
+func (s *NetOps) checkTcBackend() error {
+	unlock := s.state.lock()
+	devs := []string{}
+	for _, iface := range s.state.netIfaces {
+		devs = append(devs, iface.name)
+	}
+	unlock()
+
+	var err error
+	for _, dev := range devs {
+		_, err = s.tc.Dump(dev)
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to dump tc config on intf: %v, err: %v", dev, err)
+			err = fmt.Errorf("failed to dump tc config on intf %v: %v", dev, err)
+			break
+		}
+	}
+	s.health.setBackendErr(err)
+	return err
+}
+
+// RunHealthChecker checks the tc backend every HEALTH_CHECK_INTERVAL, until
+// the context is done.
+func (s *NetOps) RunHealthChecker(ctx context.Context) error {
+	interval, err := getHealthCheckInterval()
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	logger.GlobalLogger.Infof("Started health checker, interval: %v", interval)
+	for {
+		_ = s.checkTcBackend()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
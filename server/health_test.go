@@ -0,0 +1,253 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubeslice/netops/logger"
+	netops "github.com/kubeslice/netops/pkg/proto"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dumpFailingTcBackend fails the dumps of the tc config while err is set.
+type dumpFailingTcBackend struct {
+	TcBackend
+	err error
+}
+
+func (b *dumpFailingTcBackend) Dump(dev string) (*TcTree, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.TcBackend.Dump(dev)
+}
+
+func TestHealth(t *testing.T) {
+	ctx := context.Background()
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	t.Setenv("NETWORK_INTERFACE", "eth0")
+	t.Setenv("CHECKPOINT_PATH", "")
+	backend := &dumpFailingTcBackend{TcBackend: newFakeTcBackend()}
+	s := NewNetOps(backend)
+
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	s.RegisterHealthServer(grpcServer)
+	go func() {
+		_ = grpcServer.Serve(listener)
+	}()
+	defer grpcServer.Stop()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	httpServer := httptest.NewServer(s.HealthHandler())
+	defer httpServer.Close()
+
+	testCases := []struct {
+		Case string
+		// Changes the pod before the probes
+		Change  func()
+		Status  healthpb.HealthCheckResponse_ServingStatus
+		Healthz int
+		Readyz  int
+		// Expected body of /readyz
+		Body string
+	}{
+		{
+			"Testing the pod is not ready before the bootstrap",
+			func() {},
+			healthpb.HealthCheckResponse_NOT_SERVING,
+			http.StatusOK,
+			http.StatusServiceUnavailable,
+			"not bootstrapped: bootstrap has not run",
+		},
+		{
+			"Testing the pod is not ready after a failed bootstrap",
+			func() {
+				t.Setenv("TC_ROOT_HANDLE", "ffff")
+				if err := s.BootstrapNetOpPod(); err == nil {
+					t.Error("Expected the bootstrap to fail")
+				}
+			},
+			healthpb.HealthCheckResponse_NOT_SERVING,
+			http.StatusOK,
+			http.StatusServiceUnavailable,
+			`not bootstrapped: invalid TC_ROOT_HANDLE "ffff": reserved major`,
+		},
+		{
+			"Testing the pod is ready after the bootstrap",
+			func() {
+				t.Setenv("TC_ROOT_HANDLE", "")
+				if err := s.BootstrapNetOpPod(); err != nil {
+					t.Fatal(err)
+				}
+			},
+			healthpb.HealthCheckResponse_SERVING,
+			http.StatusOK,
+			http.StatusOK,
+			"ok",
+		},
+		{
+			"Testing the pod is not ready while the tc backend fails",
+			func() {
+				backend.err = errors.New("netlink socket closed")
+				if err := s.checkTcBackend(); err == nil {
+					t.Error("Expected the tc backend check to fail")
+				}
+			},
+			healthpb.HealthCheckResponse_NOT_SERVING,
+			http.StatusServiceUnavailable,
+			http.StatusServiceUnavailable,
+			"tc backend is unhealthy: failed to dump tc config on intf eth0: netlink socket closed",
+		},
+		{
+			"Testing the pod is ready once the tc backend recovers",
+			func() {
+				backend.err = nil
+				if err := s.checkTcBackend(); err != nil {
+					t.Error(err)
+				}
+			},
+			healthpb.HealthCheckResponse_SERVING,
+			http.StatusOK,
+			http.StatusOK,
+			"ok",
+		},
+	}
+	for _, tt := range testCases {
+		tt.Change()
+		for _, service := range []string{"", "netops.NetOpsService"} {
+			res, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+			expectErrStr(t, tt.Case, err, "")
+			if res.GetStatus() != tt.Status {
+				t.Error(tt.Case, "- Expected :", tt.Status, " of service ", service, " but got ", res.GetStatus())
+			}
+		}
+		for _, probe := range []struct {
+			Path string
+			Code int
+		}{
+			{"/healthz", tt.Healthz},
+			{"/readyz", tt.Readyz},
+		} {
+			resp, err := http.Get(httpServer.URL + probe.Path)
+			if err != nil {
+				t.Fatal(tt.Case, err)
+			}
+			body := new(strings.Builder)
+			_, err = io.Copy(body, resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(tt.Case, err)
+			}
+			if resp.StatusCode != probe.Code {
+				t.Error(tt.Case, "- Expected :", probe.Code, " from ", probe.Path, " but got ", resp.StatusCode, " ", body)
+			}
+			if probe.Path == "/readyz" && !strings.HasPrefix(body.String(), tt.Body) {
+				t.Error(tt.Case, "- Expected :", tt.Body, " but got ", body)
+			}
+		}
+	}
+}
+
+func TestGetHealthCheckInterval(t *testing.T) {
+	testCases := []struct {
+		Case     string
+		Value    string
+		Interval time.Duration
+		ErrStr   string
+	}{
+		{"Testing the default interval", "", defaultHealthCheckInterval, ""},
+		{"Testing a configured interval", "30s", 30 * time.Second, ""},
+		{"Testing a zero interval", "0s", 0, `invalid HEALTH_CHECK_INTERVAL "0s": interval must be positive`},
+		{"Testing an invalid interval", "often", 0, `invalid HEALTH_CHECK_INTERVAL "often": time: invalid duration "often"`},
+	}
+	for _, tt := range testCases {
+		t.Setenv("HEALTH_CHECK_INTERVAL", tt.Value)
+		interval, err := getHealthCheckInterval()
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		if interval != tt.Interval {
+			t.Error(tt.Case, "- Expected :", tt.Interval, " but got ", interval)
+		}
+	}
+}
+
+// TestHealthCheckerWithRpcs runs the health checker and reads the status of
+// the slice while the RPCs change the tc config, for the race detector.
+func TestHealthCheckerWithRpcs(t *testing.T) {
+	t.Setenv("HEALTH_CHECK_INTERVAL", "1ms")
+	recorder := &recordingTcBackend{TcBackend: newFakeTcBackend(), ops: []string{}}
+	s, client := newTestNetOps(t, recorder)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.RunHealthChecker(ctx)
+	}()
+	statusDone := make(chan struct{})
+	go func() {
+		defer close(statusDone)
+		for ctx.Err() == nil {
+			_, _ = client.GetSliceQosStatus(ctx, &netops.SliceQosStatusRequest{SliceId: "id-a"})
+		}
+	}()
+	gw := &netops.NetOpConnectionContext{
+		SliceId:                "id-a",
+		LocalSliceGwId:         "gw-a",
+		LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_SERVER,
+		LocalSliceGwNodePorts:  []string{"30001"},
+		RemoteSliceGwNodePorts: []string{"30002"},
+	}
+	for i := 0; i < 20; i++ {
+		_, err := client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1})
+		expectErrStr(t, "Testing the slice is added", err, "")
+		_, err = client.UpdateConnectionContext(ctx, gw)
+		expectErrStr(t, "Testing the slice gw is added", err, "")
+		// The update of the profile fails and is rolled back
+		unlock := s.state.lock()
+		recorder.fail = "class replace"
+		unlock()
+		_, err = client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{SliceName: "slice-a", SliceId: "id-a", BwCeiling: 8000, BwGuaranteed: 2000, Priority: 1, DscpClass: "AF41"})
+		if err == nil {
+			t.Error("Expected the update of the slice to fail")
+		}
+		_, err = client.DeleteConnectionContext(ctx, gw)
+		expectErrStr(t, "Testing the slice gw is deleted", err, "")
+		_, err = client.UpdateSliceLifeCycleEvent(ctx, &netops.SliceLifeCycleEvent{SliceName: "slice-a", Event: netops.EventType_EV_DELETE})
+		expectErrStr(t, "Testing the slice is deleted", err, "")
+	}
+	cancel()
+	<-statusDone
+	err := <-done
+	expectErrStr(t, "Testing the health checker stops", err, "")
+}
@@ -19,6 +19,8 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/kubeslice/netops/logger"
 	netops "github.com/kubeslice/netops/pkg/proto"
@@ -29,6 +31,47 @@ import (
 // NetOps represents the GRPC NetOps
 type NetOps struct {
 	netops.UnimplementedNetOpsServiceServer
+	// Backend used to program tc. It is never changed: the tc changes of a
+	// transaction go through the transaction of the state, see tcBackend.
+	tc TcBackend
+	// State of the slices. The RPCs are served on separate goroutines, they
+	// hold its lock while they change it.
+	state *sliceStateManager
+	// Requests for a run of the reconciler
+	reconcileCh chan struct{}
+	// Health reported to the probes
+	health *healthState
+}
+
+// NewNetOps returns a NetOps that programs tc with the given backend.
+func NewNetOps(tc TcBackend) *NetOps {
+	return &NetOps{tc: tc, state: newSliceStateManager(), reconcileCh: make(chan struct{}, 1), health: newHealthState()}
+}
+
+// sliceQosProfileFromMsg returns the QoS profile of a slice received from the
+// controller.
+func sliceQosProfileFromMsg(qosProfile *netops.SliceQosProfile) *SliceQosProfile {
+	return &SliceQosProfile{
+		name:         qosProfile.GetQosProfileName(),
+		class:        classType(qosProfile.GetClassType().String()),
+		bwCeiling:    qosProfile.GetBwCeiling(),
+		bwGuaranteed: qosProfile.GetBwGuaranteed(),
+		priority:     qosProfile.GetPriority(),
+		dscpClass:    qosProfile.GetDscpClass(),
+	}
+}
+
+// sliceGwInfoFromMsg returns the info of the local slice gw of a connection
+// context.
+func sliceGwInfoFromMsg(conContext *netops.NetOpConnectionContext) *SliceGwInfo {
+	return &SliceGwInfo{
+		sliceGwId:    conContext.GetLocalSliceGwId(),
+		gwType:       sliceGwType(conContext.GetLocalSliceGwHostType().String()),
+		protocol:     sliceGwProtocol(conContext.GetSliceGwProtocol().String()),
+		localPorts:   conContext.GetLocalSliceGwNodePorts(),
+		remotePorts:  conContext.GetRemoteSliceGwNodePorts(),
+		remoteNodeIP: conContext.GetRemoteSliceGwNodeIP(),
+	}
 }
 
 // UpdateSliceQosProfile implements the QoS Policy for a slice
@@ -40,18 +83,16 @@ func (s *NetOps) UpdateSliceQosProfile(ctx context.Context, qosProfile *netops.S
 		return nil, status.Errorf(codes.InvalidArgument, "Qos profile message is empty")
 	}
 
+	if err := validateSliceQosProfile("", qosProfile).err("Invalid qos profile"); err != nil {
+		return nil, err
+	}
+
 	logger.GlobalLogger.Debugf("SliceQosProfile : %v", qosProfile)
 
-	err := s.enforceSliceQosPolicy(
-		qosProfile.GetSliceId(),
-		qosProfile.GetSliceName(),
-		&SliceQosProfile{
-			class:        classType(qosProfile.GetClassType().String()),
-			bwCeiling:    qosProfile.GetBwCeiling(),
-			bwGuaranteed: qosProfile.GetBwGuaranteed(),
-			priority:     qosProfile.GetPriority(),
-		},
-	)
+	unlock := s.state.lock()
+	err := s.enforceSliceQosPolicy(qosProfile.GetSliceId(), qosProfile.GetSliceName(), sliceQosProfileFromMsg(qosProfile))
+	s.saveCheckpoint()
+	unlock()
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Failed to enforce QoS policy: %v", err)
 	}
@@ -71,7 +112,10 @@ func (s *NetOps) UpdateSliceLifeCycleEvent(ctx context.Context, sliceEvent *neto
 
 	logger.GlobalLogger.Infof("SliceLifeCycleEvent : %v", sliceEvent)
 
+	unlock := s.state.lock()
 	err := s.handleSliceLifeCycleEvent(sliceEvent.GetSliceName(), sliceEvent.GetEvent())
+	s.saveCheckpoint()
+	unlock()
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Failed to handle slice lifecycle event: %v", err)
 	}
@@ -94,19 +138,155 @@ func (s *NetOps) UpdateConnectionContext(ctx context.Context, conContext *netops
 	if conContext.GetLocalSliceGwHostType().String() == "" {
 		return nil, status.Errorf(codes.InvalidArgument, "Invalid Slice Gateway Host Type")
 	}
+	if err := validateConnectionContext("", conContext).err("Invalid connection context"); err != nil {
+		return nil, err
+	}
 	logger.GlobalLogger.Infof("conContext : %v", conContext)
 
-	updateSliceGwInfo(
-		conContext.GetSliceId(),
-		&SliceGwInfo{
-			sliceGwId:  conContext.GetLocalSliceGwId(),
-			gwType:     sliceGwType(conContext.GetLocalSliceGwHostType().String()),
-			localPorts:  conContext.GetLocalSliceGwNodePorts(),
-			remotePorts: conContext.GetRemoteSliceGwNodePorts(),
-		},
-	)
+	unlock := s.state.lock()
+	err := s.updateSliceGw(conContext.GetSliceId(), sliceGwInfoFromMsg(conContext))
+	var ifaceErr error
+	if err == nil {
+		// The slice gw is kept when the interface to its remote node cannot
+		// be shaped, the error is reported in the status of the slice.
+		ifaceErr = s.addNetIfaceForRemoteNode(conContext.GetRemoteSliceGwNodeIP())
+		if ifaceErr != nil {
+			ifaceErr = fmt.Errorf("failed to shape slice traffic to remote node %v: %v", conContext.GetRemoteSliceGwNodeIP(), ifaceErr)
+			if sliceInfo, found := s.state.slices[conContext.GetSliceId()]; found {
+				sliceInfo.tcErr = ifaceErr
+			}
+		}
+	}
+	s.saveCheckpoint()
+	unlock()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to update filters of the slice gw ports: %v", err)
+	}
+	if ifaceErr != nil {
+		logger.GlobalLogger.Errorf("Connection Context Updated, %v", ifaceErr)
+		return &netops.Response{StatusMsg: fmt.Sprintf("Connection Context Updated in netops pod, %v", ifaceErr)}, nil
+	}
 
 	logger.GlobalLogger.Infof("Connection Context Updated Successfully")
 
 	return &netops.Response{StatusMsg: "Connection Context Updated Successfully in netops pod"}, nil
 }
+
+// DeleteConnectionContext removes a slice gw from the slice along with the
+// filters of its ports
+func (s *NetOps) DeleteConnectionContext(ctx context.Context, conContext *netops.NetOpConnectionContext) (*netops.Response, error) {
+	if ctx.Err() == context.Canceled {
+		return nil, status.Errorf(codes.Canceled, "Client cancelled, abandoning.")
+	}
+	if conContext == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Connection Context is Empty")
+	}
+	if conContext.GetSliceId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid Slice Id")
+	}
+	if conContext.GetLocalSliceGwId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid Slice Gateway Id")
+	}
+	logger.GlobalLogger.Infof("Deleting conContext : %v", conContext)
+
+	unlock := s.state.lock()
+	err := s.deleteSliceGw(conContext.GetSliceId(), conContext.GetLocalSliceGwId())
+	s.saveCheckpoint()
+	unlock()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to delete filters of the slice gw ports: %v", err)
+	}
+
+	logger.GlobalLogger.Infof("Connection Context Deleted Successfully")
+
+	return &netops.Response{StatusMsg: "Connection Context Deleted Successfully in netops pod"}, nil
+}
+
+// GetSliceQosStatus reports the QoS config enforced for a slice, as found in
+// the tc config of the node
+func (s *NetOps) GetSliceQosStatus(ctx context.Context, req *netops.SliceQosStatusRequest) (*netops.SliceQosStatus, error) {
+	if ctx.Err() == context.Canceled {
+		return nil, status.Errorf(codes.Canceled, "Client cancelled, abandoning.")
+	}
+	if req.GetSliceId() == "" && req.GetSliceName() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid Slice Id or Name")
+	}
+
+	unlock := s.state.lock()
+	sliceID := s.state.findSlice(req.GetSliceId(), req.GetSliceName())
+	if sliceID == "" {
+		unlock()
+		if req.GetSliceId() != "" {
+			return nil, status.Errorf(codes.NotFound, sliceIdNotFound(req.GetSliceId()))
+		}
+		return nil, status.Errorf(codes.NotFound, "Slice %v is not found", req.GetSliceName())
+	}
+	st, complete := s.sliceQosStatus(sliceID)
+	unlock()
+
+	// The tc config is dumped without the lock.
+	complete()
+	return st, nil
+}
+
+// DumpState dumps the slices, the class IDs and the tc config of the node for
+// debugging
+func (s *NetOps) DumpState(ctx context.Context, req *netops.DumpStateRequest) (*netops.StateDump, error) {
+	if ctx.Err() == context.Canceled {
+		return nil, status.Errorf(codes.Canceled, "Client cancelled, abandoning.")
+	}
+
+	defer s.state.lock()()
+	return s.dumpState(), nil
+}
+
+// WatchSliceStats streams samples of the traffic statistics of the slices
+// until the client cancels
+func (s *NetOps) WatchSliceStats(req *netops.WatchSliceStatsRequest, stream netops.NetOpsService_WatchSliceStatsServer) error {
+	interval, err := sliceStatsInterval(req.GetIntervalMs())
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "Invalid stats interval: %v", err)
+	}
+	logger.GlobalLogger.Debugf("WatchSliceStats : %v", req)
+
+	sampler := newSliceStatsSampler(req.GetSliceIds(), req.GetSliceNames())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		unlock := s.state.lock()
+		sample := sampler.sample(s, time.Now())
+		unlock()
+		if err := stream.Send(sample); err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncState converges the node to the complete desired state sent by the
+// worker operator. Only the changes are applied.
+func (s *NetOps) SyncState(ctx context.Context, req *netops.SyncStateRequest) (*netops.SyncStateResponse, error) {
+	if ctx.Err() == context.Canceled {
+		return nil, status.Errorf(codes.Canceled, "Client cancelled, abandoning.")
+	}
+	if err := validateDesiredSlices(req.GetSlices()).err("Invalid desired state"); err != nil {
+		return nil, err
+	}
+	logger.GlobalLogger.Infof("SyncState : %v slices", len(req.GetSlices()))
+
+	unlock := s.state.lock()
+	summary, err := s.syncState(req.GetSlices())
+	s.saveCheckpoint()
+	unlock()
+	logger.GlobalLogger.Infof("State sync changes: %v", summary)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to sync state: %v", err)
+	}
+
+	summary.StatusMsg = "State synced successfully"
+	return summary, nil
+}
@@ -22,6 +22,7 @@ package server
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net"
 	"os"
@@ -29,26 +30,46 @@ import (
 
 	"github.com/kubeslice/netops/logger"
 	netops "github.com/kubeslice/netops/pkg/proto"
+	"github.com/vishvananda/netlink"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 )
 
-func MockBootstrapNetOpPod() error {
+// MockBootstrapNetOpPod sets up two slices. The tc config of slice randomid
+// is in place while slice randomid2 is yet to be configured.
+func MockBootstrapNetOpPod(s *NetOps) error {
 	mockSliceGwInfo := make(map[string]*SliceGwInfo)
-	mockSliceGwInfo["test-slice"] = &SliceGwInfo{tcConfigured: false, localPorts: []string{"5000", "6000"}, remotePorts: []string{"5000", "6000"}, gwType: sliceGwType("SLICE_GW_SERVER")}
-	NetOpHandle = make(map[string]*SliceInfo)
-	NetOpHandle["randomid"] = &SliceInfo{sliceName: "test-slice", qosProfile: &SliceQosProfile{class: classType(netops.ClassType_HTB.String()), bwCeiling: 1, bwGuaranteed: htbRootHandleId, priority: 2}, sliceGwInfo: mockSliceGwInfo, tcLeafClassFqId: "randomLeafID", tc: &TcInfo{class: classType(netops.ClassType_HTB.String()), bwCeiling: 1, bwGuaranteed: htbRootHandleId, priority: 2}, tcInited: false}
-	NetOpHandle["randomid2"] = &SliceInfo{sliceName: "test-slice", qosProfile: &SliceQosProfile{class: classType(netops.ClassType_HTB.String()), bwCeiling: 1, bwGuaranteed: htbRootHandleId, priority: 2}, sliceGwInfo: mockSliceGwInfo, tcLeafClassFqId: "randomLeafID"}
-	tcClassIdMap = make(map[uint32]string)
-	netIface = "eth0"
-	if os.Getenv("NETWORK_INTERFACE") != "" {
-		netIface = os.Getenv("NETWORK_INTERFACE")
-	}
+	mockSliceGwInfo["test-slice"] = &SliceGwInfo{localPorts: []string{"5000", "6000"}, remotePorts: []string{"5000", "6000"}, gwType: sliceGwType("SLICE_GW_SERVER")}
+	s.state.slices = make(map[string]*SliceInfo)
+	s.state.slices["randomid"] = &SliceInfo{sliceName: "test-slice", qosProfile: &SliceQosProfile{class: classType(netops.ClassType_HTB.String()), bwCeiling: 1, bwGuaranteed: defaultRootHandleId, priority: 2}, sliceGwInfo: mockSliceGwInfo, tcParentClassId: 0x11, tcParentClassFqId: defaultClassHandle(0x11), tcLeafClassFqId: defaultClassHandle(0x12), tc: &TcInfo{class: classType(netops.ClassType_HTB.String()), bwCeiling: 1, bwGuaranteed: defaultRootHandleId, priority: 2}, tcInited: true}
+	s.state.slices["randomid2"] = &SliceInfo{sliceName: "test-slice2", qosProfile: &SliceQosProfile{class: classType(netops.ClassType_HTB.String()), bwCeiling: 1, bwGuaranteed: defaultRootHandleId, priority: 2}, sliceGwInfo: mockSliceGwInfo, tcParentClassId: 0x22}
+	s.state.classIds = newClassIdAllocator(defaultRootHandleId)
+	s.state.classIds.take("test-slice", 0x11, sliceChildClasses)
+	s.state.classIds.take("test-slice2", 0x22, sliceChildClasses)
+	s.state.netIfaces = []*IfaceInfo{{name: "eth0"}}
 
 	// Start with a clean slate:  delete TC root qdisc
-	err := netOpDelTcRootQdisc()
+	err := s.netOpDelTcRootQdisc()
+	if err != nil {
+		return err
+	}
+
+	// Program the tc config of slice randomid
+	err = s.netOpAddTcRootQdisc()
+	if err != nil {
+		return err
+	}
+	err = s.tc.ClassAdd(&TcClass{Dev: "eth0", Parent: defaultRootHandle(), Handle: defaultClassHandle(0x11), Rate: 1, Burst: 64 * 1024, Prio: 2})
+	if err != nil {
+		return err
+	}
+	err = s.tc.ClassAdd(&TcClass{Dev: "eth0", Parent: defaultClassHandle(0x11), Handle: defaultClassHandle(0x12), Rate: uint64(defaultRootHandleId), Ceil: 1, Burst: 32 * 1024, Prio: 2})
+	if err != nil {
+		return err
+	}
+	err = s.tc.QdiscAdd(&TcQdisc{Dev: "eth0", Kind: tcKindSfq, Parent: defaultClassHandle(0x12), Handle: netlink.MakeHandle(0x11, 0), Perturb: 10})
 	if err != nil {
 		return err
 	}
@@ -57,12 +78,20 @@ func MockBootstrapNetOpPod() error {
 	return nil
 }
 
-func dialer() func(context.Context, string) (net.Conn, error) {
+// mockTcTree is the tc config programmed by MockBootstrapNetOpPod.
+var mockTcTree = []string{
+	"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+	"qdisc dev eth0 root handle 17: htb default 30",
+	"class dev eth0 parent 17: classid 17:11 htb rate 1kbit burst 65536 prio 2",
+	"class dev eth0 parent 17:11 classid 17:12 htb rate 23kbit ceil 1kbit burst 32768 prio 2",
+}
+
+func dialer(s *NetOps) func(context.Context, string) (net.Conn, error) {
 	listener := bufconn.Listen(1024 * 1024)
 
 	grpcServer := grpc.NewServer()
 
-	netops.RegisterNetOpsServiceServer(grpcServer, &NetOps{})
+	netops.RegisterNetOpsServiceServer(grpcServer, s)
 
 	go func() {
 		if err := grpcServer.Serve(listener); err != nil {
@@ -75,6 +104,33 @@ func dialer() func(context.Context, string) (net.Conn, error) {
 	}
 }
 
+// TestMain disables checkpointing unless a test sets CHECKPOINT_PATH, so that
+// the tests do not touch the default checkpoint path of the pod.
+func TestMain(m *testing.M) {
+	os.Setenv("CHECKPOINT_PATH", "")
+	os.Exit(m.Run())
+}
+
+// newTestNetOps bootstraps a NetOps on the fake eth0 interface without a
+// checkpoint and returns it with a client of its grpc server.
+func newTestNetOps(t *testing.T, backend TcBackend) (*NetOps, netops.NetOpsServiceClient) {
+	t.Helper()
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	t.Setenv("NETWORK_INTERFACE", "eth0")
+	t.Setenv("CHECKPOINT_PATH", "")
+	s := NewNetOps(backend)
+	err := s.BootstrapNetOpPod()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.DialContext(context.Background(), "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(s)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return s, netops.NewNetOpsServiceClient(conn)
+}
+
 func TestUpdateSliceQosProfileWithMockNetOpHandle(t *testing.T) {
 	tests := []struct {
 		testCase string
@@ -93,8 +149,8 @@ func TestUpdateSliceQosProfileWithMockNetOpHandle(t *testing.T) {
 				QosProfileName: "",
 				TcType:         netops.TcType_BANDWIDTH_CONTROL,
 				ClassType:      netops.ClassType_HTB,
-				BwCeiling:      1,
-				BwGuaranteed:   htbRootHandleId,
+				BwCeiling:      5000,
+				BwGuaranteed:   1000,
 				Priority:       2,
 				DscpClass:      "",
 			},
@@ -120,12 +176,14 @@ func TestUpdateSliceQosProfileWithMockNetOpHandle(t *testing.T) {
 		},
 	}
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	logger.GlobalLogger = logger.NewLogger("ERROR")
-	err := MockBootstrapNetOpPod()
+	s := NewNetOps(newFakeTcBackend())
+	err := MockBootstrapNetOpPod(s)
 	if err != nil {
 		log.Fatal(err)
 	}
-	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer()))
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(s)))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -158,7 +216,19 @@ func TestUpdateSliceQosProfileWithMockNetOpHandle(t *testing.T) {
 			}
 		})
 	}
-
+	// The classes take the rates of the QoS profile, the slice gw filters are
+	// added.
+	expectTcTree(t, s.tc, "eth0", append([]string{
+		"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+		"qdisc dev eth0 root handle 17: htb default 30",
+		"class dev eth0 parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 2",
+		"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 2",
+	},
+		"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110001 flower ip_proto udp src_port 5000 classid 17:12",
+		"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110002 flower ip_proto udp src_port 6000 classid 17:12",
+		"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110003 flower ip_proto udp src_port 5000 classid 17:12",
+		"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110004 flower ip_proto udp src_port 6000 classid 17:12",
+	))
 }
 
 func TestUpdateSliceQosProfile(t *testing.T) {
@@ -179,8 +249,8 @@ func TestUpdateSliceQosProfile(t *testing.T) {
 				QosProfileName: "",
 				TcType:         netops.TcType_BANDWIDTH_CONTROL,
 				ClassType:      netops.ClassType_HTB,
-				BwCeiling:      1,
-				BwGuaranteed:   htbRootHandleId,
+				BwCeiling:      5000,
+				BwGuaranteed:   1000,
 				Priority:       2,
 				DscpClass:      "",
 			},
@@ -196,6 +266,36 @@ func TestUpdateSliceQosProfile(t *testing.T) {
 			codes.InvalidArgument,
 			false,
 		},
+		{
+			"Priority out of range",
+			&netops.Response{StatusMsg: ""},
+			&netops.SliceQosProfile{
+				SliceName:    "test-slice",
+				SliceId:      "randomid",
+				ClassType:    netops.ClassType_HTB,
+				BwCeiling:    5000,
+				BwGuaranteed: 1000,
+				Priority:     4,
+			},
+			"Invalid qos profile: invalid priority 4, expected 0-3",
+			codes.InvalidArgument,
+			false,
+		},
+		{
+			"Invalid DSCP class",
+			&netops.Response{StatusMsg: ""},
+			&netops.SliceQosProfile{
+				SliceName:    "test-slice",
+				SliceId:      "randomid",
+				ClassType:    netops.ClassType_HTB,
+				BwCeiling:    5000,
+				BwGuaranteed: 1000,
+				DscpClass:    "CS9",
+			},
+			`Invalid qos profile: invalid DSCP class "CS9"`,
+			codes.InvalidArgument,
+			false,
+		},
 		{
 			"Test for Cancelled context",
 			&netops.Response{StatusMsg: ""},
@@ -206,12 +306,15 @@ func TestUpdateSliceQosProfile(t *testing.T) {
 		},
 	}
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	logger.GlobalLogger = logger.NewLogger("ERROR")
-	err := BootstrapNetOpPod()
+	t.Setenv("NETWORK_INTERFACE", "eth0")
+	s := NewNetOps(newFakeTcBackend())
+	err := s.BootstrapNetOpPod()
 	if err != nil {
 		log.Fatal(err)
 	}
-	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer()))
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(s)))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -244,7 +347,12 @@ func TestUpdateSliceQosProfile(t *testing.T) {
 			}
 		})
 	}
-
+	expectTcTree(t, s.tc, "eth0", []string{
+		"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+		"qdisc dev eth0 root handle 17: htb default 30",
+		"class dev eth0 parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 2",
+		"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 2",
+	})
 }
 
 func TestUpdateSliceLifeCycleEvent(t *testing.T) {
@@ -301,7 +409,7 @@ func TestUpdateSliceLifeCycleEvent(t *testing.T) {
 			"Test for Cancelled context",
 			&netops.Response{StatusMsg: ""},
 			&netops.SliceLifeCycleEvent{
-				SliceName: netIface,
+				SliceName: "eth0",
 				Event:     netops.EventType_EV_CREATE,
 			},
 			"context canceled",
@@ -310,12 +418,14 @@ func TestUpdateSliceLifeCycleEvent(t *testing.T) {
 		},
 	}
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	logger.GlobalLogger = logger.NewLogger("DEBUG")
-	err := MockBootstrapNetOpPod()
+	s := NewNetOps(newFakeTcBackend())
+	err := MockBootstrapNetOpPod(s)
 	if err != nil {
 		log.Fatal(err)
 	}
-	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer()))
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(s)))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -346,5 +456,599 @@ func TestUpdateSliceLifeCycleEvent(t *testing.T) {
 			}
 		})
 	}
+	// The slice is deleted, the root qdisc stays for slice randomid2.
+	expectTcTree(t, s.tc, "eth0", []string{"qdisc dev eth0 root handle 17: htb default 30"})
+}
+
+func TestSliceTcTreeLifeCycle(t *testing.T) {
+	tests := []struct {
+		testCase string
+		call     func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error)
+		tcTree   []string
+	}{
+		{
+			"Add slice-a",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+					SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1,
+				})
+			},
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"class dev eth0 parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+			},
+		},
+		{
+			"Connection context of slice-a is stored",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.UpdateConnectionContext(ctx, &netops.NetOpConnectionContext{
+					SliceId:                "id-a",
+					LocalSliceGwId:         "gw-a",
+					LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_SERVER,
+					LocalSliceGwNodePorts:  []string{"30001"},
+					RemoteSliceGwNodePorts: []string{"30002"},
+				})
+			},
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"class dev eth0 parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+			},
+		},
+		{
+			"QoS profile of slice-a adds the slice gw filter",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+					SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1,
+				})
+			},
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"class dev eth0 parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+				"filter dev eth0 protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp src_port 30001 classid 17:12",
+				"filter dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110002 flower ip_proto udp src_port 30001 classid 17:12",
+			},
+		},
+		{
+			"Add slice-b",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+					SliceName: "slice-b", SliceId: "id-b", BwCeiling: 2000, BwGuaranteed: 500, Priority: 2,
+				})
+			},
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"qdisc dev eth0 parent 17:23 handle 22: sfq perturb 10",
+				"class dev eth0 parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+				"class dev eth0 parent 17: classid 17:22 htb rate 2000kbit burst 65536 prio 2",
+				"class dev eth0 parent 17:22 classid 17:23 htb rate 500kbit ceil 2000kbit burst 32768 prio 2",
+				"filter dev eth0 protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp src_port 30001 classid 17:12",
+				"filter dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110002 flower ip_proto udp src_port 30001 classid 17:12",
+			},
+		},
+		{
+			"TCP connection context of slice-b is stored",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.UpdateConnectionContext(ctx, &netops.NetOpConnectionContext{
+					SliceId:                "id-b",
+					LocalSliceGwId:         "gw-b",
+					LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_CLIENT,
+					LocalSliceGwNodePorts:  []string{"30003"},
+					RemoteSliceGwNodePorts: []string{"30004"},
+					RemoteSliceGwNodeIP:    "10.0.0.2",
+					SliceGwProtocol:        netops.SliceGwProtocol_SLICE_GW_TCP,
+				})
+			},
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"qdisc dev eth0 parent 17:23 handle 22: sfq perturb 10",
+				"class dev eth0 parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+				"class dev eth0 parent 17: classid 17:22 htb rate 2000kbit burst 65536 prio 2",
+				"class dev eth0 parent 17:22 classid 17:23 htb rate 500kbit ceil 2000kbit burst 32768 prio 2",
+				"filter dev eth0 protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp src_port 30001 classid 17:12",
+				"filter dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110002 flower ip_proto udp src_port 30001 classid 17:12",
+			},
+		},
+		{
+			"QoS profile of slice-b adds the TCP slice gw filter",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+					SliceName: "slice-b", SliceId: "id-b", BwCeiling: 2000, BwGuaranteed: 500, Priority: 2,
+				})
+			},
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"qdisc dev eth0 parent 17:23 handle 22: sfq perturb 10",
+				"class dev eth0 parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+				"class dev eth0 parent 17: classid 17:22 htb rate 2000kbit burst 65536 prio 2",
+				"class dev eth0 parent 17:22 classid 17:23 htb rate 500kbit ceil 2000kbit burst 32768 prio 2",
+				"filter dev eth0 protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp src_port 30001 classid 17:12",
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x220001 flower ip_proto tcp dst_ip 10.0.0.2/32 dst_port 30004 classid 17:23",
+				"filter dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110002 flower ip_proto udp src_port 30001 classid 17:12",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x220002 flower ip_proto tcp dst_port 30004 classid 17:23",
+			},
+		},
+		{
+			"Delete slice-a",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.UpdateSliceLifeCycleEvent(ctx, &netops.SliceLifeCycleEvent{SliceName: "slice-a", Event: netops.EventType_EV_DELETE})
+			},
+			[]string{
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"qdisc dev eth0 parent 17:23 handle 22: sfq perturb 10",
+				"class dev eth0 parent 17: classid 17:22 htb rate 2000kbit burst 65536 prio 2",
+				"class dev eth0 parent 17:22 classid 17:23 htb rate 500kbit ceil 2000kbit burst 32768 prio 2",
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x220001 flower ip_proto tcp dst_ip 10.0.0.2/32 dst_port 30004 classid 17:23",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x220002 flower ip_proto tcp dst_port 30004 classid 17:23",
+			},
+		},
+		{
+			"Delete slice-b",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.UpdateSliceLifeCycleEvent(ctx, &netops.SliceLifeCycleEvent{SliceName: "slice-b", Event: netops.EventType_EV_DELETE})
+			},
+			[]string{},
+		},
+	}
+	ctx := context.Background()
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	t.Setenv("NETWORK_INTERFACE", "eth0")
+	s := NewNetOps(newFakeTcBackend())
+	err := s.BootstrapNetOpPod()
+	if err != nil {
+		log.Fatal(err)
+	}
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(s)))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := netops.NewNetOpsServiceClient(conn)
+	for _, tt := range tests {
+		t.Run(tt.testCase, func(t *testing.T) {
+			_, err := tt.call(ctx, client)
+			if err != nil {
+				t.Error("Expected no error but got ", err)
+			}
+			expectTcTree(t, s.tc, "eth0", tt.tcTree)
+		})
+	}
+}
+
+func TestSliceTcTreeIngressShaping(t *testing.T) {
+	tests := []struct {
+		testCase string
+		call     func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error)
+		tcTree   []string
+		ifbTree  []string
+	}{
+		{
+			"Add slice-a",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+					SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1, DscpClass: "EF",
+				})
+			},
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"qdisc dev eth0 ingress handle ffff:",
+				"class dev eth0 parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+			},
+			[]string{
+				"qdisc dev netops-ifb parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev netops-ifb root handle 17: htb default 30",
+				"class dev netops-ifb parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+				"class dev netops-ifb parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+			},
+		},
+		{
+			"Connection context of slice-a is stored",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.UpdateConnectionContext(ctx, &netops.NetOpConnectionContext{
+					SliceId:                "id-a",
+					LocalSliceGwId:         "gw-a",
+					LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_CLIENT,
+					LocalSliceGwNodePorts:  []string{"30001"},
+					RemoteSliceGwNodePorts: []string{"30002"},
+					RemoteSliceGwNodeIP:    "10.0.0.2",
+				})
+			},
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"qdisc dev eth0 ingress handle ffff:",
+				"class dev eth0 parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+			},
+			[]string{
+				"qdisc dev netops-ifb parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev netops-ifb root handle 17: htb default 30",
+				"class dev netops-ifb parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+				"class dev netops-ifb parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+			},
+		},
+		{
+			"QoS profile of slice-a adds the egress, ingress and redirect filters",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+					SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1, DscpClass: "EF",
+				})
+			},
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"qdisc dev eth0 ingress handle ffff:",
+				"class dev eth0 parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+				"filter dev eth0 protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp dst_ip 10.0.0.2/32 dst_port 30002 classid 17:12 action pedit ex munge ip dsfield set 0xb8 retain 0xfc pipe action csum ip pipe",
+				"filter dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110002 flower ip_proto udp dst_port 30002 classid 17:12 action pedit ex munge ip6 traffic_class set 0xb8 retain 0xfc pipe",
+				"filter dev eth0 protocol ip parent ffff: prio 1 handle 0x110001 flower ip_proto udp src_ip 10.0.0.2/32 src_port 30002 action mirred egress redirect dev netops-ifb",
+				"filter dev eth0 protocol ipv6 parent ffff: prio 11 handle 0x110002 flower ip_proto udp src_port 30002 action mirred egress redirect dev netops-ifb",
+			},
+			[]string{
+				"qdisc dev netops-ifb parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev netops-ifb root handle 17: htb default 30",
+				"class dev netops-ifb parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+				"class dev netops-ifb parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+				"filter dev netops-ifb protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp src_ip 10.0.0.2/32 src_port 30002 classid 17:12",
+				"filter dev netops-ifb protocol ipv6 parent 17: prio 11 handle 0x110002 flower ip_proto udp src_port 30002 classid 17:12",
+			},
+		},
+		{
+			"Bandwidth change of slice-a is mirrored on the IFB device",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+					SliceName: "slice-a", SliceId: "id-a", BwCeiling: 8000, BwGuaranteed: 1000, Priority: 1, DscpClass: "EF",
+				})
+			},
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"qdisc dev eth0 ingress handle ffff:",
+				"class dev eth0 parent 17: classid 17:11 htb rate 8000kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 8000kbit burst 32768 prio 1",
+				"filter dev eth0 protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp dst_ip 10.0.0.2/32 dst_port 30002 classid 17:12 action pedit ex munge ip dsfield set 0xb8 retain 0xfc pipe action csum ip pipe",
+				"filter dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110002 flower ip_proto udp dst_port 30002 classid 17:12 action pedit ex munge ip6 traffic_class set 0xb8 retain 0xfc pipe",
+				"filter dev eth0 protocol ip parent ffff: prio 1 handle 0x110001 flower ip_proto udp src_ip 10.0.0.2/32 src_port 30002 action mirred egress redirect dev netops-ifb",
+				"filter dev eth0 protocol ipv6 parent ffff: prio 11 handle 0x110002 flower ip_proto udp src_port 30002 action mirred egress redirect dev netops-ifb",
+			},
+			[]string{
+				"qdisc dev netops-ifb parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev netops-ifb root handle 17: htb default 30",
+				"class dev netops-ifb parent 17: classid 17:11 htb rate 8000kbit burst 65536 prio 1",
+				"class dev netops-ifb parent 17:11 classid 17:12 htb rate 1000kbit ceil 8000kbit burst 32768 prio 1",
+				"filter dev netops-ifb protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp src_ip 10.0.0.2/32 src_port 30002 classid 17:12",
+				"filter dev netops-ifb protocol ipv6 parent 17: prio 11 handle 0x110002 flower ip_proto udp src_port 30002 classid 17:12",
+			},
+		},
+		{
+			"Delete slice-a removes the IFB device and the ingress qdisc",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.UpdateSliceLifeCycleEvent(ctx, &netops.SliceLifeCycleEvent{SliceName: "slice-a", Event: netops.EventType_EV_DELETE})
+			},
+			[]string{},
+			[]string{},
+		},
+	}
+	ctx := context.Background()
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	t.Setenv("NETWORK_INTERFACE", "eth0")
+	t.Setenv("INGRESS_SHAPING", "true")
+	backend := newFakeTcBackend()
+	s := NewNetOps(backend)
+	err := s.BootstrapNetOpPod()
+	if err != nil {
+		log.Fatal(err)
+	}
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(s)))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := netops.NewNetOpsServiceClient(conn)
+	for _, tt := range tests {
+		t.Run(tt.testCase, func(t *testing.T) {
+			_, err := tt.call(ctx, client)
+			if err != nil {
+				t.Error("Expected no error but got ", err)
+			}
+			expectTcTree(t, s.tc, "eth0", tt.tcTree)
+			expectTcTree(t, s.tc, "netops-ifb", tt.ifbTree)
+		})
+	}
+	if backend.ifbs["netops-ifb"] {
+		t.Error("Expected the IFB device to be deleted")
+	}
+}
+
+// sliceATcTree returns the tc tree of slice-a on an interface once its
+// connection context and QoS profile are in place.
+func sliceATcTree(dev string, filters bool) []string {
+	tree := []string{
+		"qdisc dev " + dev + " parent 17:12 handle 11: sfq perturb 10",
+		"qdisc dev " + dev + " root handle 17: htb default 30",
+		"class dev " + dev + " parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+		"class dev " + dev + " parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+	}
+	if filters {
+		tree = append(tree,
+			"filter dev "+dev+" protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp dst_ip 10.0.0.2/32 dst_port 30002 classid 17:12 action pedit ex munge ip dsfield set 0xb8 retain 0xfc pipe action csum ip pipe",
+			"filter dev "+dev+" protocol ipv6 parent 17: prio 11 handle 0x110002 flower ip_proto udp dst_port 30002 classid 17:12 action pedit ex munge ip6 traffic_class set 0xb8 retain 0xfc pipe",
+		)
+	}
+	return tree
+}
+
+func TestSliceTcTreeMultipleInterfaces(t *testing.T) {
+	addSliceA := func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+		return client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+			SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1, DscpClass: "EF",
+		})
+	}
+	addConContext := func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+		return client.UpdateConnectionContext(ctx, &netops.NetOpConnectionContext{
+			SliceId:                "id-a",
+			LocalSliceGwId:         "gw-a",
+			LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_CLIENT,
+			LocalSliceGwNodePorts:  []string{"30001"},
+			RemoteSliceGwNodePorts: []string{"30002"},
+			RemoteSliceGwNodeIP:    "10.0.0.2",
+		})
+	}
+	delSliceA := func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+		return client.UpdateSliceLifeCycleEvent(ctx, &netops.SliceLifeCycleEvent{SliceName: "slice-a", Event: netops.EventType_EV_DELETE})
+	}
+	type step struct {
+		testCase string
+		call     func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error)
+		eth0Tree []string
+		eth1Tree []string
+		ifaces   []string
+	}
+	tests := []struct {
+		testCase string
+		netIface string
+		steps    []step
+	}{
+		{
+			"Interfaces listed in the config",
+			"eth0, eth1",
+			[]step{
+				{"Add slice-a", addSliceA, sliceATcTree("eth0", false), sliceATcTree("eth1", false), []string{"eth0", "eth1"}},
+				{"Connection context does not add the route interface", addConContext, sliceATcTree("eth0", false), sliceATcTree("eth1", false), []string{"eth0", "eth1"}},
+				{"QoS profile adds the filters on both interfaces", addSliceA, sliceATcTree("eth0", true), sliceATcTree("eth1", true), []string{"eth0", "eth1"}},
+				{"Delete slice-a", delSliceA, []string{}, []string{}, []string{"eth0", "eth1"}},
+			},
+		},
+		{
+			"Interfaces found from the routes",
+			"",
+			[]step{
+				{"Add slice-a", addSliceA, sliceATcTree("eth0", false), []string{}, []string{"eth0"}},
+				{"Connection context adds the interface to the remote node", addConContext, sliceATcTree("eth0", false), sliceATcTree("eth1", false), []string{"eth0", "eth1"}},
+				{"QoS profile adds the filters on both interfaces", addSliceA, sliceATcTree("eth0", true), sliceATcTree("eth1", true), []string{"eth0", "eth1"}},
+				{"Delete slice-a drops the route interface", delSliceA, []string{}, []string{}, []string{"eth0"}},
+			},
+		},
+	}
+	ctx := context.Background()
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	routeInterfaceName = func(ips ...string) (string, error) {
+		if ips[0] == "10.0.0.2" {
+			return "eth1", nil
+		}
+		return "eth0", nil
+	}
+	t.Cleanup(func() { routeInterfaceName = getRouteInterfaceName })
+	for _, tt := range tests {
+		t.Run(tt.testCase, func(t *testing.T) {
+			t.Setenv("NETWORK_INTERFACE", tt.netIface)
+			s := NewNetOps(newFakeTcBackend())
+			err := s.BootstrapNetOpPod()
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(s)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			client := netops.NewNetOpsServiceClient(conn)
+			for _, st := range tt.steps {
+				_, err := st.call(ctx, client)
+				if err != nil {
+					t.Error(st.testCase, "- Expected no error but got ", err)
+				}
+				expectTcTree(t, s.tc, "eth0", st.eth0Tree)
+				expectTcTree(t, s.tc, "eth1", st.eth1Tree)
+				ifaces := []string{}
+				for _, iface := range s.state.netIfaces {
+					ifaces = append(ifaces, iface.name)
+				}
+				if !sameStringSlice(ifaces, st.ifaces) {
+					t.Error(st.testCase, "- Expected interfaces:", st.ifaces, " but got ", ifaces)
+				}
+			}
+		})
+	}
+}
 
+// TestUpdateConnectionContextRouteFailure adds a slice gw whose remote node
+// has no route and expects the slice gw to be kept, with the error in the
+// response and in the status of the slice.
+func TestUpdateConnectionContextRouteFailure(t *testing.T) {
+	ctx := context.Background()
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	t.Setenv("NETWORK_INTERFACE", "")
+	t.Setenv("CHECKPOINT_PATH", "")
+	routeInterfaceName = func(ips ...string) (string, error) {
+		if ips[0] == "10.0.0.2" {
+			return "", errors.New("network is unreachable")
+		}
+		return "eth0", nil
+	}
+	t.Cleanup(func() { routeInterfaceName = getRouteInterfaceName })
+	s := NewNetOps(newFakeTcBackend())
+	err := s.BootstrapNetOpPod()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(s)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := netops.NewNetOpsServiceClient(conn)
+	_, err = client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.UpdateConnectionContext(ctx, &netops.NetOpConnectionContext{
+		SliceId:                "id-a",
+		LocalSliceGwId:         "gw-a",
+		LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_CLIENT,
+		LocalSliceGwNodePorts:  []string{"30001"},
+		RemoteSliceGwNodePorts: []string{"30002"},
+		RemoteSliceGwNodeIP:    "10.0.0.2",
+	})
+	expectErrStr(t, "Testing the slice gw is updated", err, "")
+	expected := "Connection Context Updated in netops pod, failed to shape slice traffic to remote node 10.0.0.2: network is unreachable"
+	if res.GetStatusMsg() != expected {
+		t.Error("Expected :", expected, " but got ", res.GetStatusMsg())
+	}
+	if _, found := s.state.slices["id-a"].sliceGwInfo["gw-a"]; !found {
+		t.Error("Expected the slice gw to be kept")
+	}
+	st, err := client.GetSliceQosStatus(ctx, &netops.SliceQosStatusRequest{SliceId: "id-a"})
+	expectErrStr(t, "Testing the status of the slice", err, "")
+	if st.GetLastApplyError() != "failed to shape slice traffic to remote node 10.0.0.2: network is unreachable" {
+		t.Error("Expected the error in the status of the slice but got ", st.GetLastApplyError())
+	}
+}
+
+func TestDeleteConnectionContext(t *testing.T) {
+	slices := []string{
+		"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+		"qdisc dev eth0 root handle 17: htb default 30",
+		"qdisc dev eth0 parent 17:23 handle 22: tbf rate 3000kbit burst 3750 latency 50ms",
+		"class dev eth0 parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+		"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+		"class dev eth0 parent 17: classid 17:22 htb rate 3000kbit burst 65536",
+		"class dev eth0 parent 17:22 classid 17:23 htb rate 3000kbit ceil 3000kbit burst 32768",
+	}
+	tests := []struct {
+		testCase string
+		call     func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error)
+		errCode  codes.Code
+		// Slice gws left in slice-a
+		sliceGws int
+		tcTree   []string
+	}{
+		{
+			"Port list of gw-a shrinks",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.UpdateConnectionContext(ctx, &netops.NetOpConnectionContext{
+					SliceId:                "id-a",
+					LocalSliceGwId:         "gw-a",
+					LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_SERVER,
+					LocalSliceGwNodePorts:  []string{"30001"},
+					RemoteSliceGwNodePorts: []string{"30002"},
+				})
+			},
+			codes.OK,
+			1,
+			append(slices,
+				"filter dev eth0 protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp src_port 30001 classid 17:12 action pedit ex munge ip dsfield set 0xb8 retain 0xfc pipe action csum ip pipe",
+				"filter dev eth0 protocol ip parent 17: prio 4 handle 0x220001 flower ip_proto udp src_port 30005 classid 17:23",
+				"filter dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110002 flower ip_proto udp src_port 30001 classid 17:12 action pedit ex munge ip6 traffic_class set 0xb8 retain 0xfc pipe",
+				"filter dev eth0 protocol ipv6 parent 17: prio 14 handle 0x220002 flower ip_proto udp src_port 30005 classid 17:23",
+			),
+		},
+		{
+			"Unknown slice gw is ignored",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.DeleteConnectionContext(ctx, &netops.NetOpConnectionContext{SliceId: "id-a", LocalSliceGwId: "gw-x"})
+			},
+			codes.OK,
+			1,
+			append(slices,
+				"filter dev eth0 protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp src_port 30001 classid 17:12 action pedit ex munge ip dsfield set 0xb8 retain 0xfc pipe action csum ip pipe",
+				"filter dev eth0 protocol ip parent 17: prio 4 handle 0x220001 flower ip_proto udp src_port 30005 classid 17:23",
+				"filter dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110002 flower ip_proto udp src_port 30001 classid 17:12 action pedit ex munge ip6 traffic_class set 0xb8 retain 0xfc pipe",
+				"filter dev eth0 protocol ipv6 parent 17: prio 14 handle 0x220002 flower ip_proto udp src_port 30005 classid 17:23",
+			),
+		},
+		{
+			"Delete gw-a",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.DeleteConnectionContext(ctx, &netops.NetOpConnectionContext{SliceId: "id-a", LocalSliceGwId: "gw-a"})
+			},
+			codes.OK,
+			0,
+			append(slices,
+				"filter dev eth0 protocol ip parent 17: prio 4 handle 0x220001 flower ip_proto udp src_port 30005 classid 17:23",
+				"filter dev eth0 protocol ipv6 parent 17: prio 14 handle 0x220002 flower ip_proto udp src_port 30005 classid 17:23",
+			),
+		},
+		{
+			"Slice gw id is missing",
+			func(ctx context.Context, client netops.NetOpsServiceClient) (*netops.Response, error) {
+				return client.DeleteConnectionContext(ctx, &netops.NetOpConnectionContext{SliceId: "id-a"})
+			},
+			codes.InvalidArgument,
+			0,
+			append(slices,
+				"filter dev eth0 protocol ip parent 17: prio 4 handle 0x220001 flower ip_proto udp src_port 30005 classid 17:23",
+				"filter dev eth0 protocol ipv6 parent 17: prio 14 handle 0x220002 flower ip_proto udp src_port 30005 classid 17:23",
+			),
+		},
+	}
+	ctx := context.Background()
+	s, client := newTestNetOps(t, newFakeTcBackend())
+	configureSlicesForAdoption(t, s)
+	// slice-b gets a slice gw of its own, its filters are left alone.
+	_, err := client.UpdateConnectionContext(ctx, &netops.NetOpConnectionContext{
+		SliceId:                "id-b",
+		LocalSliceGwId:         "gw-b",
+		LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_SERVER,
+		LocalSliceGwNodePorts:  []string{"30005"},
+		RemoteSliceGwNodePorts: []string{"30006"},
+	})
+	if err == nil {
+		_, err = client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+			SliceName: "slice-b", SliceId: "id-b", BwCeiling: 3000, BwGuaranteed: 500, Priority: 0, ClassType: netops.ClassType_TBF,
+		})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testCase, func(t *testing.T) {
+			_, err := tt.call(ctx, client)
+			if status.Code(err) != tt.errCode {
+				t.Error("Expected error code ", tt.errCode, " but got ", err)
+			}
+			if len(s.state.slices["id-a"].sliceGwInfo) != tt.sliceGws {
+				t.Error("Expected ", tt.sliceGws, " slice gws but got ", s.state.slices["id-a"].sliceGwInfo)
+			}
+			expectTcTree(t, s.tc, "eth0", tt.tcTree)
+		})
+	}
 }
@@ -22,40 +22,61 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	netops "github.com/kubeslice/netops/pkg/proto"
 
 	"github.com/kubeslice/netops/logger"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
 var (
-	// NetOpHandle is a global handle to store the slice information in a map.
-	NetOpHandle map[string]*SliceInfo
-	// Map of tc class ID to slice name
-	tcClassIdMap map[uint32]string
-	netIface     string
-	// Handle for htb root qdisc. Try to keep the handle ID obscure to avoid
-	// interfering with the exisiting config on the intf.
-	// TODO:
-	// We should choose the handle by reading the existing tc config on the
-	// intf. This can be done when we use a programmable golang package to
-	// manage tc.
-	htbRootHandleId uint32 = 17
-	// This is used to derive parent class for the slice.
-	// Every slice will have a parent class that is attached to the root htb.
-	// We are choosing a multiple of 11 so that we can have 10 classes under the
-	// parent slice class.
-	// Slice 1 would have its parent class ID as 11. While slice 2 would have its
-	// parent class ID as 22 and so on in multiples of 11.
-	// Child classes under slice 1 would range from :12 to :21, while child classes
-	// under slice 2 from :23 to :32.
-	tcParentClassIdMultiple uint32 = 11
-	// Well known internet address for route probe
-	wellKnownPublicIP string = "8.8.8.8"
+	// Class of the traffic not classified to a slice
+	htbDefaultClassId uint32 = 0x30
+	// Every slice will have a parent class that is attached to the root htb,
+	// followed by its child classes, see classIdAllocator.
+	// The parent classes are spread in multiples of 0x11 while there is room so
+	// that a slice can have 16 classes under its parent class.
+	// Slice 1 would have its parent class ID as 17:11. While slice 2 would have its
+	// parent class ID as 17:22 and so on in multiples of 0x11.
+	tcParentClassIdMultiple uint32 = 0x11
+	// Well known internet addresses for route probe
+	wellKnownPublicIP   string = "8.8.8.8"
+	wellKnownPublicIPv6 string = "2001:4860:4860::8888"
+	// Address families the slice gw traffic is classified for. The filters
+	// of both families are installed on dual-stack and single-stack nodes
+	// alike.
+	tcFilterFamilies = []int{netlink.FAMILY_V4, netlink.FAMILY_V6}
+	// Looks up the interface of the route to an IP. Replaced by the tests.
+	routeInterfaceName = getRouteInterfaceName
 )
 
-const MAX_NUM_OF_SLICE uint32 = 100
+// Token bucket config for slices in TBF mode. The bucket size is derived from
+// the bandwidth ceiling of the slice, see tbfBurst.
+const (
+	tbfLatency  uint32 = 50
+	tbfMinBurst uint32 = 1600
+)
+
+// Name of the IFB device netops creates for ingress shaping.
+const ifbIfaceName = "netops-ifb"
+
+// The kernel binds a filter prio to a single protocol, hence the IPv6 filters
+// of a slice gw are added at the prio of the IPv4 ones plus the offset.
+const tcIpv6FilterPrioOffset uint32 = 10
+
+// Slice priorities range from 0, the highest, to MAX_SLICE_PRIORITY. They are
+// used as the htb priority of the slice classes.
+const MAX_SLICE_PRIORITY uint32 = 3
+
+// The kernel picks the prio of a filter added at prio 0, so the filters of the
+// slices of priority 0 are added at this prio instead. The prio of a filter is
+// needed to delete it on its own.
+const tcDefaultFilterPrio uint32 = MAX_SLICE_PRIORITY + 1
 
 func getInterfaceConnectedToBridge(brint string) (string, error) {
 	brlink, err := netlink.LinkByName(brint)
@@ -84,13 +105,46 @@ func getInterfaceConnectedToBridge(brint string) (string, error) {
 	return brint, nil
 }
 
-func getNetworkInterfaceName() (string, error) {
+// getNetworkInterfaceNames returns the interfaces listed in the
+// NETWORK_INTERFACE env var, separated by commas, or the interface of the
+// route to the internet.
+func getNetworkInterfaceNames() ([]string, error) {
 	// If the env var is set, use it instead of auto detecting
 	if os.Getenv("NETWORK_INTERFACE") != "" {
-		return os.Getenv("NETWORK_INTERFACE"), nil
+		names := []string{}
+		for _, name := range strings.Split(os.Getenv("NETWORK_INTERFACE"), ",") {
+			name = strings.TrimSpace(name)
+			if name != "" && !containsString(names, name) {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return nil, errors.New("No interface in NETWORK_INTERFACE")
+		}
+		return names, nil
 	}
 
-	routes, err := netlink.RouteGet(net.ParseIP(wellKnownPublicIP))
+	// Probe the IPv4 route first and fall back to the IPv6 one on IPv6-only
+	// nodes.
+	name, err := routeInterfaceName(wellKnownPublicIP, wellKnownPublicIPv6)
+	if err != nil {
+		return nil, err
+	}
+	return []string{name}, nil
+}
+
+// getRouteInterfaceName returns the interface of the route to the first IP
+// with a route.
+func getRouteInterfaceName(ips ...string) (string, error) {
+	var routes []netlink.Route
+	var err error
+	for _, ip := range ips {
+		routes, err = netlink.RouteGet(net.ParseIP(ip))
+		if err == nil && len(routes) > 0 {
+			break
+		}
+		logger.GlobalLogger.Infof("No route to public IP: %v, err: %v", ip, err)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -122,28 +176,123 @@ func getNetworkInterfaceName() (string, error) {
 	return "", errors.New("Interface not found")
 }
 
-// BootstrapNetOpPod handles the bootstrap of the NetOp Pod.
-func BootstrapNetOpPod() error {
+// BootstrapNetOpPod handles the bootstrap of the NetOp Pod. The pod is not
+// ready until a bootstrap succeeds. Once it has, the RPCs own the state of the
+// slices and the bootstrap is not run again.
+func (s *NetOps) BootstrapNetOpPod() error {
+	if s.health.bootstrapped() {
+		logger.GlobalLogger.Infof("NetOp Pod is already bootstrapped")
+		return nil
+	}
+	err := s.bootstrap()
+	s.health.setBootstrapErr(err)
+	return err
+}
 
-	NetOpHandle = make(map[string]*SliceInfo)
-	tcClassIdMap = make(map[uint32]string)
+// bootstrap discovers the interfaces and restores the tc config of the slices.
+func (s *NetOps) bootstrap() error {
+	defer s.state.lock()()
 
-	var err error
-	netIface, err = getNetworkInterfaceName()
+	s.state.reset()
+
+	names, err := getNetworkInterfaceNames()
+	if err != nil {
+		return err
+	}
+	s.state.netIfaces = nil
+	for _, name := range names {
+		s.state.netIfaces = append(s.state.netIfaces, &IfaceInfo{name: name})
+	}
+	s.state.netIfacesConfigured = os.Getenv("NETWORK_INTERFACE") != ""
+
+	ingressShaping, err := ingressShapingEnabled()
+	if err != nil {
+		return err
+	}
+	s.state.ifbIface = ""
+	if ingressShaping {
+		s.state.ifbIface = ifbIfaceName
+	}
+	s.state.checkpointPath = getCheckpointPath()
+	s.state.pendingGwTTL, err = getPendingGwTTL()
+	if err != nil {
+		return err
+	}
+	s.state.unclaimedTTL, err = getUnclaimedTcTTL()
+	if err != nil {
+		return err
+	}
+
+	mode, err := getTcBootstrapMode()
 	if err != nil {
 		return err
 	}
+	replaceForeign, err := replaceForeignRootEnabled()
+	if err != nil {
+		return err
+	}
+	s.state.keepForeignRoot = mode == TC_BOOTSTRAP_ADOPT && !replaceForeign
 
-	// Start with a clean slate:  delete TC root qdisc
-	err = netOpDelTcRootQdisc()
+	cp, err := s.loadSliceCheckpoint()
+	if err != nil {
+		return err
+	}
+	rootHandleId, err := s.chooseRootHandle(cp)
 	if err != nil {
 		return err
 	}
+	s.state.setRootHandle(rootHandleId)
+
+	if mode == TC_BOOTSTRAP_ADOPT {
+		// Keep the tc config of the slices configured before the restart
+		err = s.adoptTc(cp, replaceForeign)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Start with a clean slate:  delete TC root qdisc and the IFB device
+		err = s.netOpDelTcRootQdisc()
+		if err != nil {
+			return err
+		}
+
+		// Re-apply the slices configured before the restart
+		err = s.restoreCheckpoint(cp)
+		if err != nil {
+			return err
+		}
+	}
 
-	logger.GlobalLogger.Infof("NetOp Pod is Bootstraped Successfully. Using intf: %v", netIface)
+	s.state.restorePendingSliceGws(cp, time.Now())
+
+	// The class IDs may have changed since the checkpoint, with the slices
+	// adopted or reassigned.
+	s.saveCheckpoint()
+
+	logger.GlobalLogger.Infof("NetOp Pod is Bootstraped Successfully. Using intf: %v, root qdisc: %v, ingress shaping: %v, bootstrap mode: %v, slices restored: %v",
+		names, tcHandleStr(s.state.tcRootHandle()), ingressShaping, mode, len(s.state.slices))
 	return nil
 }
 
+// ingressShapingEnabled reports whether the slice gw traffic received on the
+// interface is shaped too. It is enabled with the INGRESS_SHAPING env var.
+func ingressShapingEnabled() (bool, error) {
+	return boolEnv("INGRESS_SHAPING")
+}
+
+// boolEnv returns the value of a boolean env var, false when it is not set.
+func boolEnv(name string) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: %v", name, value, err)
+	}
+	return enabled, nil
+}
+
 func TcCmdError(tcCmd string, err error, cmdOut string) string {
 	errStr := fmt.Sprintf("tc Command: %v execution failed with err: %v and stderr : %v", tcCmd, err, cmdOut)
 	return errStr
@@ -154,9 +303,11 @@ func tcCmdOut(tcCmd string, cmdOut string) string {
 	return output
 }
 
-func tcCmdShowNetInf(netIface string) string {
-	output := fmt.Sprintf("tc qdisc show dev %s", netIface)
-	return output
+func checkSlicePriority(priority uint32) error {
+	if priority > MAX_SLICE_PRIORITY {
+		return fmt.Errorf("invalid priority %d, expected 0-%d", priority, MAX_SLICE_PRIORITY)
+	}
+	return nil
 }
 
 func sliceIdNotFound(sliceID string) string {
@@ -164,197 +315,690 @@ func sliceIdNotFound(sliceID string) string {
 	return output
 }
 
-func netOpAddTcRootQdisc() error {
-	tcCmd := fmt.Sprintf("tc qdisc add dev %s root handle %d: htb default 30", netIface, htbRootHandleId)
-	cmdOut, err := runTcCommand(tcCmd)
+// tcRootHandle returns the handle of the root htb qdisc.
+func (m *sliceStateManager) tcRootHandle() uint32 {
+	return netlink.MakeHandle(uint16(m.rootHandleId), 0)
+}
+
+// tcIngressHandle returns the handle of the ingress qdisc.
+func tcIngressHandle() uint32 {
+	return netlink.MakeHandle(0xffff, 0)
+}
+
+// tcClassHandle returns the fully qualified handle of a class under the root
+// htb qdisc.
+func (m *sliceStateManager) tcClassHandle(classId uint32) uint32 {
+	return netlink.MakeHandle(uint16(m.rootHandleId), uint16(classId))
+}
+
+func (s *NetOps) netOpAddTcRootQdisc() error {
+	if s.state.ifbIface != "" {
+		err := s.netOpAddIfb()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, iface := range s.state.netIfaces {
+		if iface.foreignRoot != "" {
+			// Reported at bootstrap
+			continue
+		}
+		err := s.addTcRootQdisc(iface)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addTcRootQdisc adds the root qdisc on the interface and, with ingress
+// shaping, the ingress qdisc holding the filters that redirect the slice gw
+// traffic to the IFB device.
+func (s *NetOps) addTcRootQdisc(iface *IfaceInfo) error {
+	// tc qdisc replace dev eth0 root handle 17: htb default 30
+	err := s.addHtbRootQdisc(iface.name)
 	if err != nil {
-		errStr := TcCmdError(tcCmd, err, cmdOut)
-		logger.GlobalLogger.Errorf(errStr)
-		return errors.New(errStr)
+		iface.tcErr = err
+		return err
+	}
+
+	if s.state.ifbIface != "" {
+		// tc qdisc add dev eth0 ingress
+		err = s.tcBackend().QdiscAdd(&TcQdisc{
+			Dev:    iface.name,
+			Kind:   tcKindIngress,
+			Parent: netlink.HANDLE_INGRESS,
+			Handle: tcIngressHandle(),
+		})
+		if err != nil && !errors.Is(err, ErrTcObjectExists) {
+			logger.GlobalLogger.Errorf("Failed to add ingress qdisc, err: %v", err)
+			iface.tcErr = err
+			return err
+		}
 	}
-	logger.GlobalLogger.Infof(tcCmdOut(tcCmd, cmdOut))
-	tcCmd = tcCmdShowNetInf(netIface)
-	cmdOut, err = runTcCommand(tcCmd)
+	iface.tcInited = true
+	iface.tcErr = nil
+
+	return nil
+}
+
+func (s *NetOps) addHtbRootQdisc(dev string) error {
+	err := s.tcBackend().QdiscReplace(&TcQdisc{
+		Dev:          dev,
+		Kind:         tcKindHtb,
+		Parent:       netlink.HANDLE_ROOT,
+		Handle:       s.state.tcRootHandle(),
+		DefaultClass: htbDefaultClassId,
+	})
 	if err != nil {
-		errStr := TcCmdError(tcCmd, err, cmdOut)
-		logger.GlobalLogger.Errorf(errStr)
+		logger.GlobalLogger.Errorf("Failed to add root qdisc, err: %v", err)
+		return err
 	}
-	logger.GlobalLogger.Infof(tcCmdOut(tcCmd, cmdOut))
+	logger.GlobalLogger.Infof("Added root qdisc %v on intf: %v", tcHandleStr(s.state.tcRootHandle()), dev)
 
 	return nil
 }
 
-func netOpDelTcRootQdisc() error {
-	tcCmd := fmt.Sprintf("tc qdisc delete dev %s root", netIface)
-	cmdOut, err := runTcCommand(tcCmd)
+func (s *NetOps) netOpDelTcRootQdisc() error {
+	for _, iface := range s.state.netIfaces {
+		err := s.delTcRootQdisc(iface)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.netOpDelIfb()
+}
+
+func (s *NetOps) delTcRootQdisc(iface *IfaceInfo) error {
+	iface.tcInited = false
+	if iface.foreignRoot != "" {
+		return nil
+	}
+	err := s.tcBackend().QdiscDel(&TcQdisc{Dev: iface.name, Parent: netlink.HANDLE_ROOT})
+	if errors.Is(err, ErrTcObjectNotFound) {
+		logger.GlobalLogger.Infof("No root qdisc to delete on intf: %v", iface.name)
+		return nil
+	}
 	if err != nil {
-		errStr := TcCmdError(tcCmd, err, cmdOut)
-		logger.GlobalLogger.Errorf(errStr)
-		return errors.New(errStr)
+		logger.GlobalLogger.Errorf("Failed to delete root qdisc, err: %v", err)
+		return err
+	}
+	logger.GlobalLogger.Infof("Deleted root qdisc on intf: %v", iface.name)
+
+	return nil
+}
+
+// netOpAddIfb adds the IFB device along with its root qdisc.
+func (s *NetOps) netOpAddIfb() error {
+	// ip link add netops-ifb type ifb && ip link set netops-ifb up
+	ifb := &TcIfb{Dev: s.state.ifbIface}
+	err := s.tcBackend().IfbAdd(ifb)
+	if err != nil {
+		logger.GlobalLogger.Errorf("Failed to add IFB device, err: %v", err)
+		return err
+	}
+	logger.GlobalLogger.Infof("Added IFB device %v for ingress shaping", s.state.ifbIface)
+
+	// tc qdisc replace dev netops-ifb root handle 17: htb default 30
+	return s.addHtbRootQdisc(s.state.ifbIface)
+}
+
+// netOpDelIfb deletes the IFB device, along with the slice tc tree on it, and
+// the ingress qdiscs holding the redirect filters. The ingress qdiscs are left
+// alone when there is no IFB device, netops did not add them then.
+func (s *NetOps) netOpDelIfb() error {
+	err := s.tcBackend().IfbDel(&TcIfb{Dev: ifbIfaceName})
+	if errors.Is(err, ErrTcObjectNotFound) {
+		return nil
 	}
-	logger.GlobalLogger.Infof(tcCmdOut(tcCmd, cmdOut))
-	tcCmd = tcCmdShowNetInf(tcCmd)
-	cmdOut, err = runTcCommand(tcCmd)
 	if err != nil {
-		errStr := TcCmdError(tcCmd, err, cmdOut)
-		logger.GlobalLogger.Errorf(errStr)
+		logger.GlobalLogger.Errorf("Failed to delete IFB device, err: %v", err)
+		return err
+	}
+	logger.GlobalLogger.Infof("Deleted IFB device %v", ifbIfaceName)
+
+	for _, iface := range s.state.netIfaces {
+		// tc qdisc del dev eth0 ingress
+		err = s.tcBackend().QdiscDel(&TcQdisc{Dev: iface.name, Kind: tcKindIngress, Parent: netlink.HANDLE_INGRESS})
+		if err != nil && !errors.Is(err, ErrTcObjectNotFound) {
+			logger.GlobalLogger.Errorf("Failed to delete ingress qdisc, err: %v", err)
+			return err
+		}
 	}
-	logger.GlobalLogger.Infof(tcCmdOut(tcCmd, cmdOut))
 
 	return nil
 }
 
-func (s *NetOps) configureTcForSliceGwPort(gwType sliceGwType, localPort string, remotePort string, prio uint32, flowId string) error {
-	//  This command adds a filter to the qdisc 1: of dev eth0, set the
-	//  priority of the filter to 1, matches packets with a
-	//  destination port 32100, and make the class 1:10 process the
-	//  packets that match.
-	tcCmd := ""
-	if gwType == SLICE_GW_CLIENT {
-		tcCmd = fmt.Sprintf("tc filter add dev %s protocol ip parent %d: prio %d u32 match ip dport %s 0xffff flowid %s",
-			netIface, htbRootHandleId, prio, remotePort, flowId)
-	} else if gwType == SLICE_GW_SERVER {
-		tcCmd = fmt.Sprintf("tc filter add dev %s protocol ip parent %d: prio %d u32 match ip sport %s 0xffff flowid %s",
-			netIface, htbRootHandleId, prio, localPort, flowId)
-	} else {
+// addNetIfaceForRemoteNode starts shaping the slice traffic on the interface
+// of the route to the node of a remote slice gw. The interfaces listed in the
+// config are used as is.
+func (s *NetOps) addNetIfaceForRemoteNode(nodeIP string) error {
+	if s.state.netIfacesConfigured || net.ParseIP(nodeIP) == nil {
+		return nil
+	}
+	name, err := routeInterfaceName(nodeIP)
+	if err != nil {
+		logger.GlobalLogger.Errorf("Failed to find the interface to remote node: %v, err: %v", nodeIP, err)
+		return err
+	}
+	if s.state.findNetIface(name) != nil {
+		return nil
+	}
+	s.state.netIfaces = append(s.state.netIfaces, &IfaceInfo{name: name, fromRoute: true})
+	logger.GlobalLogger.Infof("Shaping slice traffic on intf: %v, route to remote node: %v", name, nodeIP)
+
+	return s.syncNetIfaces()
+}
+
+// syncNetIfaces builds the tc tree of the slices on the interfaces that do not
+// have it yet. Nothing is built before the first slice is configured.
+func (s *NetOps) syncNetIfaces() error {
+	if len(s.state.slices) == 0 {
 		return nil
 	}
-	cmdOut, err := runTcCommand(tcCmd)
+	var syncErr error
+	for _, iface := range s.state.netIfaces {
+		if iface.tcInited || iface.foreignRoot != "" {
+			continue
+		}
+		err := s.configureTcOnIface(iface)
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to build slice tc tree on intf: %v, err: %v", iface.name, err)
+			iface.tcInited = false
+			iface.tcErr = err
+			if syncErr == nil {
+				syncErr = err
+			}
+			continue
+		}
+		logger.GlobalLogger.Infof("Built slice tc tree on intf: %v", iface.name)
+	}
+
+	return syncErr
+}
+
+// configureTcOnIface builds the tc tree of the configured slices on an
+// interface, starting from a clean slate so that a failed attempt can be
+// retried.
+func (s *NetOps) configureTcOnIface(iface *IfaceInfo) error {
+	if s.state.keepForeignRoot {
+		err := s.checkForeignRoot(iface)
+		if err != nil {
+			return err
+		}
+	}
+	err := s.delTcRootQdisc(iface)
+	if err != nil {
+		return err
+	}
+	err = s.addTcRootQdisc(iface)
+	if err != nil {
+		return err
+	}
+	// The interface is only used once the whole tree is in place.
+	iface.tcInited = false
+
+	for _, sliceInfo := range s.state.slices {
+		if !sliceInfo.tcInited {
+			continue
+		}
+		err = s.tcBackend().ClassAdd(s.state.sliceParentClass(iface.name, sliceInfo.tcParentClassFqId, sliceInfo.tc))
+		if err != nil {
+			return err
+		}
+		if sliceInfo.tc == nil {
+			// The leaf class of the slice is yet to be configured.
+			continue
+		}
+		err = s.tcBackend().ClassAdd(sliceLeafClass(iface.name, sliceInfo, sliceInfo.tcLeafClassFqId, sliceInfo.tc))
+		if err != nil {
+			return err
+		}
+		err = s.tcBackend().QdiscAdd(sliceLeafQdisc(iface.name, sliceInfo, sliceInfo.tc))
+		if err != nil {
+			return err
+		}
+		for _, gwInfo := range sliceInfo.sliceGwInfo {
+			for _, family := range tcFilterFamilies {
+				if !gwInfo.tcConfigured[family] {
+					continue
+				}
+				for i := range gwInfo.localPorts {
+					egress, err := s.state.sliceGwPortFilter(gwInfo, i, family, gwInfo.tcFilterPrio, sliceInfo.tcLeafClassFqId)
+					if egress == nil {
+						if err != nil {
+							return err
+						}
+						continue
+					}
+					for _, filter := range s.state.sliceGwIfaceFilters(iface.name, egress, sliceInfo.tc) {
+						err = s.tcBackend().FilterAdd(filter)
+						if err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+	iface.tcInited = true
+
+	return nil
+}
+
+func parsePort(port string) (uint16, error) {
+	p, err := strconv.ParseUint(port, 10, 16)
 	if err != nil {
-		errStr := TcCmdError(tcCmd, err, cmdOut)
-		logger.GlobalLogger.Errorf(errStr)
-		return errors.New(errStr)
+		return 0, fmt.Errorf("invalid port %q: %v", port, err)
 	}
-	logger.GlobalLogger.Infof(tcCmdOut(tcCmd, cmdOut))
+	return uint16(p), nil
+}
 
-	tcCmd = fmt.Sprintf("tc filter show dev %s", netIface)
-	cmdOut, err = runTcCommand(tcCmd)
+// sliceGwPortFilter returns the filter classifying the traffic of the address
+// family sent from or to the i-th node port of a slice gw into the leaf class
+// of the slice. It returns nil for an unknown gw type.
+func (m *sliceStateManager) sliceGwPortFilter(gwInfo *SliceGwInfo, i int, family int, prio uint32, flowId uint32) (*TcFilter, error) {
+	filter := &TcFilter{
+		Parent:  m.tcRootHandle(),
+		Prio:    uint16(prio),
+		Family:  family,
+		IPProto: unix.IPPROTO_UDP,
+		ClassId: flowId,
+	}
+	if family == netlink.FAMILY_V6 {
+		filter.Prio += uint16(tcIpv6FilterPrioOffset)
+	}
+	if handles := gwInfo.tcFilterHandles[family]; i < len(handles) {
+		filter.Handle = handles[i]
+	}
+	if gwInfo.protocol == SLICE_GW_TCP {
+		filter.IPProto = unix.IPPROTO_TCP
+	}
+	var err error
+	if gwInfo.gwType == SLICE_GW_CLIENT {
+		filter.DstPort, err = parsePort(gwInfo.remotePorts[i])
+		// The client connects to the node IP of the remote gw, the
+		// traffic of the server may reach the client through a NAT.
+		filter.DstIP = sliceGwRemoteIPNet(gwInfo.remoteNodeIP, family)
+	} else if gwInfo.gwType == SLICE_GW_SERVER {
+		filter.SrcPort, err = parsePort(gwInfo.localPorts[i])
+	} else {
+		return nil, nil
+	}
 	if err != nil {
-		errStr := TcCmdError(tcCmd, err, cmdOut)
-		logger.GlobalLogger.Errorf(errStr)
-		return errors.New(errStr)
+		return nil, err
+	}
+	return filter, nil
+}
+
+// sliceGwIngressFilter returns the filter classifying the slice gw traffic
+// received on the interface into the leaf class of the slice on the IFB
+// device. It matches the replies to the traffic matched by the egress filter.
+func (m *sliceStateManager) sliceGwIngressFilter(egress *TcFilter) *TcFilter {
+	filter := *egress
+	filter.Dev = m.ifbIface
+	filter.SrcIP, filter.DstIP = egress.DstIP, egress.SrcIP
+	filter.SrcPort, filter.DstPort = egress.DstPort, egress.SrcPort
+	filter.MarkDscp, filter.Dscp = false, 0
+	return &filter
+}
+
+// sliceGwRedirectFilter returns the filter redirecting the traffic matched
+// by the ingress filter from the interface to the IFB device.
+func (m *sliceStateManager) sliceGwRedirectFilter(dev string, ingress *TcFilter) *TcFilter {
+	filter := *ingress
+	filter.Dev = dev
+	filter.Parent = tcIngressHandle()
+	filter.ClassId = 0
+	filter.RedirectDev = m.ifbIface
+	return &filter
+}
+
+// sliceGwIfaceFilters returns the filters of a slice gw port on an
+// interface: the egress filter marking the traffic with the DSCP class of the
+// slice and, with ingress shaping, the filter redirecting the received
+// traffic to the IFB device.
+func (m *sliceStateManager) sliceGwIfaceFilters(dev string, egress *TcFilter, tc *TcInfo) []*TcFilter {
+	filter := *egress
+	filter.Dev = dev
+	filter.MarkDscp = tc.markDscp
+	filter.Dscp = tc.dscp
+	filters := []*TcFilter{&filter}
+	if m.ifbIface != "" {
+		filters = append(filters, m.sliceGwRedirectFilter(dev, m.sliceGwIngressFilter(egress)))
+	}
+	return filters
+}
+
+// sliceGwRemoteIPNet returns the node IP of the remote slice gw as a host
+// prefix, or nil when the IP is not set or of another family.
+func sliceGwRemoteIPNet(nodeIP string, family int) *net.IPNet {
+	ip := net.ParseIP(nodeIP)
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		if family != netlink.FAMILY_V4 {
+			return nil
+		}
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	if family != netlink.FAMILY_V6 {
+		return nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+func (s *NetOps) configureTcForSliceGwPort(gwInfo *SliceGwInfo, i int, family int, prio uint32, tc *TcInfo, flowId uint32) error {
+	//  This command adds a filter to the qdisc 17: of dev eth0, set the
+	//  priority of the filter to 1, matches the UDP packets with a
+	//  destination port 32100, and make the class 17:12 process the
+	//  packets that match. The packets are marked with the DSCP class of
+	//  the slice if there is one:
+	//  tc filter add dev eth0 protocol ip parent 17: prio 1 flower ip_proto udp dst_port 32100 classid 17:12 \
+	//      action pedit ex munge ip dsfield set 0xb8 retain 0xfc
+	//  The IPv6 traffic is matched by the equivalent filter at prio 11:
+	//  tc filter add dev eth0 protocol ipv6 parent 17: prio 11 flower ip_proto udp dst_port 32100 classid 17:12 \
+	//      action pedit ex munge ip6 traffic_class set 0xb8 retain 0xfc
+	//  The filters are added on every interface the slice traffic is
+	//  shaped on.
+	egress, err := s.state.sliceGwPortFilter(gwInfo, i, family, prio, flowId)
+	if egress == nil {
+		return err
+	}
+	filters := []*TcFilter{}
+	if s.state.ifbIface != "" {
+		//  With ingress shaping, the traffic received from the remote gw is
+		//  classified on the IFB device the ingress qdiscs redirect it to:
+		//  tc filter add dev netops-ifb protocol ip parent 17: prio 1 flower ip_proto udp src_port 32100 classid 17:12
+		//  tc filter add dev eth0 protocol ip parent ffff: prio 1 flower ip_proto udp src_port 32100 \
+		//      action mirred egress redirect dev netops-ifb
+		filters = append(filters, s.state.sliceGwIngressFilter(egress))
+	}
+	for _, dev := range s.state.tcIfaceNames() {
+		filters = append(filters, s.state.sliceGwIfaceFilters(dev, egress, tc)...)
+	}
+	for _, filter := range filters {
+		err = s.tcBackend().FilterAdd(filter)
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to add filter for slice gw port, err: %v", err)
+			return err
+		}
+		logger.GlobalLogger.Infof("Added filter: %v", filter)
+	}
+
+	return nil
+}
+
+// sliceFilterPrio returns the prio of the filters of the slice gw ports.
+func sliceFilterPrio(tc *TcInfo) uint32 {
+	if tc.priority == 0 {
+		return tcDefaultFilterPrio
 	}
-	logger.GlobalLogger.Infof(tcCmdOut(tcCmd, cmdOut))
+	return tc.priority
+}
 
+// allocFilterHandles assigns the handles of the filters of the slice gw ports
+// for the address family, unless the gw has them already. The handles of a
+// slice are made of its class ID and a number unique within the slice, so
+// that they do not clash with the filters of the other slices at the same
+// prio.
+func allocFilterHandles(sliceInfo *SliceInfo, gwInfo *SliceGwInfo, family int) error {
+	if len(gwInfo.tcFilterHandles[family]) == len(gwInfo.localPorts) {
+		return nil
+	}
+	used := map[uint32]bool{}
+	for _, gw := range sliceInfo.sliceGwInfo {
+		for _, handles := range gw.tcFilterHandles {
+			for _, handle := range handles {
+				used[handle] = true
+			}
+		}
+	}
+	handles := []uint32{}
+	for minor := uint32(1); minor <= 0xffff && len(handles) < len(gwInfo.localPorts); minor++ {
+		handle := netlink.MakeHandle(uint16(sliceInfo.tcParentClassId), uint16(minor))
+		if !used[handle] {
+			handles = append(handles, handle)
+		}
+	}
+	if len(handles) < len(gwInfo.localPorts) {
+		return fmt.Errorf("no free filter handle for slice: %v", sliceInfo.sliceName)
+	}
+	if gwInfo.tcFilterHandles == nil {
+		gwInfo.tcFilterHandles = make(map[int][]uint32)
+	}
+	gwInfo.tcFilterHandles[family] = handles
 	return nil
 }
 
 func (s *NetOps) configureTcForSliceGw(sliceID string, newTc *TcInfo) error {
-	sliceInfo, found := NetOpHandle[sliceID]
+	sliceInfo, found := s.state.slices[sliceID]
 	if !found {
 		errVal := sliceIdNotFound(sliceID)
 		return errors.New(errVal)
 	}
 	for k := range sliceInfo.sliceGwInfo {
-		if !sliceInfo.sliceGwInfo[k].tcConfigured {
-			for i := range sliceInfo.sliceGwInfo[k].localPorts {
-				err := s.configureTcForSliceGwPort(
-					sliceInfo.sliceGwInfo[k].gwType,
-					sliceInfo.sliceGwInfo[k].localPorts[i],
-					sliceInfo.sliceGwInfo[k].remotePorts[i],
-					sliceInfo.tc.priority, sliceInfo.tcLeafClassFqId)
+		gwInfo := sliceInfo.sliceGwInfo[k]
+		if len(gwInfo.tcConfigured) == 0 {
+			gwInfo.tcConfigured = make(map[int]bool)
+			gwInfo.tcFilterPrio = sliceFilterPrio(sliceInfo.tc)
+		}
+		// The filters of a family already configured stay at the prio they
+		// were added with.
+		for _, family := range tcFilterFamilies {
+			if gwInfo.tcConfigured[family] {
+				continue
+			}
+			err := allocFilterHandles(sliceInfo, gwInfo, family)
+			if err != nil {
+				return err
+			}
+			for i := range gwInfo.localPorts {
+				err := s.configureTcForSliceGwPort(gwInfo, i, family, gwInfo.tcFilterPrio,
+					sliceInfo.tc, sliceInfo.tcLeafClassFqId)
 				if err != nil {
 					return err
 				}
 			}
-			sliceInfo.sliceGwInfo[k].tcConfigured = true
+			gwInfo.tcConfigured[family] = true
 		}
 	}
 
 	return nil
 }
 
-func (s *NetOps) deleteTcForSliceGwAll() error {
-	tcCmd := fmt.Sprintf("tc filter delete dev %s parent %d:", netIface, htbRootHandleId)
-	cmdOut, err := runTcCommand(tcCmd)
-	if err != nil {
-		errStr := TcCmdError(tcCmd, err, cmdOut)
-		logger.GlobalLogger.Errorf(errStr)
-		return err
+// updateSliceGwDscp rewrites the DSCP marking of the filters already
+// configured for the slice gws. The filters stay at the prio they were added
+// with.
+func (s *NetOps) updateSliceGwDscp(sliceID string, newTc *TcInfo) error {
+	sliceInfo := s.state.slices[sliceID]
+	for k := range sliceInfo.sliceGwInfo {
+		gwInfo := sliceInfo.sliceGwInfo[k]
+		for _, family := range tcFilterFamilies {
+			if !gwInfo.tcConfigured[family] {
+				continue
+			}
+			for i := range gwInfo.localPorts {
+				egress, err := s.state.sliceGwPortFilter(gwInfo, i, family, gwInfo.tcFilterPrio, sliceInfo.tcLeafClassFqId)
+				if egress == nil {
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				for _, dev := range s.state.tcIfaceNames() {
+					filter := s.state.sliceGwIfaceFilters(dev, egress, newTc)[0]
+					err = s.tcBackend().FilterReplace(filter)
+					if err != nil {
+						logger.GlobalLogger.Errorf("Failed to update DSCP marking for slice gw port, err: %v", err)
+						return err
+					}
+					logger.GlobalLogger.Infof("Updated filter: %v", filter)
+				}
+			}
+		}
 	}
 
-	logger.GlobalLogger.Infof("Deleting tc config for all slice GWsi across all slices\n")
-
 	return nil
 }
 
-func (s *NetOps) invalidateSliceGwTcConfig(sliceID string) {
-	_, found := NetOpHandle[sliceID]
-	if !found {
-		return
-	}
-	for k := range NetOpHandle[sliceID].sliceGwInfo {
-		NetOpHandle[sliceID].sliceGwInfo[k].tcConfigured = false
+// deleteTcForSliceGw deletes the filters of the slice gw ports on all the
+// devices. The filters of the other slice gws are left alone.
+func (s *NetOps) deleteTcForSliceGw(sliceInfo *SliceInfo, gwInfo *SliceGwInfo) error {
+	for _, family := range tcFilterFamilies {
+		if !gwInfo.tcConfigured[family] {
+			continue
+		}
+		for i := range gwInfo.localPorts {
+			egress, err := s.state.sliceGwPortFilter(gwInfo, i, family, gwInfo.tcFilterPrio, sliceInfo.tcLeafClassFqId)
+			if egress == nil {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if egress.Handle == 0 || egress.Prio == 0 {
+				return fmt.Errorf("unknown handle of the filters of slice gw: %v port: %v", gwInfo.sliceGwId, gwInfo.localPorts[i])
+			}
+			filters := []*TcFilter{}
+			if s.state.ifbIface != "" {
+				filters = append(filters, s.state.sliceGwIngressFilter(egress))
+			}
+			for _, dev := range s.state.tcIfaceNames() {
+				filters = append(filters, s.state.sliceGwIfaceFilters(dev, egress, sliceInfo.tc)...)
+			}
+			for _, filter := range filters {
+				// tc filter del dev eth0 protocol ip parent 17: prio 1 handle 0x110001 flower
+				err = s.tcBackend().FilterDel(filter)
+				if err != nil && !errors.Is(err, ErrTcObjectNotFound) {
+					logger.GlobalLogger.Errorf("Failed to delete filter for slice gw port, err: %v", err)
+					return err
+				}
+				logger.GlobalLogger.Infof("Deleted filter: %v", filter.selector())
+			}
+		}
+		delete(gwInfo.tcConfigured, family)
+		delete(gwInfo.tcFilterHandles, family)
 	}
-	logger.GlobalLogger.Infof("Invalidated tc config for slice GWs. slice id: %s\n", sliceID)
+
+	return nil
 }
 
 func (s *NetOps) configureParentTcForSlice(sliceID string, newTc *TcInfo) error {
 	// Create a tc class object for the slice under the root qdisc. We will have a parent
 	// class under root qdisc for each slice.
-	// tc class add dev eth0 parent 17: classid 17:1 htb rate 5mbit burst 64k
-	classIdStr := fmt.Sprintf("%d:%d", htbRootHandleId, NetOpHandle[sliceID].tcParentClassId)
-	tcCmd := fmt.Sprintf("tc class add dev %s parent %d: classid %s htb rate %dkbit burst 64k",
-		netIface, htbRootHandleId, classIdStr, newTc.bwCeiling)
-	cmdOut, err := runTcCommand(tcCmd)
-	if err != nil {
-		errStr := TcCmdError(tcCmd, err, cmdOut)
-		logger.GlobalLogger.Errorf(errStr)
-		return errors.New(errStr)
-	}
-	logger.GlobalLogger.Infof(tcCmdOut(tcCmd, cmdOut))
-	tcCmd = tcCmdShowNetInf(netIface)
-	cmdOut, err = runTcCommand(tcCmd)
-	if err != nil {
-		errStr := TcCmdError(tcCmd, err, cmdOut)
-		logger.GlobalLogger.Errorf(errStr)
+	// tc class add dev eth0 parent 17: classid 17:11 htb rate 5mbit burst 64k
+	handle := s.state.tcClassHandle(s.state.slices[sliceID].tcParentClassId)
+	for _, dev := range s.state.tcDevs() {
+		class := s.state.sliceParentClass(dev, handle, newTc)
+		err := s.tcBackend().ClassAdd(class)
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to add parent class for slice: %v, err: %v", sliceID, err)
+			return err
+		}
+		logger.GlobalLogger.Infof("Added parent class: %v", class)
 	}
-	logger.GlobalLogger.Infof(tcCmdOut(tcCmd, cmdOut))
 
-	NetOpHandle[sliceID].tcParentClassFqId = classIdStr
-	NetOpHandle[sliceID].tcInited = true
+	s.state.slices[sliceID].tcParentClassFqId = handle
+	s.state.slices[sliceID].tcInited = true
 
 	return nil
 }
 
 func (s *NetOps) deleteTcForSlice(sliceID string) error {
-	sliceInfo, found := NetOpHandle[sliceID]
+	sliceInfo, found := s.state.slices[sliceID]
 	if !found {
 		logger.GlobalLogger.Infof("Delete slice tc: SliceId %v is not found", sliceID)
 		return nil
 	}
 
-	err := s.deleteTcForSliceGwAll()
-	if err != nil {
-		logger.GlobalLogger.Errorf("Failed to delete TC settings for sliceGWs: %v, err: %v", sliceID, err)
-		return err
+	for _, gwInfo := range sliceInfo.sliceGwInfo {
+		err := s.deleteTcForSliceGw(sliceInfo, gwInfo)
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to delete TC settings for sliceGWs: %v, err: %v", sliceID, err)
+			return err
+		}
 	}
 
-	// Delete the leaf class for the slice
-	tcCmd := fmt.Sprintf("tc class delete dev %s parent %s classid %s",
-		netIface, sliceInfo.tcParentClassFqId, sliceInfo.tcLeafClassFqId)
-	cmdOut, err := runTcCommand(tcCmd)
-	if err != nil {
-		errStr := TcCmdError(tcCmd, err, cmdOut)
-		logger.GlobalLogger.Errorf(errStr)
-		// Do not return error yet. Lets try deleting the parent class which would in turn cleanup the child classes.
+	if !sliceInfo.tcInited {
+		// No classes were configured for the slice yet.
+		return nil
 	}
 
-	// Delete the parent class for the slice
-	tcCmd = fmt.Sprintf("tc class delete dev %s parent %d: classid %s",
-		netIface, htbRootHandleId, sliceInfo.tcParentClassFqId)
-	cmdOut, err = runTcCommand(tcCmd)
-	if err != nil {
-		errStr := TcCmdError(tcCmd, err, cmdOut)
-		logger.GlobalLogger.Errorf(errStr)
-		return err
+	return s.deleteSliceClasses(sliceID, sliceInfo.tcParentClassId)
+}
+
+// deleteSliceClasses deletes the classes of the slice with the parent class
+// ID on all the devices. The leaf qdisc goes along with the leaf class.
+func (s *NetOps) deleteSliceClasses(sliceID string, parentClassId uint32) error {
+	// The leaf class is the first child class of the slice.
+	children := s.state.classIds.children(parentClassId)
+	if children == 0 {
+		children = sliceChildClasses
+	}
+	for _, dev := range s.state.tcDevs() {
+		// Delete the child classes for the slice, the leaf class last
+		for id := parentClassId + children; id > parentClassId; id-- {
+			err := s.tcBackend().ClassDel(&TcClass{
+				Dev:    dev,
+				Parent: s.state.tcClassHandle(parentClassId),
+				Handle: s.state.tcClassHandle(id),
+			})
+			if err != nil {
+				logger.GlobalLogger.Errorf("Failed to delete child class %v for slice: %v, err: %v", tcHandleStr(s.state.tcClassHandle(id)), sliceID, err)
+				// Do not return error yet. Lets try deleting the parent class which would in turn cleanup the child classes.
+			}
+		}
+
+		// Delete the parent class for the slice
+		err := s.tcBackend().ClassDel(&TcClass{
+			Dev:    dev,
+			Parent: s.state.tcRootHandle(),
+			Handle: s.state.tcClassHandle(parentClassId),
+		})
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to delete parent class for slice: %v, err: %v", sliceID, err)
+			return err
+		}
 	}
 
 	return nil
 }
 
+// deleteUnclaimedSlices deletes the tc config found on the node that no slice
+// claimed, along with the root qdisc when there are no slices.
+func (s *NetOps) deleteUnclaimedSlices() error {
+	ids := []uint32{}
+	for id := range s.state.unclaimed {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		err := s.deleteSliceClasses(tcHandleStr(s.state.tcClassHandle(id)), id)
+		if err != nil {
+			return err
+		}
+		s.state.classIds.free(id)
+		delete(s.state.unclaimed, id)
+		logger.GlobalLogger.Infof("Deleted unclaimed tc config of class ID: %v", tcHandleStr(s.state.tcClassHandle(id)))
+	}
+	if len(ids) != 0 && len(s.state.slices) == 0 {
+		logger.GlobalLogger.Infof("Deleting root tc config as no slices present on the node\n")
+		err := s.netOpDelTcRootQdisc()
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to delete root qdisc, err: %v\n", err)
+		}
+		s.state.dropRouteNetIfaces()
+	}
+	return nil
+}
+
 func (s *NetOps) configureTcForSlice(sliceID string, newTc *TcInfo) error {
-	sliceInfo, found := NetOpHandle[sliceID]
+	sliceInfo, found := s.state.slices[sliceID]
 	if !found {
 		errVal := sliceIdNotFound(sliceID)
 		return errors.New(errVal)
@@ -367,24 +1011,27 @@ func (s *NetOps) configureTcForSlice(sliceID string, newTc *TcInfo) error {
 			return nil
 		} else {
 			logger.GlobalLogger.Infof("Slice TC params updated. Old: %v, New: %v", sliceInfo.tc, newTc)
-			// Modify parent class config
-			tcCmd := fmt.Sprintf("tc class replace dev %s parent %d: classid %s htb rate %dkbit burst 64k",
-				netIface, htbRootHandleId, sliceInfo.tcParentClassFqId, newTc.bwCeiling)
-			cmdOut, err := runTcCommand(tcCmd)
-			if err != nil {
-				errStr := TcCmdError(tcCmd, err, cmdOut)
-				logger.GlobalLogger.Errorf(errStr)
-				return errors.New(errStr)
-			}
+			for _, dev := range s.state.tcDevs() {
+				// Modify parent class config
+				err := s.tcBackend().ClassReplace(s.state.sliceParentClass(dev, sliceInfo.tcParentClassFqId, newTc))
+				if err != nil {
+					logger.GlobalLogger.Errorf("Failed to update parent class for slice: %v, err: %v", sliceID, err)
+					return err
+				}
 
-			// Modify leaf class config
-			tcCmd = fmt.Sprintf("tc class replace dev %s parent %s classid %s htb rate %dkbit ceil %dkbit burst 32k",
-				netIface, sliceInfo.tcParentClassFqId, sliceInfo.tcLeafClassFqId, newTc.bwGuaranteed, newTc.bwCeiling)
-			cmdOut, err = runTcCommand(tcCmd)
-			if err != nil {
-				errStr := TcCmdError(tcCmd, err, cmdOut)
-				logger.GlobalLogger.Errorf(errStr)
-				return errors.New(errStr)
+				// Modify leaf class config
+				err = s.tcBackend().ClassReplace(sliceLeafClass(dev, sliceInfo, sliceInfo.tcLeafClassFqId, newTc))
+				if err != nil {
+					logger.GlobalLogger.Errorf("Failed to update leaf class for slice: %v, err: %v", sliceID, err)
+					return err
+				}
+
+				// Modify leaf qdisc config
+				err = s.updateSliceLeafQdisc(dev, sliceID, sliceInfo.tc, newTc)
+				if err != nil {
+					logger.GlobalLogger.Errorf("Failed to update leaf qdisc for slice: %v, err: %v", sliceID, err)
+					return err
+				}
 			}
 			sliceInfo.tc = newTc
 			return nil
@@ -399,61 +1046,147 @@ func (s *NetOps) configureTcForSlice(sliceID string, newTc *TcInfo) error {
 		sliceInfo.tcInited = true
 	}
 
-	// Based on the numSlices create the child class id
-	// # Class 1:10, which has a rate of 3mbit
-	// %tc class add dev eth0 parent 1:1 classid 1:10 htb rate 3mbit ceil 5mbit burst 32k
-	// TODO:
-	// We only have one child class under the parent class right now. Hence, incrementing by 1 to form
-	// the child class ID is ok for now. Needs to be modified if there is a use case in the future that
-	// requires us to create multiple child classes under the parent class.
-	classID := fmt.Sprintf("%d:%d", htbRootHandleId, sliceInfo.tcParentClassId+1)
-	tcCmd := fmt.Sprintf("tc class add dev %s parent %s classid %s htb rate %dkbit ceil %dkbit burst 32k",
-		netIface, sliceInfo.tcParentClassFqId, classID, newTc.bwGuaranteed, newTc.bwCeiling)
-	cmdOut, err := runTcCommand(tcCmd)
-	if err != nil {
-		errStr := TcCmdError(tcCmd, err, cmdOut)
-		logger.GlobalLogger.Errorf(errStr)
-		return errors.New(errStr)
+	// The leaf class is the first child class of the slice, its ID follows the one of the parent class,
+	// see classIdAllocator.
+	// # Class 17:12, which has a rate of 3mbit
+	// %tc class add dev eth0 parent 17:11 classid 17:12 htb rate 3mbit ceil 5mbit burst 32k
+	s.state.slices[sliceID].tcLeafClassFqId = s.state.tcClassHandle(sliceInfo.tcParentClassId + 1)
+	for _, dev := range s.state.tcDevs() {
+		leafClass := sliceLeafClass(dev, sliceInfo, sliceInfo.tcLeafClassFqId, newTc)
+		err := s.tcBackend().ClassAdd(leafClass)
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to add leaf class for slice: %v, err: %v", sliceID, err)
+			return err
+		}
+		logger.GlobalLogger.Infof("Added leaf class: %v", leafClass)
+
+		// Martin Devera, author of HTB, then recommends SFQ for beneath these classes:
+		// tc qdisc add dev eth0 parent 17:12 handle 11: sfq perturb 10
+		// Slices in TBF mode are shaped by a token bucket instead:
+		// tc qdisc add dev eth0 parent 17:12 handle 11: tbf rate 5mbit burst 6250 latency 50ms
+		qdisc := sliceLeafQdisc(dev, sliceInfo, newTc)
+		err = s.tcBackend().QdiscAdd(qdisc)
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to add leaf qdisc for slice: %v, err: %v", sliceID, err)
+			return err
+		}
+		logger.GlobalLogger.Infof("Added leaf qdisc: %v", qdisc)
 	}
-	logger.GlobalLogger.Infof(tcCmdOut(tcCmd, cmdOut))
-	NetOpHandle[sliceID].tcLeafClassFqId = classID
 
-	// Martin Devera, author of HTB, then recommends SFQ for beneath these classes:
-	handleID := fmt.Sprintf("%d", sliceInfo.tcParentClassId)
-	tcCmd = fmt.Sprintf("tc qdisc add dev %s parent %s handle %s: sfq perturb 10", netIface, classID, handleID)
-	cmdOut, err = runTcCommand(tcCmd)
-	if err != nil {
-		errStr := TcCmdError(tcCmd, err, cmdOut)
-		logger.GlobalLogger.Errorf(errStr)
-		return errors.New(errStr)
+	sliceInfo.tc = newTc
+
+	return nil
+}
+
+// sliceParentClass returns the parent class of the slice under the root
+// qdisc. The priority of the slice is set on both its classes so that the
+// slice is served in order of priority when borrowing spare bandwidth.
+func (m *sliceStateManager) sliceParentClass(dev string, handle uint32, tc *TcInfo) *TcClass {
+	return &TcClass{
+		Dev:    dev,
+		Parent: m.tcRootHandle(),
+		Handle: handle,
+		Rate:   uint64(tc.bwCeiling),
+		Burst:  64 * 1024,
+		Prio:   tc.priority,
 	}
-	logger.GlobalLogger.Infof(tcCmdOut(tcCmd, cmdOut))
+}
 
-	tcCmd = tcCmdShowNetInf(netIface)
-	cmdOut, err = runTcCommand(tcCmd)
-	if err != nil {
-		errStr := TcCmdError(tcCmd, err, cmdOut)
-		logger.GlobalLogger.Errorf(errStr)
+// sliceLeafClass returns the leaf class of the slice. In TBF mode the slice
+// is shaped by the tbf qdisc under the class, hence the class is not allowed
+// to throttle the slice below its ceiling.
+func sliceLeafClass(dev string, sliceInfo *SliceInfo, handle uint32, tc *TcInfo) *TcClass {
+	class := &TcClass{
+		Dev:    dev,
+		Parent: sliceInfo.tcParentClassFqId,
+		Handle: handle,
+		Rate:   uint64(tc.bwGuaranteed),
+		Ceil:   uint64(tc.bwCeiling),
+		Burst:  32 * 1024,
+		Prio:   tc.priority,
+	}
+	if tc.class == CLASS_TYPE_TBF {
+		class.Rate = uint64(tc.bwCeiling)
 	}
-	logger.GlobalLogger.Infof(tcCmdOut(tcCmd, cmdOut))
+	return class
+}
 
-	sliceInfo.tc = newTc
+// sliceLeafQdisc returns the qdisc attached to the leaf class of the slice.
+func sliceLeafQdisc(dev string, sliceInfo *SliceInfo, tc *TcInfo) *TcQdisc {
+	qdisc := &TcQdisc{
+		Dev:    dev,
+		Parent: sliceInfo.tcLeafClassFqId,
+		Handle: netlink.MakeHandle(uint16(sliceInfo.tcParentClassId), 0),
+	}
+	if tc.class == CLASS_TYPE_TBF {
+		qdisc.Kind = tcKindTbf
+		qdisc.Rate = uint64(tc.bwCeiling)
+		qdisc.Burst = tbfBurst(tc.bwCeiling)
+		qdisc.Latency = tbfLatency
+	} else {
+		qdisc.Kind = tcKindSfq
+		qdisc.Perturb = 10
+	}
+	return qdisc
+}
+
+// tbfBurst returns the bucket size for a tbf qdisc shaping at the rate, which
+// is the traffic sent in 10ms. The bucket has to hold at least one full sized
+// packet.
+func tbfBurst(rate uint32) uint32 {
+	burst := uint32(uint64(rate) * 1000 / 8 / 100)
+	if burst < tbfMinBurst {
+		return tbfMinBurst
+	}
+	return burst
+}
+
+// updateSliceLeafQdisc applies the change in the tc params of the slice to
+// its leaf qdisc. The kind of a qdisc cannot be changed in place, so the
+// qdisc is swapped when the slice moves between the HTB and TBF modes.
+func (s *NetOps) updateSliceLeafQdisc(dev string, sliceID string, oldTc *TcInfo, newTc *TcInfo) error {
+	sliceInfo := s.state.slices[sliceID]
+	qdisc := sliceLeafQdisc(dev, sliceInfo, newTc)
+	if oldTc.class == newTc.class {
+		if newTc.class != CLASS_TYPE_TBF || oldTc.bwCeiling == newTc.bwCeiling {
+			return nil
+		}
+		return s.tcBackend().QdiscReplace(qdisc)
+	}
+
+	err := s.tcBackend().QdiscDel(&TcQdisc{Dev: dev, Parent: sliceInfo.tcLeafClassFqId})
+	if err != nil && !errors.Is(err, ErrTcObjectNotFound) {
+		return err
+	}
+	err = s.tcBackend().QdiscAdd(qdisc)
+	if err != nil {
+		return err
+	}
+	logger.GlobalLogger.Infof("Slice: %v moved to %v mode, leaf qdisc: %v", sliceID, newTc.class, qdisc)
 
 	return nil
 }
 
 func (s *NetOps) enforceSliceTc(sliceID string, newTc *TcInfo) error {
-	_, found := NetOpHandle[sliceID]
+	sliceInfo, found := s.state.slices[sliceID]
 	if !found {
 		errVal := sliceIdNotFound(sliceID)
 		return errors.New(errVal)
 	}
 
+	oldTc := sliceInfo.tc
 	err := s.configureTcForSlice(sliceID, newTc)
 	if err != nil {
 		return err
 	}
 
+	if oldTc != nil && (oldTc.markDscp != newTc.markDscp || oldTc.dscp != newTc.dscp) {
+		err = s.updateSliceGwDscp(sliceID, newTc)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = s.configureTcForSliceGw(sliceID, newTc)
 	if err != nil {
 		logger.GlobalLogger.Errorf(err.Error(), "err while configuring Tc For sliceGW")
@@ -463,49 +1196,76 @@ func (s *NetOps) enforceSliceTc(sliceID string, newTc *TcInfo) error {
 	return nil
 }
 
-func (s *NetOps) getClassIdForSlice(sliceName string) (uint32, error) {
-	var i uint32 = 0
-	for i = 1; i <= MAX_NUM_OF_SLICE; i++ {
-		_, found := tcClassIdMap[i*tcParentClassIdMultiple]
-		if !found {
-			return i * tcParentClassIdMultiple, nil
-		}
+func (s *NetOps) enforceSliceQosPolicy(sliceID string, sliceName string, qosProfile *SliceQosProfile) error {
+	err := checkSlicePriority(qosProfile.priority)
+	if err != nil {
+		return err
+	}
+	dscp, markDscp, err := parseDscpClass(qosProfile.dscpClass)
+	if err != nil {
+		return err
 	}
 
-	return 0, errors.New("could not find a free class ID")
+	// Build the tc tree on the interfaces it could not be built on before.
+	syncErr := s.syncNetIfaces()
+
+	// The profile is applied as a whole or not at all.
+	err = s.inTcTxn(func() error {
+		return s.applySliceQosProfile(sliceID, sliceName, qosProfile, markDscp, dscp)
+	})
+	if sliceInfo, found := s.state.slices[sliceID]; found {
+		sliceInfo.tcErr = err
+	}
+	if err != nil {
+		return err
+	}
+
+	return syncErr
 }
 
-func (s *NetOps) enforceSliceQosPolicy(sliceID string, sliceName string, qosProfile *SliceQosProfile) error {
-	_, found := NetOpHandle[sliceID]
+// applySliceQosProfile adds the slice when it is new and applies its QoS
+// profile to the tc config of the slice and of its slice gws.
+func (s *NetOps) applySliceQosProfile(sliceID string, sliceName string, qosProfile *SliceQosProfile, markDscp bool, dscp uint8) error {
+	sliceTc := &TcInfo{
+		class:        qosProfile.class,
+		bwCeiling:    qosProfile.bwCeiling,
+		bwGuaranteed: qosProfile.bwGuaranteed,
+		priority:     qosProfile.priority,
+		markDscp:     markDscp,
+		dscp:         dscp,
+	}
+
+	_, found := s.state.slices[sliceID]
 	if !found {
-		if len(NetOpHandle) == 0 {
+		if len(s.state.slices) == 0 && len(s.state.unclaimed) == 0 {
 			// Add root qdisc
 			// tc qdisc add dev eth0 root handle 1: htb default 30
-			err := netOpAddTcRootQdisc()
+			err := s.netOpAddTcRootQdisc()
 			if err != nil {
 				return err
 			}
 		}
-		NetOpHandle[sliceID] = &SliceInfo{}
-		NetOpHandle[sliceID].sliceName = sliceName
-		NetOpHandle[sliceID].qosProfile = qosProfile
-		parentClassId, err := s.getClassIdForSlice(sliceName)
-		if err != nil {
-			logger.GlobalLogger.Errorf("Failed to assign class ID for slice: %v, err: %v", sliceName, err)
-			return err
+		s.state.slices[sliceID] = &SliceInfo{}
+		s.state.slices[sliceID].sliceName = sliceName
+		// The slice takes over the tc config found for it on the node, if
+		// any.
+		parentClassId := s.state.claimSliceTc(s.state.slices[sliceID], sliceTc)
+		if parentClassId != 0 {
+			logger.GlobalLogger.Infof("Claimed tc config of class ID: %v for slice: %v", parentClassId, sliceName)
+		} else {
+			var err error
+			parentClassId, err = s.state.classIds.alloc(sliceName, sliceChildClasses)
+			if err != nil {
+				logger.GlobalLogger.Errorf("Failed to assign class ID for slice: %v, err: %v", sliceName, err)
+				return err
+			}
+			logger.GlobalLogger.Infof("Assigning class ID: %v to slice: %v", parentClassId, sliceName)
 		}
-		logger.GlobalLogger.Infof("Assigning class ID: %v to slice: %v", parentClassId, sliceName)
-		NetOpHandle[sliceID].tcParentClassId = parentClassId
-		tcClassIdMap[parentClassId] = sliceName
-		NetOpHandle[sliceID].sliceGwInfo = make(map[string]*SliceGwInfo)
-	}
-
-	sliceTc := &TcInfo{
-		class:        qosProfile.class,
-		bwCeiling:    qosProfile.bwCeiling,
-		bwGuaranteed: qosProfile.bwGuaranteed,
-		priority:     qosProfile.priority,
+		s.state.slices[sliceID].tcParentClassId = parentClassId
+		s.state.slices[sliceID].sliceGwInfo = make(map[string]*SliceGwInfo)
+		s.state.attachPendingSliceGws(sliceID, time.Now())
 	}
+	s.state.slices[sliceID].qosProfile = qosProfile
 
 	err := s.enforceSliceTc(sliceID, sliceTc)
 	if err != nil {
@@ -523,85 +1283,175 @@ func (s *NetOps) handleSliceLifeCycleEvent(sliceName string, sliceEvent netops.E
 		return nil
 	}
 
-	foundSliceToDel := false
-	for k := range NetOpHandle {
-		if NetOpHandle[k].sliceName == sliceName {
-			err := s.deleteTcForSlice(k)
-			if err != nil {
-				logger.GlobalLogger.Errorf("Failed to delete TC settings for sliceGWs: %v, err: %v", sliceName, err)
-				return err
-			}
-			delete(tcClassIdMap, NetOpHandle[k].tcParentClassId)
-			delete(NetOpHandle, k)
-			logger.GlobalLogger.Infof("Deleted tc config for slice: name: %v, id: %v\n", sliceName, k)
-			foundSliceToDel = true
-			break
+	for k := range s.state.slices {
+		if s.state.slices[k].sliceName == sliceName {
+			return s.deleteSlice(k)
 		}
 	}
+	return nil
+}
 
-	if foundSliceToDel {
-		// When we delete the tc filter applied on sliceGW node port, we end up deleting all
-		// filters under the root qdisc. To reapply the filter on slices that are still configured
-		// on the system, we mark sliceGw tc configure as invalid so that next time when we
-		// receive qosProfile from the slice controller we go ahead and create the filters for all
-		// existing slices and their sliceGWs.
-		for k := range NetOpHandle {
-			s.invalidateSliceGwTcConfig(k)
+// deleteSlice deletes the tc config of the slice and forgets the slice. The
+// root qdisc goes along with the last slice.
+func (s *NetOps) deleteSlice(sliceID string) error {
+	sliceName := s.state.slices[sliceID].sliceName
+	err := s.deleteTcForSlice(sliceID)
+	if err != nil {
+		logger.GlobalLogger.Errorf("Failed to delete TC settings for sliceGWs: %v, err: %v", sliceName, err)
+		return err
+	}
+	s.state.classIds.free(s.state.slices[sliceID].tcParentClassId)
+	delete(s.state.slices, sliceID)
+	logger.GlobalLogger.Infof("Deleted tc config for slice: name: %v, id: %v\n", sliceName, sliceID)
+
+	// If there are no slices anymore, remove the root qdisc. This helps with cleanup of tc config
+	// when the mesh is uninstalled from the cluster. The root qdisc stays while unclaimed tc
+	// config waits for its slices.
+	if len(s.state.slices) == 0 && len(s.state.unclaimed) == 0 {
+		logger.GlobalLogger.Infof("Deleting root tc config as no slices present on the node\n")
+		err := s.netOpDelTcRootQdisc()
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to delete root qdisc, err: %v\n", err)
 		}
+		s.state.dropRouteNetIfaces()
+	}
+	return nil
+}
 
-		// If there are no slices anymore, remove the root qdisc. This helps with cleanup of tc config
-		// when the mesh is uninstalled from the cluster.
-		if len(NetOpHandle) == 0 {
-			logger.GlobalLogger.Infof("Deleting root tc config as no slices present on the node\n")
-			err := netOpDelTcRootQdisc()
-			if err != nil {
-				logger.GlobalLogger.Errorf("Failed to delete root qdisc, err: %v\n", err)
-			}
+// updateSliceGw updates the info of a slice gw. The filters of the gw ports
+// are replaced when its ports or addresses change, so that a port dropped from
+// the gw is not classified into the slice anymore, as a whole or not at all.
+// The filters of a new gw are added with the next QoS profile of the slice.
+func (s *NetOps) updateSliceGw(sliceID string, gwInfo *SliceGwInfo) error {
+	sliceInfo, found := s.state.slices[sliceID]
+	if !found {
+		s.state.updateSliceGwInfo(sliceID, gwInfo)
+		return nil
+	}
+	old, found := sliceInfo.sliceGwInfo[gwInfo.sliceGwId]
+	if !found || !sliceGwChanged(old, gwInfo) {
+		s.state.updateSliceGwInfo(sliceID, gwInfo)
+		return nil
+	}
+	configured := len(old.tcConfigured) != 0
+	return s.inTcTxn(func() error {
+		err := s.deleteTcForSliceGw(sliceInfo, old)
+		if err != nil {
+			return err
+		}
+		s.state.updateSliceGwInfo(sliceID, gwInfo)
+		if configured && sliceInfo.tcInited && sliceInfo.tc != nil {
+			return s.configureTcForSliceGw(sliceID, sliceInfo.tc)
 		}
+		return nil
+	})
+}
+
+// deleteSliceGw deletes the filters of the slice gw ports and removes the gw
+// from the slice. A slice or gw that is not known is ignored.
+func (s *NetOps) deleteSliceGw(sliceID string, sliceGwID string) error {
+	sliceInfo, found := s.state.slices[sliceID]
+	if !found {
+		if s.state.deletePendingSliceGw(sliceID, sliceGwID) {
+			logger.GlobalLogger.Infof("Deleted pending slice GW: %v, slice: %v", sliceGwID, sliceID)
+			return nil
+		}
+		logger.GlobalLogger.Infof("Slice info not available: %v. Nothing to delete for slice GW: %v", sliceID, sliceGwID)
+		return nil
+	}
+	gwInfo, found := sliceInfo.sliceGwInfo[sliceGwID]
+	if !found {
+		logger.GlobalLogger.Infof("Slice GW not found: %v, slice: %v. Nothing to delete", sliceGwID, sliceInfo.sliceName)
+		return nil
+	}
+	// The filters of the gw are deleted as a whole or not at all.
+	err := s.inTcTxn(func() error {
+		return s.deleteTcForSliceGw(sliceInfo, gwInfo)
+	})
+	if err != nil {
+		return err
 	}
+	delete(sliceInfo.sliceGwInfo, sliceGwID)
+	logger.GlobalLogger.Infof("Deleted slice GW: %v, slice: %v", sliceGwID, sliceInfo.sliceName)
 	return nil
 }
 
-func updateSliceGwInfo(sliceID string, gwInfo *SliceGwInfo) {
-	_, found := NetOpHandle[sliceID]
+// sliceGwChanged reports whether the slice gw info changed in a way that
+// changes the filters of its ports.
+func sliceGwChanged(old *SliceGwInfo, gwInfo *SliceGwInfo) bool {
+	return old.gwType != gwInfo.gwType ||
+		old.protocol != gwInfo.protocol ||
+		old.remoteNodeIP != gwInfo.remoteNodeIP ||
+		!samePortPairs(old, gwInfo)
+}
+
+// samePortPairs reports whether the slice gws have the same ports. The filter
+// of a port pairs the local port with the remote port at the same position, so
+// the ports are compared in order.
+func samePortPairs(old *SliceGwInfo, gwInfo *SliceGwInfo) bool {
+	if len(old.localPorts) != len(gwInfo.localPorts) || len(old.remotePorts) != len(gwInfo.remotePorts) {
+		return false
+	}
+	for i := range old.localPorts {
+		if old.localPorts[i] != gwInfo.localPorts[i] {
+			return false
+		}
+	}
+	for i := range old.remotePorts {
+		if old.remotePorts[i] != gwInfo.remotePorts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *sliceStateManager) updateSliceGwInfo(sliceID string, gwInfo *SliceGwInfo) {
+	_, found := m.slices[sliceID]
 	if !found {
-		logger.GlobalLogger.Infof("Slice info not available yet: %v. Cannot update GW info", sliceID)
+		m.addPendingSliceGw(sliceID, gwInfo, time.Now())
 		return
 	}
-	_, found = NetOpHandle[sliceID].sliceGwInfo[gwInfo.sliceGwId]
+	old, found := m.slices[sliceID].sliceGwInfo[gwInfo.sliceGwId]
 	if !found {
-		NetOpHandle[sliceID].sliceGwInfo[gwInfo.sliceGwId] = gwInfo
+		m.slices[sliceID].sliceGwInfo[gwInfo.sliceGwId] = gwInfo
 	} else {
 		// Check if sliceGW info has changed.
-		if NetOpHandle[sliceID].sliceGwInfo[gwInfo.sliceGwId].gwType != gwInfo.gwType ||
-		!sameStringSlice(NetOpHandle[sliceID].sliceGwInfo[gwInfo.sliceGwId].localPorts, gwInfo.localPorts) ||
-		!sameStringSlice(NetOpHandle[sliceID].sliceGwInfo[gwInfo.sliceGwId].remotePorts, gwInfo.remotePorts) {
-			logger.GlobalLogger.Infof("slicegw info changed",gwInfo,NetOpHandle[sliceID].sliceGwInfo[gwInfo.sliceGwId])
-			NetOpHandle[sliceID].sliceGwInfo[gwInfo.sliceGwId] = gwInfo
-			NetOpHandle[sliceID].sliceGwInfo[gwInfo.sliceGwId].tcConfigured = false
+		if sliceGwChanged(old, gwInfo) {
+			logger.GlobalLogger.Infof("slicegw info changed", gwInfo, old)
+			m.slices[sliceID].sliceGwInfo[gwInfo.sliceGwId] = gwInfo
+			m.slices[sliceID].sliceGwInfo[gwInfo.sliceGwId].tcConfigured = nil
 		}
 	}
 }
 
 func sameStringSlice(x, y []string) bool {
-    if len(x) != len(y) {
-        return false
-    }
-    // create a map of string -> int
-    diff := make(map[string]int, len(x))
-    for _, _x := range x {
-        // 0 value for int is 0, so just increment a counter for the string
-        diff[_x]++
-    }
-    for _, _y := range y {
-        // If the string _y is not in diff bail out early
-        if _, ok := diff[_y]; !ok {
-            return false
-        }
-        diff[_y] -= 1
-        if diff[_y] == 0 {
-            delete(diff, _y)
-        }
-    }
-    return len(diff) == 0
-}
\ No newline at end of file
+	if len(x) != len(y) {
+		return false
+	}
+	// create a map of string -> int
+	diff := make(map[string]int, len(x))
+	for _, _x := range x {
+		// 0 value for int is 0, so just increment a counter for the string
+		diff[_x]++
+	}
+	for _, _y := range y {
+		// If the string _y is not in diff bail out early
+		if _, ok := diff[_y]; !ok {
+			return false
+		}
+		diff[_y] -= 1
+		if diff[_y] == 0 {
+			delete(diff, _y)
+		}
+	}
+	return len(diff) == 0
+}
+
+func containsString(x []string, s string) bool {
+	for _, _x := range x {
+		if _x == s {
+			return true
+		}
+	}
+	return false
+}
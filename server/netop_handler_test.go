@@ -24,6 +24,8 @@ import (
 
 	"github.com/kubeslice/netops/logger"
 	netops "github.com/kubeslice/netops/pkg/proto"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 	"google.golang.org/grpc"
 )
 
@@ -33,8 +35,12 @@ func TestConfigureTcForSliceGwPort(t *testing.T) {
 		GwType     sliceGwType
 		localPort  string
 		RemotePort string
+		Protocol   sliceGwProtocol
+		NodeIP     string
+		Family     int
 		Priority   uint32
-		FlowId     string
+		Tc         *TcInfo
+		FlowId     uint32
 		ErrStr     string
 	}{
 		{
@@ -42,8 +48,12 @@ func TestConfigureTcForSliceGwPort(t *testing.T) {
 			sliceGwType("SLICE_GW_CLIENT"),
 			"5000",
 			"5000",
+			SLICE_GW_UDP,
+			"",
+			netlink.FAMILY_V4,
 			2,
-			"randomid",
+			&TcInfo{priority: 2},
+			defaultClassHandle(0x12),
 			"",
 		},
 		{
@@ -51,28 +61,141 @@ func TestConfigureTcForSliceGwPort(t *testing.T) {
 			sliceGwType("SLICE_GW_SERVER"),
 			"5000",
 			"5000",
+			SLICE_GW_UDP,
+			"",
+			netlink.FAMILY_V4,
 			2,
-			"randomid",
+			&TcInfo{priority: 2},
+			defaultClassHandle(0x12),
+			"",
+		},
+		{
+			"Testing with a DSCP class",
+			sliceGwType("SLICE_GW_CLIENT"),
+			"5000",
+			"6000",
+			SLICE_GW_UDP,
+			"",
+			netlink.FAMILY_V4,
+			2,
+			&TcInfo{priority: 2, markDscp: true, dscp: 46},
+			defaultClassHandle(0x12),
+			"",
+		},
+		{
+			"Testing for IPv6 with Gateway type SLICE_GW_SERVER",
+			sliceGwType("SLICE_GW_SERVER"),
+			"5000",
+			"5000",
+			SLICE_GW_UDP,
+			"",
+			netlink.FAMILY_V6,
+			2,
+			&TcInfo{priority: 2},
+			defaultClassHandle(0x12),
+			"",
+		},
+		{
+			"Testing for IPv6 with a DSCP class",
+			sliceGwType("SLICE_GW_CLIENT"),
+			"5000",
+			"6000",
+			SLICE_GW_UDP,
+			"",
+			netlink.FAMILY_V6,
+			2,
+			&TcInfo{priority: 2, markDscp: true, dscp: 46},
+			defaultClassHandle(0x12),
 			"",
 		},
+		{
+			"Testing for a TCP slice gw",
+			sliceGwType("SLICE_GW_SERVER"),
+			"7000",
+			"7000",
+			SLICE_GW_TCP,
+			"",
+			netlink.FAMILY_V4,
+			2,
+			&TcInfo{priority: 2},
+			defaultClassHandle(0x12),
+			"",
+		},
+		{
+			"Testing for a client with the remote node IP",
+			sliceGwType("SLICE_GW_CLIENT"),
+			"7000",
+			"8000",
+			SLICE_GW_UDP,
+			"10.0.0.2",
+			netlink.FAMILY_V4,
+			2,
+			&TcInfo{priority: 2},
+			defaultClassHandle(0x12),
+			"",
+		},
+		{
+			"Testing for IPv6 with an IPv4 remote node IP",
+			sliceGwType("SLICE_GW_CLIENT"),
+			"7000",
+			"8000",
+			SLICE_GW_UDP,
+			"10.0.0.2",
+			netlink.FAMILY_V6,
+			2,
+			&TcInfo{priority: 2},
+			defaultClassHandle(0x12),
+			"",
+		},
+		{
+			"Testing with an invalid port",
+			sliceGwType("SLICE_GW_SERVER"),
+			"abc",
+			"5000",
+			SLICE_GW_UDP,
+			"",
+			netlink.FAMILY_V4,
+			2,
+			&TcInfo{priority: 2},
+			defaultClassHandle(0x12),
+			`invalid port "abc": strconv.ParseUint: parsing "abc": invalid syntax`,
+		},
 	}
 	ctx := context.Background()
 	logger.GlobalLogger = logger.NewLogger("ERROR")
-	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer()))
+	client := NewNetOps(newFakeTcBackend())
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(client)))
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer conn.Close()
-	client := &NetOps{}
+	client.state.netIfaces = []*IfaceInfo{{name: "eth0"}}
+	err = client.netOpAddTcRootQdisc()
+	if err != nil {
+		t.Fatal(err)
+	}
 	for _, tt := range testCases {
-		err := client.configureTcForSliceGwPort(tt.GwType, tt.localPort, tt.RemotePort, tt.Priority, tt.FlowId)
-		if err != nil {
-			t.Log(err.Error())
-			if err.Error() != tt.ErrStr {
-				t.Error("Expected :", tt.ErrStr, " but got ", err)
-			}
+		gwInfo := &SliceGwInfo{
+			gwType:       tt.GwType,
+			protocol:     tt.Protocol,
+			localPorts:   []string{tt.localPort},
+			remotePorts:  []string{tt.RemotePort},
+			remoteNodeIP: tt.NodeIP,
 		}
+		err := client.configureTcForSliceGwPort(gwInfo, 0, tt.Family, tt.Priority, tt.Tc, tt.FlowId)
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
 	}
+	expectTcTree(t, client.tc, "eth0", []string{
+		"qdisc dev eth0 root handle 17: htb default 30",
+		"filter dev eth0 protocol ip parent 17: prio 2 flower ip_proto udp dst_port 5000 classid 17:12",
+		"filter dev eth0 protocol ip parent 17: prio 2 flower ip_proto udp src_port 5000 classid 17:12",
+		"filter dev eth0 protocol ip parent 17: prio 2 flower ip_proto udp dst_port 6000 classid 17:12 action pedit ex munge ip dsfield set 0xb8 retain 0xfc pipe action csum ip pipe",
+		"filter dev eth0 protocol ip parent 17: prio 2 flower ip_proto tcp src_port 7000 classid 17:12",
+		"filter dev eth0 protocol ip parent 17: prio 2 flower ip_proto udp dst_ip 10.0.0.2/32 dst_port 8000 classid 17:12",
+		"filter dev eth0 protocol ipv6 parent 17: prio 12 flower ip_proto udp src_port 5000 classid 17:12",
+		"filter dev eth0 protocol ipv6 parent 17: prio 12 flower ip_proto udp dst_port 6000 classid 17:12 action pedit ex munge ip6 traffic_class set 0xb8 retain 0xfc pipe",
+		"filter dev eth0 protocol ipv6 parent 17: prio 12 flower ip_proto udp dst_port 8000 classid 17:12",
+	})
 }
 
 func TestConfigureTcForSliceGw(t *testing.T) {
@@ -82,46 +205,97 @@ func TestConfigureTcForSliceGw(t *testing.T) {
 		SliceID  string
 		Tc       *TcInfo
 		ErrStr   string
+		TcTree   []string
 	}{
 		{
-			"Testing while the NetOpHandle map is empty",
+			"Testing while the slices map is empty",
 			true,
 			"randomid",
-			&TcInfo{class: classType(netops.ClassType_HTB.String()), bwCeiling: 1, bwGuaranteed: htbRootHandleId, priority: 2},
+			&TcInfo{class: classType(netops.ClassType_HTB.String()), bwCeiling: 1, bwGuaranteed: defaultRootHandleId, priority: 2},
 			"SliceId randomid is not found",
+			[]string{},
 		},
 		{
-			"Testing with NetOpHandle populated with a value",
+			"Testing with the slices map populated with a value",
 			false,
 			"randomid",
-			&TcInfo{class: classType(netops.ClassType_HTB.String()), bwCeiling: 1, bwGuaranteed: htbRootHandleId, priority: 2},
+			&TcInfo{class: classType(netops.ClassType_HTB.String()), bwCeiling: 1, bwGuaranteed: defaultRootHandleId, priority: 2},
 			"",
+			append(mockTcTree,
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110001 flower ip_proto udp src_port 5000 classid 17:12",
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110002 flower ip_proto udp src_port 6000 classid 17:12",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110003 flower ip_proto udp src_port 5000 classid 17:12",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110004 flower ip_proto udp src_port 6000 classid 17:12",
+			),
 		},
 	}
 	ctx := context.Background()
 	logger.GlobalLogger = logger.NewLogger("ERROR")
-	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer()))
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer conn.Close()
-	client := &NetOps{}
 	for _, tt := range testCases {
-		if !tt.EmptyMap {
-			err := MockBootstrapNetOpPod()
+		client := NewNetOps(newFakeTcBackend())
+		conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(client)))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer conn.Close()
+		if tt.EmptyMap {
+			client.state.slices = make(map[string]*SliceInfo)
+		} else {
+			err := MockBootstrapNetOpPod(client)
 			if err != nil {
 				t.Error(err)
 			}
 		}
-		err := client.configureTcForSliceGw(tt.SliceID, tt.Tc)
-		if err != nil {
-			t.Log(err.Error())
-			if err.Error() != tt.ErrStr {
-				t.Error("Expected :", tt.ErrStr, " but got ", err)
-			}
-		}
+		err = client.configureTcForSliceGw(tt.SliceID, tt.Tc)
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		expectTcTree(t, client.tc, "eth0", tt.TcTree)
 	}
 }
+func TestConfigureTcForSliceGwFamilies(t *testing.T) {
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	client := NewNetOps(newFakeTcBackend())
+	err := MockBootstrapNetOpPod(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An IPv4 filter at the prio of the IPv6 filters of the slice makes the
+	// kernel refuse them.
+	blocker := &TcFilter{Dev: "eth0", Parent: defaultRootHandle(), Prio: 12, IPProto: unix.IPPROTO_UDP, DstPort: 7000, ClassId: defaultClassHandle(0x30)}
+	err = client.tc.FilterAdd(blocker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.configureTcForSliceGw("randomid", client.state.slices["randomid"].tc)
+	expectErrStr(t, "Failing to add the IPv6 filters", err,
+		"tc filter add dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110003 flower ip_proto udp src_port 5000 classid 17:12 failed: invalid argument")
+	gwInfo := client.state.slices["randomid"].sliceGwInfo["test-slice"]
+	if !gwInfo.tcConfigured[netlink.FAMILY_V4] || gwInfo.tcConfigured[netlink.FAMILY_V6] {
+		t.Error("Expected only the IPv4 filters to be configured but got ", gwInfo.tcConfigured)
+	}
+
+	// Only the IPv6 filters are added on retry.
+	err = client.tc.FilterDel(blocker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.configureTcForSliceGw("randomid", client.state.slices["randomid"].tc)
+	expectErrStr(t, "Retrying the IPv6 filters", err, "")
+	expectTcTree(t, client.tc, "eth0", append(mockTcTree,
+		"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110001 flower ip_proto udp src_port 5000 classid 17:12",
+		"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110002 flower ip_proto udp src_port 6000 classid 17:12",
+		"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110003 flower ip_proto udp src_port 5000 classid 17:12",
+		"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110004 flower ip_proto udp src_port 6000 classid 17:12",
+	))
+
+	// Deleting the filters of the slice gw drops the state of both families.
+	err = client.deleteTcForSliceGw(client.state.slices["randomid"], gwInfo)
+	expectErrStr(t, "Deleting the filters", err, "")
+	if len(gwInfo.tcConfigured) != 0 || len(gwInfo.tcFilterHandles) != 0 {
+		t.Error("Expected no family to be configured but got ", gwInfo.tcConfigured, gwInfo.tcFilterHandles)
+	}
+	expectTcTree(t, client.tc, "eth0", mockTcTree)
+}
+
 func TestHandleSliceLifeCycleEvent(t *testing.T) {
 	testCases := []struct {
 		Case       string
@@ -129,6 +303,7 @@ func TestHandleSliceLifeCycleEvent(t *testing.T) {
 		SliceName  string
 		SliceEvent netops.EventType
 		ErrStr     string
+		TcTree     []string
 	}{
 		{
 			"Providing the wrong slice Event",
@@ -136,6 +311,7 @@ func TestHandleSliceLifeCycleEvent(t *testing.T) {
 			"test-slice",
 			netops.EventType_EV_CREATE,
 			"",
+			[]string{},
 		},
 		{
 			"Testing for delete slice event",
@@ -143,30 +319,29 @@ func TestHandleSliceLifeCycleEvent(t *testing.T) {
 			"test-slice",
 			netops.EventType_EV_DELETE,
 			"",
+			[]string{"qdisc dev eth0 root handle 17: htb default 30"},
 		},
 	}
 	ctx := context.Background()
 	logger.GlobalLogger = logger.NewLogger("ERROR")
-	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer()))
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer conn.Close()
-	client := &NetOps{}
 	for _, tt := range testCases {
-		if !tt.EmptyMap {
-			err := MockBootstrapNetOpPod()
+		client := NewNetOps(newFakeTcBackend())
+		conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(client)))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer conn.Close()
+		if tt.EmptyMap {
+			client.state.slices = make(map[string]*SliceInfo)
+		} else {
+			err := MockBootstrapNetOpPod(client)
 			if err != nil {
 				t.Error(err)
 			}
 		}
-		err := client.handleSliceLifeCycleEvent(tt.SliceName, tt.SliceEvent)
-		if err != nil {
-			t.Log(err.Error())
-			if err.Error() != tt.ErrStr {
-				t.Error("Expected :", tt.ErrStr, " but got ", err)
-			}
-		}
+		err = client.handleSliceLifeCycleEvent(tt.SliceName, tt.SliceEvent)
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		expectTcTree(t, client.tc, "eth0", tt.TcTree)
 	}
 }
 func TestConfigureTcForSlice(t *testing.T) {
@@ -176,58 +351,143 @@ func TestConfigureTcForSlice(t *testing.T) {
 		SliceID  string
 		Tc       *TcInfo
 		ErrStr   string
+		TcTree   []string
 	}{
 		{
 			"Testing with empty NetopHandle map",
 			true,
 			"randomid",
-			&TcInfo{class: classType(netops.ClassType_HTB.String()), bwCeiling: 1, bwGuaranteed: htbRootHandleId, priority: 2},
+			&TcInfo{class: classType(netops.ClassType_HTB.String()), bwCeiling: 1, bwGuaranteed: defaultRootHandleId, priority: 2},
 			"SliceId randomid is not found",
+			[]string{},
 		},
 		{
 			"Test for ignoring the update",
 			false,
 			"randomid",
-			&TcInfo{class: classType(netops.ClassType_HTB.String()), bwCeiling: 1, bwGuaranteed: htbRootHandleId, priority: 2},
-			"No change in Slice TC params, ignoring update",
+			&TcInfo{class: classType(netops.ClassType_HTB.String()), bwCeiling: 1, bwGuaranteed: defaultRootHandleId, priority: 2},
+			"",
+			mockTcTree,
 		},
 		{
 			"Test for updating slice tc parameters",
 			false,
 			"randomid",
-			&TcInfo{class: classType(netops.ClassType_HTB.String()), bwCeiling: 3, bwGuaranteed: htbRootHandleId, priority: 1},
+			&TcInfo{class: classType(netops.ClassType_HTB.String()), bwCeiling: 3, bwGuaranteed: defaultRootHandleId, priority: 1},
 			"",
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"class dev eth0 parent 17: classid 17:11 htb rate 3kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 23kbit ceil 3kbit burst 32768 prio 1",
+			},
 		},
 		{
 			"Test for updating paremeters tcLeafClassFqId and tcInited",
 			false,
 			"randomid2",
-			&TcInfo{class: classType(netops.ClassType_HTB.String()), bwCeiling: 3, bwGuaranteed: htbRootHandleId, priority: 1},
+			&TcInfo{class: classType(netops.ClassType_HTB.String()), bwCeiling: 3, bwGuaranteed: defaultRootHandleId, priority: 1},
 			"",
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"qdisc dev eth0 parent 17:23 handle 22: sfq perturb 10",
+				"class dev eth0 parent 17: classid 17:11 htb rate 1kbit burst 65536 prio 2",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 23kbit ceil 1kbit burst 32768 prio 2",
+				"class dev eth0 parent 17: classid 17:22 htb rate 3kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:22 classid 17:23 htb rate 23kbit ceil 3kbit burst 32768 prio 1",
+			},
 		},
 	}
 	ctx := context.Background()
 	logger.GlobalLogger = logger.NewLogger("INFO")
-	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer()))
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer conn.Close()
-	client := &NetOps{}
 	for _, tt := range testCases {
-		if !tt.EmptyMap {
-			err := MockBootstrapNetOpPod()
+		client := NewNetOps(newFakeTcBackend())
+		conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(client)))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer conn.Close()
+		if tt.EmptyMap {
+			client.state.slices = make(map[string]*SliceInfo)
+		} else {
+			err := MockBootstrapNetOpPod(client)
 			if err != nil {
 				t.Error(err)
 			}
 		}
+		err = client.configureTcForSlice(tt.SliceID, tt.Tc)
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		expectTcTree(t, client.tc, "eth0", tt.TcTree)
+	}
+}
+
+func TestConfigureTcForSliceClassType(t *testing.T) {
+	// The cases run in order against the same tc config.
+	testCases := []struct {
+		Case    string
+		SliceID string
+		Tc      *TcInfo
+		TcTree  []string
+	}{
+		{
+			"Switching slice from HTB to TBF",
+			"randomid",
+			&TcInfo{class: CLASS_TYPE_TBF, bwCeiling: 1000, bwGuaranteed: defaultRootHandleId, priority: 2},
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: tbf rate 1000kbit burst 1600 latency 50ms",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"class dev eth0 parent 17: classid 17:11 htb rate 1000kbit burst 65536 prio 2",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 1000kbit burst 32768 prio 2",
+			},
+		},
+		{
+			"Updating the ceiling of a TBF slice",
+			"randomid",
+			&TcInfo{class: CLASS_TYPE_TBF, bwCeiling: 2000, bwGuaranteed: defaultRootHandleId, priority: 2},
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: tbf rate 2000kbit burst 2500 latency 50ms",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"class dev eth0 parent 17: classid 17:11 htb rate 2000kbit burst 65536 prio 2",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 2000kbit ceil 2000kbit burst 32768 prio 2",
+			},
+		},
+		{
+			"Switching slice from TBF back to HTB",
+			"randomid",
+			&TcInfo{class: CLASS_TYPE_HTB, bwCeiling: 2000, bwGuaranteed: defaultRootHandleId, priority: 2},
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"class dev eth0 parent 17: classid 17:11 htb rate 2000kbit burst 65536 prio 2",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 23kbit ceil 2000kbit burst 32768 prio 2",
+			},
+		},
+		{
+			"Adding a TBF slice next to a HTB slice",
+			"randomid2",
+			&TcInfo{class: CLASS_TYPE_TBF, bwCeiling: 3000, bwGuaranteed: defaultRootHandleId, priority: 1},
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"qdisc dev eth0 parent 17:23 handle 22: tbf rate 3000kbit burst 3750 latency 50ms",
+				"class dev eth0 parent 17: classid 17:11 htb rate 2000kbit burst 65536 prio 2",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 23kbit ceil 2000kbit burst 32768 prio 2",
+				"class dev eth0 parent 17: classid 17:22 htb rate 3000kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:22 classid 17:23 htb rate 3000kbit ceil 3000kbit burst 32768 prio 1",
+			},
+		},
+	}
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	client := NewNetOps(newFakeTcBackend())
+	err := MockBootstrapNetOpPod(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range testCases {
 		err := client.configureTcForSlice(tt.SliceID, tt.Tc)
-		if err != nil {
-			t.Log(err.Error())
-			if err.Error() != tt.ErrStr {
-				t.Error("Expected :", tt.ErrStr, " but got ", err)
-			}
-		}
+		expectErrStr(t, tt.Case, err, "")
+		expectTcTree(t, client.tc, "eth0", tt.TcTree)
 	}
 }
 
@@ -239,86 +499,323 @@ func TestEnforceSliceQosPolicy(t *testing.T) {
 		QosProfile          *SliceQosProfile
 		EmptyNetOpHandleMap bool
 		ErrStr              string
+		TcTree              []string
 	}{
 		{
 			"Test when the NetopHandle Map is Empty",
 			"randomid",
 			"test-slice",
-			&SliceQosProfile{class: classType(netops.ClassType_HTB.String()), bwCeiling: 3, bwGuaranteed: htbRootHandleId, priority: 1},
+			&SliceQosProfile{class: classType(netops.ClassType_HTB.String()), bwCeiling: 3, bwGuaranteed: defaultRootHandleId, priority: 1},
 			true,
 			"",
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"class dev eth0 parent 17: classid 17:11 htb rate 3kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 23kbit ceil 3kbit burst 32768 prio 1",
+			},
 		},
 		{
-			"Test when the NetopHandle Map is Empty",
+			"Test when the NetopHandle Map is populated",
 			"randomid",
 			"test-slice",
-			&SliceQosProfile{class: classType(netops.ClassType_HTB.String()), bwCeiling: 3, bwGuaranteed: htbRootHandleId, priority: 1},
+			&SliceQosProfile{class: classType(netops.ClassType_HTB.String()), bwCeiling: 3, bwGuaranteed: defaultRootHandleId, priority: 1},
 			false,
 			"",
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"class dev eth0 parent 17: classid 17:11 htb rate 3kbit burst 65536 prio 1",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 23kbit ceil 3kbit burst 32768 prio 1",
+				"filter dev eth0 protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp src_port 5000 classid 17:12",
+				"filter dev eth0 protocol ip parent 17: prio 1 handle 0x110002 flower ip_proto udp src_port 6000 classid 17:12",
+				"filter dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110003 flower ip_proto udp src_port 5000 classid 17:12",
+				"filter dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110004 flower ip_proto udp src_port 6000 classid 17:12",
+			},
+		},
+		{
+			"Test with a priority out of range",
+			"randomid",
+			"test-slice",
+			&SliceQosProfile{class: classType(netops.ClassType_HTB.String()), bwCeiling: 3, bwGuaranteed: defaultRootHandleId, priority: 4},
+			true,
+			"invalid priority 4, expected 0-3",
+			[]string{},
+		},
+		{
+			"Test with an invalid DSCP class",
+			"randomid",
+			"test-slice",
+			&SliceQosProfile{class: classType(netops.ClassType_HTB.String()), bwCeiling: 3, bwGuaranteed: defaultRootHandleId, priority: 1, dscpClass: "AF5"},
+			true,
+			`invalid DSCP class "AF5"`,
+			[]string{},
 		},
 	}
 	ctx := context.Background()
 	logger.GlobalLogger = logger.NewLogger("ERROR")
-	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer()))
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer conn.Close()
-	client := &NetOps{}
 	for _, tt := range testCases {
-		if !tt.EmptyNetOpHandleMap {
-			err := MockBootstrapNetOpPod()
+		client := NewNetOps(newFakeTcBackend())
+		conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(client)))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer conn.Close()
+		if tt.EmptyNetOpHandleMap {
+			client.state.slices = make(map[string]*SliceInfo)
+			client.state.classIds = newClassIdAllocator(defaultRootHandleId)
+			client.state.netIfaces = []*IfaceInfo{{name: "eth0"}}
+		} else {
+			err := MockBootstrapNetOpPod(client)
 			if err != nil {
 				t.Error(err)
 			}
 		}
-		err := client.enforceSliceQosPolicy(tt.SliceID, tt.SliceName, tt.QosProfile)
-		if err != nil {
-			t.Log(err.Error())
-			if err.Error() != tt.ErrStr {
-				t.Error("Expected :", tt.ErrStr, " but got ", err)
-			}
-		}
+		err = client.enforceSliceQosPolicy(tt.SliceID, tt.SliceName, tt.QosProfile)
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		expectTcTree(t, client.tc, "eth0", tt.TcTree)
 	}
 }
-func TestDeleteTcForSliceGwAll(t *testing.T) {
+
+func TestEnforceSliceQosPolicyDscp(t *testing.T) {
+	// The cases run in order against the same tc config.
 	testCases := []struct {
-		Case               string
-		CallBootstrapNetOp bool
-		ErrStr             string
+		Case      string
+		DscpClass string
+		TcTree    []string
 	}{
 		{
-			"Test without calling BoostrapNetOpPod",
-			true,
-			"No command defined :",
+			"Marking the slice traffic",
+			"EF",
+			[]string{
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110001 flower ip_proto udp src_port 5000 classid 17:12 action pedit ex munge ip dsfield set 0xb8 retain 0xfc pipe action csum ip pipe",
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110002 flower ip_proto udp src_port 6000 classid 17:12 action pedit ex munge ip dsfield set 0xb8 retain 0xfc pipe action csum ip pipe",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110003 flower ip_proto udp src_port 5000 classid 17:12 action pedit ex munge ip6 traffic_class set 0xb8 retain 0xfc pipe",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110004 flower ip_proto udp src_port 6000 classid 17:12 action pedit ex munge ip6 traffic_class set 0xb8 retain 0xfc pipe",
+			},
 		},
 		{
-			"Testing the function with calling the helper BoostrapNetOpPod",
-			false,
+			"Changing the DSCP class",
+			"AF41",
+			[]string{
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110001 flower ip_proto udp src_port 5000 classid 17:12 action pedit ex munge ip dsfield set 0x88 retain 0xfc pipe action csum ip pipe",
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110002 flower ip_proto udp src_port 6000 classid 17:12 action pedit ex munge ip dsfield set 0x88 retain 0xfc pipe action csum ip pipe",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110003 flower ip_proto udp src_port 5000 classid 17:12 action pedit ex munge ip6 traffic_class set 0x88 retain 0xfc pipe",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110004 flower ip_proto udp src_port 6000 classid 17:12 action pedit ex munge ip6 traffic_class set 0x88 retain 0xfc pipe",
+			},
+		},
+		{
+			"Changing to a numeric DSCP value",
+			"8",
+			[]string{
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110001 flower ip_proto udp src_port 5000 classid 17:12 action pedit ex munge ip dsfield set 0x20 retain 0xfc pipe action csum ip pipe",
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110002 flower ip_proto udp src_port 6000 classid 17:12 action pedit ex munge ip dsfield set 0x20 retain 0xfc pipe action csum ip pipe",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110003 flower ip_proto udp src_port 5000 classid 17:12 action pedit ex munge ip6 traffic_class set 0x20 retain 0xfc pipe",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110004 flower ip_proto udp src_port 6000 classid 17:12 action pedit ex munge ip6 traffic_class set 0x20 retain 0xfc pipe",
+			},
+		},
+		{
+			"Clearing the DSCP class",
 			"",
+			[]string{
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110001 flower ip_proto udp src_port 5000 classid 17:12",
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110002 flower ip_proto udp src_port 6000 classid 17:12",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110003 flower ip_proto udp src_port 5000 classid 17:12",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110004 flower ip_proto udp src_port 6000 classid 17:12",
+			},
 		},
 	}
-	ctx := context.Background()
 	logger.GlobalLogger = logger.NewLogger("ERROR")
-	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer()))
+	client := NewNetOps(newFakeTcBackend())
+	err := MockBootstrapNetOpPod(client)
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
-	defer conn.Close()
-	client := &NetOps{}
 	for _, tt := range testCases {
-		if !tt.CallBootstrapNetOp {
-			err := MockBootstrapNetOpPod()
+		err := client.enforceSliceQosPolicy("randomid", "test-slice", &SliceQosProfile{
+			class:        CLASS_TYPE_HTB,
+			bwCeiling:    1,
+			bwGuaranteed: 23,
+			priority:     2,
+			dscpClass:    tt.DscpClass,
+		})
+		expectErrStr(t, tt.Case, err, "")
+		expectTcTree(t, client.tc, "eth0", append(mockTcTree, tt.TcTree...))
+	}
+}
+
+func TestEnforceSliceQosPolicyPriority(t *testing.T) {
+	// The cases run in order against the same tc config.
+	testCases := []struct {
+		Case       string
+		QosProfile *SliceQosProfile
+		TcTree     []string
+	}{
+		{
+			"Configuring the slice gws",
+			&SliceQosProfile{class: CLASS_TYPE_HTB, bwCeiling: 1, bwGuaranteed: 23, priority: 2},
+			append(mockTcTree,
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110001 flower ip_proto udp src_port 5000 classid 17:12",
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110002 flower ip_proto udp src_port 6000 classid 17:12",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110003 flower ip_proto udp src_port 5000 classid 17:12",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110004 flower ip_proto udp src_port 6000 classid 17:12",
+			),
+		},
+		{
+			"Raising the priority of the slice",
+			&SliceQosProfile{class: CLASS_TYPE_HTB, bwCeiling: 1, bwGuaranteed: 23, priority: 0},
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"class dev eth0 parent 17: classid 17:11 htb rate 1kbit burst 65536",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 23kbit ceil 1kbit burst 32768",
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110001 flower ip_proto udp src_port 5000 classid 17:12",
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110002 flower ip_proto udp src_port 6000 classid 17:12",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110003 flower ip_proto udp src_port 5000 classid 17:12",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110004 flower ip_proto udp src_port 6000 classid 17:12",
+			},
+		},
+		{
+			"Marking the slice traffic after a priority change",
+			&SliceQosProfile{class: CLASS_TYPE_HTB, bwCeiling: 1, bwGuaranteed: 23, priority: 0, dscpClass: "EF"},
+			[]string{
+				"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+				"qdisc dev eth0 root handle 17: htb default 30",
+				"class dev eth0 parent 17: classid 17:11 htb rate 1kbit burst 65536",
+				"class dev eth0 parent 17:11 classid 17:12 htb rate 23kbit ceil 1kbit burst 32768",
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110001 flower ip_proto udp src_port 5000 classid 17:12 action pedit ex munge ip dsfield set 0xb8 retain 0xfc pipe action csum ip pipe",
+				"filter dev eth0 protocol ip parent 17: prio 2 handle 0x110002 flower ip_proto udp src_port 6000 classid 17:12 action pedit ex munge ip dsfield set 0xb8 retain 0xfc pipe action csum ip pipe",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110003 flower ip_proto udp src_port 5000 classid 17:12 action pedit ex munge ip6 traffic_class set 0xb8 retain 0xfc pipe",
+				"filter dev eth0 protocol ipv6 parent 17: prio 12 handle 0x110004 flower ip_proto udp src_port 6000 classid 17:12 action pedit ex munge ip6 traffic_class set 0xb8 retain 0xfc pipe",
+			},
+		},
+	}
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	client := NewNetOps(newFakeTcBackend())
+	err := MockBootstrapNetOpPod(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range testCases {
+		err := client.enforceSliceQosPolicy("randomid", "test-slice", tt.QosProfile)
+		expectErrStr(t, tt.Case, err, "")
+		expectTcTree(t, client.tc, "eth0", tt.TcTree)
+	}
+}
+
+func TestDeleteTcForSliceGw(t *testing.T) {
+	otherFilter := &TcFilter{Dev: "eth0", Parent: defaultRootHandle(), Prio: 2, Handle: 0x220001, IPProto: unix.IPPROTO_UDP, SrcPort: 7000, ClassId: defaultClassHandle(0x23)}
+	testCases := []struct {
+		Case    string
+		Handles map[int][]uint32
+		ErrStr  string
+		TcTree  []string
+	}{
+		{
+			"Testing the filters of the slice gw are deleted",
+			map[int][]uint32{netlink.FAMILY_V4: {0x110001, 0x110002}},
+			"",
+			append(mockTcTree, "filter "+otherFilter.String()),
+		},
+		{
+			"Testing a slice gw without filter handles",
+			nil,
+			"unknown handle of the filters of slice gw: test-gw port: 5000",
+			append(mockTcTree,
+				"filter dev eth0 protocol ip parent 17: prio 2 flower ip_proto udp src_port 5000 classid 17:12",
+				"filter dev eth0 protocol ip parent 17: prio 2 flower ip_proto udp src_port 6000 classid 17:12",
+				"filter "+otherFilter.String(),
+			),
+		},
+	}
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	for _, tt := range testCases {
+		client := NewNetOps(newFakeTcBackend())
+		err := MockBootstrapNetOpPod(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sliceInfo := client.state.slices["randomid"]
+		gwInfo := &SliceGwInfo{
+			sliceGwId:       "test-gw",
+			gwType:          SLICE_GW_SERVER,
+			localPorts:      []string{"5000", "6000"},
+			remotePorts:     []string{"5000", "6000"},
+			tcConfigured:    map[int]bool{netlink.FAMILY_V4: true},
+			tcFilterPrio:    2,
+			tcFilterHandles: tt.Handles,
+		}
+		for i := range gwInfo.localPorts {
+			err = client.configureTcForSliceGwPort(gwInfo, i, netlink.FAMILY_V4, 2, sliceInfo.tc, sliceInfo.tcLeafClassFqId)
 			if err != nil {
-				t.Error(err)
+				t.Fatal(err)
 			}
 		}
-		err := client.deleteTcForSliceGwAll()
+		// A filter of another slice at the same prio
+		err = client.tc.FilterAdd(otherFilter)
 		if err != nil {
-			t.Log(err.Error())
-			if err.Error() != tt.ErrStr {
-				t.Error("Expected :", tt.ErrStr, " but got ", err)
-			}
+			t.Fatal(err)
+		}
+
+		err = client.deleteTcForSliceGw(sliceInfo, gwInfo)
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		expectTcTree(t, client.tc, "eth0", tt.TcTree)
+	}
+}
+
+func TestIngressShapingEnabled(t *testing.T) {
+	testCases := []struct {
+		Case    string
+		Value   string
+		Enabled bool
+		ErrStr  string
+	}{
+		{"Testing without the env var", "", false, ""},
+		{"Testing with ingress shaping enabled", "true", true, ""},
+		{"Testing with ingress shaping disabled", "false", false, ""},
+		{"Testing with an invalid value", "yes", false, `invalid INGRESS_SHAPING "yes": strconv.ParseBool: parsing "yes": invalid syntax`},
+	}
+	for _, tt := range testCases {
+		t.Setenv("INGRESS_SHAPING", tt.Value)
+		enabled, err := ingressShapingEnabled()
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		if enabled != tt.Enabled {
+			t.Error(tt.Case, "- Expected :", tt.Enabled, " but got ", enabled)
+		}
+	}
+}
+
+// expectErrStr fails the test when err does not match the expected error
+// string. An empty string expects no error.
+func expectErrStr(t *testing.T, testCase string, err error, expected string) {
+	t.Helper()
+	errStr := ""
+	if err != nil {
+		t.Log(err.Error())
+		errStr = err.Error()
+	}
+	if errStr != expected {
+		t.Error(testCase, "- Expected :", expected, " but got ", err)
+	}
+}
+
+func TestSliceGwChanged(t *testing.T) {
+	old := &SliceGwInfo{gwType: SLICE_GW_SERVER, localPorts: []string{"30001", "30003"}, remotePorts: []string{"30002", "30004"}}
+	testCases := []struct {
+		Case        string
+		LocalPorts  []string
+		RemotePorts []string
+		Changed     bool
+	}{
+		{"Testing the same ports", []string{"30001", "30003"}, []string{"30002", "30004"}, false},
+		{"Testing the ports paired the other way", []string{"30001", "30003"}, []string{"30004", "30002"}, true},
+		{"Testing the port pairs in another order", []string{"30003", "30001"}, []string{"30004", "30002"}, true},
+		{"Testing a port added", []string{"30001", "30003", "30005"}, []string{"30002", "30004", "30006"}, true},
+	}
+	for _, tt := range testCases {
+		gwInfo := &SliceGwInfo{gwType: SLICE_GW_SERVER, localPorts: tt.LocalPorts, remotePorts: tt.RemotePorts}
+		if changed := sliceGwChanged(old, gwInfo); changed != tt.Changed {
+			t.Error(tt.Case, "- Expected :", tt.Changed, " but got ", changed)
 		}
 	}
 }
@@ -0,0 +1,139 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kubeslice/netops/logger"
+)
+
+// defaultPendingGwTTL is how long the info of a slice gw received before the
+// QoS profile of its slice is kept.
+const defaultPendingGwTTL = 10 * time.Minute
+
+// pendingSliceGw is the info of a slice gw received before the QoS profile of
+// its slice. The worker operator does not order the two.
+type pendingSliceGw struct {
+	gwInfo *SliceGwInfo
+	// Time the info is dropped at, zero to keep it until the slice shows up
+	expiry time.Time
+}
+
+// getPendingGwTTL returns the expiry of the pending slice gws set by the
+// PENDING_CONTEXT_TTL env var. A zero TTL keeps them until their slice shows
+// up.
+func getPendingGwTTL() (time.Duration, error) {
+	value := os.Getenv("PENDING_CONTEXT_TTL")
+	if value == "" {
+		return defaultPendingGwTTL, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err == nil && ttl < 0 {
+		err = errors.New("negative TTL")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid PENDING_CONTEXT_TTL %q: %v", value, err)
+	}
+	return ttl, nil
+}
+
+// addPendingSliceGw keeps the info of a slice gw until the QoS profile of its
+// slice is enforced. It replaces the pending info of the same gw.
+func (m *sliceStateManager) addPendingSliceGw(sliceID string, gwInfo *SliceGwInfo, now time.Time) {
+	m.expirePendingSliceGws(now)
+	if m.pendingGws[sliceID] == nil {
+		m.pendingGws[sliceID] = make(map[string]*pendingSliceGw)
+	}
+	pending := &pendingSliceGw{gwInfo: gwInfo}
+	if m.pendingGwTTL != 0 {
+		pending.expiry = now.Add(m.pendingGwTTL)
+	}
+	m.pendingGws[sliceID][gwInfo.sliceGwId] = pending
+	logger.GlobalLogger.Infof("Slice info not available yet: %v. Keeping GW info: %v until the slice QoS profile is received", sliceID, gwInfo.sliceGwId)
+}
+
+// expirePendingSliceGws drops the pending slice gws whose slice did not show
+// up in time.
+func (m *sliceStateManager) expirePendingSliceGws(now time.Time) {
+	for sliceID, gws := range m.pendingGws {
+		for gwID, pending := range gws {
+			if !pending.expiry.IsZero() && !now.Before(pending.expiry) {
+				logger.GlobalLogger.Errorf("Dropping GW info: %v of slice: %v, the slice QoS profile was not received in %v", gwID, sliceID, m.pendingGwTTL)
+				delete(gws, gwID)
+			}
+		}
+		if len(gws) == 0 {
+			delete(m.pendingGws, sliceID)
+		}
+	}
+}
+
+// attachPendingSliceGws moves the pending slice gws of a slice to the slice.
+// Their filters are added along with the tc config of the slice.
+func (m *sliceStateManager) attachPendingSliceGws(sliceID string, now time.Time) {
+	m.expirePendingSliceGws(now)
+	sliceInfo := m.slices[sliceID]
+	for gwID, pending := range m.pendingGws[sliceID] {
+		// The pending info is left as is for a rollback of the slice.
+		gwInfo := *pending.gwInfo
+		sliceInfo.sliceGwInfo[gwID] = &gwInfo
+		logger.GlobalLogger.Infof("Attached pending GW info: %v to slice: %v", gwID, sliceInfo.sliceName)
+	}
+	delete(m.pendingGws, sliceID)
+}
+
+// restorePendingSliceGws keeps the pending slice gws of the checkpoint until
+// the expiry they were given before the restart.
+func (m *sliceStateManager) restorePendingSliceGws(cp *checkpoint, now time.Time) {
+	if cp == nil {
+		return
+	}
+	for _, cpg := range cp.PendingSliceGws {
+		if _, found := m.slices[cpg.SliceID]; found {
+			logger.GlobalLogger.Infof("Dropping pending GW info: %v, slice: %v is in the checkpoint", cpg.SliceGw.SliceGwID, cpg.SliceID)
+			continue
+		}
+		pending := &pendingSliceGw{gwInfo: cpg.SliceGw.sliceGwInfo()}
+		if cpg.Expiry != nil {
+			pending.expiry = *cpg.Expiry
+		}
+		if m.pendingGws[cpg.SliceID] == nil {
+			m.pendingGws[cpg.SliceID] = make(map[string]*pendingSliceGw)
+		}
+		m.pendingGws[cpg.SliceID][cpg.SliceGw.SliceGwID] = pending
+		logger.GlobalLogger.Infof("Restored pending GW info: %v of slice: %v", cpg.SliceGw.SliceGwID, cpg.SliceID)
+	}
+	m.expirePendingSliceGws(now)
+}
+
+// deletePendingSliceGw drops the pending info of a slice gw. It reports
+// whether the gw was pending.
+func (m *sliceStateManager) deletePendingSliceGw(sliceID string, sliceGwID string) bool {
+	if _, found := m.pendingGws[sliceID][sliceGwID]; !found {
+		return false
+	}
+	delete(m.pendingGws[sliceID], sliceGwID)
+	if len(m.pendingGws[sliceID]) == 0 {
+		delete(m.pendingGws, sliceID)
+	}
+	return true
+}
@@ -0,0 +1,231 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kubeslice/netops/logger"
+	netops "github.com/kubeslice/netops/pkg/proto"
+	"google.golang.org/grpc"
+)
+
+func TestPendingSliceGw(t *testing.T) {
+	sliceA := []string{
+		"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+		"qdisc dev eth0 root handle 17: htb default 30",
+		"class dev eth0 parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+		"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+	}
+	testCases := []struct {
+		Case string
+		// The tc change failing on the first QoS profile
+		Fail string
+		// Deletes the context before the QoS profile
+		Delete bool
+		ErrStr string
+		TcTree []string
+	}{
+		{
+			"Testing the pending context is attached with the QoS profile",
+			"",
+			false,
+			"",
+			append(sliceA,
+				"filter dev eth0 protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp src_port 30001 classid 17:12",
+				"filter dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110002 flower ip_proto udp src_port 30001 classid 17:12",
+			),
+		},
+		{
+			"Testing the pending context is kept when the QoS profile is rolled back",
+			"filter add dev eth0 protocol ipv6",
+			false,
+			"rpc error: code = Internal desc = Failed to enforce QoS policy: tc filter add dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110002 flower ip_proto udp src_port 30001 classid 17:12 failed: input/output error, rolled back 5 tc changes",
+			append(sliceA,
+				"filter dev eth0 protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp src_port 30001 classid 17:12",
+				"filter dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110002 flower ip_proto udp src_port 30001 classid 17:12",
+			),
+		},
+		{
+			"Testing a deleted pending context is not attached",
+			"",
+			true,
+			"",
+			sliceA,
+		},
+	}
+	ctx := context.Background()
+	for _, tt := range testCases {
+		backend := &recordingTcBackend{TcBackend: newFakeTcBackend()}
+		s, client := newTestNetOps(t, backend)
+		conContext := &netops.NetOpConnectionContext{
+			SliceId:                "id-a",
+			LocalSliceGwId:         "gw-a",
+			LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_SERVER,
+			LocalSliceGwNodePorts:  []string{"30001"},
+			RemoteSliceGwNodePorts: []string{"30002"},
+		}
+		_, err := client.UpdateConnectionContext(ctx, conContext)
+		expectErrStr(t, tt.Case, err, "")
+		if s.state.pendingGws["id-a"]["gw-a"] == nil {
+			t.Error(tt.Case, "- Expected gw-a to be pending")
+		}
+		if tt.Delete {
+			_, err = client.DeleteConnectionContext(ctx, conContext)
+			expectErrStr(t, tt.Case, err, "")
+		}
+
+		profile := &netops.SliceQosProfile{SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1}
+		backend.fail = tt.Fail
+		_, err = client.UpdateSliceQosProfile(ctx, profile)
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		if tt.ErrStr != "" {
+			if s.state.pendingGws["id-a"]["gw-a"] == nil {
+				t.Error(tt.Case, "- Expected gw-a to be pending after the rollback")
+			}
+			_, err = client.UpdateSliceQosProfile(ctx, profile)
+			expectErrStr(t, tt.Case, err, "")
+		}
+		if len(s.state.pendingGws) != 0 {
+			t.Error(tt.Case, "- Expected no pending slice gw but got ", s.state.pendingGws)
+		}
+		expectTcTree(t, backend, "eth0", tt.TcTree)
+	}
+}
+
+// TestRestorePendingSliceGws restarts netops with a pending slice gw in the
+// checkpoint and expects it to be attached with the QoS profile received
+// after the restart, until its expiry.
+func TestRestorePendingSliceGws(t *testing.T) {
+	ctx := context.Background()
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	t.Setenv("NETWORK_INTERFACE", "eth0")
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	t.Setenv("CHECKPOINT_PATH", path)
+	backend := newFakeTcBackend()
+	s := NewNetOps(backend)
+	err := s.BootstrapNetOpPod()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(s)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = netops.NewNetOpsServiceClient(conn).UpdateConnectionContext(ctx, &netops.NetOpConnectionContext{
+		SliceId:                "id-a",
+		LocalSliceGwId:         "gw-a",
+		LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_SERVER,
+		LocalSliceGwNodePorts:  []string{"30001"},
+		RemoteSliceGwNodePorts: []string{"30002"},
+	})
+	expectErrStr(t, "Testing the slice gw is pending", err, "")
+	expiry := s.state.pendingGws["id-a"]["gw-a"].expiry
+
+	restarted := NewNetOps(backend)
+	err = restarted.BootstrapNetOpPod()
+	expectErrStr(t, "Testing the pending slice gw is restored", err, "")
+	pending := restarted.state.pendingGws["id-a"]["gw-a"]
+	if pending == nil {
+		t.Fatal("Expected gw-a to be pending after the restart")
+	}
+	if !pending.expiry.Equal(expiry) {
+		t.Error("Expected the expiry ", expiry, " but got ", pending.expiry)
+	}
+	restartedConn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(restarted)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restartedConn.Close()
+	_, err = netops.NewNetOpsServiceClient(restartedConn).UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1})
+	expectErrStr(t, "Testing the pending slice gw is attached", err, "")
+	expectTcTree(t, backend, "eth0", []string{
+		"qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10",
+		"qdisc dev eth0 root handle 17: htb default 30",
+		"class dev eth0 parent 17: classid 17:11 htb rate 5000kbit burst 65536 prio 1",
+		"class dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+		"filter dev eth0 protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp src_port 30001 classid 17:12",
+		"filter dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110002 flower ip_proto udp src_port 30001 classid 17:12",
+	})
+
+	// A pending slice gw past its expiry is dropped on restart.
+	expired := time.Now().Add(-time.Minute)
+	err = writeCheckpoint(path, &checkpoint{Version: checkpointVersion, RootHandle: 0x17, PendingSliceGws: []checkpointPendingSliceGw{
+		{SliceID: "id-b", SliceGw: checkpointSliceGw{SliceGwID: "gw-b", GwType: "SLICE_GW_SERVER", LocalPorts: []string{"30003"}, RemotePorts: []string{"30004"}}, Expiry: &expired},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted = NewNetOps(newFakeTcBackend())
+	err = restarted.BootstrapNetOpPod()
+	expectErrStr(t, "Testing the expired slice gw is dropped", err, "")
+	if len(restarted.state.pendingGws) != 0 {
+		t.Error("Expected no pending slice gw but got ", restarted.state.pendingGws)
+	}
+}
+
+func TestExpirePendingSliceGws(t *testing.T) {
+	testCases := []struct {
+		Case    string
+		TTL     time.Duration
+		Elapsed time.Duration
+		Pending bool
+	}{
+		{"Testing a pending slice gw within its TTL is kept", time.Minute, 30 * time.Second, true},
+		{"Testing a pending slice gw past its TTL is dropped", time.Minute, time.Minute, false},
+		{"Testing a pending slice gw is kept without a TTL", 0, time.Hour, true},
+	}
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	for _, tt := range testCases {
+		m := newSliceStateManager()
+		m.pendingGwTTL = tt.TTL
+		now := time.Now()
+		m.addPendingSliceGw("id-a", &SliceGwInfo{sliceGwId: "gw-a"}, now)
+		m.expirePendingSliceGws(now.Add(tt.Elapsed))
+		if pending := m.pendingGws["id-a"]["gw-a"] != nil; pending != tt.Pending {
+			t.Error(tt.Case, "- Expected pending:", tt.Pending, " but got ", pending)
+		}
+	}
+}
+
+func TestGetPendingGwTTL(t *testing.T) {
+	testCases := []struct {
+		Case   string
+		Value  string
+		TTL    time.Duration
+		ErrStr string
+	}{
+		{"Testing without the env var", "", 10 * time.Minute, ""},
+		{"Testing a TTL", "2m", 2 * time.Minute, ""},
+		{"Testing the expiry disabled", "0", 0, ""},
+		{"Testing a negative TTL", "-1m", 0, `invalid PENDING_CONTEXT_TTL "-1m": negative TTL`},
+		{"Testing an invalid TTL", "soon", 0, `invalid PENDING_CONTEXT_TTL "soon": time: invalid duration "soon"`},
+	}
+	for _, tt := range testCases {
+		t.Setenv("PENDING_CONTEXT_TTL", tt.Value)
+		ttl, err := getPendingGwTTL()
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		if ttl != tt.TTL {
+			t.Error(tt.Case, "- Expected :", tt.TTL, " but got ", ttl)
+		}
+	}
+}
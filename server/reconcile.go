@@ -0,0 +1,449 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/kubeslice/netops/logger"
+	"github.com/vishvananda/netlink"
+)
+
+// Interval of the reconciler unless set with the RECONCILE_INTERVAL env var.
+const defaultReconcileInterval = time.Minute
+
+// Number of drift records kept for the status.
+const maxDriftRecords = 100
+
+// tcDrift - How a tc object found on the node differs from the desired one
+type tcDrift string
+
+const (
+	// The object is not on the device.
+	TC_DRIFT_MISSING tcDrift = "missing"
+	// The object is on the device with other params.
+	TC_DRIFT_ALTERED tcDrift = "altered"
+	// The filter is not one of the slice gw filters.
+	TC_DRIFT_UNEXPECTED tcDrift = "unexpected"
+)
+
+// driftRecord records a drift of the tc config found by the reconciler.
+type driftRecord struct {
+	time time.Time
+	dev  string
+	// Slice the object belongs to, empty for the root and ingress qdiscs and
+	// the unexpected filters.
+	sliceName string
+	drift     tcDrift
+	// The object as found, or as desired when missing
+	object   string
+	repaired bool
+	// Error of the repair
+	err error
+}
+
+func (d *driftRecord) String() string {
+	str := fmt.Sprintf("%v %v", d.drift, d.object)
+	if d.sliceName != "" {
+		str += fmt.Sprintf(", slice: %v", d.sliceName)
+	}
+	if !d.repaired {
+		str += fmt.Sprintf(", not repaired: %v", d.err)
+	}
+	return str
+}
+
+// getReconcileInterval returns the interval set by the RECONCILE_INTERVAL env
+// var. A zero interval disables the periodic runs, the reconciler only runs
+// on demand then.
+func getReconcileInterval() (time.Duration, error) {
+	value := os.Getenv("RECONCILE_INTERVAL")
+	if value == "" {
+		return defaultReconcileInterval, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err == nil && interval < 0 {
+		err = errors.New("negative interval")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid RECONCILE_INTERVAL %q: %v", value, err)
+	}
+	return interval, nil
+}
+
+// RunReconciler repairs the drift of the tc config from the slices every
+// RECONCILE_INTERVAL and on demand, until the context is done.
+func (s *NetOps) RunReconciler(ctx context.Context) error {
+	interval, err := getReconcileInterval()
+	if err != nil {
+		return err
+	}
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	logger.GlobalLogger.Infof("Started tc reconciler, interval: %v", interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick:
+		case <-s.reconcileCh:
+		}
+		s.reconcile()
+	}
+}
+
+// TriggerReconcile asks the reconciler for a run. The requests made while a
+// run is pending are served by that run.
+func (s *NetOps) TriggerReconcile() {
+	select {
+	case s.reconcileCh <- struct{}{}:
+	default:
+	}
+}
+
+// reconcile compares the tc config of the slices against the tc tree of the
+// devices and repairs the objects missing or altered. It returns the drifts
+// found.
+func (s *NetOps) reconcile() []*driftRecord {
+	defer s.state.lock()()
+	s.state.expirePendingSliceGws(time.Now())
+	s.expireUnclaimedSlices(time.Now())
+	if len(s.state.slices) == 0 {
+		return nil
+	}
+
+	// Retry the interfaces the tc tree could not be built on.
+	_ = s.syncNetIfaces()
+
+	drifts := []*driftRecord{}
+	if s.state.ifbIface != "" {
+		drifts = append(drifts, s.reconcileDev(s.state.ifbIface, nil)...)
+	}
+	for _, iface := range s.state.netIfaces {
+		if iface.tcInited {
+			drifts = append(drifts, s.reconcileDev(iface.name, iface)...)
+		}
+	}
+	for _, drift := range drifts {
+		s.state.recordDrift(drift)
+	}
+
+	return drifts
+}
+
+// reconcileDev repairs the tc tree of the slices on a device, the IFB device
+// when iface is nil.
+func (s *NetOps) reconcileDev(dev string, iface *IfaceInfo) []*driftRecord {
+	tree, err := s.tcBackend().Dump(dev)
+	if err != nil {
+		if iface != nil {
+			logger.GlobalLogger.Errorf("Failed to dump tc config on intf: %v, err: %v", dev, err)
+			return nil
+		}
+		// The IFB device is gone.
+		tree = &TcTree{}
+	}
+
+	root := rootQdisc(tree)
+	if root == nil || !s.state.isNetopsRootQdisc(root) {
+		drift := &driftRecord{dev: dev, drift: TC_DRIFT_MISSING, object: "qdisc dev " + dev + " root handle " + tcHandleStr(s.state.tcRootHandle()) + " htb"}
+		if root != nil {
+			drift.drift = TC_DRIFT_ALTERED
+			drift.object = "qdisc " + root.String()
+		}
+		if iface != nil {
+			// The classes went away with the root qdisc, rebuild the whole
+			// tree.
+			drift.err = s.configureTcOnIface(iface)
+			if drift.err != nil {
+				iface.tcErr = drift.err
+			}
+			drift.repaired = drift.err == nil
+			return []*driftRecord{drift}
+		}
+		drift.err = s.netOpAddIfb()
+		drift.repaired = drift.err == nil
+		if drift.err != nil {
+			return []*driftRecord{drift}
+		}
+		drifts := []*driftRecord{drift}
+		return append(drifts, s.reconcileSliceTc(dev, &TcTree{})...)
+	}
+
+	drifts := []*driftRecord{}
+	if iface != nil && s.state.ifbIface != "" && qdiscByHandle(tree, tcIngressHandle()) == nil {
+		qdisc := &TcQdisc{Dev: dev, Kind: tcKindIngress, Parent: netlink.HANDLE_INGRESS, Handle: tcIngressHandle()}
+		drift := &driftRecord{dev: dev, drift: TC_DRIFT_MISSING, object: "qdisc " + qdisc.String()}
+		drift.err = s.tcBackend().QdiscAdd(qdisc)
+		drift.repaired = drift.err == nil
+		drifts = append(drifts, drift)
+	}
+
+	return append(drifts, s.reconcileSliceTc(dev, tree)...)
+}
+
+// sliceIDsByClassId returns the IDs of the slices in the order of their class
+// IDs, so that the repairs are made in a stable order.
+func (m *sliceStateManager) sliceIDsByClassId() []string {
+	ids := []string{}
+	for sliceID := range m.slices {
+		ids = append(ids, sliceID)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return m.slices[ids[i]].tcParentClassId < m.slices[ids[j]].tcParentClassId
+	})
+	return ids
+}
+
+// reconcileSliceTc repairs the classes, leaf qdiscs and filters of the slices
+// in the tree of a device.
+func (s *NetOps) reconcileSliceTc(dev string, tree *TcTree) []*driftRecord {
+	drifts := []*driftRecord{}
+	for _, sliceID := range s.state.sliceIDsByClassId() {
+		sliceInfo := s.state.slices[sliceID]
+		if !sliceInfo.tcInited || sliceInfo.tc == nil {
+			continue
+		}
+		for _, class := range []*TcClass{
+			s.state.sliceParentClass(dev, sliceInfo.tcParentClassFqId, sliceInfo.tc),
+			sliceLeafClass(dev, sliceInfo, sliceInfo.tcLeafClassFqId, sliceInfo.tc),
+		} {
+			drift := s.reconcileClass(tree, class)
+			if drift != nil {
+				drift.sliceName = sliceInfo.sliceName
+				drifts = append(drifts, drift)
+			}
+		}
+		drift := s.reconcileLeafQdisc(tree, sliceLeafQdisc(dev, sliceInfo, sliceInfo.tc))
+		if drift != nil {
+			drift.sliceName = sliceInfo.sliceName
+			drifts = append(drifts, drift)
+		}
+	}
+
+	return append(drifts, s.reconcileFilters(dev, tree)...)
+}
+
+// sameClass reports whether the class found matches the desired one. The
+// burst is left out, the kernel rounds it to its clock.
+func sameClass(found *TcClass, desired *TcClass) bool {
+	ceil := func(c *TcClass) uint64 {
+		if c.Ceil == 0 {
+			return c.Rate
+		}
+		return c.Ceil
+	}
+	return found.Parent == desired.Parent && found.Rate == desired.Rate &&
+		ceil(found) == ceil(desired) && found.Prio == desired.Prio
+}
+
+func (s *NetOps) reconcileClass(tree *TcTree, class *TcClass) *driftRecord {
+	found := classByHandle(tree, class.Handle)
+	if found != nil && sameClass(found, class) {
+		return nil
+	}
+	drift := &driftRecord{dev: class.Dev, drift: TC_DRIFT_MISSING, object: "class " + class.String()}
+	if found == nil {
+		drift.err = s.tcBackend().ClassAdd(class)
+	} else {
+		drift.drift = TC_DRIFT_ALTERED
+		drift.object = "class " + found.String()
+		drift.err = s.tcBackend().ClassReplace(class)
+	}
+	drift.repaired = drift.err == nil
+	return drift
+}
+
+// sameQdisc reports whether the leaf qdisc found matches the desired one.
+func sameQdisc(found *TcQdisc, desired *TcQdisc) bool {
+	return found.Kind == desired.Kind && found.Handle == desired.Handle && found.Rate == desired.Rate
+}
+
+func (s *NetOps) reconcileLeafQdisc(tree *TcTree, qdisc *TcQdisc) *driftRecord {
+	var found *TcQdisc
+	for _, q := range tree.Qdiscs {
+		if q.Parent == qdisc.Parent {
+			found = q
+		}
+	}
+	if found != nil && sameQdisc(found, qdisc) {
+		return nil
+	}
+	drift := &driftRecord{dev: qdisc.Dev, drift: TC_DRIFT_MISSING, object: "qdisc " + qdisc.String()}
+	if found != nil {
+		// The kind of a qdisc cannot be changed in place.
+		drift.drift = TC_DRIFT_ALTERED
+		drift.object = "qdisc " + found.String()
+		drift.err = s.tcBackend().QdiscDel(&TcQdisc{Dev: qdisc.Dev, Parent: qdisc.Parent})
+	}
+	if drift.err == nil {
+		drift.err = s.tcBackend().QdiscAdd(qdisc)
+	}
+	drift.repaired = drift.err == nil
+	return drift
+}
+
+// sliceGwDevFilters returns the filters of the slice gws configured on a
+// device, keyed by filterKey, along with the slice they belong to.
+func (s *NetOps) sliceGwDevFilters(dev string) (map[string]*TcFilter, map[string]string) {
+	filters := map[string]*TcFilter{}
+	sliceNames := map[string]string{}
+	for _, sliceID := range s.state.sliceIDsByClassId() {
+		sliceInfo := s.state.slices[sliceID]
+		if sliceInfo.tc == nil {
+			continue
+		}
+		for _, gwInfo := range sliceInfo.sliceGwInfo {
+			for _, family := range tcFilterFamilies {
+				if !gwInfo.tcConfigured[family] {
+					continue
+				}
+				for i := range gwInfo.localPorts {
+					egress, _ := s.state.sliceGwPortFilter(gwInfo, i, family, gwInfo.tcFilterPrio, sliceInfo.tcLeafClassFqId)
+					if egress == nil {
+						continue
+					}
+					devFilters := []*TcFilter{s.state.sliceGwIngressFilter(egress)}
+					if dev != s.state.ifbIface {
+						devFilters = s.state.sliceGwIfaceFilters(dev, egress, sliceInfo.tc)
+					}
+					for _, filter := range devFilters {
+						filters[filterKey(filter)] = filter
+						sliceNames[filterKey(filter)] = sliceInfo.sliceName
+					}
+				}
+			}
+		}
+	}
+	return filters, sliceNames
+}
+
+// ownsFilter reports whether the filter under the root or ingress qdisc was
+// added by netops. The root qdisc is the netops one, all its filters are. The
+// ingress qdisc of an interface is shared with other components, the netops
+// filters there are the ones redirecting to the IFB device, the ones whose
+// handle is made of a class ID of the slices and the ones matching a slice gw
+// filter, keyed by filterKey.
+func (m *sliceStateManager) ownsFilter(filter *TcFilter, sliceGwFilters map[string]*TcFilter) bool {
+	switch {
+	case filter.Parent == m.tcRootHandle():
+		return true
+	case filter.Parent != tcIngressHandle():
+		return false
+	case filter.RedirectDev == ifbIfaceName:
+		return true
+	}
+	if filter.Handle != 0 {
+		major, _ := netlink.MajorMinor(filter.Handle)
+		if m.classIds.blocks[uint32(major)] != nil {
+			return true
+		}
+	}
+	return sliceGwFilters[filterKey(filter)] != nil
+}
+
+// reconcileFilters repairs the slice gw filters of a device. The unexpected
+// netops filters are deleted by their handle, the filters under the root
+// qdisc are flushed and added again when one without a handle is found there.
+func (s *NetOps) reconcileFilters(dev string, tree *TcTree) []*driftRecord {
+	desired, sliceNames := s.sliceGwDevFilters(dev)
+	found := map[string]bool{}
+	flush := map[uint32][]*driftRecord{}
+	drifts := []*driftRecord{}
+	for _, filter := range tree.Filters {
+		if !s.state.ownsFilter(filter, desired) {
+			continue
+		}
+		key := filterKey(filter)
+		if want := desired[key]; want != nil && want.Handle == filter.Handle && !found[key] {
+			found[key] = true
+			continue
+		}
+		drift := &driftRecord{dev: dev, drift: TC_DRIFT_UNEXPECTED, object: "filter " + filter.String()}
+		drifts = append(drifts, drift)
+		// The shared ingress qdisc is never flushed, the filters without a
+		// handle are deleted along with the others at their prio there.
+		if (filter.Handle == 0 || filter.Prio == 0) && filter.Parent == s.state.tcRootHandle() {
+			flush[filter.Parent] = append(flush[filter.Parent], drift)
+			continue
+		}
+		drift.err = s.tcBackend().FilterDel(filter)
+		drift.repaired = drift.err == nil
+	}
+	keys := []string{}
+	for key := range desired {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		filter := desired[key]
+		if found[key] {
+			continue
+		}
+		drift := &driftRecord{dev: dev, sliceName: sliceNames[key], drift: TC_DRIFT_MISSING, object: "filter " + filter.String()}
+		drifts = append(drifts, drift)
+		if flush[filter.Parent] != nil {
+			flush[filter.Parent] = append(flush[filter.Parent], drift)
+			continue
+		}
+		drift.err = s.tcBackend().FilterAdd(filter)
+		drift.repaired = drift.err == nil
+	}
+
+	for parent, parentDrifts := range flush {
+		err := s.tcBackend().FilterDel(&TcFilter{Dev: dev, Parent: parent})
+		for _, key := range keys {
+			if err != nil {
+				break
+			}
+			if desired[key].Parent == parent {
+				err = s.tcBackend().FilterAdd(desired[key])
+			}
+		}
+		for _, drift := range parentDrifts {
+			drift.err = err
+			drift.repaired = err == nil
+		}
+	}
+
+	return drifts
+}
+
+// recordDrift logs a drift and keeps it for the status.
+func (m *sliceStateManager) recordDrift(drift *driftRecord) {
+	drift.time = time.Now()
+	if drift.repaired {
+		logger.GlobalLogger.Infof("Repaired tc drift on intf: %v, %v", drift.dev, drift)
+	} else {
+		logger.GlobalLogger.Errorf("Failed to repair tc drift on intf: %v, %v", drift.dev, drift)
+	}
+	m.drifts = append(m.drifts, drift)
+	if len(m.drifts) > maxDriftRecords {
+		m.drifts = m.drifts[len(m.drifts)-maxDriftRecords:]
+	}
+	m.driftCount++
+}
@@ -0,0 +1,305 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestReconcile(t *testing.T) {
+	root := defaultRootHandle()
+	testCases := []struct {
+		Case string
+		// Changes the tc config behind the back of netops
+		Change func(b TcBackend) error
+		// Expected drifts
+		Drifts []string
+	}{
+		{
+			"Testing no drift is found in the tc config of the slices",
+			nil,
+			[]string{},
+		},
+		{
+			"Testing a missing leaf qdisc is added",
+			func(b TcBackend) error {
+				return b.QdiscDel(&TcQdisc{Dev: "eth0", Parent: defaultClassHandle(0x12)})
+			},
+			[]string{"missing qdisc dev eth0 parent 17:12 handle 11: sfq perturb 10, slice: slice-a"},
+		},
+		{
+			"Testing an altered class is replaced",
+			func(b TcBackend) error {
+				return b.ClassReplace(&TcClass{Dev: "eth0", Parent: root, Handle: defaultClassHandle(0x22), Rate: 1000, Burst: 64 * 1024})
+			},
+			[]string{"altered class dev eth0 parent 17: classid 17:22 htb rate 1000kbit burst 65536, slice: slice-b"},
+		},
+		{
+			"Testing a leaf qdisc of another kind is swapped",
+			func(b TcBackend) error {
+				err := b.QdiscDel(&TcQdisc{Dev: "eth0", Parent: defaultClassHandle(0x23)})
+				if err == nil {
+					err = b.QdiscAdd(&TcQdisc{Dev: "eth0", Kind: tcKindSfq, Parent: defaultClassHandle(0x23), Handle: netlink.MakeHandle(0x22, 0), Perturb: 10})
+				}
+				return err
+			},
+			[]string{"altered qdisc dev eth0 parent 17:23 handle 22: sfq perturb 10, slice: slice-b"},
+		},
+		{
+			"Testing missing filters are added",
+			func(b TcBackend) error {
+				return b.FilterDel(&TcFilter{Dev: "eth0", Parent: root, Prio: 11, Family: netlink.FAMILY_V6})
+			},
+			[]string{
+				"missing filter dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110003 flower ip_proto udp src_port 30001 classid 17:12 action pedit ex munge ip6 traffic_class set 0xb8 retain 0xfc pipe, slice: slice-a",
+				"missing filter dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110004 flower ip_proto udp src_port 30003 classid 17:12 action pedit ex munge ip6 traffic_class set 0xb8 retain 0xfc pipe, slice: slice-a",
+			},
+		},
+		{
+			"Testing an unexpected filter is removed",
+			func(b TcBackend) error {
+				return b.FilterAdd(&TcFilter{Dev: "eth0", Parent: root, Prio: 3, IPProto: unix.IPPROTO_UDP, DstPort: 40000, ClassId: defaultClassHandle(0x23)})
+			},
+			[]string{"unexpected filter dev eth0 protocol ip parent 17: prio 3 flower ip_proto udp dst_port 40000 classid 17:23"},
+		},
+		{
+			"Testing an unexpected filter with a handle is deleted on its own",
+			func(b TcBackend) error {
+				return b.FilterAdd(&TcFilter{Dev: "eth0", Parent: root, Prio: 3, Handle: 0x330001, IPProto: unix.IPPROTO_UDP, DstPort: 40000, ClassId: defaultClassHandle(0x23)})
+			},
+			[]string{"unexpected filter dev eth0 protocol ip parent 17: prio 3 handle 0x330001 flower ip_proto udp dst_port 40000 classid 17:23"},
+		},
+		{
+			"Testing a filter added again with another handle is replaced",
+			func(b TcBackend) error {
+				filter := &TcFilter{Dev: "eth0", Parent: root, Prio: 1, Handle: 0x110001, IPProto: unix.IPPROTO_UDP, SrcPort: 30001, ClassId: defaultClassHandle(0x12), MarkDscp: true, Dscp: 0x2e}
+				err := b.FilterDel(filter)
+				if err == nil {
+					filter.Handle = 0x110009
+					err = b.FilterAdd(filter)
+				}
+				return err
+			},
+			[]string{
+				"unexpected filter dev eth0 protocol ip parent 17: prio 1 handle 0x110009 flower ip_proto udp src_port 30001 classid 17:12 action pedit ex munge ip dsfield set 0xb8 retain 0xfc pipe action csum ip pipe",
+				"missing filter dev eth0 protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp src_port 30001 classid 17:12 action pedit ex munge ip dsfield set 0xb8 retain 0xfc pipe action csum ip pipe, slice: slice-a",
+			},
+		},
+		{
+			"Testing the tree is rebuilt without the root qdisc",
+			func(b TcBackend) error {
+				return b.QdiscDel(&TcQdisc{Dev: "eth0", Parent: netlink.HANDLE_ROOT})
+			},
+			[]string{"missing qdisc dev eth0 root handle 17: htb"},
+		},
+	}
+	for _, tt := range testCases {
+		backend := newFakeTcBackend()
+		s, _ := newTestNetOps(t, backend)
+		configureSlicesForAdoption(t, s)
+		before, err := backend.Dump("eth0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.Change != nil {
+			err = tt.Change(backend)
+			if err != nil {
+				t.Fatal(tt.Case, err)
+			}
+		}
+
+		drifts := []string{}
+		for _, drift := range s.reconcile() {
+			drifts = append(drifts, drift.String())
+		}
+		if len(drifts) != len(tt.Drifts) {
+			t.Error(tt.Case, "- Expected drifts:", tt.Drifts, " but got ", drifts)
+		}
+		for i := range drifts {
+			if i < len(tt.Drifts) && drifts[i] != tt.Drifts[i] {
+				t.Error(tt.Case, "- Expected :", tt.Drifts[i], " but got ", drifts[i])
+			}
+		}
+		expectTcTree(t, backend, "eth0", tcTreeLines(before))
+		if s.state.driftCount != uint64(len(tt.Drifts)) || len(s.state.drifts) != len(tt.Drifts) {
+			t.Error(tt.Case, "- Expected ", len(tt.Drifts), " drift records but got ", s.state.driftCount)
+		}
+		// The repaired tree has no drift left.
+		if drifts := s.reconcile(); len(drifts) != 0 {
+			t.Error(tt.Case, "- Expected no drift after the repair but got ", drifts)
+		}
+	}
+}
+
+func TestReconcileIfb(t *testing.T) {
+	t.Setenv("INGRESS_SHAPING", "true")
+	backend := newFakeTcBackend()
+	s, _ := newTestNetOps(t, backend)
+	configureSlicesForAdoption(t, s)
+	eth0, err := backend.Dump("eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ifb, err := backend.Dump(ifbIfaceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The IFB device and the ingress qdisc holding the redirect filters go
+	// away.
+	err = backend.IfbDel(&TcIfb{Dev: ifbIfaceName})
+	if err == nil {
+		err = backend.QdiscDel(&TcQdisc{Dev: "eth0", Kind: tcKindIngress, Parent: netlink.HANDLE_INGRESS})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	drifts := s.reconcile()
+	if len(drifts) == 0 || drifts[0].object != "qdisc dev netops-ifb root handle 17: htb" || !drifts[0].repaired {
+		t.Error("Expected the root qdisc of the IFB device to be added but got ", drifts)
+	}
+	expectTcTree(t, backend, "eth0", tcTreeLines(eth0))
+	expectTcTree(t, backend, ifbIfaceName, tcTreeLines(ifb))
+	if !backend.ifbs[ifbIfaceName] {
+		t.Error("Expected the IFB device to be added")
+	}
+}
+
+func TestReconcileIngressFilters(t *testing.T) {
+	t.Setenv("INGRESS_SHAPING", "true")
+	backend := newFakeTcBackend()
+	s, _ := newTestNetOps(t, backend)
+	configureSlicesForAdoption(t, s)
+
+	// The filters of another component on the shared ingress qdisc are left
+	// alone, even without a handle at the prio of the slice gw filters. The
+	// one redirecting to the IFB device is a netops one.
+	foreign := []*TcFilter{
+		{Dev: "eth0", Parent: tcIngressHandle(), Prio: 1, Handle: 0x10001, IPProto: unix.IPPROTO_TCP, DstPort: 443, ClassId: netlink.MakeHandle(1, 1)},
+		{Dev: "eth0", Parent: tcIngressHandle(), Prio: 2, IPProto: unix.IPPROTO_TCP, DstPort: 8443, ClassId: netlink.MakeHandle(1, 2)},
+	}
+	for _, filter := range foreign {
+		err := backend.FilterAdd(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	eth0, err := backend.Dump("eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = backend.FilterAdd(&TcFilter{Dev: "eth0", Parent: tcIngressHandle(), Prio: 1, Handle: 0x990001, IPProto: unix.IPPROTO_UDP, SrcPort: 40000, RedirectDev: ifbIfaceName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	drifts := []string{}
+	for _, drift := range s.reconcile() {
+		drifts = append(drifts, drift.String())
+	}
+	expected := []string{"unexpected filter dev eth0 protocol ip parent ffff: prio 1 handle 0x990001 flower ip_proto udp src_port 40000 action mirred egress redirect dev netops-ifb"}
+	if !reflect.DeepEqual(drifts, expected) {
+		t.Error("Expected drifts:", expected, " but got ", drifts)
+	}
+	expectTcTree(t, backend, "eth0", tcTreeLines(eth0))
+
+	// The tc config adopted on restart leaves it alone too.
+	err = NewNetOps(backend).BootstrapNetOpPod()
+	if err != nil {
+		t.Fatal(err)
+	}
+	eth0, err = backend.Dump("eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ingress := []string{}
+	for _, filter := range eth0.Filters {
+		if filter.Parent == tcIngressHandle() {
+			ingress = append(ingress, filter.String())
+		}
+	}
+	expected = []string{}
+	for _, filter := range foreign {
+		expected = append(expected, filter.String())
+	}
+	sort.Strings(ingress)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(ingress, expected) {
+		t.Error("Expected the ingress filters:", expected, " but got ", ingress)
+	}
+}
+
+func TestRunReconciler(t *testing.T) {
+	t.Setenv("RECONCILE_INTERVAL", "0")
+	backend := newFakeTcBackend()
+	s, _ := newTestNetOps(t, backend)
+	configureSlicesForAdoption(t, s)
+	err := backend.QdiscDel(&TcQdisc{Dev: "eth0", Parent: defaultClassHandle(0x12)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.RunReconciler(ctx) }()
+	s.TriggerReconcile()
+	for i := 0; i < 100; i++ {
+		unlock := s.state.lock()
+		count := s.state.driftCount
+		unlock()
+		if count != 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	err = <-done
+	expectErrStr(t, "Testing the reconciler stops", err, "")
+	if s.state.driftCount != 1 {
+		t.Error("Expected the drift to be repaired on demand but got ", s.state.drifts)
+	}
+}
+
+func TestGetReconcileInterval(t *testing.T) {
+	testCases := []struct {
+		Case     string
+		Value    string
+		Interval time.Duration
+		ErrStr   string
+	}{
+		{"Testing without the env var", "", time.Minute, ""},
+		{"Testing an interval", "30s", 30 * time.Second, ""},
+		{"Testing the periodic runs disabled", "0", 0, ""},
+		{"Testing a negative interval", "-1s", 0, `invalid RECONCILE_INTERVAL "-1s": negative interval`},
+		{"Testing an invalid interval", "often", 0, `invalid RECONCILE_INTERVAL "often": time: invalid duration "often"`},
+	}
+	for _, tt := range testCases {
+		t.Setenv("RECONCILE_INTERVAL", tt.Value)
+		interval, err := getReconcileInterval()
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		if interval != tt.Interval {
+			t.Error(tt.Case, "- Expected :", tt.Interval, " but got ", interval)
+		}
+	}
+}
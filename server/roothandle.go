@@ -0,0 +1,155 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kubeslice/netops/logger"
+	"github.com/vishvananda/netlink"
+)
+
+// Major of the root qdisc netops prefers, the one of the releases that did
+// not choose it.
+const defaultRootHandleId uint32 = 0x17
+
+// getConfiguredRootHandle returns the major of the root qdisc set by the
+// TC_ROOT_HANDLE env var, 0 when it is not set. The major is in hex the way
+// tc prints it, with or without the trailing colon. It only picks the handle
+// of the root qdisc netops adds: the tc tree of the slices is not attached
+// under the hierarchy of another component, whose root qdisc is reported as
+// foreign.
+func getConfiguredRootHandle() (uint32, error) {
+	value := os.Getenv("TC_ROOT_HANDLE")
+	if value == "" {
+		return 0, nil
+	}
+	major, err := strconv.ParseUint(strings.TrimSuffix(value, ":"), 16, 16)
+	if err == nil && (major == 0 || major == 0xffff) {
+		err = errors.New("reserved major")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid TC_ROOT_HANDLE %q: %v", value, err)
+	}
+	return uint32(major), nil
+}
+
+// isNetopsRootSignature reports whether the root qdisc looks like one netops
+// added: an htb qdisc sending the unclassified traffic to the netops default
+// class.
+func isNetopsRootSignature(qdisc *TcQdisc) bool {
+	return qdisc.Parent == netlink.HANDLE_ROOT && qdisc.Kind == tcKindHtb && qdisc.DefaultClass == htbDefaultClassId
+}
+
+// ownsRootQdisc reports whether the root qdisc found on bootstrap is the one
+// netops added: it matches a marker of the checkpoint. Without the markers,
+// with no checkpoint or one of an older version, it is told by its signature.
+func (m *sliceStateManager) ownsRootQdisc(cp *checkpoint, qdisc *TcQdisc) bool {
+	if cp == nil || cp.RootQdiscs == nil {
+		return m.isNetopsRootQdisc(qdisc)
+	}
+	for i := range cp.RootQdiscs {
+		if cp.RootQdiscs[i].matches(qdisc) && qdisc.Handle == m.tcRootHandle() {
+			return true
+		}
+	}
+	return false
+}
+
+// rootHandleTaken reports whether a root qdisc of another component uses the
+// major of the checkpoint: it has the major but matches no marker.
+func (s *NetOps) rootHandleTaken(cp *checkpoint) (bool, error) {
+	if cp.RootQdiscs == nil {
+		return false, nil
+	}
+	for _, iface := range s.state.netIfaces {
+		tree, err := s.tcBackend().Dump(iface.name)
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to dump tc config on intf: %v, err: %v", iface.name, err)
+			return false, err
+		}
+		root := rootQdisc(tree)
+		if root == nil || root.Handle>>16 != cp.RootHandle {
+			continue
+		}
+		owned := false
+		for i := range cp.RootQdiscs {
+			owned = owned || cp.RootQdiscs[i].matches(root)
+		}
+		if !owned {
+			logger.GlobalLogger.Infof("Root qdisc handle %v of the checkpoint is in use by a foreign root qdisc: %v",
+				tcHandleStr(netlink.MakeHandle(uint16(cp.RootHandle), 0)), root)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// chooseRootHandle returns the major of the netops root qdisc: the configured
+// one, else the one of the checkpoint unless a root qdisc of another component
+// took it over, else the one of a root qdisc netops added before the
+// checkpoint was lost, else a major no qdisc uses on the interfaces.
+func (s *NetOps) chooseRootHandle(cp *checkpoint) (uint32, error) {
+	major, err := getConfiguredRootHandle()
+	if err != nil || major != 0 {
+		return major, err
+	}
+	if cp != nil && cp.RootHandle != 0 {
+		taken, err := s.rootHandleTaken(cp)
+		if err != nil {
+			return 0, err
+		}
+		if !taken {
+			return cp.RootHandle, nil
+		}
+	}
+
+	used := map[uint32]bool{}
+	for _, iface := range s.state.netIfaces {
+		tree, err := s.tcBackend().Dump(iface.name)
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to dump tc config on intf: %v, err: %v", iface.name, err)
+			return 0, err
+		}
+		for _, qdisc := range tree.Qdiscs {
+			if cp == nil && isNetopsRootSignature(qdisc) {
+				// Keep the major, so that the tree is adopted.
+				return qdisc.Handle >> 16, nil
+			}
+			used[qdisc.Handle>>16] = true
+		}
+	}
+	if !used[defaultRootHandleId] {
+		return defaultRootHandleId, nil
+	}
+	// The majors after the default one are tried first, 1: and the like are
+	// the ones other components pick.
+	for major = defaultRootHandleId + 1; major != defaultRootHandleId; major = major%0xfffe + 1 {
+		if !used[major] {
+			logger.GlobalLogger.Infof("Root qdisc handle %v is in use, using %v instead",
+				tcHandleStr(netlink.MakeHandle(uint16(defaultRootHandleId), 0)), tcHandleStr(netlink.MakeHandle(uint16(major), 0)))
+			return major, nil
+		}
+	}
+
+	return 0, errors.New("could not find a free root qdisc handle")
+}
@@ -0,0 +1,294 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kubeslice/netops/logger"
+	netops "github.com/kubeslice/netops/pkg/proto"
+	"github.com/vishvananda/netlink"
+	"google.golang.org/grpc"
+)
+
+func TestChooseRootHandle(t *testing.T) {
+	testCases := []struct {
+		Case string
+		// Root qdisc on the interface, if any
+		Root       *TcQdisc
+		Configured string
+		Checkpoint *checkpoint
+		Major      uint32
+		ErrStr     string
+	}{
+		{
+			"Testing the default handle is used on a node without tc config",
+			nil,
+			"",
+			nil,
+			0x17,
+			"",
+		},
+		{
+			"Testing the root qdisc of an earlier netops keeps the default handle",
+			&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: netlink.MakeHandle(0x17, 0), DefaultClass: 0x30},
+			"",
+			nil,
+			0x17,
+			"",
+		},
+		{
+			"Testing a root qdisc of another component with the default handle is avoided",
+			&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: netlink.MakeHandle(0x17, 0), DefaultClass: 0x1},
+			"",
+			nil,
+			0x18,
+			"",
+		},
+		{
+			"Testing the handle of a netops root qdisc is kept without a checkpoint",
+			&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: netlink.MakeHandle(0x19, 0), DefaultClass: 0x30},
+			"",
+			nil,
+			0x19,
+			"",
+		},
+		{
+			"Testing the handle of the checkpoint is used",
+			&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: netlink.MakeHandle(0x19, 0), DefaultClass: 0x30},
+			"",
+			&checkpoint{Version: checkpointVersion, RootHandle: 0x19},
+			0x19,
+			"",
+		},
+		{
+			"Testing the handle of the checkpoint is used with its root qdisc",
+			&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: netlink.MakeHandle(0x19, 0), DefaultClass: 0x30},
+			"",
+			&checkpoint{Version: checkpointVersion, RootHandle: 0x19, RootQdiscs: []checkpointRootQdisc{{Dev: "eth0", Kind: tcKindHtb, Handle: netlink.MakeHandle(0x19, 0), DefaultClass: 0x30}}},
+			0x19,
+			"",
+		},
+		{
+			"Testing the handle of the checkpoint taken by a root qdisc of another component is avoided",
+			&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: netlink.MakeHandle(0x19, 0), DefaultClass: 0x1},
+			"",
+			&checkpoint{Version: checkpointVersion, RootHandle: 0x19, RootQdiscs: []checkpointRootQdisc{{Dev: "eth0", Kind: tcKindHtb, Handle: netlink.MakeHandle(0x19, 0), DefaultClass: 0x30}}},
+			0x17,
+			"",
+		},
+		{
+			"Testing a root qdisc with the netops signature but no marker is avoided",
+			&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: netlink.MakeHandle(0x19, 0), DefaultClass: 0x30},
+			"",
+			&checkpoint{Version: checkpointVersion, RootHandle: 0x19, RootQdiscs: []checkpointRootQdisc{}},
+			0x17,
+			"",
+		},
+		{
+			"Testing the configured handle is used",
+			&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: netlink.MakeHandle(0x20, 0), DefaultClass: 0x1},
+			"20:",
+			&checkpoint{Version: checkpointVersion, RootHandle: 0x19},
+			0x20,
+			"",
+		},
+		{
+			"Testing the ingress major cannot be configured",
+			nil,
+			"ffff",
+			nil,
+			0,
+			`invalid TC_ROOT_HANDLE "ffff": reserved major`,
+		},
+		{
+			"Testing an invalid configured handle",
+			nil,
+			"1:1",
+			nil,
+			0,
+			`invalid TC_ROOT_HANDLE "1:1": strconv.ParseUint: parsing "1:1": invalid syntax`,
+		},
+	}
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	t.Setenv("NETWORK_INTERFACE", "eth0")
+	for _, tt := range testCases {
+		t.Setenv("TC_ROOT_HANDLE", tt.Configured)
+		backend := newFakeTcBackend()
+		if tt.Root != nil {
+			err := backend.QdiscAdd(tt.Root)
+			if err != nil {
+				t.Fatal(tt.Case, err)
+			}
+		}
+		s := NewNetOps(backend)
+		s.state.netIfaces = []*IfaceInfo{{name: "eth0"}}
+		major, err := s.chooseRootHandle(tt.Checkpoint)
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		if major != tt.Major {
+			t.Error(tt.Case, "- Expected :", tt.Major, " but got ", major)
+		}
+	}
+}
+
+func TestOwnsRootQdisc(t *testing.T) {
+	root := &TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: netlink.MakeHandle(0x17, 0), DefaultClass: 0x30}
+	marker := checkpointRootQdisc{Dev: "eth0", Kind: tcKindHtb, Handle: netlink.MakeHandle(0x17, 0), DefaultClass: 0x30}
+	testCases := []struct {
+		Case       string
+		Root       *TcQdisc
+		Checkpoint *checkpoint
+		Owned      bool
+	}{
+		{"Testing the signature is used without a checkpoint", root, nil, true},
+		{"Testing the signature is used without the markers", root, &checkpoint{RootHandle: 0x17}, true},
+		{"Testing a root qdisc matching its marker", root, &checkpoint{RootHandle: 0x17, RootQdiscs: []checkpointRootQdisc{marker}}, true},
+		{"Testing a root qdisc without a marker", root, &checkpoint{RootHandle: 0x17, RootQdiscs: []checkpointRootQdisc{}}, false},
+		{
+			"Testing a root qdisc with the marker of another interface",
+			&TcQdisc{Dev: "eth1", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: netlink.MakeHandle(0x17, 0), DefaultClass: 0x30},
+			&checkpoint{RootHandle: 0x17, RootQdiscs: []checkpointRootQdisc{marker}},
+			false,
+		},
+		{
+			"Testing a root qdisc of another component with the netops handle",
+			&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: netlink.MakeHandle(0x17, 0), DefaultClass: 0x1},
+			&checkpoint{RootHandle: 0x17, RootQdiscs: []checkpointRootQdisc{marker}},
+			false,
+		},
+	}
+	for _, tt := range testCases {
+		m := newSliceStateManager()
+		if owned := m.ownsRootQdisc(tt.Checkpoint, tt.Root); owned != tt.Owned {
+			t.Error(tt.Case, "- Expected :", tt.Owned, " but got ", owned)
+		}
+	}
+}
+
+// TestRootHandleOfForeignRoot replaces a root qdisc of another component
+// using the handle netops prefers and expects the netops tc config to use
+// another handle, across restarts.
+func TestRootHandleOfForeignRoot(t *testing.T) {
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	t.Setenv("NETWORK_INTERFACE", "eth0")
+	t.Setenv("TC_REPLACE_FOREIGN_ROOT", "true")
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	t.Setenv("CHECKPOINT_PATH", path)
+	backend := newFakeTcBackend()
+	err := backend.QdiscAdd(&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: netlink.MakeHandle(0x17, 0), DefaultClass: 0x1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewNetOps(backend)
+	err = s.BootstrapNetOpPod()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(s)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := netops.NewNetOpsServiceClient(conn)
+	_, err = client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1})
+	expectErrStr(t, "Testing the slice is added", err, "")
+	_, err = client.UpdateConnectionContext(ctx, &netops.NetOpConnectionContext{
+		SliceId:                "id-a",
+		LocalSliceGwId:         "gw-a",
+		LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_SERVER,
+		LocalSliceGwNodePorts:  []string{"30001"},
+		RemoteSliceGwNodePorts: []string{"30002"},
+	})
+	expectErrStr(t, "Testing the slice gw is added", err, "")
+	_, err = client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1})
+	expectErrStr(t, "Testing the filters of the slice gw are added", err, "")
+	tcTree := []string{
+		"qdisc dev eth0 parent 18:12 handle 11: sfq perturb 10",
+		"qdisc dev eth0 root handle 18: htb default 30",
+		"class dev eth0 parent 18: classid 18:11 htb rate 5000kbit burst 65536 prio 1",
+		"class dev eth0 parent 18:11 classid 18:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+		"filter dev eth0 protocol ip parent 18: prio 1 handle 0x110001 flower ip_proto udp src_port 30001 classid 18:12",
+		"filter dev eth0 protocol ipv6 parent 18: prio 11 handle 0x110002 flower ip_proto udp src_port 30001 classid 18:12",
+	}
+	expectTcTree(t, backend, "eth0", tcTree)
+	cp, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	markers := []checkpointRootQdisc{{Dev: "eth0", Kind: tcKindHtb, Handle: netlink.MakeHandle(0x18, 0), DefaultClass: 0x30}}
+	if !reflect.DeepEqual(cp.RootQdiscs, markers) {
+		t.Error("Expected the root qdisc markers:", markers, " but got ", cp.RootQdiscs)
+	}
+
+	// The handle is taken from the checkpoint on restart, the tc config is
+	// adopted as is.
+	recorder := &recordingTcBackend{TcBackend: backend, ops: []string{}}
+	restarted := NewNetOps(recorder)
+	err = restarted.BootstrapNetOpPod()
+	expectErrStr(t, "Testing the tc config is adopted", err, "")
+	if restarted.state.rootHandleId != 0x18 {
+		t.Error("Expected the root handle 0x18 but got ", restarted.state.rootHandleId)
+	}
+	if len(recorder.ops) != 0 {
+		t.Error("Expected no tc change but got ", recorder.ops)
+	}
+	expectTcTree(t, backend, "eth0", tcTree)
+}
+
+// TestRootHandleCollidesWithCheckpoint configures a root handle holding the
+// class ID of a slice in the checkpoint and expects the slice to get another
+// class ID.
+func TestRootHandleCollidesWithCheckpoint(t *testing.T) {
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	t.Setenv("NETWORK_INTERFACE", "eth0")
+	t.Setenv("TC_ROOT_HANDLE", "22")
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	t.Setenv("CHECKPOINT_PATH", path)
+	err := writeCheckpoint(path, &checkpoint{Version: checkpointVersion, RootHandle: 0x17, Slices: []checkpointSlice{
+		{SliceID: "id-a", SliceName: "slice-a", ClassID: 0x11, QosProfile: &checkpointQosProfile{ClassType: "HTB", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1}},
+		{SliceID: "id-b", SliceName: "slice-b", ClassID: 0x22, QosProfile: &checkpointQosProfile{ClassType: "HTB", BwCeiling: 3000, BwGuaranteed: 500, Priority: 2}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := newFakeTcBackend()
+	s := NewNetOps(backend)
+	err = s.BootstrapNetOpPod()
+	expectErrStr(t, "Testing the slices are restored", err, "")
+	classIds := map[string]uint32{}
+	for sliceID, sliceInfo := range s.state.slices {
+		classIds[sliceID] = sliceInfo.tcParentClassId
+	}
+	expected := map[string]uint32{"id-a": 0x11, "id-b": 0x33}
+	if !reflect.DeepEqual(classIds, expected) {
+		t.Error("Expected class IDs:", expected, " but got ", classIds)
+	}
+	expectTcTree(t, backend, "eth0", []string{
+		"qdisc dev eth0 parent 22:12 handle 11: sfq perturb 10",
+		"qdisc dev eth0 root handle 22: htb default 30",
+		"qdisc dev eth0 parent 22:34 handle 33: sfq perturb 10",
+		"class dev eth0 parent 22: classid 22:11 htb rate 5000kbit burst 65536 prio 1",
+		"class dev eth0 parent 22:11 classid 22:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1",
+		"class dev eth0 parent 22: classid 22:33 htb rate 3000kbit burst 65536 prio 2",
+		"class dev eth0 parent 22:33 classid 22:34 htb rate 500kbit ceil 3000kbit burst 32768 prio 2",
+	})
+}
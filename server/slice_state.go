@@ -0,0 +1,151 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// sliceStateManager owns the state of the slices configured on the node and
+// of the interfaces their traffic is shaped on.
+//
+// The slices share the root qdisc, the filters under it and the class IDs, so
+// the changes are serialized across all the slices rather than per slice. The
+// lock is held for the whole change, tc commands included, so that the state
+// and the kernel config move together.
+type sliceStateManager struct {
+	mu sync.Mutex
+	// Slice information keyed by slice ID
+	slices map[string]*SliceInfo
+	// Major of the htb root qdisc, the handles of the classes, leaf qdiscs
+	// and filters derive from it. Try to keep the handle ID obscure to avoid
+	// interfering with the exisiting config on the intf. Handles and class
+	// IDs are hex numbers, the way tc prints them. It is chosen on
+	// bootstrap, before any tc change, see chooseRootHandle.
+	rootHandleId uint32
+	// Class IDs of the slices
+	classIds *classIdAllocator
+	// Tc config of the slices found on the node without a checkpoint, keyed
+	// by the ID of the parent class. A slice claims it when its QoS profile
+	// arrives.
+	unclaimed map[uint32]*TcInfo
+	// Time the unclaimed tc config is deleted at, zero to keep it
+	unclaimedExpiry time.Time
+	// Time the unclaimed tc config is kept for, zero to keep it until the
+	// slices are synced
+	unclaimedTTL time.Duration
+	// Interfaces the slice traffic is shaped on. Each one has the full tc
+	// tree of the slices.
+	netIfaces []*IfaceInfo
+	// Set when the interfaces are listed in the config. They are found from
+	// the routes to the remote slice gw nodes otherwise.
+	netIfacesConfigured bool
+	// IFB device the slice gw traffic received on the interfaces is
+	// redirected to for shaping. Empty unless ingress shaping is enabled.
+	ifbIface string
+	// File the slices are checkpointed to after each change. Empty when
+	// checkpointing is disabled.
+	checkpointPath string
+	// Set when the root qdiscs of other components are left alone.
+	keepForeignRoot bool
+	// Latest drifts of the tc config found by the reconciler
+	drifts []*driftRecord
+	// Number of drifts found since the start
+	driftCount uint64
+	// Slice gws received before the QoS profile of their slice, keyed by
+	// slice ID and slice gw ID
+	pendingGws map[string]map[string]*pendingSliceGw
+	// Time the pending slice gws are kept for, zero to keep them
+	pendingGwTTL time.Duration
+	// Transaction the tc changes go through, nil outside inTcTxn
+	txn *tcTxn
+}
+
+func newSliceStateManager() *sliceStateManager {
+	m := &sliceStateManager{rootHandleId: defaultRootHandleId, pendingGwTTL: defaultPendingGwTTL}
+	m.reset()
+	return m
+}
+
+// lock serializes a change of the slice state. The returned func releases
+// the lock.
+func (m *sliceStateManager) lock() func() {
+	m.mu.Lock()
+	return m.mu.Unlock
+}
+
+// reset forgets the slices.
+func (m *sliceStateManager) reset() {
+	m.slices = make(map[string]*SliceInfo)
+	m.classIds = newClassIdAllocator(m.rootHandleId)
+	m.unclaimed = make(map[uint32]*TcInfo)
+	m.unclaimedExpiry = time.Time{}
+	m.pendingGws = make(map[string]map[string]*pendingSliceGw)
+}
+
+// setRootHandle sets the major of the root qdisc and forgets the slices, the
+// handles of their tc config derive from it.
+func (m *sliceStateManager) setRootHandle(major uint32) {
+	m.rootHandleId = major
+	m.reset()
+}
+
+// findNetIface returns the interface with the name, or nil when the slice
+// traffic is not shaped on it.
+func (m *sliceStateManager) findNetIface(name string) *IfaceInfo {
+	for _, iface := range m.netIfaces {
+		if iface.name == name {
+			return iface
+		}
+	}
+	return nil
+}
+
+// tcIfaceNames returns the interfaces the tc tree of the slices is built on.
+func (m *sliceStateManager) tcIfaceNames() []string {
+	names := []string{}
+	for _, iface := range m.netIfaces {
+		if iface.tcInited {
+			names = append(names, iface.name)
+		}
+	}
+	return names
+}
+
+// tcDevs returns the devices the tc tree of the slices is built on. With
+// ingress shaping the tree is mirrored on the IFB device for the traffic
+// received on all the interfaces.
+func (m *sliceStateManager) tcDevs() []string {
+	if m.ifbIface == "" {
+		return m.tcIfaceNames()
+	}
+	return append(m.tcIfaceNames(), m.ifbIface)
+}
+
+// dropRouteNetIfaces stops tracking the interfaces found from the routes to
+// the remote slice gw nodes, they are found again for the new slices.
+func (m *sliceStateManager) dropRouteNetIfaces() {
+	ifaces := []*IfaceInfo{}
+	for _, iface := range m.netIfaces {
+		if !iface.fromRoute {
+			ifaces = append(ifaces, iface)
+		}
+	}
+	m.netIfaces = ifaces
+}
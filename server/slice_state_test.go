@@ -0,0 +1,126 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kubeslice/netops/logger"
+	netops "github.com/kubeslice/netops/pkg/proto"
+	"google.golang.org/grpc"
+)
+
+// TestConcurrentRpcs drives the RPCs of many slices at once. The fake tc
+// backend is not safe for concurrent use, run with -race to catch the RPCs
+// that change the state or tc without holding the lock.
+func TestConcurrentRpcs(t *testing.T) {
+	const numSlices = 8
+	const numUpdates = 5
+	ctx := context.Background()
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	t.Setenv("NETWORK_INTERFACE", "eth0")
+	s := NewNetOps(newFakeTcBackend())
+	err := s.BootstrapNetOpPod()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(dialer(s)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := netops.NewNetOpsServiceClient(conn)
+
+	// run calls the func for every slice on its own goroutine and waits for
+	// all of them.
+	run := func(call func(i int) error) {
+		var wg sync.WaitGroup
+		errs := make(chan error, numSlices)
+		for i := 0; i < numSlices; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs <- call(i)
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Error("Expected no error but got ", err)
+			}
+		}
+	}
+
+	run(func(i int) error {
+		sliceID := fmt.Sprintf("id-%d", i)
+		sliceName := fmt.Sprintf("slice-%d", i)
+		for j := 0; j < numUpdates; j++ {
+			_, err := client.UpdateConnectionContext(ctx, &netops.NetOpConnectionContext{
+				SliceId:                sliceID,
+				LocalSliceGwId:         sliceName + "-gw",
+				LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_SERVER,
+				LocalSliceGwNodePorts:  []string{fmt.Sprint(30000 + i)},
+				RemoteSliceGwNodePorts: []string{fmt.Sprint(31000 + i)},
+			})
+			if err != nil {
+				return err
+			}
+			_, err = client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+				SliceName: sliceName, SliceId: sliceID, BwCeiling: uint32(5000 + j), BwGuaranteed: 1000, Priority: 1,
+			})
+			if err != nil {
+				return err
+			}
+			_, err = client.UpdateSliceLifeCycleEvent(ctx, &netops.SliceLifeCycleEvent{SliceName: sliceName, Event: netops.EventType_EV_UPDATE})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if len(s.state.slices) != numSlices || len(s.state.classIds.blocks) != numSlices {
+		t.Fatal("Expected", numSlices, "slices but got", len(s.state.slices), "slices and", len(s.state.classIds.blocks), "class IDs")
+	}
+	tree, err := s.tc.Dump("eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Join(tcTreeLines(tree), "\n")
+	for classId, block := range s.state.classIds.blocks {
+		class := fmt.Sprintf("class dev eth0 parent 17: classid %v htb rate %vkbit", tcHandleStr(defaultClassHandle(classId)), 5000+numUpdates-1)
+		if !strings.Contains(lines, class) {
+			t.Error("Expected the parent class of", block.sliceName, "in the tc tree:\n", lines)
+		}
+	}
+
+	run(func(i int) error {
+		_, err := client.UpdateSliceLifeCycleEvent(ctx, &netops.SliceLifeCycleEvent{SliceName: fmt.Sprintf("slice-%d", i), Event: netops.EventType_EV_DELETE})
+		return err
+	})
+
+	if len(s.state.slices) != 0 || len(s.state.classIds.blocks) != 0 {
+		t.Error("Expected no slices but got", len(s.state.slices), "slices and", len(s.state.classIds.blocks), "class IDs")
+	}
+	expectTcTree(t, s.tc, "eth0", []string{})
+}
@@ -0,0 +1,153 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kubeslice/netops/logger"
+	netops "github.com/kubeslice/netops/pkg/proto"
+)
+
+const (
+	// Interval between two samples of the slice stats when the client does
+	// not choose one
+	defaultSliceStatsInterval = time.Second
+	// Shortest interval between two samples, each sample dumps the tc config
+	// of the devices
+	minSliceStatsInterval = 100 * time.Millisecond
+)
+
+// sliceStatsInterval returns the interval between two samples for the
+// interval requested in ms.
+func sliceStatsInterval(intervalMs uint32) (time.Duration, error) {
+	if intervalMs == 0 {
+		return defaultSliceStatsInterval, nil
+	}
+	interval := time.Duration(intervalMs) * time.Millisecond
+	if interval < minSliceStatsInterval {
+		return 0, fmt.Errorf("interval %v is shorter than %v", interval, minSliceStatsInterval)
+	}
+	return interval, nil
+}
+
+// sliceStatsSampler samples the stats of the tc objects of the watched
+// slices. It keeps the byte counters of the previous sample to compute the
+// rates.
+type sliceStatsSampler struct {
+	// Slices watched. All the slices are watched when both are empty.
+	sliceIDs   map[string]bool
+	sliceNames map[string]bool
+	// Byte counters of the previous sample by tc object
+	prevBytes map[string]uint64
+	prevTime  time.Time
+}
+
+func newSliceStatsSampler(sliceIDs []string, sliceNames []string) *sliceStatsSampler {
+	sampler := &sliceStatsSampler{sliceIDs: map[string]bool{}, sliceNames: map[string]bool{}, prevBytes: map[string]uint64{}}
+	for _, id := range sliceIDs {
+		sampler.sliceIDs[id] = true
+	}
+	for _, name := range sliceNames {
+		sampler.sliceNames[name] = true
+	}
+	return sampler
+}
+
+// watched reports whether the slice is watched.
+func (p *sliceStatsSampler) watched(sliceID string, sliceName string) bool {
+	if len(p.sliceIDs) == 0 && len(p.sliceNames) == 0 {
+		return true
+	}
+	return p.sliceIDs[sliceID] || p.sliceNames[sliceName]
+}
+
+// sample returns the stats of the watched slices, read from the devices at
+// the time now. The caller holds the lock of the slice state.
+func (p *sliceStatsSampler) sample(s *NetOps, now time.Time) *netops.SliceStatsSample {
+	sample := &netops.SliceStatsSample{Timestamp: now.UnixMilli(), Slices: []*netops.SliceStats{}}
+	elapsed := now.Sub(p.prevTime)
+	bytes := map[string]uint64{}
+	tcStats := func(dev string, kind string, handle uint32, stats *TcStats) *netops.TcStats {
+		st := &netops.TcStats{Handle: tcHandleStr(handle)}
+		if stats == nil {
+			return st
+		}
+		st.Bytes = stats.Bytes
+		st.Packets = stats.Packets
+		st.Drops = stats.Drops
+		st.Overlimits = stats.Overlimits
+		st.Backlog = stats.Backlog
+		key := fmt.Sprintf("%v %v %v", dev, kind, st.Handle)
+		bytes[key] = stats.Bytes
+		// The counters restart when the object is added again.
+		if prev, found := p.prevBytes[key]; found && stats.Bytes >= prev && elapsed > 0 {
+			st.Rate = uint64(float64(stats.Bytes-prev) * 8 / 1000 / elapsed.Seconds())
+		}
+		return st
+	}
+
+	trees := map[string]*TcTree{}
+	errs := map[string]error{}
+	for _, sliceID := range s.state.sliceIDsByClassId() {
+		sliceInfo := s.state.slices[sliceID]
+		if !p.watched(sliceID, sliceInfo.sliceName) || !sliceInfo.tcInited || sliceInfo.tc == nil {
+			continue
+		}
+		st := &netops.SliceStats{
+			SliceId:    sliceID,
+			SliceName:  sliceInfo.sliceName,
+			BwCeiling:  sliceInfo.tc.bwCeiling,
+			Interfaces: []*netops.SliceInterfaceStats{},
+		}
+		for _, dev := range s.state.tcDevs() {
+			ifaceSt := &netops.SliceInterfaceStats{Name: dev}
+			st.Interfaces = append(st.Interfaces, ifaceSt)
+			tree, dumped := trees[dev]
+			if !dumped && errs[dev] == nil {
+				var err error
+				tree, err = s.tc.Dump(dev)
+				if err != nil {
+					logger.GlobalLogger.Errorf("Failed to dump tc config on intf: %v, err: %v", dev, err)
+					errs[dev] = err
+				} else {
+					trees[dev] = tree
+				}
+			}
+			if errs[dev] != nil {
+				ifaceSt.Error = errs[dev].Error()
+				continue
+			}
+			if class := classByHandle(tree, sliceInfo.tcParentClassFqId); class != nil {
+				ifaceSt.ParentClass = tcStats(dev, "class", class.Handle, class.Stats)
+			}
+			if class := classByHandle(tree, sliceInfo.tcLeafClassFqId); class != nil {
+				ifaceSt.LeafClass = tcStats(dev, "class", class.Handle, class.Stats)
+			}
+			if qdisc := qdiscAt(tree, sliceInfo.tcLeafClassFqId); qdisc != nil {
+				ifaceSt.LeafQdisc = tcStats(dev, "qdisc", qdisc.Handle, qdisc.Stats)
+			}
+		}
+		sample.Slices = append(sample.Slices, st)
+	}
+
+	p.prevBytes = bytes
+	p.prevTime = now
+	return sample
+}
@@ -0,0 +1,173 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	netops "github.com/kubeslice/netops/pkg/proto"
+)
+
+func TestSliceStatsInterval(t *testing.T) {
+	testCases := []struct {
+		Case       string
+		IntervalMs uint32
+		Interval   time.Duration
+		ErrStr     string
+	}{
+		{"Testing the default interval", 0, time.Second, ""},
+		{"Testing a chosen interval", 250, 250 * time.Millisecond, ""},
+		{"Testing the shortest interval", 100, 100 * time.Millisecond, ""},
+		{"Testing a too short interval", 99, 0, "interval 99ms is shorter than 100ms"},
+	}
+	for _, tt := range testCases {
+		interval, err := sliceStatsInterval(tt.IntervalMs)
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		if interval != tt.Interval {
+			t.Error(tt.Case, "- Expected :", tt.Interval, " but got ", interval)
+		}
+	}
+}
+
+func TestSliceStatsSampler(t *testing.T) {
+	backend := newFakeTcBackend()
+	s, _ := newTestNetOps(t, backend)
+	configureSlicesForAdoption(t, s)
+
+	// Rates of the slice-a classes and leaf qdisc, then of slice-b
+	type rates [6]uint64
+	sampleRates := func(sample *netops.SliceStatsSample) rates {
+		r := rates{}
+		for i, st := range sample.Slices {
+			if len(st.Interfaces) != 1 || st.Interfaces[0].Name != "eth0" {
+				t.Fatal("Expected the stats of eth0 but got ", st.Interfaces)
+			}
+			eth0 := st.Interfaces[0]
+			if eth0.ParentClass == nil || eth0.LeafClass == nil || eth0.LeafQdisc == nil {
+				t.Fatal("Expected the stats of the tc objects of ", st.SliceName, " but got ", eth0)
+			}
+			r[i*3], r[i*3+1], r[i*3+2] = eth0.ParentClass.Rate, eth0.LeafClass.Rate, eth0.LeafQdisc.Rate
+		}
+		return r
+	}
+
+	sampler := newSliceStatsSampler(nil, nil)
+	now := time.Now()
+	sample := sampler.sample(s, now)
+	if len(sample.Slices) != 2 || sample.Slices[0].SliceId != "id-a" || sample.Slices[1].SliceId != "id-b" {
+		t.Fatal("Expected the stats of slice-a and slice-b but got ", sample.Slices)
+	}
+	if r := sampleRates(sample); r != (rates{}) {
+		t.Error("Expected no rates in the first sample but got ", r)
+	}
+
+	// 1000kbit sent by slice-a over 1s, 500kbit by slice-b over 2s
+	backend.sendTraffic("eth0", defaultClassHandle(0x12), 125000, 100)
+	backend.sendTraffic("eth0", defaultClassHandle(0x23), 62500, 50)
+	sample = sampler.sample(s, now.Add(time.Second))
+	if r := sampleRates(sample); r != (rates{1000, 1000, 1000, 500, 500, 500}) {
+		t.Error("Expected the rates since the first sample but got ", r)
+	}
+	leaf := sample.Slices[0].Interfaces[0].LeafClass
+	if leaf.Handle != "17:12" || leaf.Bytes != 125000 || leaf.Packets != 100 {
+		t.Error("Expected the counters of the leaf class of slice-a but got ", leaf)
+	}
+	if sample.Slices[0].BwCeiling != 5000 || sample.Slices[0].Interfaces[0].LeafQdisc.Handle != "11:" {
+		t.Error("Expected the ceiling and the sfq qdisc of slice-a but got ", sample.Slices[0])
+	}
+
+	backend.sendTraffic("eth0", defaultClassHandle(0x12), 250000, 200)
+	sample = sampler.sample(s, now.Add(2*time.Second))
+	if r := sampleRates(sample); r != (rates{2000, 2000, 2000, 0, 0, 0}) {
+		t.Error("Expected the rates since the previous sample but got ", r)
+	}
+
+	// The counters of a slice restart when its tc objects are added again.
+	err := backend.QdiscDel(&TcQdisc{Dev: "eth0", Parent: defaultClassHandle(0x12)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.reconcile()
+	sample = sampler.sample(s, now.Add(3*time.Second))
+	if r := sampleRates(sample); r != (rates{}) {
+		t.Error("Expected no rates after the leaf qdisc was added again but got ", r)
+	}
+
+	for _, tt := range []struct {
+		Case       string
+		SliceIDs   []string
+		SliceNames []string
+		Expected   []string
+	}{
+		{"Testing a slice by ID", []string{"id-b"}, nil, []string{"id-b"}},
+		{"Testing a slice by name", nil, []string{"slice-a"}, []string{"id-a"}},
+		{"Testing slices by ID and name", []string{"id-b"}, []string{"slice-a"}, []string{"id-a", "id-b"}},
+		{"Testing an unknown slice", []string{"id-c"}, nil, []string{}},
+	} {
+		sample := newSliceStatsSampler(tt.SliceIDs, tt.SliceNames).sample(s, now)
+		ids := []string{}
+		for _, st := range sample.Slices {
+			ids = append(ids, st.SliceId)
+		}
+		if len(ids) != len(tt.Expected) || (len(ids) != 0 && ids[0] != tt.Expected[0]) || (len(ids) > 1 && ids[1] != tt.Expected[1]) {
+			t.Error(tt.Case, "- Expected :", tt.Expected, " but got ", ids)
+		}
+	}
+}
+
+func TestWatchSliceStats(t *testing.T) {
+	s, client := newTestNetOps(t, newFakeTcBackend())
+	configureSlicesForAdoption(t, s)
+
+	stream, err := client.WatchSliceStats(context.Background(), &netops.WatchSliceStatsRequest{IntervalMs: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	expectErrStr(t, "Testing a too short interval", err, "rpc error: code = InvalidArgument desc = Invalid stats interval: interval 10ms is shorter than 100ms")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err = client.WatchSliceStats(ctx, &netops.WatchSliceStatsRequest{IntervalMs: 100, SliceNames: []string{"slice-b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prev int64
+	for i := 0; i < 2; i++ {
+		sample, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sample.Slices) != 1 || sample.Slices[0].SliceName != "slice-b" {
+			t.Error("Expected the stats of slice-b but got ", sample.Slices)
+		}
+		if sample.Timestamp <= prev {
+			t.Error("Expected a sample after ", prev, " but got ", sample.Timestamp)
+		}
+		prev = sample.Timestamp
+	}
+	cancel()
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	if err == io.EOF {
+		t.Error("Expected the stream to be cancelled but it ended")
+	}
+}
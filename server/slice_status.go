@@ -0,0 +1,238 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kubeslice/netops/logger"
+	netops "github.com/kubeslice/netops/pkg/proto"
+	"github.com/vishvananda/netlink"
+)
+
+// findSlice returns the ID of the slice with the ID, or with the name when
+// the ID is empty. It returns an empty ID when the slice is not found.
+func (m *sliceStateManager) findSlice(sliceID string, sliceName string) string {
+	if sliceID != "" {
+		if _, found := m.slices[sliceID]; found {
+			return sliceID
+		}
+		return ""
+	}
+	for id, sliceInfo := range m.slices {
+		if sliceInfo.sliceName == sliceName {
+			return id
+		}
+	}
+	return ""
+}
+
+// familyName returns the name of an address family in the status.
+func familyName(family int) string {
+	if family == netlink.FAMILY_V6 {
+		return "ipv6"
+	}
+	return "ipv4"
+}
+
+// errString returns the message of the error, empty when there is none.
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// qosProfileMsg returns the QoS profile applied to the slice, or nil.
+func qosProfileMsg(sliceID string, sliceInfo *SliceInfo) *netops.SliceQosProfile {
+	p := sliceInfo.qosProfile
+	if p == nil {
+		return nil
+	}
+	return &netops.SliceQosProfile{
+		SliceName:      sliceInfo.sliceName,
+		SliceId:        sliceID,
+		QosProfileName: p.name,
+		ClassType:      netops.ClassType(netops.ClassType_value[string(p.class)]),
+		BwCeiling:      p.bwCeiling,
+		BwGuaranteed:   p.bwGuaranteed,
+		Priority:       p.priority,
+		DscpClass:      p.dscpClass,
+	}
+}
+
+// devQosCheck holds the tc objects of a slice expected on a device, checked
+// against its dump to complete the status of the device.
+type devQosCheck struct {
+	st      *netops.SliceInterfaceQosStatus
+	classes []*TcClass
+	qdisc   *TcQdisc
+}
+
+// filterQosCheck holds a filter of a slice gw port, checked against the dump
+// of its device to complete the status of the filter.
+type filterQosCheck struct {
+	st     *netops.SliceGwFilterStatus
+	filter *TcFilter
+}
+
+// sliceQosStatus returns the QoS status of the slice, from the slice state,
+// and a function completing it with the tc objects read from the devices.
+// The caller holds the state lock while it gets the status but not while it
+// completes it, so that a hung backend does not block the RPCs.
+func (s *NetOps) sliceQosStatus(sliceID string) (*netops.SliceQosStatus, func()) {
+	sliceInfo := s.state.slices[sliceID]
+	st := &netops.SliceQosStatus{
+		SliceId:        sliceID,
+		SliceName:      sliceInfo.sliceName,
+		TcInited:       sliceInfo.tcInited,
+		LastApplyError: errString(sliceInfo.tcErr),
+		Interfaces:     []*netops.SliceInterfaceQosStatus{},
+		SliceGws:       []*netops.SliceGwQosStatus{},
+		Drifts:         []string{},
+	}
+	st.QosProfile = qosProfileMsg(sliceID, sliceInfo)
+	if sliceInfo.tcInited {
+		st.ParentClassId = tcHandleStr(sliceInfo.tcParentClassFqId)
+		st.LeafClassId = tcHandleStr(sliceInfo.tcLeafClassFqId)
+	}
+
+	devChecks := []*devQosCheck{}
+	devStatus := func(dev string, tcInited bool, tcErr string) {
+		check := &devQosCheck{st: &netops.SliceInterfaceQosStatus{Name: dev, TcInited: tcInited, Error: tcErr, TcObjects: []string{}}}
+		st.Interfaces = append(st.Interfaces, check.st)
+		devChecks = append(devChecks, check)
+		if !sliceInfo.tcInited || sliceInfo.tc == nil {
+			return
+		}
+		check.classes = []*TcClass{
+			s.state.sliceParentClass(dev, sliceInfo.tcParentClassFqId, sliceInfo.tc),
+			sliceLeafClass(dev, sliceInfo, sliceInfo.tcLeafClassFqId, sliceInfo.tc),
+		}
+		check.qdisc = sliceLeafQdisc(dev, sliceInfo, sliceInfo.tc)
+	}
+	for _, iface := range s.state.netIfaces {
+		tcErr := errString(iface.tcErr)
+		if iface.foreignRoot != "" {
+			tcErr = fmt.Sprintf("foreign root qdisc %v", iface.foreignRoot)
+		}
+		devStatus(iface.name, iface.tcInited, tcErr)
+	}
+	if s.state.ifbIface != "" {
+		devStatus(s.state.ifbIface, len(s.state.tcIfaceNames()) != 0, "")
+	}
+
+	filterChecks := []*filterQosCheck{}
+	gwIDs := []string{}
+	for gwID := range sliceInfo.sliceGwInfo {
+		gwIDs = append(gwIDs, gwID)
+	}
+	sort.Strings(gwIDs)
+	for _, gwID := range gwIDs {
+		gwSt, checks := s.sliceGwQosStatus(sliceInfo, sliceInfo.sliceGwInfo[gwID])
+		st.SliceGws = append(st.SliceGws, gwSt)
+		filterChecks = append(filterChecks, checks...)
+	}
+
+	for _, drift := range s.state.drifts {
+		if drift.sliceName == sliceInfo.sliceName {
+			st.Drifts = append(st.Drifts, fmt.Sprintf("%v %v", drift.time.Format(time.RFC3339), drift))
+		}
+	}
+
+	complete := func() {
+		trees := map[string]*TcTree{}
+		for _, check := range devChecks {
+			dev := check.st.Name
+			tree, err := s.tc.Dump(dev)
+			if err != nil {
+				logger.GlobalLogger.Errorf("Failed to dump tc config on intf: %v, err: %v", dev, err)
+				if check.st.Error == "" {
+					check.st.Error = err.Error()
+				}
+				continue
+			}
+			trees[dev] = tree
+			if check.qdisc == nil {
+				continue
+			}
+			check.st.InSync = true
+			for _, class := range check.classes {
+				found := classByHandle(tree, class.Handle)
+				if found == nil {
+					check.st.InSync = false
+					continue
+				}
+				check.st.TcObjects = append(check.st.TcObjects, "class "+found.String())
+				check.st.InSync = check.st.InSync && sameClass(found, class)
+			}
+			found := qdiscAt(tree, check.qdisc.Parent)
+			if found == nil {
+				check.st.InSync = false
+				continue
+			}
+			check.st.TcObjects = append(check.st.TcObjects, "qdisc "+found.String())
+			check.st.InSync = check.st.InSync && sameQdisc(found, check.qdisc)
+		}
+		for _, check := range filterChecks {
+			tree := trees[check.filter.Dev]
+			if tree == nil {
+				continue
+			}
+			for _, found := range tree.Filters {
+				if filterKey(found) == filterKey(check.filter) && (check.filter.Handle == 0 || found.Handle == check.filter.Handle) {
+					check.st.Installed = true
+					check.st.Filter = found.String()
+					break
+				}
+			}
+		}
+	}
+	return st, complete
+}
+
+// sliceGwQosStatus returns the status of the filters of the slice gw ports
+// and the checks completing it from the dumps of the devices.
+func (s *NetOps) sliceGwQosStatus(sliceInfo *SliceInfo, gwInfo *SliceGwInfo) (*netops.SliceGwQosStatus, []*filterQosCheck) {
+	st := &netops.SliceGwQosStatus{SliceGwId: gwInfo.sliceGwId, TcConfigured: []string{}, Filters: []*netops.SliceGwFilterStatus{}}
+	checks := []*filterQosCheck{}
+	if sliceInfo.tc == nil {
+		return st, checks
+	}
+	for _, family := range tcFilterFamilies {
+		if !gwInfo.tcConfigured[family] {
+			continue
+		}
+		st.TcConfigured = append(st.TcConfigured, familyName(family))
+		for i, portFilters := range s.sliceGwFilters(sliceInfo, gwInfo, family, s.state.tcIfaceNames()) {
+			for _, filter := range portFilters {
+				filterSt := &netops.SliceGwFilterStatus{
+					Port:      gwInfo.localPorts[i],
+					Interface: filter.Dev,
+					Family:    familyName(family),
+					Filter:    filter.String(),
+				}
+				st.Filters = append(st.Filters, filterSt)
+				checks = append(checks, &filterQosCheck{st: filterSt, filter: filter})
+			}
+		}
+	}
+	return st, checks
+}
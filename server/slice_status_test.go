@@ -0,0 +1,244 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	netops "github.com/kubeslice/netops/pkg/proto"
+	"github.com/vishvananda/netlink"
+)
+
+func TestGetSliceQosStatus(t *testing.T) {
+	testCases := []struct {
+		Case string
+		Req  *netops.SliceQosStatusRequest
+		// Changes the tc config behind the back of netops
+		Change func(b TcBackend) error
+		// The tc change failing on an update of slice-a
+		Fail   string
+		ErrStr string
+		// Expected status of eth0
+		InSync  bool
+		Objects int
+		// Expected number of installed filters out of the filters of the
+		// slice gw ports
+		Installed int
+		Filters   int
+		ApplyErr  string
+	}{
+		{
+			"Testing the status of a slice by ID",
+			&netops.SliceQosStatusRequest{SliceId: "id-a"},
+			nil,
+			"",
+			"",
+			true,
+			3,
+			4,
+			4,
+			"",
+		},
+		{
+			"Testing the status of a slice by name",
+			&netops.SliceQosStatusRequest{SliceName: "slice-b"},
+			nil,
+			"",
+			"",
+			true,
+			3,
+			0,
+			0,
+			"",
+		},
+		{
+			"Testing a missing leaf qdisc is reported",
+			&netops.SliceQosStatusRequest{SliceId: "id-a"},
+			func(b TcBackend) error {
+				return b.QdiscDel(&TcQdisc{Dev: "eth0", Parent: defaultClassHandle(0x12)})
+			},
+			"",
+			"",
+			false,
+			2,
+			4,
+			4,
+			"",
+		},
+		{
+			"Testing an altered class is reported",
+			&netops.SliceQosStatusRequest{SliceId: "id-a"},
+			func(b TcBackend) error {
+				return b.ClassReplace(&TcClass{Dev: "eth0", Parent: defaultRootHandle(), Handle: defaultClassHandle(0x11), Rate: 1000, Burst: 64 * 1024})
+			},
+			"",
+			"",
+			false,
+			3,
+			4,
+			4,
+			"",
+		},
+		{
+			"Testing missing filters are reported",
+			&netops.SliceQosStatusRequest{SliceId: "id-a"},
+			func(b TcBackend) error {
+				return b.FilterDel(&TcFilter{Dev: "eth0", Parent: defaultRootHandle(), Prio: 11, Family: netlink.FAMILY_V6})
+			},
+			"",
+			"",
+			true,
+			3,
+			2,
+			4,
+			"",
+		},
+		{
+			"Testing the last apply error is reported",
+			&netops.SliceQosStatusRequest{SliceId: "id-a"},
+			nil,
+			"class replace dev eth0 parent 17: classid 17:11",
+			"",
+			true,
+			3,
+			4,
+			4,
+			"tc class replace dev eth0 parent 17: classid 17:11 htb rate 8000kbit burst 65536 prio 1 failed: input/output error, rolled back 0 tc changes",
+		},
+		{
+			"Testing an unknown slice",
+			&netops.SliceQosStatusRequest{SliceName: "slice-c"},
+			nil,
+			"",
+			"rpc error: code = NotFound desc = Slice slice-c is not found",
+			false,
+			0,
+			0,
+			0,
+			"",
+		},
+		{
+			"Testing an unknown slice ID",
+			&netops.SliceQosStatusRequest{SliceId: "id-c", SliceName: "slice-a"},
+			nil,
+			"",
+			"rpc error: code = NotFound desc = SliceId id-c is not found",
+			false,
+			0,
+			0,
+			0,
+			"",
+		},
+		{
+			"Testing a request without a slice",
+			&netops.SliceQosStatusRequest{},
+			nil,
+			"",
+			"rpc error: code = InvalidArgument desc = Invalid Slice Id or Name",
+			false,
+			0,
+			0,
+			0,
+			"",
+		},
+	}
+	ctx := context.Background()
+	for _, tt := range testCases {
+		backend := &recordingTcBackend{TcBackend: newFakeTcBackend()}
+		s, client := newTestNetOps(t, backend)
+		configureSlicesForAdoption(t, s)
+		if tt.Change != nil {
+			err := tt.Change(backend.TcBackend)
+			if err != nil {
+				t.Fatal(tt.Case, err)
+			}
+		}
+		if tt.Fail != "" {
+			backend.fail = tt.Fail
+			_, err := client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+				SliceName: "slice-a", SliceId: "id-a", BwCeiling: 8000, BwGuaranteed: 1000, Priority: 1, DscpClass: "EF",
+			})
+			if err == nil {
+				t.Error(tt.Case, "- Expected the update to fail")
+			}
+		}
+
+		st, err := client.GetSliceQosStatus(ctx, tt.Req)
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		if err != nil {
+			continue
+		}
+		if !st.TcInited || st.QosProfile == nil || st.ParentClassId == "" || st.LeafClassId == "" {
+			t.Error(tt.Case, "- Expected the slice to be configured but got ", st)
+		}
+		if st.LastApplyError != tt.ApplyErr {
+			t.Error(tt.Case, "- Expected :", tt.ApplyErr, " but got ", st.LastApplyError)
+		}
+		if len(st.Interfaces) != 1 || st.Interfaces[0].Name != "eth0" || !st.Interfaces[0].TcInited {
+			t.Fatal(tt.Case, "- Expected the status of eth0 but got ", st.Interfaces)
+		}
+		eth0 := st.Interfaces[0]
+		if eth0.InSync != tt.InSync || len(eth0.TcObjects) != tt.Objects {
+			t.Error(tt.Case, "- Expected in sync:", tt.InSync, " with ", tt.Objects, " objects but got ", eth0)
+		}
+		installed, filters := 0, 0
+		for _, gw := range st.SliceGws {
+			for _, filter := range gw.Filters {
+				filters++
+				if filter.Installed {
+					installed++
+				}
+			}
+		}
+		if installed != tt.Installed || filters != tt.Filters {
+			t.Error(tt.Case, "- Expected ", tt.Installed, " of ", tt.Filters, " filters installed but got ", installed, " of ", filters)
+		}
+	}
+}
+
+func TestGetSliceQosStatusDrifts(t *testing.T) {
+	ctx := context.Background()
+	backend := newFakeTcBackend()
+	s, client := newTestNetOps(t, backend)
+	configureSlicesForAdoption(t, s)
+	err := backend.QdiscDel(&TcQdisc{Dev: "eth0", Parent: defaultClassHandle(0x12)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.reconcile()
+
+	for _, tt := range []struct {
+		SliceName string
+		Drifts    int
+	}{
+		{"slice-a", 1},
+		{"slice-b", 0},
+	} {
+		st, err := client.GetSliceQosStatus(ctx, &netops.SliceQosStatusRequest{SliceName: tt.SliceName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(st.Drifts) != tt.Drifts {
+			t.Error("Expected ", tt.Drifts, " drifts of ", tt.SliceName, " but got ", st.Drifts)
+		}
+		if !st.Interfaces[0].InSync {
+			t.Error("Expected ", tt.SliceName, " to be in sync after the repair but got ", st.Interfaces[0])
+		}
+	}
+}
@@ -22,44 +22,10 @@ import (
 	"errors"
 	"fmt"
 	"os/exec"
-	"strings"
-
-	"github.com/kubeslice/netops/logger"
 
 	"github.com/google/shlex"
 )
 
-func runTcCommand(tcCmd string) (string, error) {
-	var errVal error = nil
-	var err error = nil
-	var cmdOut string = ""
-	cmdOut, err = runCommand(tcCmd)
-	if err != nil {
-		errStr := TcCmdError(tcCmd, err, cmdOut)
-		logger.GlobalLogger.Errorf(errStr)
-
-		if strings.Contains(cmdOut, "RTNETLINK answers: File exists") {
-			tcDelCmd := strings.Replace(tcCmd, "add", "del", -1)
-			cmdOut, err = runCommand(tcDelCmd)
-			if err != nil {
-				errStr := TcCmdError(tcCmd, err, cmdOut)
-				logger.GlobalLogger.Errorf(errStr)
-				errVal = errors.New(errStr)
-			}
-			logger.GlobalLogger.Debugf("tc Command: %v output :%v", tcDelCmd, cmdOut)
-
-			// Re run the tc command
-			cmdOut, err = runCommand(tcCmd)
-			if err != nil {
-				errStr := TcCmdError(tcCmd, err, cmdOut)
-				errVal = errors.New(errStr)
-			}
-			logger.GlobalLogger.Infof("tc Command: %v output :%v", tcCmd, cmdOut)
-		}
-	}
-	return cmdOut, errVal
-}
-
 // runCommand runs the command string
 func runCommand(cmdString string) (string, error) {
 	var outb, errb bytes.Buffer
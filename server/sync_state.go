@@ -0,0 +1,226 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kubeslice/netops/logger"
+	netops "github.com/kubeslice/netops/pkg/proto"
+)
+
+// validateDesiredSlices returns the invalid fields of the desired state of
+// the slices.
+func validateDesiredSlices(slices []*netops.DesiredSlice) fieldViolations {
+	v := fieldViolations{}
+	sliceIDs := map[string]bool{}
+	for i, slice := range slices {
+		path := fmt.Sprintf("slices[%d].", i)
+		sliceID := slice.GetQosProfile().GetSliceId()
+		v = append(v, validateSliceQosProfile(path+"qosProfile.", slice.GetQosProfile())...)
+		if sliceID != "" && sliceIDs[sliceID] {
+			v.add(path+"qosProfile.sliceId", "slice %v is listed twice", sliceID)
+		}
+		sliceIDs[sliceID] = true
+
+		gwIDs := map[string]bool{}
+		for j, conContext := range slice.GetConnectionContexts() {
+			path := fmt.Sprintf("%vconnectionContexts[%d].", path, j)
+			v = append(v, validateConnectionContext(path, conContext)...)
+			if conContext.GetSliceId() != "" && conContext.GetSliceId() != sliceID {
+				v.add(path+"sliceId", "connection context of slice %v under slice %v", conContext.GetSliceId(), sliceID)
+			}
+			gwID := conContext.GetLocalSliceGwId()
+			if gwID != "" && gwIDs[gwID] {
+				v.add(path+"localSliceGwId", "slice gw %v is listed twice", gwID)
+			}
+			gwIDs[gwID] = true
+		}
+	}
+	return v
+}
+
+// syncState converges the slices to the desired ones. The slices are synced
+// one by one, a slice that fails to sync does not stop the others. The
+// summary holds the changes made.
+func (s *NetOps) syncState(desired []*netops.DesiredSlice) (*netops.SyncStateResponse, error) {
+	summary := &netops.SyncStateResponse{
+		SlicesAdded:     []string{},
+		SlicesUpdated:   []string{},
+		SlicesDeleted:   []string{},
+		SliceGwsAdded:   []string{},
+		SliceGwsUpdated: []string{},
+		SliceGwsDeleted: []string{},
+	}
+	errs := []string{}
+
+	desired = append([]*netops.DesiredSlice{}, desired...)
+	sort.Slice(desired, func(i, j int) bool {
+		return desired[i].GetQosProfile().GetSliceId() < desired[j].GetQosProfile().GetSliceId()
+	})
+	sliceIDs := map[string]bool{}
+	for _, slice := range desired {
+		sliceIDs[slice.GetQosProfile().GetSliceId()] = true
+		err := s.syncSlice(slice, summary)
+		if err != nil {
+			logger.GlobalLogger.Errorf("Failed to sync slice: %v, err: %v", slice.GetQosProfile().GetSliceName(), err)
+			errs = append(errs, fmt.Sprintf("slice %v: %v", slice.GetQosProfile().GetSliceName(), err))
+		}
+	}
+
+	// The slices are deleted last, so that the root qdisc is not deleted and
+	// added back when all the slices are replaced.
+	for _, sliceID := range s.state.sliceIDsByClassId() {
+		if sliceIDs[sliceID] {
+			continue
+		}
+		sliceName := s.state.slices[sliceID].sliceName
+		err := s.deleteSlice(sliceID)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("slice %v: %v", sliceName, err))
+			continue
+		}
+		summary.SlicesDeleted = append(summary.SlicesDeleted, sliceName)
+	}
+	// The tc config found without a checkpoint belongs to none of the
+	// desired slices once they are all synced.
+	if len(errs) == 0 {
+		err := s.deleteUnclaimedSlices()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("unclaimed slices: %v", err))
+		}
+	}
+	for sliceID := range s.state.pendingGws {
+		if !sliceIDs[sliceID] {
+			delete(s.state.pendingGws, sliceID)
+		}
+	}
+
+	if len(errs) != 0 {
+		return summary, errors.New(strings.Join(errs, "; "))
+	}
+	return summary, nil
+}
+
+// syncSlice converges a slice to its desired QoS profile and slice gws. The
+// QoS profile is applied again when it changed or failed to apply, and when
+// slice gws lack their filters.
+func (s *NetOps) syncSlice(slice *netops.DesiredSlice, summary *netops.SyncStateResponse) error {
+	qosProfile := sliceQosProfileFromMsg(slice.GetQosProfile())
+	sliceID := slice.GetQosProfile().GetSliceId()
+	sliceName := slice.GetQosProfile().GetSliceName()
+	gws := map[string]*SliceGwInfo{}
+	gwIDs := []string{}
+	for _, conContext := range slice.GetConnectionContexts() {
+		gwInfo := sliceGwInfoFromMsg(conContext)
+		gws[gwInfo.sliceGwId] = gwInfo
+		gwIDs = append(gwIDs, gwInfo.sliceGwId)
+	}
+	sort.Strings(gwIDs)
+	changed := false
+
+	sliceInfo, found := s.state.slices[sliceID]
+	if found {
+		oldGwIDs := []string{}
+		for gwID := range sliceInfo.sliceGwInfo {
+			oldGwIDs = append(oldGwIDs, gwID)
+		}
+		sort.Strings(oldGwIDs)
+		for _, gwID := range oldGwIDs {
+			if gws[gwID] != nil {
+				continue
+			}
+			err := s.deleteSliceGw(sliceID, gwID)
+			if err != nil {
+				return err
+			}
+			summary.SliceGwsDeleted = append(summary.SliceGwsDeleted, sliceName+"/"+gwID)
+			changed = true
+		}
+	}
+	for gwID := range s.state.pendingGws[sliceID] {
+		if gws[gwID] == nil {
+			s.state.deletePendingSliceGw(sliceID, gwID)
+		}
+	}
+
+	for _, gwID := range gwIDs {
+		var old *SliceGwInfo
+		if found {
+			old = sliceInfo.sliceGwInfo[gwID]
+		}
+		if old != nil && !sliceGwChanged(old, gws[gwID]) {
+			continue
+		}
+		err := s.updateSliceGw(sliceID, gws[gwID])
+		if err != nil {
+			return err
+		}
+		err = s.addNetIfaceForRemoteNode(gws[gwID].remoteNodeIP)
+		if err != nil {
+			return err
+		}
+		if old == nil {
+			summary.SliceGwsAdded = append(summary.SliceGwsAdded, sliceName+"/"+gwID)
+		} else {
+			summary.SliceGwsUpdated = append(summary.SliceGwsUpdated, sliceName+"/"+gwID)
+		}
+		changed = true
+	}
+
+	if !found {
+		err := s.enforceSliceQosPolicy(sliceID, sliceName, qosProfile)
+		if err != nil {
+			return err
+		}
+		summary.SlicesAdded = append(summary.SlicesAdded, sliceName)
+		return nil
+	}
+	update := sliceInfo.qosProfile == nil || *sliceInfo.qosProfile != *qosProfile ||
+		!sliceInfo.tcInited || sliceInfo.tcErr != nil
+	if !update && sliceGwsConfigured(sliceInfo) {
+		if !changed {
+			summary.SlicesUnchanged++
+		}
+		return nil
+	}
+	err := s.enforceSliceQosPolicy(sliceID, sliceName, qosProfile)
+	if err != nil {
+		return err
+	}
+	if update {
+		summary.SlicesUpdated = append(summary.SlicesUpdated, sliceName)
+	}
+	return nil
+}
+
+// sliceGwsConfigured reports whether the filters of the slice gw ports are
+// configured for all the address families.
+func sliceGwsConfigured(sliceInfo *SliceInfo) bool {
+	for _, gwInfo := range sliceInfo.sliceGwInfo {
+		for _, family := range tcFilterFamilies {
+			if !gwInfo.tcConfigured[family] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,267 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	netops "github.com/kubeslice/netops/pkg/proto"
+)
+
+func TestSyncState(t *testing.T) {
+	profileA := func(bwCeiling uint32) *netops.SliceQosProfile {
+		return &netops.SliceQosProfile{SliceName: "slice-a", SliceId: "id-a", BwCeiling: bwCeiling, BwGuaranteed: 1000, Priority: 1, DscpClass: "EF"}
+	}
+	gwA := func(localPorts []string, remotePorts []string) *netops.NetOpConnectionContext {
+		return &netops.NetOpConnectionContext{
+			SliceId:                "id-a",
+			LocalSliceGwId:         "gw-a",
+			LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_SERVER,
+			LocalSliceGwNodePorts:  localPorts,
+			RemoteSliceGwNodePorts: remotePorts,
+		}
+	}
+	sliceA := &netops.DesiredSlice{QosProfile: profileA(5000), ConnectionContexts: []*netops.NetOpConnectionContext{gwA([]string{"30001", "30003"}, []string{"30002", "30004"})}}
+	sliceB := &netops.DesiredSlice{QosProfile: &netops.SliceQosProfile{
+		SliceName: "slice-b", SliceId: "id-b", BwCeiling: 3000, BwGuaranteed: 500, Priority: 0, ClassType: netops.ClassType_TBF,
+	}}
+	sliceC := &netops.DesiredSlice{
+		QosProfile: &netops.SliceQosProfile{SliceName: "slice-c", SliceId: "id-c", BwCeiling: 2000, BwGuaranteed: 200, Priority: 2},
+		ConnectionContexts: []*netops.NetOpConnectionContext{{
+			LocalSliceGwId:         "gw-c",
+			LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_CLIENT,
+			LocalSliceGwNodePorts:  []string{"30005"},
+			RemoteSliceGwNodePorts: []string{"30006"},
+		}},
+	}
+	summary := func(change func(r *netops.SyncStateResponse)) *netops.SyncStateResponse {
+		r := &netops.SyncStateResponse{StatusMsg: "State synced successfully"}
+		change(r)
+		return r
+	}
+
+	testCases := []struct {
+		Case string
+		// Changes the state before the sync
+		Setup  func(client netops.NetOpsServiceClient, b *recordingTcBackend) error
+		Slices []*netops.DesiredSlice
+		// The tc change failing during the sync
+		Fail     string
+		ErrStr   string
+		Expected *netops.SyncStateResponse
+		// Expected slices after the sync
+		SliceIDs []string
+	}{
+		{
+			"Testing the current state",
+			nil,
+			[]*netops.DesiredSlice{sliceA, sliceB},
+			"",
+			"",
+			summary(func(r *netops.SyncStateResponse) { r.SlicesUnchanged = 2 }),
+			[]string{"id-a", "id-b"},
+		},
+		{
+			"Testing a changed QoS profile",
+			nil,
+			[]*netops.DesiredSlice{sliceB, {QosProfile: profileA(8000), ConnectionContexts: sliceA.ConnectionContexts}},
+			"",
+			"",
+			summary(func(r *netops.SyncStateResponse) { r.SlicesUpdated = []string{"slice-a"}; r.SlicesUnchanged = 1 }),
+			[]string{"id-a", "id-b"},
+		},
+		{
+			"Testing a slice missing from the state is deleted",
+			nil,
+			[]*netops.DesiredSlice{sliceA},
+			"",
+			"",
+			summary(func(r *netops.SyncStateResponse) { r.SlicesDeleted = []string{"slice-b"}; r.SlicesUnchanged = 1 }),
+			[]string{"id-a"},
+		},
+		{
+			"Testing a new slice with a slice gw",
+			nil,
+			[]*netops.DesiredSlice{sliceA, sliceB, sliceC},
+			"",
+			"",
+			summary(func(r *netops.SyncStateResponse) {
+				r.SlicesAdded = []string{"slice-c"}
+				r.SliceGwsAdded = []string{"slice-c/gw-c"}
+				r.SlicesUnchanged = 2
+			}),
+			[]string{"id-a", "id-b", "id-c"},
+		},
+		{
+			"Testing a slice gw missing from the state is deleted",
+			nil,
+			[]*netops.DesiredSlice{{QosProfile: profileA(5000)}, sliceB},
+			"",
+			"",
+			summary(func(r *netops.SyncStateResponse) { r.SliceGwsDeleted = []string{"slice-a/gw-a"}; r.SlicesUnchanged = 1 }),
+			[]string{"id-a", "id-b"},
+		},
+		{
+			"Testing a changed slice gw",
+			nil,
+			[]*netops.DesiredSlice{{QosProfile: profileA(5000), ConnectionContexts: []*netops.NetOpConnectionContext{gwA([]string{"30001"}, []string{"30002"})}}, sliceB},
+			"",
+			"",
+			summary(func(r *netops.SyncStateResponse) { r.SliceGwsUpdated = []string{"slice-a/gw-a"}; r.SlicesUnchanged = 1 }),
+			[]string{"id-a", "id-b"},
+		},
+		{
+			"Testing an empty state deletes all the slices",
+			nil,
+			nil,
+			"",
+			"",
+			summary(func(r *netops.SyncStateResponse) { r.SlicesDeleted = []string{"slice-a", "slice-b"} }),
+			[]string{},
+		},
+		{
+			"Testing a slice that failed to apply is repaired",
+			func(client netops.NetOpsServiceClient, b *recordingTcBackend) error {
+				b.fail = "class replace dev eth0 parent 17: classid 17:11"
+				_, err := client.UpdateSliceQosProfile(context.Background(), profileA(8000))
+				if err == nil {
+					t.Error("Expected the update to fail")
+				}
+				return nil
+			},
+			[]*netops.DesiredSlice{sliceA, sliceB},
+			"",
+			"",
+			summary(func(r *netops.SyncStateResponse) { r.SlicesUpdated = []string{"slice-a"}; r.SlicesUnchanged = 1 }),
+			[]string{"id-a", "id-b"},
+		},
+		{
+			"Testing a pending slice gw of a missing slice is dropped",
+			func(client netops.NetOpsServiceClient, b *recordingTcBackend) error {
+				_, err := client.UpdateConnectionContext(context.Background(), &netops.NetOpConnectionContext{
+					SliceId:                "id-d",
+					LocalSliceGwId:         "gw-d",
+					LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_SERVER,
+					LocalSliceGwNodePorts:  []string{"30007"},
+					RemoteSliceGwNodePorts: []string{"30008"},
+				})
+				return err
+			},
+			[]*netops.DesiredSlice{sliceA, sliceB},
+			"",
+			"",
+			summary(func(r *netops.SyncStateResponse) { r.SlicesUnchanged = 2 }),
+			[]string{"id-a", "id-b"},
+		},
+		{
+			"Testing a failed sync of a slice",
+			nil,
+			[]*netops.DesiredSlice{sliceB, sliceC, {QosProfile: profileA(8000), ConnectionContexts: sliceA.ConnectionContexts}},
+			"class replace dev eth0 parent 17: classid 17:11",
+			"rpc error: code = Internal desc = Failed to sync state: slice slice-a: tc class replace dev eth0 parent 17: classid 17:11 htb rate 8000kbit burst 65536 prio 1 failed: input/output error, rolled back 0 tc changes",
+			nil,
+			[]string{"id-a", "id-b", "id-c"},
+		},
+		{
+			"Testing a slice listed twice",
+			nil,
+			[]*netops.DesiredSlice{sliceA, sliceA},
+			"",
+			"rpc error: code = InvalidArgument desc = Invalid desired state: slice id-a is listed twice",
+			nil,
+			[]string{"id-a", "id-b"},
+		},
+		{
+			"Testing a slice without an ID",
+			nil,
+			[]*netops.DesiredSlice{{QosProfile: &netops.SliceQosProfile{SliceName: "slice-a", BwCeiling: 5000, BwGuaranteed: 1000}}},
+			"",
+			"rpc error: code = InvalidArgument desc = Invalid desired state: sliceId is required",
+			nil,
+			[]string{"id-a", "id-b"},
+		},
+		{
+			"Testing a connection context of another slice",
+			nil,
+			[]*netops.DesiredSlice{sliceA, {QosProfile: sliceB.QosProfile, ConnectionContexts: sliceA.ConnectionContexts}},
+			"",
+			"rpc error: code = InvalidArgument desc = Invalid desired state: connection context of slice id-a under slice id-b",
+			nil,
+			[]string{"id-a", "id-b"},
+		},
+		{
+			"Testing an invalid QoS profile",
+			nil,
+			[]*netops.DesiredSlice{{QosProfile: &netops.SliceQosProfile{SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 7}}},
+			"",
+			"rpc error: code = InvalidArgument desc = Invalid desired state: invalid priority 7, expected 0-3",
+			nil,
+			[]string{"id-a", "id-b"},
+		},
+	}
+	ctx := context.Background()
+	for _, tt := range testCases {
+		backend := &recordingTcBackend{TcBackend: newFakeTcBackend()}
+		s, client := newTestNetOps(t, backend)
+		configureSlicesForAdoption(t, s)
+		if tt.Setup != nil {
+			err := tt.Setup(client, backend)
+			if err != nil {
+				t.Fatal(tt.Case, err)
+			}
+		}
+
+		backend.fail = tt.Fail
+		backend.ops = nil
+		r, err := client.SyncState(ctx, &netops.SyncStateRequest{Slices: tt.Slices})
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		if err == nil && !proto.Equal(r, tt.Expected) {
+			t.Error(tt.Case, "- Expected :", tt.Expected, " but got ", r)
+		}
+		if tt.Expected != nil && tt.Expected.SlicesUnchanged == uint32(len(tt.Slices)) && len(tt.Expected.SlicesDeleted) == 0 && len(backend.ops) != 0 {
+			t.Error(tt.Case, "- Expected no tc changes but got ", backend.ops)
+		}
+		if len(s.state.slices) != len(tt.SliceIDs) {
+			t.Error(tt.Case, "- Expected slices ", tt.SliceIDs, " but got ", len(s.state.slices), " slices")
+		}
+		for _, sliceID := range tt.SliceIDs {
+			sliceInfo, found := s.state.slices[sliceID]
+			if !found {
+				t.Error(tt.Case, "- Expected slice ", sliceID)
+				continue
+			}
+			if err == nil && (!sliceInfo.tcInited || sliceInfo.tcErr != nil || !sliceGwsConfigured(sliceInfo)) {
+				t.Error(tt.Case, "- Expected slice ", sliceID, " to be configured")
+			}
+		}
+		if err == nil && len(s.state.pendingGws) != 0 {
+			t.Error(tt.Case, "- Expected no pending slice gws but got ", s.state.pendingGws)
+		}
+
+		// The state converged, syncing it again changes nothing.
+		if err == nil {
+			backend.ops = nil
+			r, err = client.SyncState(ctx, &netops.SyncStateRequest{Slices: tt.Slices})
+			if err != nil || r.SlicesUnchanged != uint32(len(tt.Slices)) || len(backend.ops) != 0 {
+				t.Error(tt.Case, "- Expected the second sync to change nothing but got ", r, err, backend.ops)
+			}
+		}
+	}
+}
@@ -0,0 +1,378 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Kinds of tc objects managed by netops.
+const (
+	tcKindHtb     = "htb"
+	tcKindSfq     = "sfq"
+	tcKindTbf     = "tbf"
+	tcKindIngress = "ingress"
+	tcKindFlower  = "flower"
+)
+
+// Names of the supported tc backends. The backend is selected with the
+// TC_BACKEND env var.
+const (
+	TC_BACKEND_NETLINK = "netlink"
+	TC_BACKEND_SHELL   = "shell"
+)
+
+var (
+	// ErrTcObjectExists is returned when the tc object being added is already
+	// present on the interface.
+	ErrTcObjectExists = errors.New("tc object already exists")
+	// ErrTcObjectNotFound is returned when the tc object being changed or
+	// deleted is not present on the interface.
+	ErrTcObjectNotFound = errors.New("tc object not found")
+)
+
+// TcError is the error returned by the tc backends when an operation fails.
+type TcError struct {
+	// Operation that failed, e.g. "class add"
+	Op string
+	// The tc object the operation was applied on
+	Obj fmt.Stringer
+	// Underlying error
+	Err error
+}
+
+func (e *TcError) Error() string {
+	// A delete only carries the fields selecting the object, print just those.
+	if obj, ok := e.Obj.(interface{ selector() string }); ok && strings.Contains(e.Op, "del") {
+		return fmt.Sprintf("tc %s %s failed: %v", e.Op, obj.selector(), e.Err)
+	}
+	return fmt.Sprintf("tc %s %v failed: %v", e.Op, e.Obj, e.Err)
+}
+
+func (e *TcError) Unwrap() error {
+	return e.Err
+}
+
+// Is maps the errno returned by the kernel onto the netops tc errors.
+func (e *TcError) Is(target error) bool {
+	switch target {
+	case ErrTcObjectExists:
+		return errors.Is(e.Err, syscall.EEXIST)
+	case ErrTcObjectNotFound:
+		return errors.Is(e.Err, syscall.ENOENT)
+	}
+	return false
+}
+
+// TcQdisc describes a queueing discipline attached to an interface.
+type TcQdisc struct {
+	Dev    string
+	Kind   string
+	Handle uint32
+	Parent uint32
+	// Class for unclassified traffic. Only used by htb.
+	DefaultClass uint32
+	// Flow hash perturbation interval in seconds. Only used by sfq.
+	Perturb uint8
+	// Token rate in kbit/s. Only used by tbf.
+	Rate uint64
+	// Bucket size in bytes. Only used by tbf.
+	Burst uint32
+	// Time a packet can wait for tokens in ms. Only used by tbf.
+	Latency uint32
+	// Statistics of the qdisc. Only set by Dump.
+	Stats *TcStats
+}
+
+// selector returns the tc arguments identifying the qdisc.
+func (q *TcQdisc) selector() string {
+	args := fmt.Sprintf("dev %s %s", q.Dev, tcParentStr(q.Parent))
+	if q.Handle != 0 {
+		args += fmt.Sprintf(" handle %s", tcHandleStr(q.Handle))
+	}
+	return args
+}
+
+func (q *TcQdisc) String() string {
+	args := q.selector()
+	// The ingress parent already stands for the ingress qdisc.
+	if q.Kind != "" && q.Kind != tcKindIngress {
+		args += " " + q.Kind
+	}
+	switch q.Kind {
+	case tcKindHtb:
+		if q.DefaultClass != 0 {
+			args += fmt.Sprintf(" default %x", q.DefaultClass)
+		}
+	case tcKindSfq:
+		if q.Perturb != 0 {
+			args += fmt.Sprintf(" perturb %d", q.Perturb)
+		}
+	case tcKindTbf:
+		args += fmt.Sprintf(" rate %dkbit burst %d latency %dms", q.Rate, q.Burst, q.Latency)
+	}
+	return args
+}
+
+// TcStats holds the counters the kernel keeps for a qdisc or a class.
+type TcStats struct {
+	Bytes   uint64
+	Packets uint64
+	// Packets dropped
+	Drops uint32
+	// Packets delayed for exceeding the rate
+	Overlimits uint32
+	// Bytes queued
+	Backlog uint32
+}
+
+// TcClass describes an htb class.
+type TcClass struct {
+	Dev    string
+	Handle uint32
+	Parent uint32
+	// Guaranteed rate in kbit/s
+	Rate uint64
+	// Rate ceiling in kbit/s. Defaults to the rate when not set.
+	Ceil uint64
+	// Burst size in bytes
+	Burst uint32
+	// Priority of the class when borrowing spare bandwidth, lower is served
+	// first.
+	Prio uint32
+	// Statistics of the class. Only set by Dump.
+	Stats *TcStats
+}
+
+// selector returns the tc arguments identifying the class.
+func (c *TcClass) selector() string {
+	return fmt.Sprintf("dev %s %s classid %s", c.Dev, tcParentStr(c.Parent), tcHandleStr(c.Handle))
+}
+
+func (c *TcClass) String() string {
+	args := fmt.Sprintf("%s htb rate %dkbit", c.selector(), c.Rate)
+	if c.Ceil != 0 {
+		args += fmt.Sprintf(" ceil %dkbit", c.Ceil)
+	}
+	if c.Burst != 0 {
+		args += fmt.Sprintf(" burst %d", c.Burst)
+	}
+	if c.Prio != 0 {
+		args += fmt.Sprintf(" prio %d", c.Prio)
+	}
+	return args
+}
+
+// TcFilter describes a flower filter that steers the traffic of an L4
+// protocol matching ports and addresses to a class. A port or an address
+// left unset is not matched on.
+type TcFilter struct {
+	Dev    string
+	Parent uint32
+	Prio   uint16
+	// Address family of the traffic matched, netlink.FAMILY_V4 or
+	// netlink.FAMILY_V6. Defaults to IPv4.
+	Family int
+	// Handle of the filter. Assigned by the kernel when the filter is added.
+	Handle uint32
+	// L4 protocol, unix.IPPROTO_UDP or unix.IPPROTO_TCP
+	IPProto uint8
+	SrcIP   *net.IPNet
+	DstIP   *net.IPNet
+	SrcPort uint16
+	DstPort uint16
+	ClassId uint32
+	// Rewrite the DSCP of the matching packets to Dscp.
+	MarkDscp bool
+	Dscp     uint8
+	// Redirect the matching packets to the egress of the device.
+	RedirectDev string
+}
+
+// ipv6 reports whether the filter matches IPv6 traffic.
+func (f *TcFilter) ipv6() bool {
+	return f.Family == netlink.FAMILY_V6
+}
+
+func (f *TcFilter) protocol() string {
+	if f.ipv6() {
+		return "ipv6"
+	}
+	return "ip"
+}
+
+// sameMatch reports whether the filters match the same traffic.
+func (f *TcFilter) sameMatch(other *TcFilter) bool {
+	return f.ipv6() == other.ipv6() && f.IPProto == other.IPProto &&
+		tcIPNetStr(f.SrcIP) == tcIPNetStr(other.SrcIP) && tcIPNetStr(f.DstIP) == tcIPNetStr(other.DstIP) &&
+		f.SrcPort == other.SrcPort && f.DstPort == other.DstPort
+}
+
+// selector returns the tc arguments identifying the filter. Without a prio
+// it selects all the filters under the parent.
+func (f *TcFilter) selector() string {
+	if f.Prio == 0 {
+		return fmt.Sprintf("dev %s %s", f.Dev, tcParentStr(f.Parent))
+	}
+	args := fmt.Sprintf("dev %s protocol %s %s prio %d", f.Dev, f.protocol(), tcParentStr(f.Parent), f.Prio)
+	if f.Handle != 0 {
+		args += fmt.Sprintf(" handle 0x%x %s", f.Handle, tcKindFlower)
+	}
+	return args
+}
+
+func (f *TcFilter) String() string {
+	args := fmt.Sprintf("dev %s protocol %s %s prio %d", f.Dev, f.protocol(), tcParentStr(f.Parent), f.Prio)
+	if f.Handle != 0 {
+		args += fmt.Sprintf(" handle 0x%x", f.Handle)
+	}
+	args += " " + tcKindFlower
+	if f.IPProto != 0 {
+		args += fmt.Sprintf(" ip_proto %s", tcIPProtoStr(f.IPProto))
+	}
+	if f.SrcIP != nil {
+		args += fmt.Sprintf(" src_ip %s", f.SrcIP)
+	}
+	if f.DstIP != nil {
+		args += fmt.Sprintf(" dst_ip %s", f.DstIP)
+	}
+	if f.SrcPort != 0 {
+		args += fmt.Sprintf(" src_port %d", f.SrcPort)
+	}
+	if f.DstPort != 0 {
+		args += fmt.Sprintf(" dst_port %d", f.DstPort)
+	}
+	if f.ClassId != 0 {
+		args += fmt.Sprintf(" classid %s", tcHandleStr(f.ClassId))
+	}
+	if f.MarkDscp {
+		// The DSCP is the upper six bits of the dsfield, the ECN bits are kept.
+		dsfield := "ip dsfield"
+		if f.ipv6() {
+			dsfield = "ip6 traffic_class"
+		}
+		args += fmt.Sprintf(" action pedit ex munge %s set 0x%x retain 0xfc pipe", dsfield, f.Dscp<<2)
+		// The rewrite of the dsfield invalidates the IPv4 header checksum.
+		if !f.ipv6() {
+			args += " action csum ip pipe"
+		}
+	}
+	if f.RedirectDev != "" {
+		args += fmt.Sprintf(" action mirred egress redirect dev %s", f.RedirectDev)
+	}
+	return args
+}
+
+// TcIfb describes an IFB device. The traffic redirected to the device is
+// shaped by the qdiscs on its egress.
+type TcIfb struct {
+	Dev string
+}
+
+func (i *TcIfb) String() string {
+	return fmt.Sprintf("dev %s type ifb", i.Dev)
+}
+
+// TcTree is a snapshot of the tc objects configured on an interface.
+type TcTree struct {
+	Qdiscs  []*TcQdisc
+	Classes []*TcClass
+	Filters []*TcFilter
+}
+
+// TcBackend programs tc objects on the network interfaces.
+type TcBackend interface {
+	QdiscAdd(qdisc *TcQdisc) error
+	QdiscReplace(qdisc *TcQdisc) error
+	// QdiscDel deletes the qdisc attached at the parent. Deleting a parent
+	// with no qdisc, or the default root qdisc, returns ErrTcObjectNotFound.
+	// A qdisc with a kind is only deleted when the attached qdisc is of
+	// that kind.
+	QdiscDel(qdisc *TcQdisc) error
+	ClassAdd(class *TcClass) error
+	ClassReplace(class *TcClass) error
+	ClassDel(class *TcClass) error
+	FilterAdd(filter *TcFilter) error
+	// FilterReplace replaces the actions of the filter with the same parent,
+	// prio and match, or adds the filter when there is none.
+	FilterReplace(filter *TcFilter) error
+	// FilterDel deletes the filters matching the selector. A selector without
+	// a prio deletes all the filters under the parent.
+	FilterDel(filter *TcFilter) error
+	// IfbAdd adds the IFB device and brings it up. An existing device is
+	// brought up.
+	IfbAdd(ifb *TcIfb) error
+	// IfbDel deletes the IFB device along with its qdiscs. Deleting a missing
+	// device returns ErrTcObjectNotFound.
+	IfbDel(ifb *TcIfb) error
+	// Dump returns the qdiscs, classes and filters configured on the
+	// interface.
+	Dump(dev string) (*TcTree, error)
+}
+
+// NewTcBackend returns the tc backend with the given name. The netlink
+// backend is used unless the shell backend is asked for.
+func NewTcBackend(name string) TcBackend {
+	if strings.ToLower(name) == TC_BACKEND_SHELL {
+		return &shellTcBackend{}
+	}
+	return &netlinkTcBackend{}
+}
+
+// tcHandleStr formats a handle the way the tc command line expects it.
+func tcHandleStr(handle uint32) string {
+	major, minor := netlink.MajorMinor(handle)
+	if minor == 0 {
+		return fmt.Sprintf("%x:", major)
+	}
+	return fmt.Sprintf("%x:%x", major, minor)
+}
+
+func tcIPNetStr(ipNet *net.IPNet) string {
+	if ipNet == nil {
+		return ""
+	}
+	return ipNet.String()
+}
+
+func tcIPProtoStr(proto uint8) string {
+	switch proto {
+	case unix.IPPROTO_UDP:
+		return "udp"
+	case unix.IPPROTO_TCP:
+		return "tcp"
+	}
+	return fmt.Sprintf("%d", proto)
+}
+
+func tcParentStr(parent uint32) string {
+	switch parent {
+	case netlink.HANDLE_ROOT:
+		return "root"
+	case netlink.HANDLE_INGRESS:
+		return "ingress"
+	}
+	return "parent " + tcHandleStr(parent)
+}
@@ -0,0 +1,331 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/kubeslice/netops/logger"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+func TestTcObjectArgs(t *testing.T) {
+	root := netlink.MakeHandle(0x17, 0)
+	testCases := []struct {
+		testCase string
+		obj      fmt.Stringer
+		expected string
+	}{
+		{
+			"Root htb qdisc",
+			&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: root, DefaultClass: 0x30},
+			"dev eth0 root handle 17: htb default 30",
+		},
+		{
+			"Leaf sfq qdisc",
+			&TcQdisc{Dev: "eth0", Kind: tcKindSfq, Parent: netlink.MakeHandle(0x17, 0x12), Handle: netlink.MakeHandle(0x11, 0), Perturb: 10},
+			"dev eth0 parent 17:12 handle 11: sfq perturb 10",
+		},
+		{
+			"Leaf tbf qdisc",
+			&TcQdisc{Dev: "eth0", Kind: tcKindTbf, Parent: netlink.MakeHandle(0x17, 0x12), Handle: netlink.MakeHandle(0x11, 0), Rate: 5000, Burst: 6250, Latency: 50},
+			"dev eth0 parent 17:12 handle 11: tbf rate 5000kbit burst 6250 latency 50ms",
+		},
+		{
+			"Ingress qdisc",
+			&TcQdisc{Dev: "eth0", Kind: tcKindIngress, Parent: netlink.HANDLE_INGRESS, Handle: netlink.MakeHandle(0xffff, 0)},
+			"dev eth0 ingress handle ffff:",
+		},
+		{
+			"Leaf htb class",
+			&TcClass{Dev: "eth0", Parent: netlink.MakeHandle(0x17, 0x11), Handle: netlink.MakeHandle(0x17, 0x12), Rate: 1000, Ceil: 5000, Burst: 32 * 1024},
+			"dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768",
+		},
+		{
+			"Leaf htb class with a priority",
+			&TcClass{Dev: "eth0", Parent: netlink.MakeHandle(0x17, 0x11), Handle: netlink.MakeHandle(0x17, 0x12), Rate: 1000, Ceil: 5000, Burst: 32 * 1024, Prio: 3},
+			"dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 3",
+		},
+		{
+			"Slice gw client filter",
+			&TcFilter{Dev: "eth0", Parent: root, Prio: 2, IPProto: unix.IPPROTO_UDP, DstPort: 5000, ClassId: netlink.MakeHandle(0x17, 0x12)},
+			"dev eth0 protocol ip parent 17: prio 2 flower ip_proto udp dst_port 5000 classid 17:12",
+		},
+		{
+			"TCP slice gw server filter with an address and DSCP marking",
+			&TcFilter{Dev: "eth0", Parent: root, Prio: 2, Handle: 0x1, IPProto: unix.IPPROTO_TCP, SrcPort: 5000, DstIP: &net.IPNet{IP: net.IPv4(10, 1, 1, 1).To4(), Mask: net.CIDRMask(32, 32)}, ClassId: netlink.MakeHandle(0x17, 0x12), MarkDscp: true, Dscp: 34},
+			"dev eth0 protocol ip parent 17: prio 2 handle 0x1 flower ip_proto tcp dst_ip 10.1.1.1/32 src_port 5000 classid 17:12 action pedit ex munge ip dsfield set 0x88 retain 0xfc pipe action csum ip pipe",
+		},
+		{
+			"IPv6 slice gw filter with DSCP marking",
+			&TcFilter{Dev: "eth0", Parent: root, Prio: 12, Family: netlink.FAMILY_V6, IPProto: unix.IPPROTO_UDP, DstPort: 5000, ClassId: netlink.MakeHandle(0x17, 0x12), MarkDscp: true, Dscp: 46},
+			"dev eth0 protocol ipv6 parent 17: prio 12 flower ip_proto udp dst_port 5000 classid 17:12 action pedit ex munge ip6 traffic_class set 0xb8 retain 0xfc pipe",
+		},
+		{
+			"Ingress slice gw filter redirecting to an IFB device",
+			&TcFilter{Dev: "eth0", Parent: netlink.MakeHandle(0xffff, 0), Prio: 2, IPProto: unix.IPPROTO_UDP, SrcPort: 5000, RedirectDev: "netops-ifb"},
+			"dev eth0 protocol ip parent ffff: prio 2 flower ip_proto udp src_port 5000 action mirred egress redirect dev netops-ifb",
+		},
+		{
+			"IFB device",
+			&TcIfb{Dev: "netops-ifb"},
+			"dev netops-ifb type ifb",
+		},
+	}
+	for _, tt := range testCases {
+		if tt.obj.String() != tt.expected {
+			t.Error(tt.testCase, "- Expected :", tt.expected, " but got ", tt.obj.String())
+		}
+	}
+}
+
+func TestTcObjectSelector(t *testing.T) {
+	root := netlink.MakeHandle(0x17, 0)
+	testCases := []struct {
+		testCase string
+		selector string
+		expected string
+	}{
+		{
+			"Root qdisc",
+			(&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT}).selector(),
+			"dev eth0 root",
+		},
+		{
+			"Parent class",
+			(&TcClass{Dev: "eth0", Parent: root, Handle: netlink.MakeHandle(0x17, 0x11), Rate: 1000}).selector(),
+			"dev eth0 parent 17: classid 17:11",
+		},
+		{
+			"All filters under the root qdisc",
+			(&TcFilter{Dev: "eth0", Parent: root}).selector(),
+			"dev eth0 parent 17:",
+		},
+		{
+			"Filters with a prio",
+			(&TcFilter{Dev: "eth0", Parent: root, Prio: 3}).selector(),
+			"dev eth0 protocol ip parent 17: prio 3",
+		},
+		{
+			"IPv6 filters with a prio",
+			(&TcFilter{Dev: "eth0", Parent: root, Prio: 13, Family: netlink.FAMILY_V6}).selector(),
+			"dev eth0 protocol ipv6 parent 17: prio 13",
+		},
+	}
+	for _, tt := range testCases {
+		if tt.selector != tt.expected {
+			t.Error(tt.testCase, "- Expected :", tt.expected, " but got ", tt.selector)
+		}
+	}
+}
+
+func TestTcErrorIs(t *testing.T) {
+	testCases := []struct {
+		testCase string
+		err      error
+		exists   bool
+		notFound bool
+	}{
+		{
+			"Object exists",
+			&TcError{Op: "class add", Obj: &TcClass{}, Err: syscall.EEXIST},
+			true,
+			false,
+		},
+		{
+			"Object not found",
+			&TcError{Op: "class del", Obj: &TcClass{}, Err: syscall.ENOENT},
+			false,
+			true,
+		},
+		{
+			"Other error",
+			&TcError{Op: "class del", Obj: &TcClass{}, Err: syscall.EPERM},
+			false,
+			false,
+		},
+	}
+	for _, tt := range testCases {
+		if errors.Is(tt.err, ErrTcObjectExists) != tt.exists {
+			t.Error(tt.testCase, "- Expected exists:", tt.exists)
+		}
+		if errors.Is(tt.err, ErrTcObjectNotFound) != tt.notFound {
+			t.Error(tt.testCase, "- Expected not found:", tt.notFound)
+		}
+	}
+}
+
+func TestShellTcBackendErrors(t *testing.T) {
+	testCases := []struct {
+		testCase string
+		op       func(b *shellTcBackend) error
+		cmdOut   string
+		cmdErr   error
+		exists   bool
+		notFound bool
+		errStr   string
+	}{
+		{
+			"Added object exists",
+			func(b *shellTcBackend) error {
+				return b.ClassAdd(&TcClass{Dev: "eth0", Parent: netlink.MakeHandle(0x17, 0), Handle: netlink.MakeHandle(0x17, 0x11), Rate: 1000})
+			},
+			"RTNETLINK answers: File exists\nWe have an error talking to the kernel\n",
+			errors.New("Could not run cmd: exit status 2"),
+			true,
+			false,
+			"tc class add dev eth0 parent 17: classid 17:11 htb rate 1000kbit failed: tc object already exists: RTNETLINK answers: File exists\nWe have an error talking to the kernel",
+		},
+		{
+			"Deleted object not found",
+			func(b *shellTcBackend) error {
+				return b.QdiscDel(&TcQdisc{Dev: "eth0", Parent: netlink.HANDLE_ROOT})
+			},
+			"RTNETLINK answers: No such file or directory\n",
+			errors.New("Could not run cmd: exit status 2"),
+			false,
+			true,
+			"tc qdisc delete dev eth0 root failed: tc object not found: RTNETLINK answers: No such file or directory",
+		},
+		{
+			"Device not found",
+			func(b *shellTcBackend) error {
+				return b.ClassDel(&TcClass{Dev: "eth9", Parent: netlink.MakeHandle(0x17, 0), Handle: netlink.MakeHandle(0x17, 0x11)})
+			},
+			"Cannot find device \"eth9\"\n",
+			errors.New("Could not run cmd: exit status 1"),
+			false,
+			true,
+			"tc class delete dev eth9 parent 17: classid 17:11 failed: tc object not found: Cannot find device \"eth9\"",
+		},
+		{
+			"Other failure",
+			func(b *shellTcBackend) error {
+				return b.QdiscAdd(&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: netlink.MakeHandle(0x17, 0)})
+			},
+			"RTNETLINK answers: Operation not permitted\n",
+			errors.New("Could not run cmd: exit status 2"),
+			false,
+			false,
+			"tc qdisc add dev eth0 root handle 17: htb failed: Could not run cmd: exit status 2: RTNETLINK answers: Operation not permitted",
+		},
+		{
+			"Success",
+			func(b *shellTcBackend) error {
+				return b.QdiscAdd(&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: netlink.MakeHandle(0x17, 0)})
+			},
+			"",
+			nil,
+			false,
+			false,
+			"",
+		},
+	}
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	for _, tt := range testCases {
+		cmds := []string{}
+		b := &shellTcBackend{runCmd: func(cmdString string) (string, error) {
+			cmds = append(cmds, cmdString)
+			return tt.cmdOut, tt.cmdErr
+		}}
+		err := tt.op(b)
+		expectErrStr(t, tt.testCase, err, tt.errStr)
+		if errors.Is(err, ErrTcObjectExists) != tt.exists {
+			t.Error(tt.testCase, "- Expected exists:", tt.exists)
+		}
+		if errors.Is(err, ErrTcObjectNotFound) != tt.notFound {
+			t.Error(tt.testCase, "- Expected not found:", tt.notFound)
+		}
+		// A failed command is never retried, the callers decide what to do.
+		if len(cmds) != 1 {
+			t.Error(tt.testCase, "- Expected a single tc command but got ", cmds)
+		}
+	}
+}
+
+func TestFlowerActions(t *testing.T) {
+	root := netlink.MakeHandle(0x17, 0)
+	testCases := []struct {
+		testCase string
+		filter   *TcFilter
+		expected []string
+	}{
+		{
+			"IPv4 filter with DSCP marking",
+			&TcFilter{Dev: "eth0", Parent: root, Prio: 1, IPProto: unix.IPPROTO_UDP, DstPort: 5000, MarkDscp: true, Dscp: 46},
+			[]string{tcActPedit, tcActCsum},
+		},
+		{
+			"IPv6 filter with DSCP marking",
+			&TcFilter{Dev: "eth0", Parent: root, Prio: 11, Family: netlink.FAMILY_V6, IPProto: unix.IPPROTO_UDP, DstPort: 5000, MarkDscp: true, Dscp: 46},
+			[]string{tcActPedit},
+		},
+		{
+			"IPv4 filter with DSCP marking and a redirect",
+			&TcFilter{Dev: "eth0", Parent: netlink.MakeHandle(0xffff, 0), Prio: 1, IPProto: unix.IPPROTO_UDP, SrcPort: 5000, MarkDscp: true, Dscp: 46, RedirectDev: "netops-ifb"},
+			[]string{tcActPedit, tcActCsum, tcActMirred},
+		},
+		{
+			"Filter with a redirect",
+			&TcFilter{Dev: "eth0", Parent: netlink.MakeHandle(0xffff, 0), Prio: 1, IPProto: unix.IPPROTO_UDP, SrcPort: 5000, RedirectDev: "netops-ifb"},
+			[]string{tcActMirred},
+		},
+		{
+			"Filter without actions",
+			&TcFilter{Dev: "eth0", Parent: root, Prio: 1, IPProto: unix.IPPROTO_UDP, DstPort: 5000},
+			nil,
+		},
+	}
+	for _, tt := range testCases {
+		var kinds []string
+		if actions := flowerActions(tt.filter, 1); actions != nil {
+			attrs, err := nl.ParseRouteAttr(actions.Serialize())
+			if err != nil {
+				t.Fatal(tt.testCase, err)
+			}
+			tables, err := nl.ParseRouteAttr(attrs[0].Value)
+			if err != nil {
+				t.Fatal(tt.testCase, err)
+			}
+			for i, table := range tables {
+				// The kernel runs the actions in the order of their table.
+				if int(table.Attr.Type) != nl.TCA_ACT_TAB+i {
+					t.Error(tt.testCase, "- Expected table ", nl.TCA_ACT_TAB+i, " but got ", table.Attr.Type)
+				}
+				action, err := nl.ParseRouteAttr(table.Value)
+				if err != nil {
+					t.Fatal(tt.testCase, err)
+				}
+				for _, attr := range action {
+					if attr.Attr.Type == nl.TCA_ACT_KIND {
+						kinds = append(kinds, string(attr.Value[:len(attr.Value)-1]))
+					}
+				}
+			}
+		}
+		if fmt.Sprint(kinds) != fmt.Sprint(tt.expected) {
+			t.Error(tt.testCase, "- Expected :", tt.expected, " but got ", kinds)
+		}
+	}
+}
@@ -0,0 +1,615 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// fakeTcBackend is an in-memory TcBackend. It models the htb tree built by
+// netops and rejects the operations the kernel would reject, so the handlers
+// can be tested without root.
+type fakeTcBackend struct {
+	mu   sync.Mutex
+	devs map[string]*TcTree
+	// IFB devices added
+	ifbs map[string]bool
+}
+
+func newFakeTcBackend() *fakeTcBackend {
+	return &fakeTcBackend{devs: make(map[string]*TcTree), ifbs: make(map[string]bool)}
+}
+
+func (b *fakeTcBackend) tree(dev string) (*TcTree, error) {
+	if dev == "" {
+		return nil, syscall.ENODEV
+	}
+	tree, found := b.devs[dev]
+	if !found {
+		tree = &TcTree{}
+		b.devs[dev] = tree
+	}
+	return tree, nil
+}
+
+func sameMajor(a, b uint32) bool {
+	return a&0xffff0000 == b&0xffff0000
+}
+
+// removeQdisc removes the qdisc along with its classes and filters.
+func removeQdisc(tree *TcTree, qdisc *TcQdisc) {
+	qdiscs := tree.Qdiscs[:0]
+	for _, q := range tree.Qdiscs {
+		if q != qdisc {
+			qdiscs = append(qdiscs, q)
+		}
+	}
+	tree.Qdiscs = qdiscs
+
+	filters := tree.Filters[:0]
+	for _, f := range tree.Filters {
+		if f.Parent != qdisc.Handle {
+			filters = append(filters, f)
+		}
+	}
+	tree.Filters = filters
+
+	var owned []*TcClass
+	classes := tree.Classes[:0]
+	for _, c := range tree.Classes {
+		if sameMajor(c.Handle, qdisc.Handle) {
+			owned = append(owned, c)
+		} else {
+			classes = append(classes, c)
+		}
+	}
+	tree.Classes = classes
+	for _, c := range owned {
+		if leaf := qdiscAt(tree, c.Handle); leaf != nil {
+			removeQdisc(tree, leaf)
+		}
+	}
+}
+
+func (b *fakeTcBackend) addQdisc(q *TcQdisc, replace bool) error {
+	tree, err := b.tree(q.Dev)
+	if err != nil {
+		return err
+	}
+	if q.Parent != netlink.HANDLE_ROOT && q.Parent != netlink.HANDLE_INGRESS && classByHandle(tree, q.Parent) == nil {
+		return syscall.ENOENT
+	}
+	old := qdiscAt(tree, q.Parent)
+	if old != nil && !replace {
+		return syscall.EEXIST
+	}
+	if q.Handle != 0 {
+		if other := qdiscByHandle(tree, q.Handle); other != nil && other != old {
+			return syscall.EEXIST
+		}
+	}
+	if old != nil && old.Kind == q.Kind && (q.Handle == 0 || q.Handle == old.Handle) {
+		// Changing the parameters keeps the classes and filters.
+		old.DefaultClass, old.Perturb = q.DefaultClass, q.Perturb
+		old.Rate, old.Burst, old.Latency = q.Rate, q.Burst, q.Latency
+		return nil
+	}
+	if old != nil && q.Handle == old.Handle {
+		// The kind of a qdisc cannot be changed in place.
+		return syscall.EINVAL
+	}
+	if old != nil {
+		removeQdisc(tree, old)
+	}
+	qdisc := *q
+	tree.Qdiscs = append(tree.Qdiscs, &qdisc)
+	return nil
+}
+
+func (b *fakeTcBackend) QdiscAdd(q *TcQdisc) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.addQdisc(q, false); err != nil {
+		return &TcError{Op: "qdisc add", Obj: q, Err: err}
+	}
+	return nil
+}
+
+func (b *fakeTcBackend) QdiscReplace(q *TcQdisc) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.addQdisc(q, true); err != nil {
+		return &TcError{Op: "qdisc replace", Obj: q, Err: err}
+	}
+	return nil
+}
+
+func (b *fakeTcBackend) QdiscDel(q *TcQdisc) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	tree, err := b.tree(q.Dev)
+	if err != nil {
+		return &TcError{Op: "qdisc del", Obj: q, Err: err}
+	}
+	qdisc := qdiscAt(tree, q.Parent)
+	if qdisc == nil || (q.Handle != 0 && qdisc.Handle != q.Handle) || (q.Kind != "" && qdisc.Kind != q.Kind) {
+		return &TcError{Op: "qdisc del", Obj: q, Err: syscall.ENOENT}
+	}
+	removeQdisc(tree, qdisc)
+	return nil
+}
+
+func (b *fakeTcBackend) addClass(c *TcClass, replace bool) error {
+	tree, err := b.tree(c.Dev)
+	if err != nil {
+		return err
+	}
+	if old := classByHandle(tree, c.Handle); old != nil {
+		if !replace {
+			return syscall.EEXIST
+		}
+		old.Rate, old.Ceil, old.Burst, old.Prio = c.Rate, c.Ceil, c.Burst, c.Prio
+		return nil
+	}
+	qdisc := qdiscByHandle(tree, c.Parent&0xffff0000)
+	if qdisc == nil {
+		return syscall.ENOENT
+	}
+	if qdisc.Kind != tcKindHtb || !sameMajor(c.Handle, c.Parent) {
+		return syscall.EINVAL
+	}
+	if c.Parent != qdisc.Handle && classByHandle(tree, c.Parent) == nil {
+		return syscall.ENOENT
+	}
+	class := *c
+	tree.Classes = append(tree.Classes, &class)
+	return nil
+}
+
+func (b *fakeTcBackend) ClassAdd(c *TcClass) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.addClass(c, false); err != nil {
+		return &TcError{Op: "class add", Obj: c, Err: err}
+	}
+	return nil
+}
+
+func (b *fakeTcBackend) ClassReplace(c *TcClass) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.addClass(c, true); err != nil {
+		return &TcError{Op: "class replace", Obj: c, Err: err}
+	}
+	return nil
+}
+
+func (b *fakeTcBackend) delClass(c *TcClass) error {
+	tree, err := b.tree(c.Dev)
+	if err != nil {
+		return err
+	}
+	class := classByHandle(tree, c.Handle)
+	if class == nil {
+		return syscall.ENOENT
+	}
+	// htb refuses to delete a class with children or filters pointing at it.
+	for _, child := range tree.Classes {
+		if child.Parent == class.Handle {
+			return syscall.EBUSY
+		}
+	}
+	for _, f := range tree.Filters {
+		if f.ClassId == class.Handle {
+			return syscall.EBUSY
+		}
+	}
+	if leaf := qdiscAt(tree, class.Handle); leaf != nil {
+		removeQdisc(tree, leaf)
+	}
+	classes := tree.Classes[:0]
+	for _, other := range tree.Classes {
+		if other != class {
+			classes = append(classes, other)
+		}
+	}
+	tree.Classes = classes
+	return nil
+}
+
+func (b *fakeTcBackend) ClassDel(c *TcClass) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.delClass(c); err != nil {
+		return &TcError{Op: "class del", Obj: c, Err: err}
+	}
+	return nil
+}
+
+func (b *fakeTcBackend) addFilter(f *TcFilter, replace bool) error {
+	tree, err := b.tree(f.Dev)
+	if err != nil {
+		return err
+	}
+	if qdiscByHandle(tree, f.Parent) == nil {
+		return syscall.ENOENT
+	}
+	if f.RedirectDev != "" && !b.ifbs[f.RedirectDev] {
+		return syscall.ENODEV
+	}
+	filter := *f
+	if filter.Prio == 0 {
+		// The kernel picks a prio below the ones in use.
+		filter.Prio = 0xc000
+		for _, other := range tree.Filters {
+			if other.Parent == f.Parent && other.Prio <= filter.Prio {
+				filter.Prio = other.Prio - 1
+			}
+		}
+	}
+	for _, other := range tree.Filters {
+		// The kernel binds a prio to the protocol of its first filter.
+		if other.Parent == filter.Parent && other.Prio == filter.Prio && other.ipv6() != filter.ipv6() {
+			return syscall.EINVAL
+		}
+		if !replace && filter.Handle != 0 && other.Parent == filter.Parent && other.Prio == filter.Prio && other.Handle == filter.Handle {
+			return syscall.EEXIST
+		}
+	}
+	if replace {
+		// The filter is looked up by its match, the replaced filter keeps
+		// its handle.
+		for _, other := range tree.Filters {
+			if other.Parent == filter.Parent && other.Prio == filter.Prio && other.sameMatch(&filter) {
+				other.ClassId = filter.ClassId
+				other.MarkDscp = filter.MarkDscp
+				other.Dscp = filter.Dscp
+				other.RedirectDev = filter.RedirectDev
+				return nil
+			}
+		}
+	}
+	// The kernel lists the filters under a parent by prio and handle.
+	for i, other := range tree.Filters {
+		if other.Parent == filter.Parent && filter.Handle != 0 && (other.Prio > filter.Prio || (other.Prio == filter.Prio && other.Handle > filter.Handle)) {
+			tree.Filters = append(tree.Filters[:i], append([]*TcFilter{&filter}, tree.Filters[i:]...)...)
+			return nil
+		}
+	}
+	tree.Filters = append(tree.Filters, &filter)
+	return nil
+}
+
+func (b *fakeTcBackend) FilterAdd(f *TcFilter) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.addFilter(f, false); err != nil {
+		return &TcError{Op: "filter add", Obj: f, Err: err}
+	}
+	return nil
+}
+
+func (b *fakeTcBackend) FilterReplace(f *TcFilter) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.addFilter(f, true); err != nil {
+		return &TcError{Op: "filter replace", Obj: f, Err: err}
+	}
+	return nil
+}
+
+func (b *fakeTcBackend) delFilter(f *TcFilter) error {
+	tree, err := b.tree(f.Dev)
+	if err != nil {
+		return err
+	}
+	if qdiscByHandle(tree, f.Parent) == nil {
+		return syscall.ENOENT
+	}
+	found := false
+	filters := tree.Filters[:0]
+	for _, other := range tree.Filters {
+		if other.Parent == f.Parent && f.Prio != 0 && other.Prio == f.Prio && other.ipv6() != f.ipv6() {
+			return syscall.EINVAL
+		}
+	}
+	for _, other := range tree.Filters {
+		// A selector with a handle deletes the filter on its own.
+		if other.Parent == f.Parent && (f.Prio == 0 || other.Prio == f.Prio) && (f.Handle == 0 || other.Handle == f.Handle) {
+			found = true
+			continue
+		}
+		filters = append(filters, other)
+	}
+	tree.Filters = filters
+	// Flushing a parent without filters is not an error.
+	if !found && f.Prio != 0 {
+		return syscall.ENOENT
+	}
+	return nil
+}
+
+func (b *fakeTcBackend) FilterDel(f *TcFilter) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.delFilter(f); err != nil {
+		return &TcError{Op: "filter del", Obj: f, Err: err}
+	}
+	return nil
+}
+
+func (b *fakeTcBackend) IfbAdd(ifb *TcIfb) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ifb.Dev == "" {
+		return &TcError{Op: "ifb add", Obj: ifb, Err: syscall.EINVAL}
+	}
+	b.ifbs[ifb.Dev] = true
+	return nil
+}
+
+func (b *fakeTcBackend) IfbDel(ifb *TcIfb) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.ifbs[ifb.Dev] {
+		return &TcError{Op: "ifb del", Obj: ifb, Err: syscall.ENOENT}
+	}
+	delete(b.ifbs, ifb.Dev)
+	delete(b.devs, ifb.Dev)
+	return nil
+}
+
+// sendTraffic counts the packets sent through a class on the class, its
+// parent classes and the qdisc attached to it, the way the kernel does.
+func (b *fakeTcBackend) sendTraffic(dev string, classId uint32, bytes uint64, packets uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	tree := b.devs[dev]
+	count := func(stats *TcStats) *TcStats {
+		// Dumps share the stats, they are not changed in place.
+		counted := &TcStats{Bytes: bytes, Packets: packets}
+		if stats != nil {
+			counted.Bytes += stats.Bytes
+			counted.Packets += stats.Packets
+		}
+		return counted
+	}
+	if qdisc := qdiscAt(tree, classId); qdisc != nil {
+		qdisc.Stats = count(qdisc.Stats)
+	}
+	for class := classByHandle(tree, classId); class != nil; class = classByHandle(tree, class.Parent) {
+		class.Stats = count(class.Stats)
+	}
+}
+
+// Dump returns a copy of the tree, sorted by handle so that it can be
+// compared.
+func (b *fakeTcBackend) Dump(dev string) (*TcTree, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	tree, err := b.tree(dev)
+	if err != nil {
+		return nil, err
+	}
+	dump := &TcTree{}
+	// The kernel counts from the time the object is added.
+	noStats := &TcStats{}
+	for _, q := range tree.Qdiscs {
+		qdisc := *q
+		if qdisc.Stats == nil {
+			qdisc.Stats = noStats
+		}
+		dump.Qdiscs = append(dump.Qdiscs, &qdisc)
+	}
+	for _, c := range tree.Classes {
+		class := *c
+		if class.Stats == nil {
+			class.Stats = noStats
+		}
+		dump.Classes = append(dump.Classes, &class)
+	}
+	for _, f := range tree.Filters {
+		filter := *f
+		dump.Filters = append(dump.Filters, &filter)
+	}
+	sort.SliceStable(dump.Qdiscs, func(i, j int) bool { return dump.Qdiscs[i].Handle < dump.Qdiscs[j].Handle })
+	sort.SliceStable(dump.Classes, func(i, j int) bool { return dump.Classes[i].Handle < dump.Classes[j].Handle })
+	sort.SliceStable(dump.Filters, func(i, j int) bool {
+		if dump.Filters[i].Parent != dump.Filters[j].Parent {
+			return dump.Filters[i].Parent < dump.Filters[j].Parent
+		}
+		return dump.Filters[i].Prio < dump.Filters[j].Prio
+	})
+	return dump, nil
+}
+
+// defaultRootHandle returns the handle of the root qdisc the tests run with.
+func defaultRootHandle() uint32 {
+	return netlink.MakeHandle(uint16(defaultRootHandleId), 0)
+}
+
+// defaultClassHandle returns the handle of a class under the root qdisc the
+// tests run with.
+func defaultClassHandle(classId uint32) uint32 {
+	return netlink.MakeHandle(uint16(defaultRootHandleId), uint16(classId))
+}
+
+// tcTreeLines formats the tree as tc arguments, one object per line.
+func tcTreeLines(tree *TcTree) []string {
+	lines := []string{}
+	for _, q := range tree.Qdiscs {
+		lines = append(lines, "qdisc "+q.String())
+	}
+	for _, c := range tree.Classes {
+		lines = append(lines, "class "+c.String())
+	}
+	for _, f := range tree.Filters {
+		lines = append(lines, "filter "+f.String())
+	}
+	return lines
+}
+
+// expectTcTree fails the test when the tree on the interface differs from the
+// expected tc objects.
+func expectTcTree(t *testing.T, backend TcBackend, dev string, expected []string) {
+	t.Helper()
+	tree, err := backend.Dump(dev)
+	if err != nil {
+		t.Fatal("Failed to dump tc tree: ", err)
+	}
+	if lines := tcTreeLines(tree); !reflect.DeepEqual(lines, expected) {
+		t.Error("Expected tc tree:\n", strings.Join(expected, "\n"), "\nbut got:\n", strings.Join(lines, "\n"))
+	}
+}
+
+func TestFakeTcBackend(t *testing.T) {
+	root := defaultRootHandle()
+	testCases := []struct {
+		testCase string
+		op       func(b *fakeTcBackend) error
+		ErrStr   string
+	}{
+		{
+			"Class without a root qdisc",
+			func(b *fakeTcBackend) error {
+				return b.ClassAdd(&TcClass{Dev: "eth0", Parent: root, Handle: defaultClassHandle(0x11), Rate: 1000})
+			},
+			"tc class add dev eth0 parent 17: classid 17:11 htb rate 1000kbit failed: no such file or directory",
+		},
+		{
+			"Duplicate class ID",
+			func(b *fakeTcBackend) error {
+				b.QdiscAdd(&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: root})
+				b.ClassAdd(&TcClass{Dev: "eth0", Parent: root, Handle: defaultClassHandle(0x11), Rate: 1000})
+				return b.ClassAdd(&TcClass{Dev: "eth0", Parent: root, Handle: defaultClassHandle(0x11), Rate: 2000})
+			},
+			"tc class add dev eth0 parent 17: classid 17:11 htb rate 2000kbit failed: file exists",
+		},
+		{
+			"Class with a missing parent class",
+			func(b *fakeTcBackend) error {
+				b.QdiscAdd(&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: root})
+				return b.ClassAdd(&TcClass{Dev: "eth0", Parent: defaultClassHandle(0x11), Handle: defaultClassHandle(0x12), Rate: 1000})
+			},
+			"tc class add dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit failed: no such file or directory",
+		},
+		{
+			"Class with children",
+			func(b *fakeTcBackend) error {
+				b.QdiscAdd(&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: root})
+				b.ClassAdd(&TcClass{Dev: "eth0", Parent: root, Handle: defaultClassHandle(0x11), Rate: 1000})
+				b.ClassAdd(&TcClass{Dev: "eth0", Parent: defaultClassHandle(0x11), Handle: defaultClassHandle(0x12), Rate: 1000})
+				return b.ClassDel(&TcClass{Dev: "eth0", Parent: root, Handle: defaultClassHandle(0x11)})
+			},
+			"tc class del dev eth0 parent 17: classid 17:11 failed: device or resource busy",
+		},
+		{
+			"Filter without a root qdisc",
+			func(b *fakeTcBackend) error {
+				return b.FilterAdd(&TcFilter{Dev: "eth0", Parent: root, Prio: 1, IPProto: unix.IPPROTO_UDP, DstPort: 5000, ClassId: defaultClassHandle(0x12)})
+			},
+			"tc filter add dev eth0 protocol ip parent 17: prio 1 flower ip_proto udp dst_port 5000 classid 17:12 failed: no such file or directory",
+		},
+		{
+			"IPv6 filter at the prio of an IPv4 filter",
+			func(b *fakeTcBackend) error {
+				b.QdiscAdd(&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: root})
+				b.FilterAdd(&TcFilter{Dev: "eth0", Parent: root, Prio: 1, IPProto: unix.IPPROTO_UDP, DstPort: 5000, ClassId: defaultClassHandle(0x12)})
+				return b.FilterAdd(&TcFilter{Dev: "eth0", Parent: root, Prio: 1, Family: netlink.FAMILY_V6, IPProto: unix.IPPROTO_UDP, DstPort: 5000, ClassId: defaultClassHandle(0x12)})
+			},
+			"tc filter add dev eth0 protocol ipv6 parent 17: prio 1 flower ip_proto udp dst_port 5000 classid 17:12 failed: invalid argument",
+		},
+		{
+			"Duplicate filter handle",
+			func(b *fakeTcBackend) error {
+				b.QdiscAdd(&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: root})
+				b.FilterAdd(&TcFilter{Dev: "eth0", Parent: root, Prio: 1, Handle: 0x110001, IPProto: unix.IPPROTO_UDP, DstPort: 5000, ClassId: defaultClassHandle(0x12)})
+				return b.FilterAdd(&TcFilter{Dev: "eth0", Parent: root, Prio: 1, Handle: 0x110001, IPProto: unix.IPPROTO_UDP, DstPort: 6000, ClassId: defaultClassHandle(0x12)})
+			},
+			"tc filter add dev eth0 protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp dst_port 6000 classid 17:12 failed: file exists",
+		},
+		{
+			"Deleting filters by handle",
+			func(b *fakeTcBackend) error {
+				b.QdiscAdd(&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: root})
+				b.FilterAdd(&TcFilter{Dev: "eth0", Parent: root, Prio: 1, Handle: 0x110001, IPProto: unix.IPPROTO_UDP, DstPort: 5000, ClassId: defaultClassHandle(0x12)})
+				b.FilterAdd(&TcFilter{Dev: "eth0", Parent: root, Prio: 1, Handle: 0x110002, IPProto: unix.IPPROTO_UDP, DstPort: 6000, ClassId: defaultClassHandle(0x12)})
+				err := b.FilterDel(&TcFilter{Dev: "eth0", Parent: root, Prio: 1, Handle: 0x110001})
+				if err == nil {
+					// The other filter at the prio is left alone.
+					err = b.FilterDel(&TcFilter{Dev: "eth0", Parent: root, Prio: 1, Handle: 0x110002})
+				}
+				if err == nil {
+					err = b.QdiscDel(&TcQdisc{Dev: "eth0", Parent: netlink.HANDLE_ROOT})
+				}
+				return err
+			},
+			"",
+		},
+		{
+			"Filter redirecting to a missing IFB device",
+			func(b *fakeTcBackend) error {
+				b.QdiscAdd(&TcQdisc{Dev: "eth0", Kind: tcKindIngress, Parent: netlink.HANDLE_INGRESS, Handle: tcIngressHandle()})
+				return b.FilterAdd(&TcFilter{Dev: "eth0", Parent: tcIngressHandle(), Prio: 1, IPProto: unix.IPPROTO_UDP, SrcPort: 5000, RedirectDev: "netops-ifb"})
+			},
+			"tc filter add dev eth0 protocol ip parent ffff: prio 1 flower ip_proto udp src_port 5000 action mirred egress redirect dev netops-ifb failed: no such device",
+		},
+		{
+			"Deleting a qdisc of another kind",
+			func(b *fakeTcBackend) error {
+				b.QdiscAdd(&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: root})
+				return b.QdiscDel(&TcQdisc{Dev: "eth0", Kind: tcKindIngress, Parent: netlink.HANDLE_ROOT})
+			},
+			"tc qdisc del dev eth0 root failed: no such file or directory",
+		},
+		{
+			"Deleting a missing IFB device",
+			func(b *fakeTcBackend) error {
+				return b.IfbDel(&TcIfb{Dev: "netops-ifb"})
+			},
+			"tc ifb del dev netops-ifb type ifb failed: no such file or directory",
+		},
+		{
+			"Deleting the root qdisc removes the tree",
+			func(b *fakeTcBackend) error {
+				b.QdiscAdd(&TcQdisc{Dev: "eth0", Kind: tcKindHtb, Parent: netlink.HANDLE_ROOT, Handle: root})
+				b.ClassAdd(&TcClass{Dev: "eth0", Parent: root, Handle: defaultClassHandle(0x11), Rate: 1000})
+				b.QdiscAdd(&TcQdisc{Dev: "eth0", Kind: tcKindSfq, Parent: defaultClassHandle(0x11), Handle: netlink.MakeHandle(0x11, 0)})
+				b.FilterAdd(&TcFilter{Dev: "eth0", Parent: root, Prio: 1, IPProto: unix.IPPROTO_UDP, DstPort: 5000, ClassId: defaultClassHandle(0x11)})
+				return b.QdiscDel(&TcQdisc{Dev: "eth0", Parent: netlink.HANDLE_ROOT})
+			},
+			"",
+		},
+	}
+	for _, tt := range testCases {
+		b := newFakeTcBackend()
+		err := tt.op(b)
+		expectErrStr(t, tt.testCase, err, tt.ErrStr)
+		if tt.ErrStr == "" {
+			expectTcTree(t, b, "eth0", []string{})
+		}
+	}
+}
@@ -0,0 +1,415 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+package server
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// The flower filters are encoded here rather than with the netlink package,
+// which can neither set the class of a flower filter nor encode the pedit
+// dsfield action used for the DSCP marking.
+
+const (
+	tcActPedit  = "pedit"
+	tcActCsum   = "csum"
+	tcActMirred = "mirred"
+)
+
+const (
+	// The dsfield is the second byte of the first word of the IPv4 header.
+	// The mask keeps everything but the DSCP bits of the dsfield.
+	dsfieldKeyMask = 0xff03ffff
+	dsfieldShift   = 16
+	// The traffic class of IPv6 follows the 4 bit version in the first word
+	// of the header.
+	trafficClassKeyMask = 0xf03fffff
+	trafficClassShift   = 20
+)
+
+// toNetworkOrder returns the value to store for the kernel to read v in
+// network order.
+func toNetworkOrder(v uint32) uint32 {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	return nl.NativeEndian().Uint32(b[:])
+}
+
+func fromNetworkOrder(v uint32) uint32 {
+	var b [4]byte
+	nl.NativeEndian().PutUint32(b[:], v)
+	return binary.BigEndian.Uint32(b[:])
+}
+
+func htons(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+// ethProtocol returns the ethernet protocol of the traffic matched by the
+// filter.
+func ethProtocol(f *TcFilter) uint16 {
+	if f.ipv6() {
+		return unix.ETH_P_IPV6
+	}
+	return unix.ETH_P_IP
+}
+
+// dsfieldPedit returns the pedit action rewriting the DSCP of the packets
+// matched by the filter.
+func dsfieldPedit(f *TcFilter) *nl.TcPedit {
+	key := nl.TcPeditKey{
+		Mask: toNetworkOrder(dsfieldKeyMask),
+		Val:  toNetworkOrder(uint32(f.Dscp<<2) << dsfieldShift),
+	}
+	keyEx := nl.TcPeditKeyEx{
+		HeaderType: nl.TCA_PEDIT_KEY_EX_HDR_TYPE_IP4,
+		Cmd:        nl.TCA_PEDIT_KEY_EX_CMD_SET,
+	}
+	if f.ipv6() {
+		key.Mask = toNetworkOrder(trafficClassKeyMask)
+		key.Val = toNetworkOrder(uint32(f.Dscp<<2) << trafficClassShift)
+		keyEx.HeaderType = nl.TCA_PEDIT_KEY_EX_HDR_TYPE_IP6
+	}
+	pedit := &nl.TcPedit{}
+	pedit.Sel.Action = int32(netlink.TC_ACT_PIPE)
+	pedit.Keys = append(pedit.Keys, key)
+	pedit.KeysEx = append(pedit.KeysEx, keyEx)
+	pedit.Sel.NKeys = 1
+	return pedit
+}
+
+// iphCsum returns the csum action updating the IPv4 header checksum after
+// the dsfield was rewritten. IPv6 has no header checksum.
+func iphCsum() *nl.TcCsum {
+	csum := &nl.TcCsum{UpdateFlags: uint32(netlink.TCA_CSUM_UPDATE_FLAG_IPV4HDR)}
+	csum.Action = int32(netlink.TC_ACT_PIPE)
+	return csum
+}
+
+// mirredRedirect returns the mirred action redirecting the packets to the
+// egress of the device.
+func mirredRedirect(index int) *nl.TcMirred {
+	mirred := &nl.TcMirred{
+		Eaction: int32(netlink.TCA_EGRESS_REDIR),
+		Ifindex: uint32(index),
+	}
+	mirred.Action = int32(netlink.TC_ACT_STOLEN)
+	return mirred
+}
+
+// flowerPortKeys returns the attributes matching the source and destination
+// ports of the L4 protocol.
+func flowerPortKeys(proto uint8) (int, int) {
+	if proto == unix.IPPROTO_TCP {
+		return nl.TCA_FLOWER_KEY_TCP_SRC, nl.TCA_FLOWER_KEY_TCP_DST
+	}
+	return nl.TCA_FLOWER_KEY_UDP_SRC, nl.TCA_FLOWER_KEY_UDP_DST
+}
+
+// flowerIPKeys returns the attributes matching the source and destination
+// addresses of the family, followed by their masks.
+func flowerIPKeys(f *TcFilter) (int, int, int, int) {
+	if f.ipv6() {
+		return nl.TCA_FLOWER_KEY_IPV6_SRC, nl.TCA_FLOWER_KEY_IPV6_SRC_MASK,
+			nl.TCA_FLOWER_KEY_IPV6_DST, nl.TCA_FLOWER_KEY_IPV6_DST_MASK
+	}
+	return nl.TCA_FLOWER_KEY_IPV4_SRC, nl.TCA_FLOWER_KEY_IPV4_SRC_MASK,
+		nl.TCA_FLOWER_KEY_IPV4_DST, nl.TCA_FLOWER_KEY_IPV4_DST_MASK
+}
+
+// flowerIP returns the address in the length of the family.
+func flowerIP(f *TcFilter, ip net.IP) net.IP {
+	if f.ipv6() {
+		return ip.To16()
+	}
+	return ip.To4()
+}
+
+func flowerFilterRequest(proto int, flags int, index int, f *TcFilter) (*nl.NetlinkRequest, error) {
+	redirectIndex := 0
+	if f.RedirectDev != "" {
+		var err error
+		redirectIndex, err = linkIndex(f.RedirectDev)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req := nl.NewNetlinkRequest(proto, flags|unix.NLM_F_ACK)
+	req.AddData(&nl.TcMsg{
+		Family:  nl.FAMILY_ALL,
+		Ifindex: int32(index),
+		Handle:  f.Handle,
+		Parent:  f.Parent,
+		Info:    netlink.MakeHandle(f.Prio, nl.Swap16(ethProtocol(f))),
+	})
+	req.AddData(nl.NewRtAttr(nl.TCA_KIND, nl.ZeroTerminated(tcKindFlower)))
+
+	options := nl.NewRtAttr(nl.TCA_OPTIONS, nil)
+	if f.ClassId != 0 {
+		options.AddRtAttr(nl.TCA_FLOWER_CLASSID, nl.Uint32Attr(f.ClassId))
+	}
+	// The kernel only parses the keys of the L3 and L4 protocols matched.
+	options.AddRtAttr(nl.TCA_FLOWER_KEY_ETH_TYPE, htons(ethProtocol(f)))
+	if f.IPProto != 0 {
+		options.AddRtAttr(nl.TCA_FLOWER_KEY_IP_PROTO, []byte{f.IPProto})
+	}
+	srcKey, srcMaskKey, dstKey, dstMaskKey := flowerIPKeys(f)
+	if f.SrcIP != nil {
+		options.AddRtAttr(srcKey, flowerIP(f, f.SrcIP.IP))
+		options.AddRtAttr(srcMaskKey, []byte(f.SrcIP.Mask))
+	}
+	if f.DstIP != nil {
+		options.AddRtAttr(dstKey, flowerIP(f, f.DstIP.IP))
+		options.AddRtAttr(dstMaskKey, []byte(f.DstIP.Mask))
+	}
+	srcPortKey, dstPortKey := flowerPortKeys(f.IPProto)
+	if f.SrcPort != 0 {
+		options.AddRtAttr(srcPortKey, htons(f.SrcPort))
+	}
+	if f.DstPort != 0 {
+		options.AddRtAttr(dstPortKey, htons(f.DstPort))
+	}
+	if actions := flowerActions(f, redirectIndex); actions != nil {
+		options.AddChild(actions)
+	}
+	req.AddData(options)
+	return req, nil
+}
+
+// flowerActions returns the actions of the filter, nil when it has none.
+func flowerActions(f *TcFilter, redirectIndex int) *nl.RtAttr {
+	if !f.MarkDscp && f.RedirectDev == "" {
+		return nil
+	}
+	// The actions are run in the order of their table.
+	actions := nl.NewRtAttr(nl.TCA_FLOWER_ACT, nil)
+	table := nl.TCA_ACT_TAB
+	if f.MarkDscp {
+		dsfieldPedit(f).Encode(actions.AddRtAttr(table, nil))
+		table++
+		if !f.ipv6() {
+			action := actions.AddRtAttr(table, nil)
+			action.AddRtAttr(nl.TCA_ACT_KIND, nl.ZeroTerminated(tcActCsum))
+			actOpts := action.AddRtAttr(nl.TCA_ACT_OPTIONS, nil)
+			actOpts.AddRtAttr(nl.TCA_CSUM_PARMS, iphCsum().Serialize())
+			table++
+		}
+	}
+	if f.RedirectDev != "" {
+		action := actions.AddRtAttr(table, nil)
+		action.AddRtAttr(nl.TCA_ACT_KIND, nl.ZeroTerminated(tcActMirred))
+		actOpts := action.AddRtAttr(nl.TCA_ACT_OPTIONS, nil)
+		actOpts.AddRtAttr(nl.TCA_MIRRED_PARMS, mirredRedirect(redirectIndex).Serialize())
+	}
+	return actions
+}
+
+// listFlowerFilters returns the flower filters under the parent.
+func listFlowerFilters(dev string, index int, parent uint32) ([]*TcFilter, error) {
+	req := nl.NewNetlinkRequest(unix.RTM_GETTFILTER, unix.NLM_F_DUMP)
+	req.AddData(&nl.TcMsg{
+		Family:  nl.FAMILY_ALL,
+		Ifindex: int32(index),
+		Parent:  parent,
+	})
+	msgs, err := req.Execute(unix.NETLINK_ROUTE, unix.RTM_NEWTFILTER)
+	if err != nil {
+		return nil, err
+	}
+
+	var filters []*TcFilter
+	for _, m := range msgs {
+		msg := nl.DeserializeTcMsg(m)
+		attrs, err := nl.ParseRouteAttr(m[msg.Len():])
+		if err != nil {
+			return nil, err
+		}
+		f := &TcFilter{Dev: dev, Parent: msg.Parent, Handle: msg.Handle, Family: netlink.FAMILY_V4}
+		prio, protocol := netlink.MajorMinor(msg.Info)
+		f.Prio = prio
+		if protocol == nl.Swap16(unix.ETH_P_IPV6) {
+			f.Family = netlink.FAMILY_V6
+		}
+		kind := ""
+		var options []syscall.NetlinkRouteAttr
+		for _, attr := range attrs {
+			switch attr.Attr.Type {
+			case nl.TCA_KIND:
+				kind = string(attr.Value[:len(attr.Value)-1])
+			case nl.TCA_OPTIONS:
+				options, err = nl.ParseRouteAttr(attr.Value)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		// Skip the entries of the filter chains, they carry no filter.
+		if kind != tcKindFlower || f.Handle == 0 {
+			continue
+		}
+		err = parseFlowerOptions(f, options)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+func parseFlowerOptions(f *TcFilter, options []syscall.NetlinkRouteAttr) error {
+	var srcIP, dstIP net.IP
+	var srcMask, dstMask net.IPMask
+	for _, option := range options {
+		switch option.Attr.Type {
+		case nl.TCA_FLOWER_CLASSID:
+			f.ClassId = nl.NativeEndian().Uint32(option.Value)
+		case nl.TCA_FLOWER_KEY_IP_PROTO:
+			f.IPProto = option.Value[0]
+		case nl.TCA_FLOWER_KEY_IPV4_SRC, nl.TCA_FLOWER_KEY_IPV6_SRC:
+			srcIP = net.IP(option.Value)
+		case nl.TCA_FLOWER_KEY_IPV4_SRC_MASK, nl.TCA_FLOWER_KEY_IPV6_SRC_MASK:
+			srcMask = net.IPMask(option.Value)
+		case nl.TCA_FLOWER_KEY_IPV4_DST, nl.TCA_FLOWER_KEY_IPV6_DST:
+			dstIP = net.IP(option.Value)
+		case nl.TCA_FLOWER_KEY_IPV4_DST_MASK, nl.TCA_FLOWER_KEY_IPV6_DST_MASK:
+			dstMask = net.IPMask(option.Value)
+		case nl.TCA_FLOWER_KEY_UDP_SRC, nl.TCA_FLOWER_KEY_TCP_SRC:
+			f.SrcPort = binary.BigEndian.Uint16(option.Value)
+		case nl.TCA_FLOWER_KEY_UDP_DST, nl.TCA_FLOWER_KEY_TCP_DST:
+			f.DstPort = binary.BigEndian.Uint16(option.Value)
+		case nl.TCA_FLOWER_ACT:
+			err := parseFlowerActions(f, option.Value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if srcIP != nil {
+		f.SrcIP = &net.IPNet{IP: srcIP, Mask: srcMask}
+	}
+	if dstIP != nil {
+		f.DstIP = &net.IPNet{IP: dstIP, Mask: dstMask}
+	}
+	return nil
+}
+
+// parseFlowerActions looks for the pedit dsfield and the mirred redirect
+// actions in the actions of a filter.
+func parseFlowerActions(f *TcFilter, value []byte) error {
+	tables, err := nl.ParseRouteAttr(value)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		attrs, err := nl.ParseRouteAttr(table.Value)
+		if err != nil {
+			return err
+		}
+		kind := ""
+		for _, attr := range attrs {
+			switch attr.Attr.Type {
+			case nl.TCA_ACT_KIND:
+				kind = string(attr.Value[:len(attr.Value)-1])
+			case nl.TCA_ACT_OPTIONS:
+				options, err := nl.ParseRouteAttr(attr.Value)
+				if err != nil {
+					return err
+				}
+				switch kind {
+				case tcActPedit:
+					parseDsfieldPedit(f, options)
+				case tcActMirred:
+					err = parseMirredRedirect(f, options)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseDsfieldPedit sets the DSCP of the filter from the pedit dsfield
+// action.
+func parseDsfieldPedit(f *TcFilter, options []syscall.NetlinkRouteAttr) {
+	for _, option := range options {
+		if option.Attr.Type != nl.TCA_PEDIT_PARMS_EX && option.Attr.Type != nl.TCA_PEDIT_PARMS {
+			continue
+		}
+		_, keys := nl.DeserializeTcPedit(option.Value)
+		for _, key := range keys {
+			if key.Off != 0 {
+				continue
+			}
+			switch fromNetworkOrder(key.Mask) {
+			case dsfieldKeyMask:
+				f.MarkDscp, f.Dscp = true, uint8(fromNetworkOrder(key.Val)>>dsfieldShift)>>2
+			case trafficClassKeyMask:
+				f.MarkDscp, f.Dscp = true, uint8(fromNetworkOrder(key.Val)>>trafficClassShift)>>2
+			}
+		}
+	}
+}
+
+// parseMirredRedirect sets the device the filter redirects to from the
+// mirred action.
+func parseMirredRedirect(f *TcFilter, options []syscall.NetlinkRouteAttr) error {
+	for _, option := range options {
+		if option.Attr.Type != nl.TCA_MIRRED_PARMS {
+			continue
+		}
+		mirred := nl.DeserializeTcMirred(option.Value)
+		if mirred.Eaction != int32(netlink.TCA_EGRESS_REDIR) {
+			continue
+		}
+		link, err := netlink.LinkByIndex(int(mirred.Ifindex))
+		if err != nil {
+			return err
+		}
+		f.RedirectDev = link.Attrs().Name
+	}
+	return nil
+}
+
+// findFlowerFilter returns the filter with the same parent, prio and match as
+// f, or nil when there is none.
+func findFlowerFilter(f *TcFilter) (*TcFilter, error) {
+	index, err := linkIndex(f.Dev)
+	if err != nil {
+		return nil, err
+	}
+	filters, err := listFlowerFilters(f.Dev, index, f.Parent)
+	if err != nil {
+		return nil, err
+	}
+	for _, filter := range filters {
+		if filter.Prio == f.Prio && filter.sameMatch(f) {
+			return filter, nil
+		}
+	}
+	return nil, nil
+}
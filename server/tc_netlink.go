@@ -0,0 +1,366 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"errors"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// netlinkTcBackend programs tc over rtnetlink, without forking the tc binary.
+type netlinkTcBackend struct{}
+
+func linkIndex(dev string) (int, error) {
+	link, err := netlink.LinkByName(dev)
+	if err != nil {
+		return 0, err
+	}
+	return link.Attrs().Index, nil
+}
+
+func toNetlinkQdisc(q *TcQdisc, index int) netlink.Qdisc {
+	attrs := netlink.QdiscAttrs{
+		LinkIndex: index,
+		Handle:    q.Handle,
+		Parent:    q.Parent,
+	}
+	switch q.Kind {
+	case tcKindHtb:
+		htb := netlink.NewHtb(attrs)
+		htb.Defcls = q.DefaultClass
+		return htb
+	case tcKindSfq:
+		return &netlink.Sfq{QdiscAttrs: attrs, Perturb: q.Perturb}
+	case tcKindIngress:
+		return &netlink.Ingress{QdiscAttrs: attrs}
+	case tcKindTbf:
+		// The kernel takes the bucket size as the time needed to fill it, and
+		// the latency as the number of bytes that can queue up meanwhile.
+		rate := q.Rate * 1000 / 8
+		return &netlink.Tbf{
+			QdiscAttrs: attrs,
+			Rate:       rate,
+			Buffer:     netlink.Xmittime(rate, q.Burst),
+			Limit:      uint32(rate*uint64(q.Latency)/1000) + q.Burst,
+		}
+	}
+	return &netlink.GenericQdisc{QdiscAttrs: attrs, QdiscType: q.Kind}
+}
+
+func toNetlinkClass(c *TcClass, index int) netlink.Class {
+	return netlink.NewHtbClass(
+		netlink.ClassAttrs{
+			LinkIndex: index,
+			Handle:    c.Handle,
+			Parent:    c.Parent,
+		},
+		netlink.HtbClassAttrs{
+			Rate:   c.Rate * 1000,
+			Ceil:   c.Ceil * 1000,
+			Buffer: c.Burst,
+			Prio:   c.Prio,
+		},
+	)
+}
+
+func (b *netlinkTcBackend) QdiscAdd(q *TcQdisc) error {
+	index, err := linkIndex(q.Dev)
+	if err == nil {
+		err = netlink.QdiscAdd(toNetlinkQdisc(q, index))
+	}
+	if err != nil {
+		return &TcError{Op: "qdisc add", Obj: q, Err: err}
+	}
+	return nil
+}
+
+func (b *netlinkTcBackend) QdiscReplace(q *TcQdisc) error {
+	index, err := linkIndex(q.Dev)
+	if err == nil {
+		err = netlink.QdiscReplace(toNetlinkQdisc(q, index))
+	}
+	if err != nil {
+		return &TcError{Op: "qdisc replace", Obj: q, Err: err}
+	}
+	return nil
+}
+
+func (b *netlinkTcBackend) QdiscDel(q *TcQdisc) error {
+	link, err := netlink.LinkByName(q.Dev)
+	if err != nil {
+		return &TcError{Op: "qdisc del", Obj: q, Err: err}
+	}
+	// The kernel wants the kind of the qdisc being deleted, look it up so that
+	// callers can delete whatever is attached at the parent.
+	qdiscs, err := netlink.QdiscList(link)
+	if err != nil {
+		return &TcError{Op: "qdisc del", Obj: q, Err: err}
+	}
+	for _, qdisc := range qdiscs {
+		attrs := qdisc.Attrs()
+		if attrs.Parent != q.Parent || (q.Handle != 0 && attrs.Handle != q.Handle) {
+			continue
+		}
+		if attrs.Handle == 0 || (q.Kind != "" && qdisc.Type() != q.Kind) {
+			// Default qdisc installed by the kernel, or a qdisc of
+			// another kind, nothing to delete.
+			break
+		}
+		err = netlink.QdiscDel(qdisc)
+		if err != nil {
+			return &TcError{Op: "qdisc del", Obj: q, Err: err}
+		}
+		return nil
+	}
+	return &TcError{Op: "qdisc del", Obj: q, Err: syscall.ENOENT}
+}
+
+func (b *netlinkTcBackend) ClassAdd(c *TcClass) error {
+	index, err := linkIndex(c.Dev)
+	if err == nil {
+		err = netlink.ClassAdd(toNetlinkClass(c, index))
+	}
+	if err != nil {
+		return &TcError{Op: "class add", Obj: c, Err: err}
+	}
+	return nil
+}
+
+func (b *netlinkTcBackend) ClassReplace(c *TcClass) error {
+	index, err := linkIndex(c.Dev)
+	if err == nil {
+		err = netlink.ClassReplace(toNetlinkClass(c, index))
+	}
+	if err != nil {
+		return &TcError{Op: "class replace", Obj: c, Err: err}
+	}
+	return nil
+}
+
+func (b *netlinkTcBackend) ClassDel(c *TcClass) error {
+	index, err := linkIndex(c.Dev)
+	if err == nil {
+		err = netlink.ClassDel(toNetlinkClass(c, index))
+	}
+	if err != nil {
+		return &TcError{Op: "class del", Obj: c, Err: err}
+	}
+	return nil
+}
+
+func (b *netlinkTcBackend) FilterAdd(f *TcFilter) error {
+	index, err := linkIndex(f.Dev)
+	if err == nil {
+		err = executeFlowerRequest(unix.RTM_NEWTFILTER, unix.NLM_F_CREATE|unix.NLM_F_EXCL, index, f)
+	}
+	if err != nil {
+		return &TcError{Op: "filter add", Obj: f, Err: err}
+	}
+	return nil
+}
+
+// FilterReplace changes the filter with the same match in place, keeping
+// its handle.
+func (b *netlinkTcBackend) FilterReplace(f *TcFilter) error {
+	old, err := findFlowerFilter(f)
+	if err != nil {
+		return &TcError{Op: "filter replace", Obj: f, Err: err}
+	}
+	if old == nil {
+		return b.FilterAdd(f)
+	}
+	index, err := linkIndex(f.Dev)
+	if err == nil {
+		replaced := *f
+		replaced.Handle = old.Handle
+		err = executeFlowerRequest(unix.RTM_NEWTFILTER, unix.NLM_F_CREATE, index, &replaced)
+	}
+	if err != nil {
+		return &TcError{Op: "filter replace", Obj: f, Err: err}
+	}
+	return nil
+}
+
+func (b *netlinkTcBackend) FilterDel(f *TcFilter) error {
+	index, err := linkIndex(f.Dev)
+	if err == nil {
+		if f.Prio == 0 {
+			err = flushFilters(index, f.Parent)
+		} else {
+			err = executeFlowerRequest(unix.RTM_DELTFILTER, 0, index, f)
+		}
+	}
+	if err != nil {
+		return &TcError{Op: "filter del", Obj: f, Err: err}
+	}
+	return nil
+}
+
+func executeFlowerRequest(proto int, flags int, index int, f *TcFilter) error {
+	req, err := flowerFilterRequest(proto, flags, index, f)
+	if err != nil {
+		return err
+	}
+	_, err = req.Execute(unix.NETLINK_ROUTE, 0)
+	return err
+}
+
+// flushFilters deletes all the filters under the parent. The kernel only
+// flushes when the request carries neither a kind nor a protocol, which the
+// netlink package always sets, hence the request is built here.
+func flushFilters(index int, parent uint32) error {
+	req := nl.NewNetlinkRequest(unix.RTM_DELTFILTER, unix.NLM_F_ACK)
+	req.AddData(&nl.TcMsg{
+		Family:  nl.FAMILY_ALL,
+		Ifindex: int32(index),
+		Parent:  parent,
+	})
+	_, err := req.Execute(unix.NETLINK_ROUTE, 0)
+	return err
+}
+
+func (b *netlinkTcBackend) IfbAdd(ifb *TcIfb) error {
+	link := &netlink.Ifb{LinkAttrs: netlink.LinkAttrs{Name: ifb.Dev}}
+	err := netlink.LinkAdd(link)
+	if err != nil && !errors.Is(err, syscall.EEXIST) {
+		return &TcError{Op: "ifb add", Obj: ifb, Err: err}
+	}
+	err = netlink.LinkSetUp(link)
+	if err != nil {
+		return &TcError{Op: "ifb add", Obj: ifb, Err: err}
+	}
+	return nil
+}
+
+func (b *netlinkTcBackend) IfbDel(ifb *TcIfb) error {
+	link, err := netlink.LinkByName(ifb.Dev)
+	if _, ok := err.(netlink.LinkNotFoundError); ok {
+		return &TcError{Op: "ifb del", Obj: ifb, Err: syscall.ENOENT}
+	}
+	if err == nil && link.Type() != "ifb" {
+		// Never delete a device netops did not create.
+		err = syscall.EINVAL
+	}
+	if err == nil {
+		err = netlink.LinkDel(link)
+	}
+	if err != nil {
+		return &TcError{Op: "ifb del", Obj: ifb, Err: err}
+	}
+	return nil
+}
+
+func (b *netlinkTcBackend) Dump(dev string) (*TcTree, error) {
+	link, err := netlink.LinkByName(dev)
+	if err != nil {
+		return nil, err
+	}
+	tree := &TcTree{}
+	qdiscs, err := netlink.QdiscList(link)
+	if err != nil {
+		return nil, err
+	}
+	for _, qdisc := range qdiscs {
+		tree.Qdiscs = append(tree.Qdiscs, fromNetlinkQdisc(dev, qdisc))
+	}
+	classes, err := netlink.ClassList(link, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, class := range classes {
+		if htb, ok := class.(*netlink.HtbClass); ok {
+			tree.Classes = append(tree.Classes, fromNetlinkClass(dev, htb))
+		}
+	}
+	for _, qdisc := range tree.Qdiscs {
+		if qdisc.Handle == 0 {
+			continue
+		}
+		filters, err := listFlowerFilters(dev, link.Attrs().Index, qdisc.Handle)
+		if err != nil {
+			return nil, err
+		}
+		tree.Filters = append(tree.Filters, filters...)
+	}
+	return tree, nil
+}
+
+func fromNetlinkQdisc(dev string, qdisc netlink.Qdisc) *TcQdisc {
+	attrs := qdisc.Attrs()
+	q := &TcQdisc{
+		Dev:    dev,
+		Kind:   qdisc.Type(),
+		Handle: attrs.Handle,
+		Parent: attrs.Parent,
+		Stats:  fromNetlinkStats((*netlink.ClassStatistics)(attrs.Statistics)),
+	}
+	switch qdisc := qdisc.(type) {
+	case *netlink.Htb:
+		q.DefaultClass = qdisc.Defcls
+	case *netlink.Sfq:
+		q.Perturb = qdisc.Perturb
+	case *netlink.Tbf:
+		q.Rate = qdisc.Rate * 8 / 1000
+		q.Burst = netlink.Xmitsize(qdisc.Rate, qdisc.Buffer)
+		if qdisc.Rate != 0 && qdisc.Limit > q.Burst {
+			q.Latency = uint32(uint64(qdisc.Limit-q.Burst) * 1000 / qdisc.Rate)
+		}
+	}
+	return q
+}
+
+func fromNetlinkClass(dev string, htb *netlink.HtbClass) *TcClass {
+	// The kernel reports the rates in bytes/s and the burst as the time
+	// needed to send it at the rate.
+	parent := htb.Parent
+	if parent == netlink.HANDLE_ROOT {
+		// Classes attached to the qdisc are reported under the root.
+		parent = htb.Handle & 0xffff0000
+	}
+	return &TcClass{
+		Dev:    dev,
+		Handle: htb.Handle,
+		Parent: parent,
+		Rate:   htb.Rate * 8 / 1000,
+		Ceil:   htb.Ceil * 8 / 1000,
+		Burst:  netlink.Xmitsize(htb.Rate, htb.Buffer),
+		Prio:   htb.Prio,
+		Stats:  fromNetlinkStats(htb.Statistics),
+	}
+}
+
+func fromNetlinkStats(stats *netlink.ClassStatistics) *TcStats {
+	if stats == nil {
+		return nil
+	}
+	tcStats := &TcStats{}
+	if stats.Basic != nil {
+		tcStats.Bytes = stats.Basic.Bytes
+		tcStats.Packets = uint64(stats.Basic.Packets)
+	}
+	if stats.Queue != nil {
+		tcStats.Drops = stats.Queue.Drops
+		tcStats.Overlimits = stats.Queue.Overlimits
+		tcStats.Backlog = stats.Queue.Backlog
+	}
+	return tcStats
+}
@@ -0,0 +1,125 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kubeslice/netops/logger"
+)
+
+// shellTcBackend programs tc by running the tc binary. It is kept as a
+// fallback for nodes where the netlink backend cannot be used.
+type shellTcBackend struct {
+	// Runs the tc command, runCommand when not set
+	runCmd func(cmdString string) (string, error)
+}
+
+func (b *shellTcBackend) run(op string, obj fmt.Stringer, args string) error {
+	tcCmd := fmt.Sprintf("tc %s %s", op, args)
+	runCmd := b.runCmd
+	if runCmd == nil {
+		runCmd = runCommand
+	}
+	cmdOut, err := runCmd(tcCmd)
+	if err != nil {
+		return &TcError{Op: op, Obj: obj, Err: shellTcErr(err, cmdOut)}
+	}
+	logger.GlobalLogger.Infof(tcCmdOut(tcCmd, cmdOut))
+	return nil
+}
+
+// shellTcErr returns the error of a failed tc command. The messages tc prints
+// for an object already present or missing are mapped onto the netops tc
+// errors, the other failures are returned with the output of tc.
+func shellTcErr(err error, cmdOut string) error {
+	cmdOut = strings.TrimSpace(cmdOut)
+	switch {
+	case strings.Contains(cmdOut, "File exists"):
+		return fmt.Errorf("%w: %v", ErrTcObjectExists, cmdOut)
+	case strings.Contains(cmdOut, "No such file or directory"), strings.Contains(cmdOut, "Cannot find"):
+		return fmt.Errorf("%w: %v", ErrTcObjectNotFound, cmdOut)
+	}
+	if cmdOut == "" {
+		return err
+	}
+	return fmt.Errorf("%v: %v", err, cmdOut)
+}
+
+func (b *shellTcBackend) QdiscAdd(q *TcQdisc) error {
+	return b.run("qdisc add", q, q.String())
+}
+
+func (b *shellTcBackend) QdiscReplace(q *TcQdisc) error {
+	return b.run("qdisc replace", q, q.String())
+}
+
+func (b *shellTcBackend) QdiscDel(q *TcQdisc) error {
+	return b.run("qdisc delete", q, q.selector())
+}
+
+func (b *shellTcBackend) ClassAdd(c *TcClass) error {
+	return b.run("class add", c, c.String())
+}
+
+func (b *shellTcBackend) ClassReplace(c *TcClass) error {
+	return b.run("class replace", c, c.String())
+}
+
+func (b *shellTcBackend) ClassDel(c *TcClass) error {
+	return b.run("class delete", c, c.selector())
+}
+
+func (b *shellTcBackend) FilterAdd(f *TcFilter) error {
+	return b.run("filter add", f, f.String())
+}
+
+// FilterReplace changes the filter with the same match in place. The handle
+// of the filter is looked up over netlink.
+func (b *shellTcBackend) FilterReplace(f *TcFilter) error {
+	old, err := findFlowerFilter(f)
+	if err != nil {
+		return &TcError{Op: "filter replace", Obj: f, Err: err}
+	}
+	if old == nil {
+		return b.run("filter add", f, f.String())
+	}
+	replaced := *f
+	replaced.Handle = old.Handle
+	return b.run("filter replace", f, replaced.String())
+}
+
+func (b *shellTcBackend) FilterDel(f *TcFilter) error {
+	return b.run("filter delete", f, f.selector())
+}
+
+// IfbAdd and IfbDel manage the device over netlink, it is not a tc object.
+func (b *shellTcBackend) IfbAdd(ifb *TcIfb) error {
+	return (&netlinkTcBackend{}).IfbAdd(ifb)
+}
+
+func (b *shellTcBackend) IfbDel(ifb *TcIfb) error {
+	return (&netlinkTcBackend{}).IfbDel(ifb)
+}
+
+// Dump reads the tc config over netlink, parsing the tc output is not worth
+// the trouble.
+func (b *shellTcBackend) Dump(dev string) (*TcTree, error) {
+	return (&netlinkTcBackend{}).Dump(dev)
+}
@@ -0,0 +1,439 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kubeslice/netops/logger"
+)
+
+// tcUndo undoes a change of the tc config.
+type tcUndo struct {
+	// The change undone, for the logs
+	change string
+	undo   func() error
+}
+
+// tcTxn is a TcBackend recording how to undo the changes made through it, so
+// that a change of the slices spanning several tc objects can be rolled back
+// when one of them fails.
+//
+// The objects replaced or deleted are looked up before the change and put
+// back on rollback. A filter without a handle and a prio cannot be deleted on
+// its own, so the filters under its parent are restored as a whole: they are
+// flushed and the ones found before the first such change are added again.
+type tcTxn struct {
+	TcBackend
+	undos []tcUndo
+	// Parents whose filters are restored on rollback, keyed by device
+	filterParents map[string]map[uint32]bool
+}
+
+func newTcTxn(tc TcBackend) *tcTxn {
+	return &tcTxn{TcBackend: tc, filterParents: make(map[string]map[uint32]bool)}
+}
+
+func (t *tcTxn) push(change string, undo func() error) {
+	t.undos = append(t.undos, tcUndo{change: change, undo: undo})
+}
+
+// qdiscAt returns the qdisc attached at the parent on the device, or nil.
+func (t *tcTxn) qdiscAt(dev string, parent uint32) (*TcQdisc, error) {
+	tree, err := t.TcBackend.Dump(dev)
+	if err != nil {
+		return nil, err
+	}
+	for _, qdisc := range tree.Qdiscs {
+		if qdisc.Parent == parent {
+			return qdisc, nil
+		}
+	}
+	return nil, nil
+}
+
+// classAt returns the class with the handle on the device, or nil.
+func (t *tcTxn) classAt(dev string, handle uint32) (*TcClass, error) {
+	tree, err := t.TcBackend.Dump(dev)
+	if err != nil {
+		return nil, err
+	}
+	return classByHandle(tree, handle), nil
+}
+
+func (t *tcTxn) QdiscAdd(q *TcQdisc) error {
+	err := t.TcBackend.QdiscAdd(q)
+	if err == nil {
+		t.push("qdisc add "+q.String(), func() error {
+			return t.TcBackend.QdiscDel(&TcQdisc{Dev: q.Dev, Kind: q.Kind, Parent: q.Parent})
+		})
+	}
+	return err
+}
+
+func (t *tcTxn) QdiscReplace(q *TcQdisc) error {
+	old, err := t.qdiscAt(q.Dev, q.Parent)
+	if err != nil {
+		return err
+	}
+	err = t.TcBackend.QdiscReplace(q)
+	if err != nil {
+		return err
+	}
+	t.push("qdisc replace "+q.String(), func() error {
+		switch {
+		case old == nil || old.Handle == 0:
+			// The kernel attaches its default qdisc again.
+			return t.TcBackend.QdiscDel(&TcQdisc{Dev: q.Dev, Parent: q.Parent})
+		case old.Handle == q.Handle && old.Kind == q.Kind:
+			return t.TcBackend.QdiscReplace(old)
+		}
+		err := t.TcBackend.QdiscDel(&TcQdisc{Dev: q.Dev, Parent: q.Parent})
+		if err != nil {
+			return err
+		}
+		return t.TcBackend.QdiscAdd(old)
+	})
+	return nil
+}
+
+func (t *tcTxn) QdiscDel(q *TcQdisc) error {
+	old, err := t.qdiscAt(q.Dev, q.Parent)
+	if err != nil {
+		return err
+	}
+	err = t.TcBackend.QdiscDel(q)
+	if err == nil && old != nil && old.Handle != 0 {
+		t.push("qdisc del "+q.selector(), func() error {
+			return t.TcBackend.QdiscAdd(old)
+		})
+	}
+	return err
+}
+
+func (t *tcTxn) ClassAdd(c *TcClass) error {
+	err := t.TcBackend.ClassAdd(c)
+	if err == nil {
+		t.push("class add "+c.String(), func() error {
+			return t.TcBackend.ClassDel(c)
+		})
+	}
+	return err
+}
+
+func (t *tcTxn) ClassReplace(c *TcClass) error {
+	old, err := t.classAt(c.Dev, c.Handle)
+	if err != nil {
+		return err
+	}
+	err = t.TcBackend.ClassReplace(c)
+	if err == nil {
+		t.push("class replace "+c.String(), func() error {
+			if old == nil {
+				return t.TcBackend.ClassDel(c)
+			}
+			return t.TcBackend.ClassReplace(old)
+		})
+	}
+	return err
+}
+
+func (t *tcTxn) ClassDel(c *TcClass) error {
+	old, err := t.classAt(c.Dev, c.Handle)
+	if err != nil {
+		return err
+	}
+	err = t.TcBackend.ClassDel(c)
+	if err == nil && old != nil {
+		t.push("class del "+c.selector(), func() error {
+			return t.TcBackend.ClassAdd(old)
+		})
+	}
+	return err
+}
+
+// filterAt returns the filter with the prio and handle of the filter, or nil.
+func (t *tcTxn) filterAt(f *TcFilter) (*TcFilter, error) {
+	tree, err := t.TcBackend.Dump(f.Dev)
+	if err != nil {
+		return nil, err
+	}
+	for _, filter := range tree.Filters {
+		if filter.Parent == f.Parent && filter.Prio == f.Prio && filter.Handle == f.Handle {
+			return filter, nil
+		}
+	}
+	return nil, nil
+}
+
+// saveFilters records how to restore the filters under the parent of the
+// filter before the first change under the parent.
+func (t *tcTxn) saveFilters(f *TcFilter) error {
+	if t.filterParents[f.Dev][f.Parent] {
+		return nil
+	}
+	tree, err := t.TcBackend.Dump(f.Dev)
+	if err != nil {
+		return err
+	}
+	saved := []*TcFilter{}
+	for _, filter := range tree.Filters {
+		if filter.Parent == f.Parent {
+			saved = append(saved, filter)
+		}
+	}
+	if t.filterParents[f.Dev] == nil {
+		t.filterParents[f.Dev] = make(map[uint32]bool)
+	}
+	t.filterParents[f.Dev][f.Parent] = true
+	t.push(fmt.Sprintf("filter changes dev %s %s", f.Dev, tcParentStr(f.Parent)), func() error {
+		err := t.TcBackend.FilterDel(&TcFilter{Dev: f.Dev, Parent: f.Parent})
+		if err != nil {
+			return err
+		}
+		for _, filter := range saved {
+			err = t.TcBackend.FilterAdd(filter)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return nil
+}
+
+func (t *tcTxn) FilterAdd(f *TcFilter) error {
+	if f.Handle == 0 || f.Prio == 0 {
+		err := t.saveFilters(f)
+		if err != nil {
+			return err
+		}
+		return t.TcBackend.FilterAdd(f)
+	}
+	err := t.TcBackend.FilterAdd(f)
+	if err == nil {
+		t.push("filter add "+f.String(), func() error {
+			return t.TcBackend.FilterDel(f)
+		})
+	}
+	return err
+}
+
+func (t *tcTxn) FilterReplace(f *TcFilter) error {
+	if f.Handle == 0 || f.Prio == 0 {
+		err := t.saveFilters(f)
+		if err != nil {
+			return err
+		}
+		return t.TcBackend.FilterReplace(f)
+	}
+	old, err := t.filterAt(f)
+	if err != nil {
+		return err
+	}
+	err = t.TcBackend.FilterReplace(f)
+	if err == nil {
+		t.push("filter replace "+f.String(), func() error {
+			if old == nil {
+				return t.TcBackend.FilterDel(f)
+			}
+			return t.TcBackend.FilterReplace(old)
+		})
+	}
+	return err
+}
+
+func (t *tcTxn) FilterDel(f *TcFilter) error {
+	if f.Handle == 0 || f.Prio == 0 {
+		err := t.saveFilters(f)
+		if err != nil {
+			return err
+		}
+		return t.TcBackend.FilterDel(f)
+	}
+	old, err := t.filterAt(f)
+	if err != nil {
+		return err
+	}
+	err = t.TcBackend.FilterDel(f)
+	if err == nil && old != nil {
+		t.push("filter del "+f.selector(), func() error {
+			return t.TcBackend.FilterAdd(old)
+		})
+	}
+	return err
+}
+
+func (t *tcTxn) IfbAdd(ifb *TcIfb) error {
+	// The device is deleted on rollback unless the slices were shaped on it
+	// already.
+	tree, err := t.TcBackend.Dump(ifb.Dev)
+	existed := err == nil && rootQdisc(tree) != nil
+	err = t.TcBackend.IfbAdd(ifb)
+	if err == nil && !existed {
+		t.push("ifb add "+ifb.String(), func() error {
+			return t.TcBackend.IfbDel(ifb)
+		})
+	}
+	return err
+}
+
+// rollback undoes the changes, the last one first. It carries on past a
+// failed undo to put back as much as it can, and returns the first error.
+func (t *tcTxn) rollback() error {
+	var rollbackErr error
+	for i := len(t.undos) - 1; i >= 0; i-- {
+		err := t.undos[i].undo()
+		if err != nil && !errors.Is(err, ErrTcObjectNotFound) {
+			logger.GlobalLogger.Errorf("Failed to undo tc change: %v, err: %v", t.undos[i].change, err)
+			if rollbackErr == nil {
+				rollbackErr = err
+			}
+			continue
+		}
+		logger.GlobalLogger.Infof("Undid tc change: %v", t.undos[i].change)
+	}
+	t.undos = nil
+	return rollbackErr
+}
+
+// tcTxnError is returned when a transaction failed and was rolled back.
+type tcTxnError struct {
+	// Error of the failed step
+	err error
+	// Number of changes undone
+	undone int
+	// Error of the rollback
+	rollbackErr error
+}
+
+func (e *tcTxnError) Error() string {
+	if e.rollbackErr != nil {
+		return fmt.Sprintf("%v, rollback of %d tc changes failed: %v", e.err, e.undone, e.rollbackErr)
+	}
+	return fmt.Sprintf("%v, rolled back %d tc changes", e.err, e.undone)
+}
+
+func (e *tcTxnError) Unwrap() error {
+	return e.err
+}
+
+// sliceStateSnapshot is a copy of the slice state the rollback of a
+// transaction restores.
+type sliceStateSnapshot struct {
+	slices     map[string]*SliceInfo
+	classIds   *classIdAllocator
+	unclaimed  map[uint32]*TcInfo
+	netIfaces  []*IfaceInfo
+	pendingGws map[string]map[string]*pendingSliceGw
+}
+
+// snapshot returns a copy of the slice state. The QoS profiles, tc params and
+// pending slice gws are replaced rather than changed in place, they are shared
+// with the copy.
+func (m *sliceStateManager) snapshot() *sliceStateSnapshot {
+	snap := &sliceStateSnapshot{
+		slices:     make(map[string]*SliceInfo, len(m.slices)),
+		classIds:   m.classIds.copy(),
+		unclaimed:  make(map[uint32]*TcInfo, len(m.unclaimed)),
+		netIfaces:  make([]*IfaceInfo, 0, len(m.netIfaces)),
+		pendingGws: make(map[string]map[string]*pendingSliceGw, len(m.pendingGws)),
+	}
+	for sliceID, sliceInfo := range m.slices {
+		info := *sliceInfo
+		info.sliceGwInfo = make(map[string]*SliceGwInfo, len(sliceInfo.sliceGwInfo))
+		for gwID, gwInfo := range sliceInfo.sliceGwInfo {
+			gw := *gwInfo
+			if gwInfo.tcConfigured != nil {
+				gw.tcConfigured = make(map[int]bool, len(gwInfo.tcConfigured))
+				for family, configured := range gwInfo.tcConfigured {
+					gw.tcConfigured[family] = configured
+				}
+			}
+			if gwInfo.tcFilterHandles != nil {
+				gw.tcFilterHandles = make(map[int][]uint32, len(gwInfo.tcFilterHandles))
+				for family, handles := range gwInfo.tcFilterHandles {
+					gw.tcFilterHandles[family] = append([]uint32{}, handles...)
+				}
+			}
+			info.sliceGwInfo[gwID] = &gw
+		}
+		snap.slices[sliceID] = &info
+	}
+	for id, tc := range m.unclaimed {
+		snap.unclaimed[id] = tc
+	}
+	for _, iface := range m.netIfaces {
+		info := *iface
+		snap.netIfaces = append(snap.netIfaces, &info)
+	}
+	for sliceID, gws := range m.pendingGws {
+		snap.pendingGws[sliceID] = make(map[string]*pendingSliceGw, len(gws))
+		for gwID, pending := range gws {
+			snap.pendingGws[sliceID][gwID] = pending
+		}
+	}
+	return snap
+}
+
+// restore puts back the slice state of the snapshot.
+func (m *sliceStateManager) restore(snap *sliceStateSnapshot) {
+	m.slices = snap.slices
+	m.classIds = snap.classIds
+	m.unclaimed = snap.unclaimed
+	m.netIfaces = snap.netIfaces
+	m.pendingGws = snap.pendingGws
+}
+
+// tcBackend returns the backend the tc changes of the slices go through: the
+// transaction in progress, if any, or the backend of NetOps. The caller holds
+// the state lock.
+func (s *NetOps) tcBackend() TcBackend {
+	if s.state.txn != nil {
+		return s.state.txn
+	}
+	return s.tc
+}
+
+// inTcTxn applies a change of the slices as a transaction: either all its tc
+// changes land and the slice state is kept, or the tc changes made are undone
+// and the slice state is put back as it was. The caller holds the state lock.
+func (s *NetOps) inTcTxn(change func() error) error {
+	snap := s.state.snapshot()
+	outer := s.state.txn
+	txn := newTcTxn(s.tcBackend())
+	s.state.txn = txn
+	err := func() error {
+		defer func() { s.state.txn = outer }()
+		return change()
+	}()
+	if err == nil {
+		return nil
+	}
+
+	undone := len(txn.undos)
+	rollbackErr := txn.rollback()
+	s.state.restore(snap)
+	if rollbackErr != nil {
+		logger.GlobalLogger.Errorf("Failed to roll back tc changes, err: %v", rollbackErr)
+	} else {
+		logger.GlobalLogger.Infof("Rolled back %d tc changes", undone)
+	}
+	return &tcTxnError{err: err, undone: undone, rollbackErr: rollbackErr}
+}
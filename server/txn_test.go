@@ -0,0 +1,230 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/kubeslice/netops/logger"
+	netops "github.com/kubeslice/netops/pkg/proto"
+)
+
+func TestSliceQosProfileRollback(t *testing.T) {
+	testCases := []struct {
+		Case string
+		// Configure slice-a and slice-b before the update
+		Slices bool
+		// The tc change failing
+		Fail    string
+		Context *netops.NetOpConnectionContext
+		Profile *netops.SliceQosProfile
+		ErrStr  string
+	}{
+		{
+			"Testing a new slice failing on its leaf qdisc",
+			true,
+			"qdisc add dev eth0 parent 17:34",
+			nil,
+			&netops.SliceQosProfile{SliceName: "slice-c", SliceId: "id-c", BwCeiling: 2000, BwGuaranteed: 1000, Priority: 2},
+			"rpc error: code = Internal desc = Failed to enforce QoS policy: tc qdisc add dev eth0 parent 17:34 handle 33: sfq perturb 10 failed: input/output error, rolled back 2 tc changes",
+		},
+		{
+			"Testing an update failing on the DSCP marking of the filters",
+			true,
+			"filter replace",
+			nil,
+			&netops.SliceQosProfile{SliceName: "slice-a", SliceId: "id-a", BwCeiling: 8000, BwGuaranteed: 2000, Priority: 1, DscpClass: "AF41"},
+			"rpc error: code = Internal desc = Failed to enforce QoS policy: tc filter replace dev eth0 protocol ip parent 17: prio 1 handle 0x110001 flower ip_proto udp src_port 30001 classid 17:12 action pedit ex munge ip dsfield set 0x88 retain 0xfc pipe action csum ip pipe failed: input/output error, rolled back 2 tc changes",
+		},
+		{
+			"Testing a slice moving to HTB mode failing on its sfq qdisc",
+			true,
+			"qdisc add dev eth0 parent 17:23",
+			nil,
+			&netops.SliceQosProfile{SliceName: "slice-b", SliceId: "id-b", BwCeiling: 3000, BwGuaranteed: 500, Priority: 0},
+			"rpc error: code = Internal desc = Failed to enforce QoS policy: tc qdisc add dev eth0 parent 17:23 handle 22: sfq perturb 10 failed: input/output error, rolled back 3 tc changes",
+		},
+		{
+			"Testing the filters of a new slice gw failing",
+			true,
+			"filter add dev eth0 protocol ipv6",
+			&netops.NetOpConnectionContext{
+				SliceId:                "id-a",
+				LocalSliceGwId:         "gw-b",
+				LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_SERVER,
+				LocalSliceGwNodePorts:  []string{"30005"},
+				RemoteSliceGwNodePorts: []string{"30006"},
+			},
+			&netops.SliceQosProfile{SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1, DscpClass: "EF"},
+			"rpc error: code = Internal desc = Failed to enforce QoS policy: tc filter add dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110006 flower ip_proto udp src_port 30005 classid 17:12 action pedit ex munge ip6 traffic_class set 0xb8 retain 0xfc pipe failed: input/output error, rolled back 1 tc changes",
+		},
+		{
+			"Testing the first slice failing on its leaf class",
+			false,
+			"class add dev eth0 parent 17:11",
+			nil,
+			&netops.SliceQosProfile{SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1},
+			"rpc error: code = Internal desc = Failed to enforce QoS policy: tc class add dev eth0 parent 17:11 classid 17:12 htb rate 1000kbit ceil 5000kbit burst 32768 prio 1 failed: input/output error, rolled back 2 tc changes",
+		},
+	}
+	ctx := context.Background()
+	for _, tt := range testCases {
+		backend := &recordingTcBackend{TcBackend: newFakeTcBackend()}
+		s, client := newTestNetOps(t, backend)
+		if tt.Slices {
+			configureSlicesForAdoption(t, s)
+		}
+		if tt.Context != nil {
+			_, err := client.UpdateConnectionContext(ctx, tt.Context)
+			if err != nil {
+				t.Fatal(tt.Case, err)
+			}
+		}
+		before, err := backend.Dump("eth0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		state := s.state.snapshot()
+
+		backend.fail = tt.Fail
+		_, err = client.UpdateSliceQosProfile(ctx, tt.Profile)
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		expectTcTree(t, backend, "eth0", tcTreeLines(before))
+		// The error of the update is kept for the status of the slice.
+		if sliceInfo := s.state.slices[tt.Profile.SliceId]; sliceInfo != nil {
+			if sliceInfo.tcErr == nil {
+				t.Error(tt.Case, "- Expected the error of the update to be kept")
+			}
+			sliceInfo.tcErr = nil
+		}
+		if !reflect.DeepEqual(s.state.snapshot(), state) {
+			t.Error(tt.Case, "- Expected the slice state to be left as before")
+		}
+
+		// The update lands once the tc change goes through.
+		backend.fail = ""
+		_, err = client.UpdateSliceQosProfile(ctx, tt.Profile)
+		expectErrStr(t, tt.Case, err, "")
+	}
+}
+
+func TestDeleteSliceGwRollback(t *testing.T) {
+	ctx := context.Background()
+	backend := &recordingTcBackend{TcBackend: newFakeTcBackend()}
+	s, client := newTestNetOps(t, backend)
+	configureSlicesForAdoption(t, s)
+	before, err := backend.Dump("eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handles := map[int][]uint32{}
+	for family, familyHandles := range s.state.slices["id-a"].sliceGwInfo["gw-a"].tcFilterHandles {
+		handles[family] = append([]uint32{}, familyHandles...)
+	}
+
+	// The IPv4 filters are deleted before the IPv6 ones fail.
+	backend.fail = "filter del dev eth0 protocol ipv6"
+	conContext := &netops.NetOpConnectionContext{SliceId: "id-a", LocalSliceGwId: "gw-a"}
+	_, err = client.DeleteConnectionContext(ctx, conContext)
+	expectErrStr(t, "Testing the deletion of the slice gw failing", err,
+		"rpc error: code = Internal desc = Failed to delete filters of the slice gw ports: tc filter del dev eth0 protocol ipv6 parent 17: prio 11 handle 0x110003 flower failed: input/output error, rolled back 2 tc changes")
+	expectTcTree(t, backend, "eth0", tcTreeLines(before))
+	gwInfo := s.state.slices["id-a"].sliceGwInfo["gw-a"]
+	if gwInfo == nil {
+		t.Fatal("Expected the slice gw to be kept")
+	}
+	if !reflect.DeepEqual(gwInfo.tcFilterHandles, handles) {
+		t.Error("Expected the filter handles:", handles, " but got ", gwInfo.tcFilterHandles)
+	}
+	if len(gwInfo.tcConfigured) != len(tcFilterFamilies) {
+		t.Error("Expected the filters of both families to be configured but got ", gwInfo.tcConfigured)
+	}
+
+	// The deletion lands once the tc change goes through.
+	backend.fail = ""
+	_, err = client.DeleteConnectionContext(ctx, conContext)
+	expectErrStr(t, "Testing the slice gw is deleted", err, "")
+	if s.state.slices["id-a"].sliceGwInfo["gw-a"] != nil {
+		t.Error("Expected the slice gw to be deleted")
+	}
+}
+
+func TestUpdateSliceGwRollback(t *testing.T) {
+	ctx := context.Background()
+	backend := &recordingTcBackend{TcBackend: newFakeTcBackend()}
+	s, client := newTestNetOps(t, backend)
+	configureSlicesForAdoption(t, s)
+	before, err := backend.Dump("eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := s.state.snapshot().slices["id-a"].sliceGwInfo["gw-a"]
+
+	// The filters of the old ports are deleted before the ones of the new
+	// ports fail.
+	backend.fail = "filter add dev eth0 protocol ipv6"
+	conContext := &netops.NetOpConnectionContext{
+		SliceId:                "id-a",
+		LocalSliceGwId:         "gw-a",
+		LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_SERVER,
+		LocalSliceGwNodePorts:  []string{"30001", "30005"},
+		RemoteSliceGwNodePorts: []string{"30002", "30006"},
+	}
+	_, err = client.UpdateConnectionContext(ctx, conContext)
+	if err == nil {
+		t.Error("Expected the update of the slice gw to fail")
+	}
+	expectTcTree(t, backend, "eth0", tcTreeLines(before))
+	if gwInfo := s.state.slices["id-a"].sliceGwInfo["gw-a"]; !reflect.DeepEqual(gwInfo, old) {
+		t.Error("Expected the slice gw:", *old, " but got ", *gwInfo)
+	}
+
+	// The update lands once the tc change goes through.
+	backend.fail = ""
+	_, err = client.UpdateConnectionContext(ctx, conContext)
+	expectErrStr(t, "Testing the slice gw is updated", err, "")
+	if !reflect.DeepEqual(s.state.slices["id-a"].sliceGwInfo["gw-a"].localPorts, conContext.LocalSliceGwNodePorts) {
+		t.Error("Expected the ports:", conContext.LocalSliceGwNodePorts, " but got ", s.state.slices["id-a"].sliceGwInfo["gw-a"].localPorts)
+	}
+}
+
+// TestTcTxnPanic panics in the middle of a transaction and expects the tc
+// changes to go to the backend of NetOps again afterwards.
+func TestTcTxnPanic(t *testing.T) {
+	logger.GlobalLogger = logger.NewLogger("ERROR")
+	backend := newFakeTcBackend()
+	s := NewNetOps(backend)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected the change to panic")
+			}
+		}()
+		_ = s.inTcTxn(func() error {
+			panic("change failed")
+		})
+	}()
+	if s.tcBackend() != TcBackend(backend) {
+		t.Error("Expected the backend of NetOps but got ", s.tcBackend())
+	}
+	if s.tc != TcBackend(backend) {
+		t.Error("Expected the backend of NetOps unchanged but got ", s.tc)
+	}
+}
@@ -0,0 +1,156 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	netops "github.com/kubeslice/netops/pkg/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Range of the bandwidths of a slice in kbps
+const (
+	minSliceBandwidth uint32 = 100
+	maxSliceBandwidth uint32 = 100000
+)
+
+// fieldViolations collects the invalid fields of a request.
+type fieldViolations []*errdetails.BadRequest_FieldViolation
+
+func (v *fieldViolations) add(field string, format string, args ...interface{}) {
+	*v = append(*v, &errdetails.BadRequest_FieldViolation{Field: field, Description: fmt.Sprintf(format, args...)})
+}
+
+// err returns an InvalidArgument error carrying the violations as
+// google.rpc.BadRequest details, nil when there are none. The message lists
+// the violations after msg.
+func (v fieldViolations) err(msg string) error {
+	if len(v) == 0 {
+		return nil
+	}
+	descs := []string{}
+	for _, violation := range v {
+		descs = append(descs, violation.Description)
+	}
+	st := status.Newf(codes.InvalidArgument, "%v: %v", msg, strings.Join(descs, "; "))
+	detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: v})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// validateSliceQosProfile returns the invalid fields of a QoS profile. The
+// field names are prefixed with the path of the profile in the request.
+func validateSliceQosProfile(path string, p *netops.SliceQosProfile) fieldViolations {
+	v := fieldViolations{}
+	if p.GetSliceId() == "" {
+		v.add(path+"sliceId", "sliceId is required")
+	}
+	if _, found := netops.ClassType_name[int32(p.GetClassType())]; !found {
+		v.add(path+"ClassType", "unknown class type %d", p.GetClassType())
+	}
+	bwCeiling := p.GetBwCeiling()
+	if bwCeiling == 0 {
+		v.add(path+"bwCeiling", "bwCeiling is required")
+	} else if bwCeiling < minSliceBandwidth || bwCeiling > maxSliceBandwidth {
+		v.add(path+"bwCeiling", "bwCeiling %d is out of range %d-%d kbps", bwCeiling, minSliceBandwidth, maxSliceBandwidth)
+	}
+	// The slice is not guaranteed any bandwidth in TBF mode.
+	bwGuaranteed := p.GetBwGuaranteed()
+	if p.GetClassType() == netops.ClassType_HTB && (bwGuaranteed < minSliceBandwidth || bwGuaranteed > maxSliceBandwidth) {
+		v.add(path+"bwGuaranteed", "bwGuaranteed %d is out of range %d-%d kbps", bwGuaranteed, minSliceBandwidth, maxSliceBandwidth)
+	} else if bwCeiling != 0 && bwGuaranteed > bwCeiling {
+		v.add(path+"bwGuaranteed", "bwGuaranteed %d is above bwCeiling %d", bwGuaranteed, bwCeiling)
+	}
+	if err := checkSlicePriority(p.GetPriority()); err != nil {
+		v.add(path+"priority", err.Error())
+	}
+	if _, _, err := parseDscpClass(p.GetDscpClass()); err != nil {
+		v.add(path+"dscpClass", err.Error())
+	}
+	return v
+}
+
+// validateConnectionContext returns the invalid fields of a connection
+// context. The field names are prefixed with the path of the context in the
+// request.
+func validateConnectionContext(path string, c *netops.NetOpConnectionContext) fieldViolations {
+	v := fieldViolations{}
+	if c.GetLocalSliceGwId() == "" {
+		v.add(path+"localSliceGwId", "localSliceGwId is required")
+	}
+	if _, found := netops.SliceGwHostType_name[int32(c.GetLocalSliceGwHostType())]; !found {
+		v.add(path+"localSliceGwHostType", "unknown slice gw host type %d", c.GetLocalSliceGwHostType())
+	}
+	if _, found := netops.SliceGwHostType_name[int32(c.GetRemoteSliceGwHostType())]; !found {
+		v.add(path+"remoteSliceGwHostType", "unknown slice gw host type %d", c.GetRemoteSliceGwHostType())
+	}
+	if _, found := netops.SliceGwProtocol_name[int32(c.GetSliceGwProtocol())]; !found {
+		v.add(path+"sliceGwProtocol", "unknown slice gw protocol %d", c.GetSliceGwProtocol())
+	}
+
+	// The filters of the slice gw pair the local and remote ports by index.
+	localPorts, remotePorts := c.GetLocalSliceGwNodePorts(), c.GetRemoteSliceGwNodePorts()
+	if len(localPorts) == 0 {
+		v.add(path+"localSliceGwNodePorts", "localSliceGwNodePorts is required")
+	} else if len(localPorts) != len(remotePorts) {
+		v.add(path+"remoteSliceGwNodePorts", "%d remote ports for %d local ports", len(remotePorts), len(localPorts))
+	}
+	checkPorts := func(field string, ports []string) {
+		for i, port := range ports {
+			if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+				v.add(fmt.Sprintf("%v%v[%d]", path, field, i), "invalid port %q", port)
+			}
+		}
+	}
+	checkPorts("localSliceGwNodePorts", localPorts)
+	checkPorts("remoteSliceGwNodePorts", remotePorts)
+
+	for _, ip := range []struct {
+		field string
+		value string
+	}{
+		{"localSliceGwVpnIP", c.GetLocalSliceGwVpnIP()},
+		{"localSliceGwNodeIP", c.GetLocalSliceGwNodeIP()},
+		{"remoteSliceGwVpnIP", c.GetRemoteSliceGwVpnIP()},
+		{"remoteSliceGwNodeIP", c.GetRemoteSliceGwNodeIP()},
+	} {
+		if ip.value != "" && net.ParseIP(ip.value) == nil {
+			v.add(path+ip.field, "invalid %v %q", ip.field, ip.value)
+		}
+	}
+	for _, subnet := range []struct {
+		field string
+		value string
+	}{
+		{"localSliceGwNsmSubnet", c.GetLocalSliceGwNsmSubnet()},
+		{"remoteSliceGwNsmSubnet", c.GetRemoteSliceGwNsmSubnet()},
+	} {
+		if _, _, err := net.ParseCIDR(subnet.value); subnet.value != "" && err != nil {
+			v.add(path+subnet.field, "invalid %v %q", subnet.field, subnet.value)
+		}
+	}
+	return v
+}
@@ -0,0 +1,213 @@
+/*  Copyright (c) 2022 Avesha, Inc. All rights reserved.
+ *
+ *  SPDX-License-Identifier: Apache-2.0
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	netops "github.com/kubeslice/netops/pkg/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// violatedFields returns the fields of the violations.
+func violatedFields(v fieldViolations) []string {
+	fields := []string{}
+	for _, violation := range v {
+		fields = append(fields, violation.Field)
+	}
+	return fields
+}
+
+func TestValidateSliceQosProfile(t *testing.T) {
+	valid := func(change func(p *netops.SliceQosProfile)) *netops.SliceQosProfile {
+		p := &netops.SliceQosProfile{SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000, Priority: 1, DscpClass: "EF"}
+		if change != nil {
+			change(p)
+		}
+		return p
+	}
+	testCases := []struct {
+		Case    string
+		Profile *netops.SliceQosProfile
+		Fields  []string
+	}{
+		{"Testing a valid profile", valid(nil), []string{}},
+		{"Testing the bandwidth bounds", valid(func(p *netops.SliceQosProfile) { p.BwCeiling, p.BwGuaranteed = 100000, 100 }), []string{}},
+		{"Testing a TBF profile without a guaranteed bandwidth", valid(func(p *netops.SliceQosProfile) { p.ClassType, p.BwGuaranteed = netops.ClassType_TBF, 0 }), []string{}},
+		{"Testing a missing slice ID", valid(func(p *netops.SliceQosProfile) { p.SliceId = "" }), []string{"sliceId"}},
+		{"Testing an unknown class type", valid(func(p *netops.SliceQosProfile) { p.ClassType = 2 }), []string{"ClassType"}},
+		{"Testing a zero ceiling", valid(func(p *netops.SliceQosProfile) { p.BwCeiling = 0 }), []string{"bwCeiling"}},
+		{"Testing a ceiling out of range", valid(func(p *netops.SliceQosProfile) { p.BwCeiling = 100001 }), []string{"bwCeiling"}},
+		{"Testing a guaranteed bandwidth out of range", valid(func(p *netops.SliceQosProfile) { p.BwGuaranteed = 99 }), []string{"bwGuaranteed"}},
+		{"Testing a guaranteed bandwidth above the ceiling", valid(func(p *netops.SliceQosProfile) { p.BwGuaranteed = 6000 }), []string{"bwGuaranteed"}},
+		{"Testing a TBF guaranteed bandwidth above the ceiling", valid(func(p *netops.SliceQosProfile) { p.ClassType, p.BwGuaranteed = netops.ClassType_TBF, 6000 }), []string{"bwGuaranteed"}},
+		{"Testing a priority out of range", valid(func(p *netops.SliceQosProfile) { p.Priority = 4 }), []string{"priority"}},
+		{"Testing an unknown DSCP class", valid(func(p *netops.SliceQosProfile) { p.DscpClass = "AF44" }), []string{"dscpClass"}},
+		{
+			"Testing all the fields are reported",
+			&netops.SliceQosProfile{Priority: 9, DscpClass: "XX"},
+			[]string{"sliceId", "bwCeiling", "bwGuaranteed", "priority", "dscpClass"},
+		},
+	}
+	for _, tt := range testCases {
+		fields := violatedFields(validateSliceQosProfile("", tt.Profile))
+		if !reflect.DeepEqual(fields, tt.Fields) {
+			t.Error(tt.Case, "- Expected :", tt.Fields, " but got ", fields)
+		}
+	}
+}
+
+func TestValidateConnectionContext(t *testing.T) {
+	valid := func(change func(c *netops.NetOpConnectionContext)) *netops.NetOpConnectionContext {
+		c := &netops.NetOpConnectionContext{
+			SliceId:                "id-a",
+			LocalSliceGwId:         "gw-a",
+			LocalSliceGwVpnIP:      "10.1.1.1",
+			LocalSliceGwHostType:   netops.SliceGwHostType_SLICE_GW_CLIENT,
+			LocalSliceGwNsmSubnet:  "192.168.1.0/24",
+			LocalSliceGwNodeIP:     "10.0.0.1",
+			LocalSliceGwNodePorts:  []string{"30001", "30003"},
+			RemoteSliceGwVpnIP:     "10.1.1.2",
+			RemoteSliceGwNsmSubnet: "fd00::/64",
+			RemoteSliceGwNodeIP:    "fd01::2",
+			RemoteSliceGwNodePorts: []string{"30002", "30004"},
+		}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+	testCases := []struct {
+		Case    string
+		Context *netops.NetOpConnectionContext
+		Fields  []string
+	}{
+		{"Testing a valid context", valid(nil), []string{}},
+		{"Testing a context without addresses", valid(func(c *netops.NetOpConnectionContext) {
+			c.LocalSliceGwVpnIP, c.LocalSliceGwNodeIP, c.RemoteSliceGwVpnIP, c.RemoteSliceGwNodeIP = "", "", "", ""
+			c.LocalSliceGwNsmSubnet, c.RemoteSliceGwNsmSubnet = "", ""
+		}), []string{}},
+		{"Testing a missing slice gw ID", valid(func(c *netops.NetOpConnectionContext) { c.LocalSliceGwId = "" }), []string{"localSliceGwId"}},
+		{"Testing unknown enum values", valid(func(c *netops.NetOpConnectionContext) {
+			c.LocalSliceGwHostType, c.RemoteSliceGwHostType, c.SliceGwProtocol = 2, 3, 4
+		}), []string{"localSliceGwHostType", "remoteSliceGwHostType", "sliceGwProtocol"}},
+		{"Testing missing ports", valid(func(c *netops.NetOpConnectionContext) {
+			c.LocalSliceGwNodePorts, c.RemoteSliceGwNodePorts = nil, nil
+		}), []string{"localSliceGwNodePorts"}},
+		{"Testing port lists of different lengths", valid(func(c *netops.NetOpConnectionContext) {
+			c.RemoteSliceGwNodePorts = []string{"30002"}
+		}), []string{"remoteSliceGwNodePorts"}},
+		{"Testing invalid ports", valid(func(c *netops.NetOpConnectionContext) {
+			c.LocalSliceGwNodePorts = []string{"30001", "port"}
+			c.RemoteSliceGwNodePorts = []string{"0", "65536"}
+		}), []string{"localSliceGwNodePorts[1]", "remoteSliceGwNodePorts[0]", "remoteSliceGwNodePorts[1]"}},
+		{"Testing invalid IPs", valid(func(c *netops.NetOpConnectionContext) {
+			c.LocalSliceGwVpnIP, c.RemoteSliceGwNodeIP = "10.1.1", "10.0.0.2/32"
+		}), []string{"localSliceGwVpnIP", "remoteSliceGwNodeIP"}},
+		{"Testing invalid subnets", valid(func(c *netops.NetOpConnectionContext) {
+			c.LocalSliceGwNsmSubnet, c.RemoteSliceGwNsmSubnet = "192.168.1.0", "fd00::/129"
+		}), []string{"localSliceGwNsmSubnet", "remoteSliceGwNsmSubnet"}},
+	}
+	for _, tt := range testCases {
+		fields := violatedFields(validateConnectionContext("", tt.Context))
+		if !reflect.DeepEqual(fields, tt.Fields) {
+			t.Error(tt.Case, "- Expected :", tt.Fields, " but got ", fields)
+		}
+	}
+}
+
+func TestFieldViolationDetails(t *testing.T) {
+	testCases := []struct {
+		Case   string
+		Call   func(ctx context.Context, client netops.NetOpsServiceClient) error
+		ErrStr string
+		// Expected fields of the BadRequest details
+		Fields []string
+	}{
+		{
+			"Testing an invalid QoS profile",
+			func(ctx context.Context, client netops.NetOpsServiceClient) error {
+				_, err := client.UpdateSliceQosProfile(ctx, &netops.SliceQosProfile{
+					SliceName: "slice-a", SliceId: "id-a", BwCeiling: 1000, BwGuaranteed: 5000, Priority: 1, DscpClass: "AF5",
+				})
+				return err
+			},
+			`rpc error: code = InvalidArgument desc = Invalid qos profile: bwGuaranteed 5000 is above bwCeiling 1000; invalid DSCP class "AF5"`,
+			[]string{"bwGuaranteed", "dscpClass"},
+		},
+		{
+			"Testing an invalid connection context",
+			func(ctx context.Context, client netops.NetOpsServiceClient) error {
+				_, err := client.UpdateConnectionContext(ctx, &netops.NetOpConnectionContext{
+					SliceId:                "id-a",
+					LocalSliceGwId:         "gw-a",
+					LocalSliceGwNodePorts:  []string{"30001", "30003"},
+					RemoteSliceGwNodePorts: []string{"30002"},
+					RemoteSliceGwNodeIP:    "10.0.0",
+				})
+				return err
+			},
+			`rpc error: code = InvalidArgument desc = Invalid connection context: 1 remote ports for 2 local ports; invalid remoteSliceGwNodeIP "10.0.0"`,
+			[]string{"remoteSliceGwNodePorts", "remoteSliceGwNodeIP"},
+		},
+		{
+			"Testing an invalid desired state",
+			func(ctx context.Context, client netops.NetOpsServiceClient) error {
+				_, err := client.SyncState(ctx, &netops.SyncStateRequest{Slices: []*netops.DesiredSlice{{
+					QosProfile: &netops.SliceQosProfile{SliceName: "slice-a", SliceId: "id-a", BwCeiling: 5000, BwGuaranteed: 1000},
+					ConnectionContexts: []*netops.NetOpConnectionContext{
+						{LocalSliceGwId: "gw-a", LocalSliceGwNodePorts: []string{"30001"}, RemoteSliceGwNodePorts: []string{"x"}},
+					},
+				}}})
+				return err
+			},
+			`rpc error: code = InvalidArgument desc = Invalid desired state: invalid port "x"`,
+			[]string{"slices[0].connectionContexts[0].remoteSliceGwNodePorts[0]"},
+		},
+	}
+	ctx := context.Background()
+	s, client := newTestNetOps(t, newFakeTcBackend())
+	for _, tt := range testCases {
+		err := tt.Call(ctx, client)
+		expectErrStr(t, tt.Case, err, tt.ErrStr)
+		st, _ := status.FromError(err)
+		if st.Code() != codes.InvalidArgument || len(st.Details()) != 1 {
+			t.Error(tt.Case, "- Expected the BadRequest details but got ", st.Details())
+			continue
+		}
+		badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+		if !ok {
+			t.Error(tt.Case, "- Expected the BadRequest details but got ", st.Details()[0])
+			continue
+		}
+		fields := []string{}
+		for _, violation := range badRequest.FieldViolations {
+			fields = append(fields, violation.Field)
+		}
+		if !reflect.DeepEqual(fields, tt.Fields) {
+			t.Error(tt.Case, "- Expected :", tt.Fields, " but got ", fields)
+		}
+	}
+	if len(s.state.slices) != 0 || len(s.state.pendingGws) != 0 {
+		t.Error("Expected the invalid requests to change nothing but got ", s.state.slices, s.state.pendingGws)
+	}
+}